@@ -101,8 +101,8 @@ export default function HomePage() {
 
       const data = await response.json()
       console.log('Search API response:', data)
-      setRepositories(data.repositories || [])
-      console.log('Set repositories:', data.repositories || [])
+      setRepositories(data.items || [])
+      console.log('Set repositories:', data.items || [])
     } catch (error) {
       console.error("Error searching repositories:", error)
       setRepositories([])
@@ -135,7 +135,7 @@ export default function HomePage() {
       }
 
       const data = await response.json()
-      setRepositories(data.repositories || [])
+      setRepositories(data.items || [])
     } catch (error) {
       console.error("Error fetching initial repositories:", error)
       setRepositories([])
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/ahmednasr/ai-in-action/server/internal/config"
@@ -16,19 +17,30 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // main is the single entry‑point for the REST API.
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
 	log.Printf("Configuration loaded:")
 	log.Printf("  - Database: %s", cfg.DBName)
 	log.Printf("  - MongoDB URI: %s", cfg.MongoURI)
 	log.Printf("  - Federated MongoDB URI: %s", cfg.FederatedMongoURI)
 
+	mongoOpts := database.Options{
+		MaxPoolSize:    uint64(cfg.MongoMaxPoolSize),
+		MinPoolSize:    uint64(cfg.MongoMinPoolSize),
+		ReadPreference: cfg.MongoReadPreference,
+		WriteConcern:   cfg.MongoWriteConcern,
+	}
+
 	// Connect to main MongoDB (for embeddings)
-	mainClient, mainCtx, mainCancel, err := database.NewMongo(cfg.MongoURI)
+	mainClient, mainCtx, mainCancel, err := database.NewMongo(cfg.MongoURI, mongoOpts)
 	if err != nil {
 		log.Fatalf("Failed to connect to main MongoDB: %v", err)
 	}
@@ -37,7 +49,7 @@ func main() {
 	log.Printf("Connected to main MongoDB")
 
 	// Connect to federated MongoDB (for code access)
-	federatedClient, fedCtx, fedCancel, err := database.NewMongo(cfg.FederatedMongoURI)
+	federatedClient, fedCtx, fedCancel, err := database.NewMongo(cfg.FederatedMongoURI, mongoOpts)
 	if err != nil {
 		log.Fatalf("Failed to connect to federated MongoDB: %v", err)
 	}
@@ -57,75 +69,223 @@ func main() {
 	mainDB := mainClient.Database(cfg.DBName)
 	log.Printf("Using main database: %s", cfg.DBName)
 
-	federatedDB := federatedClient.Database("reposdb") // Use the correct federated database name
-	log.Printf("Using federated database: reposdb")
+	federatedDB := federatedClient.Database(cfg.FederatedDBName)
+	log.Printf("Using federated database: %s", cfg.FederatedDBName)
+
+	collections := repository.CollectionNames{
+		Meta:          cfg.MetaCollection,
+		Code:          cfg.CodeCollection,
+		FederatedMeta: cfg.FederatedMetaCollection,
+		Guides:        cfg.GuidesCollection,
+		Summaries:     cfg.SummariesCollection,
+		Feedback:      cfg.FeedbackCollection,
+		Idempotency:   cfg.IdempotencyCollection,
+	}
 
-	repoRepo, err := repository.NewRepoRepository(mainDB, federatedDB, storageClient)
+	repoRepo, err := repository.NewRepoRepository(mainDB, federatedDB, storageClient, collections)
 	if err != nil {
 		log.Fatalf("Failed to initialize repository repository: %v", err)
 	}
+	repoRepo.SetLookupTimeout(cfg.RepoLookupTimeout)
+	repoRepo.SetAggregateAttempts(cfg.MongoAggregateAttempts)
+	repoRepo.SetMaxEnrichedResults(cfg.MaxEnrichedResults)
 
-	guideRepo := repository.NewGuideRepository(mainDB)
+	// Let search queries read from replicas, over their own connection when
+	// a read-only URI is configured
+	if cfg.MongoSearchURI != "" {
+		searchOpts := mongoOpts
+		if cfg.MongoSearchReadPreference != "" {
+			searchOpts.ReadPreference = cfg.MongoSearchReadPreference
+		}
+		searchClient, searchCtx, searchCancel, err := database.NewMongo(cfg.MongoSearchURI, searchOpts)
+		if err != nil {
+			log.Fatalf("Failed to connect to search MongoDB: %v", err)
+		}
+		defer searchCancel()
+		defer searchClient.Disconnect(searchCtx)
+		repoRepo.SetSearchDatabase(searchClient.Database(cfg.DBName))
+		log.Printf("Connected to search MongoDB")
+	} else if cfg.MongoSearchReadPreference != "" {
+		rp, err := database.ParseReadPreference(cfg.MongoSearchReadPreference)
+		if err != nil {
+			log.Fatalf("Invalid search read preference: %v", err)
+		}
+		repoRepo.SetSearchDatabase(mainClient.Database(cfg.DBName, options.Database().SetReadPreference(rp)))
+		log.Printf("Search queries use read preference %s", cfg.MongoSearchReadPreference)
+	}
+
+	// Fail fast when the bucket holding the repository files is unusable
+	bucketCtx, bucketCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err = repoRepo.CheckBucket(bucketCtx)
+	bucketCancel()
+	if err != nil {
+		if !cfg.AllowMissingBucket {
+			log.Fatalf("GCS bucket check failed: %v (set GCS_ALLOW_MISSING_BUCKET=true to start without file access)", err)
+		}
+		log.Printf("WARNING: GCS bucket check failed: %v; starting degraded, file requests will fail", err)
+	}
+
+	guideRepo := repository.NewGuideRepository(mainDB, collections)
+	feedbackRepo := repository.NewFeedbackRepository(mainDB, collections)
+	idempotencyRepo := repository.NewIdempotencyRepository(mainDB, collections, cfg.IdempotencyTTL)
+	if err := idempotencyRepo.EnsureIndexes(mainCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	}
 
 	// List collections to verify access
-	collections, err := mainDB.ListCollectionNames(mainCtx, bson.M{})
+	available, err := mainDB.ListCollectionNames(mainCtx, bson.M{})
 	if err != nil {
 		log.Printf("Warning: Failed to list collections: %v", err)
 	} else {
-		log.Printf("Available collections: %v", collections)
+		log.Printf("Available collections: %v", available)
+	}
+
+	// Initialize embedders
+	embedderCfg := service.EmbedderConfig{
+		Provider:     cfg.EmbedderProvider,
+		PythonBin:    cfg.PythonBin,
+		MinLength:    cfg.EmbedMinTextLength,
+		PoolSize:     cfg.EmbedWorkerPoolSize,
+		LocalTimeout: cfg.LocalEmbedTimeout,
+		ProjectID:    cfg.ProjectID,
+		Location:     cfg.Location,
+		Timeout:      cfg.VertexEmbedTimeout,
+		MaxAttempts:  cfg.VertexEmbedMaxAttempts,
 	}
 
-	// Initialize local embedders
-	metadataEmbedder, err := service.NewLocalEmbedder("metadata")
+	metadataCfg := embedderCfg
+	metadataCfg.ModelType = "metadata"
+	metadataCfg.ModelName = cfg.MetadataEmbeddingModel
+	metadataCfg.Dimension = cfg.MetadataEmbeddingDim
+	baseMetadataEmbedder, err := service.NewEmbedder(metadataCfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize metadata embedder: %v", err)
 	}
-	defer metadataEmbedder.Close()
+	baseMetadataEmbedder = withFallbackEmbedder(baseMetadataEmbedder, metadataCfg, cfg.EmbedderFallbackProvider, cfg.EmbedderFallbackMetadataDim)
+	defer baseMetadataEmbedder.Close()
 
-	codeEmbedder, err := service.NewLocalEmbedder("code")
+	codeCfg := embedderCfg
+	codeCfg.ModelType = "code"
+	codeCfg.ModelName = cfg.CodeEmbeddingModel
+	codeCfg.Dimension = cfg.CodeEmbeddingDim
+	baseCodeEmbedder, err := service.NewEmbedder(codeCfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize code embedder: %v", err)
 	}
-	defer codeEmbedder.Close()
+	baseCodeEmbedder = withFallbackEmbedder(baseCodeEmbedder, codeCfg, cfg.EmbedderFallbackProvider, cfg.EmbedderFallbackCodeDim)
+	defer baseCodeEmbedder.Close()
+	log.Printf("Using %s embedders", cfg.EmbedderProvider)
+
+	// Bound concurrent embeddings across both embedders
+	embedLimiter := service.NewEmbedLimiter(cfg.MaxConcurrentEmbeddings, cfg.EmbedQueueTimeout)
+	metadataEmbedder := embedLimiter.Wrap(baseMetadataEmbedder)
+	codeEmbedder := embedLimiter.Wrap(baseCodeEmbedder)
 
 	// Initialize GitHub client
-	ghClient := github.NewClient(cfg.GitHubToken)
+	ghClient := github.NewClientWithBaseURL(cfg.GitHubToken, cfg.GitHubAPIURL)
+	ghClient.SetUserAgent(cfg.GitHubUserAgent)
+	ghClient.SetAPIVersion(cfg.GitHubAPIVersion)
+	ghClient.SetIssueCacheTTL(cfg.GitHubIssueCacheTTL)
+	ghClient.SetTransport(github.TransportConfig{
+		MaxIdleConns:        cfg.GitHubMaxIdleConns,
+		MaxIdleConnsPerHost: cfg.GitHubMaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.GitHubIdleConnTimeout,
+	})
 	log.Printf("Initialized GitHub client")
 
+	scoreNormalization, err := service.ParseScoreNormalization(cfg.ScoreNormalization)
+	if err != nil {
+		log.Fatalf("Invalid SCORE_NORMALIZATION: %v", err)
+	}
+
+	reposSort := service.DefaultRepoSort
+	if cfg.ReposSort != "" {
+		reposSort, err = service.ParseRepoSort(cfg.ReposSort, cfg.ReposSortOrder)
+		if err != nil {
+			log.Fatalf("Invalid REPOS_SORT: %v", err)
+		}
+	}
+
 	// Initialize services
-	searchSvc := service.NewSearchService(repoRepo, metadataEmbedder)
-	repoSvc := service.NewRepoService(repoRepo, ghClient)
-	codeSvc := service.NewCodeService(repoRepo)
+	searchSvc := service.NewSearchService(repoRepo, metadataEmbedder, scoreNormalization, reposSort)
+	repoSvc := service.NewRepoService(repoRepo, guideRepo, ghClient)
+	codeSvc := service.NewCodeService(repoRepo, ghClient, service.AllowAll{})
 
-	// Initialize Vertex AI LLM
-	llm, err := service.NewVertexLLM()
-	if err != nil {
-		log.Fatalf("Failed to initialize Vertex AI LLM: %v", err)
+	// Initialize the LLM backend
+	var llm service.LLMClient
+	switch cfg.LLMProvider {
+	case "vertex":
+		vertexLLM, err := service.NewVertexLLM()
+		if err != nil {
+			log.Fatalf("Failed to initialize Vertex AI LLM: %v", err)
+		}
+		defer vertexLLM.Close()
+		vertexLLM.SetPromptWarnTokens(cfg.PromptWarnTokens)
+		llm = vertexLLM
+	case "openai":
+		openAILLM := service.NewOpenAILLM(cfg.OpenAIChatURL, cfg.OpenAIModel, cfg.OpenAIAPIKey)
+		openAILLM.SetPromptWarnTokens(cfg.PromptWarnTokens)
+		llm = openAILLM
+		log.Printf("Using OpenAI-compatible LLM %s at %s", cfg.OpenAIModel, cfg.OpenAIChatURL)
+	default:
+		log.Fatalf("Unknown LLM_PROVIDER %q (expected \"vertex\" or \"openai\")", cfg.LLMProvider)
 	}
-	defer llm.Close()
 
-	guideSvc := service.NewGuideService(guideRepo, ghClient, repoRepo, metadataEmbedder, llm)
-	chatSvc := service.NewChatService(guideSvc)
+	// Bound concurrent generations across RAG, guides and chat
+	if cfg.MaxConcurrentLLM > 0 {
+		llm = service.NewLLMLimiter(cfg.MaxConcurrentLLM, cfg.LLMQueueTimeout).Wrap(llm)
+	}
+
+	chunkBoosts, err := service.ParseChunkTypeBoosts(cfg.ChunkTypeBoosts)
+	if err != nil {
+		log.Fatalf("Invalid CHUNK_TYPE_BOOSTS: %v", err)
+	}
+	prompts, err := service.NewPromptStore(service.PromptFiles{
+		Guide:      cfg.GuidePromptFile,
+		IssueGuide: cfg.IssueGuidePromptFile,
+		RAG:        cfg.RAGPromptFile,
+		Chat:       cfg.ChatPromptFile,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load prompts: %v", err)
+	}
+	if cfg.PromptReloadInterval > 0 {
+		go prompts.Watch(context.Background(), cfg.PromptReloadInterval)
+	}
+	guideSvc := service.NewGuideService(guideRepo, ghClient, repoRepo, metadataEmbedder, llm, cfg.GuideContextBudget, chunkBoosts, cfg.MinReadmeChunks, prompts, cfg.EmptyIssueBodyNote)
+	chatSvc := service.NewChatService(guideSvc, prompts)
+	feedbackSvc := service.NewFeedbackService(feedbackRepo)
 
 	// Use code embedder for RAG service
-	ragService := service.NewRAGService(mainDB.Collection("repos_code"), mainDB.Collection("repos_meta"), codeEmbedder, llm, guideSvc)
+	ragService := service.NewRAGService(mainDB.Collection(cfg.CodeCollection), mainDB.Collection(cfg.MetaCollection), codeEmbedder, llm, guideSvc, cfg.MinSourceRelevance, cfg.EmptyIssueBodyNote)
+	ragService.SetPromptStore(prompts)
+	ragService.SetFullFileSource(codeSvc, cfg.FullFileMaxBytes)
+	ragService.SetSourceDedupThreshold(cfg.SourceDedupThreshold)
 
-	// Initialize handlers
-	healthHandler := handler.NewHealthHandler(mainClient, federatedClient)
-	ragHandler := handler.NewRAGHandler(ragService)
-	codeSearchHandler := handler.NewCodeSearchHandler(repoRepo, codeEmbedder, codeSvc)
+	// Re-embedding of stored vectors when an embedding model changes
+	statsSvc := service.NewStatsService(repository.NewStatsRepository(mainDB, federatedDB, collections), cfg.AdminStatsTTL)
+	indexingSvc := service.NewIndexingService(
+		mainDB.Collection(cfg.CodeCollection), codeEmbedder, service.EmbedderModelName(codeCfg),
+		mainDB.Collection(cfg.MetaCollection), federatedDB.Collection(cfg.FederatedMetaCollection), metadataEmbedder, service.EmbedderModelName(metadataCfg),
+		mainDB.Collection(cfg.MigrationsCollection),
+	)
+
+	// Warm up the embedders and LLM in the background; /ready reports 503 until done
+	readiness := &service.Readiness{}
+	go service.WarmUp(context.Background(), readiness, llm, metadataEmbedder, codeEmbedder)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
+		ErrorHandler: handler.ErrorHandler,
 	})
 
 	// Add middleware
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "https://frontend-222198140851.us-central1.run.app,http://localhost:3000",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-GitHub-Token",
 		AllowCredentials: true,
 		MaxAge:           300, // Cache preflight requests for 5 minutes
 	}))
@@ -137,10 +297,29 @@ func main() {
 	})
 
 	// Register routes
-	handler.RegisterRoutes(app, searchSvc, repoSvc, guideSvc, chatSvc, repoRepo, metadataEmbedder, codeEmbedder, codeSvc)
-	healthHandler.Register(app)
-	ragHandler.RegisterRoutes(app)
-	codeSearchHandler.Register(app)
+	api := &handler.App{
+		MainClient:         mainClient,
+		FederatedClient:    federatedClient,
+		Readiness:          readiness,
+		SearchSvc:          searchSvc,
+		RepoSvc:            repoSvc,
+		GuideSvc:           guideSvc,
+		ChatSvc:            chatSvc,
+		CodeSvc:            codeSvc,
+		FeedbackSvc:        feedbackSvc,
+		RAGSvc:             ragService,
+		IndexingSvc:        indexingSvc,
+		StatsSvc:           statsSvc,
+		Prompts:            prompts,
+		IdempotencyStore:   idempotencyRepo,
+		RepoRepository:     repoRepo,
+		CodeEmbedder:       codeEmbedder,
+		MaxQueryLength:     cfg.MaxQueryLength,
+		MaxChunkLength:     cfg.MaxChunkLength,
+		ScoreNormalization: scoreNormalization,
+		AdminToken:         cfg.AdminToken,
+	}
+	api.RegisterRoutes(app)
 
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
@@ -148,3 +327,24 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// withFallbackEmbedder wraps primary with an embedder for fallbackProvider,
+// configured like cfg otherwise, that takes over when primary fails. An empty
+// provider returns primary unchanged.
+func withFallbackEmbedder(primary service.ClosableEmbedder, cfg service.EmbedderConfig, fallbackProvider string, dimension int) service.ClosableEmbedder {
+	if fallbackProvider == "" {
+		return primary
+	}
+	fallbackCfg := cfg
+	fallbackCfg.Provider = fallbackProvider
+	fallback, err := service.NewEmbedder(fallbackCfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s fallback embedder: %v", cfg.ModelType, err)
+	}
+	if dimension > 0 {
+		log.Printf("WARNING: %s fallback embedder (%s) vectors will be truncated or zero-padded to %d dimensions; search quality degrades while it is in use", cfg.ModelType, fallbackProvider, dimension)
+	} else {
+		log.Printf("Using %s fallback embedder for %s embeddings", fallbackProvider, cfg.ModelType)
+	}
+	return service.NewFallbackEmbedder(primary, fallback, dimension)
+}
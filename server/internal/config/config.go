@@ -4,7 +4,7 @@
 package config
 
 import (
-	"log"
+	"fmt"
 	"os"
 	"strconv"
 	"time"
@@ -22,45 +22,275 @@ type Config struct {
 	MongoURI          string
 	FederatedMongoURI string
 	DBName            string
+	FederatedDBName   string
+
+	// Collection names
+	MetaCollection          string
+	CodeCollection          string
+	FederatedMetaCollection string
+	GuidesCollection        string
+	SummariesCollection     string
+	FeedbackCollection      string
+	MigrationsCollection    string
+	IdempotencyCollection   string
+
+	// IdempotencyTTL is how long a response is replayed for its Idempotency-Key
+	IdempotencyTTL time.Duration
+
+	// Mongo driver tuning; zero values keep the driver defaults
+	MongoMaxPoolSize    int
+	MongoMinPoolSize    int
+	MongoReadPreference string
+	MongoWriteConcern   string
+
+	// Search queries (vector searches, chunk lookups) can read from replicas:
+	// MongoSearchURI opens a separate, read-only connection for them and
+	// MongoSearchReadPreference overrides the read preference they use. Empty
+	// values keep them on the main connection; writes always stay there.
+	MongoSearchURI            string
+	MongoSearchReadPreference string
+
+	// MongoAggregateAttempts is how often a vector search aggregation is tried
+	// on transient errors
+	MongoAggregateAttempts int
 
 	// External services
-	GitHubToken string
+	GitHubToken      string
+	GitHubAPIURL     string
+	GitHubUserAgent  string
+	GitHubAPIVersion string
+
+	// GitHubIssueCacheTTL is how long a fetched issue is reused; 0 disables
+	GitHubIssueCacheTTL time.Duration
+
+	// GitHub connection pool tuning
+	GitHubMaxIdleConns        int
+	GitHubMaxIdleConnsPerHost int
+	GitHubIdleConnTimeout     time.Duration
+
+	// ReposSort and ReposSortOrder are the default order of GET /repos
+	ReposSort      string
+	ReposSortOrder string
+
+	// AdminToken is the bearer token for /admin routes; empty disables them.
+	AdminToken string
+
+	// AdminStatsTTL is how long /admin/stats reuses its collection counts
+	AdminStatsTTL time.Duration
 
 	// Server tuning
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 
+	// LLM backend: "vertex" (default) or "openai" for any OpenAI-compatible endpoint
+	LLMProvider   string
+	OpenAIChatURL string
+	OpenAIModel   string
+	OpenAIAPIKey  string
+
+	// Embedding backend: "local" (default), "vertex" or "gemini"
+	EmbedderProvider string
+
+	// Fallback embedder used when the primary one fails: a provider like
+	// EmbedderProvider, "" for none. A positive dimension truncates or
+	// zero-pads its vectors to match the metadata / code index.
+	EmbedderFallbackProvider    string
+	EmbedderFallbackMetadataDim int
+	EmbedderFallbackCodeDim     int
+
+	// Vertex / Gemini embedders
+	VertexEmbedTimeout     time.Duration
+	VertexEmbedMaxAttempts int
+
+	// Local embedder
+	PythonBin              string
+	MetadataEmbeddingModel string
+	MetadataEmbeddingDim   int
+	CodeEmbeddingModel     string
+	CodeEmbeddingDim       int
+	EmbedMinTextLength     int
+	EmbedWorkerPoolSize    int // persistent Python workers per model; 0 spawns one per call
+	LocalEmbedTimeout      time.Duration
+
+	// Embedding concurrency
+	MaxConcurrentEmbeddings int
+	EmbedQueueTimeout       time.Duration
+
+	// LLM concurrency; MaxConcurrentLLM 0 leaves generations unbounded
+	MaxConcurrentLLM int
+	LLMQueueTimeout  time.Duration
+
+	// ChatPromptFile overrides the built-in chat follow-up prompt template
+	ChatPromptFile string
+
+	// GuidePromptFile, IssueGuidePromptFile and RAGPromptFile override the
+	// built-in RAG guide, issue guide and RAG answer prompts (fmt format
+	// strings)
+	GuidePromptFile      string
+	IssueGuidePromptFile string
+	RAGPromptFile        string
+
+	// PromptReloadInterval is how often prompt files are checked for changes;
+	// 0 disables hot-reload (POST /admin/prompts/reload still works)
+	PromptReloadInterval time.Duration
+
+	// EmptyIssueBodyNote overrides the prompt note used for issues without a body
+	EmptyIssueBodyNote string
+
+	// RAG tuning
+	MinSourceRelevance float64
+	GuideContextBudget int    // characters of code context sent with a guide prompt
+	PromptWarnTokens   int    // estimated prompt tokens above which a warning is logged; 0 disables
+	FullFileMaxBytes   int    // size limit of full files attached to RAG sources (include_full_file)
+	ChunkTypeBoosts    string // guide context score multipliers by chunk type, e.g. "readme=1.5,doc=1.2"
+	MinReadmeChunks    int    // README chunks always included in guide context; 0 disables
+
+	// SourceDedupThreshold is the shingle overlap (0–1) above which RAG
+	// sources from the same file are merged; 0 disables
+	SourceDedupThreshold float64
+
+	// Request validation
+	MaxQueryLength int
+
+	// RepoLookupTimeout bounds each federated metadata lookup during search
+	RepoLookupTimeout time.Duration
+
+	// MaxEnrichedResults is how many search results get full federated
+	// metadata; 0 enriches all
+	MaxEnrichedResults int
+
+	// MaxChunkLength caps code chunk text in code search responses (characters)
+	MaxChunkLength int
+
+	// ScoreNormalization adds a per-query 0–1 normalized_score to search and
+	// code search results: "none", "minmax" or "zscore"
+	ScoreNormalization string
+
+	// AllowMissingBucket lets the server start, with file access broken, when
+	// the GCS repository bucket is missing or unreadable; otherwise startup
+	// fails
+	AllowMissingBucket bool
+
 	// ProjectID and Location
 	ProjectID string
 	Location  string
+
+	// invalidEnv lists the variables Load had to replace with defaults
+	// because they were malformed; Validate reports them
+	invalidEnv []string
 }
 
 // Load parses the environment (and an optional .env file) into Config.
-// It panics on missing critical variables so mis‑configurations fail fast.
+// It doesn't fail on missing or malformed variables; call Validate on the
+// result so every mis‑configuration is reported at once.
 func Load() Config {
 	// godotenv.Load() is a no‑op if .env doesn't exist—safe in production.
 	_ = godotenv.Load()
 
-	return Config{
-		Port:              must("PORT"),
-		MongoURI:          must("MONGODB_URI"),
-		FederatedMongoURI: must("FEDERATED_MONGODB_URI"),
+	env := &envReader{}
+	cfg := Config{
+		Port:              os.Getenv("PORT"),
+		MongoURI:          os.Getenv("MONGODB_URI"),
+		FederatedMongoURI: os.Getenv("FEDERATED_MONGODB_URI"),
 		DBName:            getEnv("MONGODB_DB", "ai_action"),
-		GitHubToken:       must("GITHUB_TOKEN"),
-		ProjectID:         must("GCP_PROJECT_ID"),
-		Location:          must("GCP_LOCATION"),
-		ReadTimeout:       getDuration("READ_TIMEOUT_SEC", 5),
-		WriteTimeout:      getDuration("WRITE_TIMEOUT_SEC", 10),
-	}
-}
+		FederatedDBName:   getEnv("FEDERATED_DB_NAME", "reposdb"),
+		GitHubToken:       os.Getenv("GITHUB_TOKEN"),
+		GitHubAPIURL:      getEnv("GITHUB_API_URL", "https://api.github.com"),
+		GitHubUserAgent:   getEnv("GITHUB_USER_AGENT", "ai-in-action-api"),
+		GitHubAPIVersion:  getEnv("GITHUB_API_VERSION", "2022-11-28"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		AdminStatsTTL:     env.getDuration("ADMIN_STATS_TTL_SEC", 60),
+		ProjectID:         os.Getenv("GCP_PROJECT_ID"),
+		Location:          os.Getenv("GCP_LOCATION"),
+		ReadTimeout:       env.getDuration("READ_TIMEOUT_SEC", 5),
+		WriteTimeout:      env.getDuration("WRITE_TIMEOUT_SEC", 10),
+		MaxQueryLength:    env.getInt("MAX_QUERY_LENGTH", 512),
+		MaxChunkLength:    env.getInt("CODE_SEARCH_MAX_CHUNK_LENGTH", 4000),
+		RepoLookupTimeout: env.getDuration("REPO_LOOKUP_TIMEOUT_SEC", 3),
+
+		MaxEnrichedResults: env.getInt("SEARCH_MAX_ENRICHED_RESULTS", 0),
+
+		ScoreNormalization: getEnv("SCORE_NORMALIZATION", "none"),
+
+		AllowMissingBucket: env.getBool("GCS_ALLOW_MISSING_BUCKET", false),
+
+		GitHubIssueCacheTTL:       env.getDuration("GITHUB_ISSUE_CACHE_TTL_SEC", 120),
+		GitHubMaxIdleConns:        env.getInt("GITHUB_MAX_IDLE_CONNS", 100),
+		GitHubMaxIdleConnsPerHost: env.getInt("GITHUB_MAX_IDLE_CONNS_PER_HOST", 20),
+		GitHubIdleConnTimeout:     env.getDuration("GITHUB_IDLE_CONN_TIMEOUT_SEC", 90),
 
-// must fetches a required env var or terminates the program.
-func must(key string) string {
-	val := os.Getenv(key)
-	if val == "" {
-		log.Fatalf("env var %s is required", key)
+		ReposSort:      getEnv("REPOS_SORT", "stargazers_count"),
+		ReposSortOrder: getEnv("REPOS_SORT_ORDER", "desc"),
+
+		MongoMaxPoolSize:    env.getInt("MONGO_MAX_POOL_SIZE", 0),
+		MongoMinPoolSize:    env.getInt("MONGO_MIN_POOL_SIZE", 0),
+		MongoReadPreference: os.Getenv("MONGO_READ_PREFERENCE"),
+		MongoWriteConcern:   os.Getenv("MONGO_WRITE_CONCERN"),
+
+		MongoSearchURI:            os.Getenv("MONGODB_SEARCH_URI"),
+		MongoSearchReadPreference: os.Getenv("MONGO_SEARCH_READ_PREFERENCE"),
+
+		MongoAggregateAttempts: env.getInt("MONGO_AGGREGATE_ATTEMPTS", 3),
+
+		MetaCollection:          getEnv("REPOS_META_COLLECTION", "repos_meta"),
+		CodeCollection:          getEnv("REPOS_CODE_COLLECTION", "repos_code"),
+		FederatedMetaCollection: getEnv("FEDERATED_REPOS_COLLECTION", "repos_meta"),
+		GuidesCollection:        getEnv("GUIDES_COLLECTION", "guides"),
+		SummariesCollection:     getEnv("ISSUE_SUMMARIES_COLLECTION", "issue_summaries"),
+		FeedbackCollection:      getEnv("GUIDE_FEEDBACK_COLLECTION", "guide_feedback"),
+		MigrationsCollection:    getEnv("EMBEDDING_MIGRATIONS_COLLECTION", "embedding_migrations"),
+		IdempotencyCollection:   getEnv("IDEMPOTENCY_COLLECTION", "idempotency_keys"),
+		IdempotencyTTL:          env.getDuration("IDEMPOTENCY_TTL_SEC", 24*60*60),
+
+		ChatPromptFile:       os.Getenv("CHAT_PROMPT_FILE"),
+		GuidePromptFile:      os.Getenv("GUIDE_PROMPT_FILE"),
+		IssueGuidePromptFile: os.Getenv("ISSUE_GUIDE_PROMPT_FILE"),
+		RAGPromptFile:        os.Getenv("RAG_PROMPT_FILE"),
+
+		PromptReloadInterval: env.getDuration("PROMPT_RELOAD_INTERVAL_SEC", 0),
+
+		EmptyIssueBodyNote: os.Getenv("EMPTY_ISSUE_BODY_NOTE"),
+
+		MinSourceRelevance: env.getFloat("RAG_MIN_SOURCE_RELEVANCE", 0),
+		GuideContextBudget: env.getInt("GUIDE_CONTEXT_BUDGET_CHARS", 40000),
+		PromptWarnTokens:   env.getInt("PROMPT_WARN_TOKENS", 30000),
+		ChunkTypeBoosts:    os.Getenv("CHUNK_TYPE_BOOSTS"),
+		MinReadmeChunks:    env.getInt("GUIDE_MIN_README_CHUNKS", 2),
+		FullFileMaxBytes:   env.getInt("RAG_FULL_FILE_MAX_BYTES", 64*1024),
+
+		SourceDedupThreshold: env.getFloat("RAG_SOURCE_DEDUP_THRESHOLD", 0.6),
+
+		EmbedderProvider:       getEnv("EMBEDDER_PROVIDER", "local"),
+		VertexEmbedTimeout:     env.getDuration("VERTEX_EMBED_TIMEOUT_SEC", 30),
+		VertexEmbedMaxAttempts: env.getInt("VERTEX_EMBED_MAX_ATTEMPTS", 3),
+
+		EmbedderFallbackProvider:    os.Getenv("EMBEDDER_FALLBACK_PROVIDER"),
+		EmbedderFallbackMetadataDim: env.getInt("EMBEDDER_FALLBACK_METADATA_DIM", 0),
+		EmbedderFallbackCodeDim:     env.getInt("EMBEDDER_FALLBACK_CODE_DIM", 0),
+
+		// PYTHON_PATH is the legacy name; empty means auto-detect.
+		PythonBin:              getEnv("PYTHON_BIN", os.Getenv("PYTHON_PATH")),
+		MetadataEmbeddingModel: getEnv("METADATA_EMBEDDING_MODEL", "all-mpnet-base-v2"),
+		MetadataEmbeddingDim:   env.getInt("METADATA_EMBEDDING_DIM", 768),
+		CodeEmbeddingModel:     getEnv("CODE_EMBEDDING_MODEL", "intfloat/multilingual-e5-large"),
+		CodeEmbeddingDim:       env.getInt("CODE_EMBEDDING_DIM", 1024),
+		EmbedMinTextLength:     env.getInt("EMBED_MIN_TEXT_LENGTH", 1),
+		EmbedWorkerPoolSize:    env.getInt("EMBED_WORKER_POOL_SIZE", 2),
+		LocalEmbedTimeout:      env.getDuration("LOCAL_EMBED_TIMEOUT_SEC", 300),
+
+		LLMProvider:   getEnv("LLM_PROVIDER", "vertex"),
+		OpenAIChatURL: getEnv("OPENAI_CHAT_URL", "https://api.openai.com/v1/chat/completions"),
+		OpenAIModel:   getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		OpenAIAPIKey:  os.Getenv("OPENAI_API_KEY"),
+
+		MaxConcurrentEmbeddings: env.getInt("MAX_CONCURRENT_EMBEDDINGS", 4),
+		EmbedQueueTimeout:       env.getDuration("EMBED_QUEUE_TIMEOUT_SEC", 10),
+
+		MaxConcurrentLLM: env.getInt("MAX_CONCURRENT_LLM", 8),
+		LLMQueueTimeout:  env.getDuration("LLM_QUEUE_TIMEOUT_SEC", 15),
 	}
-	return val
+	cfg.invalidEnv = env.malformed
+	return cfg
 }
 
 // getEnv returns env[key] if set, otherwise defaultVal.
@@ -71,13 +301,53 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
+// envReader reads typed variables from the environment for one Load,
+// collecting the malformed ones it fell back on defaults for.
+type envReader struct {
+	malformed []string
+}
+
 // getDuration reads an integer (seconds) from env, falling back to defaultSec.
-func getDuration(key string, defaultSec int) time.Duration {
+func (r *envReader) getDuration(key string, defaultSec int) time.Duration {
 	if v := os.Getenv(key); v != "" {
 		if sec, err := strconv.Atoi(v); err == nil {
 			return time.Duration(sec) * time.Second
 		}
-		log.Printf("invalid %s=%q; using default %ds", key, v, defaultSec)
+		r.malformed = append(r.malformed, fmt.Sprintf("%s=%q is not a whole number of seconds", key, v))
 	}
 	return time.Duration(defaultSec) * time.Second
 }
+
+// getInt reads an integer from env, falling back to defaultVal.
+func (r *envReader) getInt(key string, defaultVal int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		r.malformed = append(r.malformed, fmt.Sprintf("%s=%q is not an integer", key, v))
+	}
+	return defaultVal
+}
+
+// getBool reads a boolean ("true", "1", "false", ...) from env, falling back
+// to defaultVal.
+func (r *envReader) getBool(key string, defaultVal bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+		r.malformed = append(r.malformed, fmt.Sprintf("%s=%q is not a boolean", key, v))
+	}
+	return defaultVal
+}
+
+// getFloat reads a float from env, falling back to defaultVal.
+func (r *envReader) getFloat(key string, defaultVal float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		r.malformed = append(r.malformed, fmt.Sprintf("%s=%q is not a number", key, v))
+	}
+	return defaultVal
+}
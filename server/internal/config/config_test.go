@@ -0,0 +1,111 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadMongoOptions(t *testing.T) {
+	t.Setenv("MONGO_MAX_POOL_SIZE", "50")
+	t.Setenv("MONGO_MIN_POOL_SIZE", "5")
+	t.Setenv("MONGO_READ_PREFERENCE", "nearest")
+	t.Setenv("MONGO_WRITE_CONCERN", "majority")
+
+	cfg := Load()
+	if cfg.MongoMaxPoolSize != 50 || cfg.MongoMinPoolSize != 5 {
+		t.Errorf("pool sizes = %d/%d, want 50/5", cfg.MongoMaxPoolSize, cfg.MongoMinPoolSize)
+	}
+	if cfg.MongoReadPreference != "nearest" || cfg.MongoWriteConcern != "majority" {
+		t.Errorf("read preference %q, write concern %q; want nearest, majority", cfg.MongoReadPreference, cfg.MongoWriteConcern)
+	}
+}
+
+func TestLoadMongoOptionsDefaults(t *testing.T) {
+	for _, key := range []string{"MONGO_MAX_POOL_SIZE", "MONGO_MIN_POOL_SIZE", "MONGO_READ_PREFERENCE", "MONGO_WRITE_CONCERN"} {
+		t.Setenv(key, "")
+	}
+
+	cfg := Load()
+	if cfg.MongoMaxPoolSize != 0 || cfg.MongoMinPoolSize != 0 || cfg.MongoReadPreference != "" || cfg.MongoWriteConcern != "" {
+		t.Errorf("unset options loaded as %d/%d/%q/%q, want zero values", cfg.MongoMaxPoolSize, cfg.MongoMinPoolSize, cfg.MongoReadPreference, cfg.MongoWriteConcern)
+	}
+}
+
+func TestLoadCollectionNames(t *testing.T) {
+	names := func(cfg Config) [4]string {
+		return [4]string{cfg.MetaCollection, cfg.CodeCollection, cfg.FederatedMetaCollection, cfg.GuidesCollection}
+	}
+	keys := [4]string{"REPOS_META_COLLECTION", "REPOS_CODE_COLLECTION", "FEDERATED_REPOS_COLLECTION", "GUIDES_COLLECTION"}
+
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+	if got, want := names(Load()), [4]string{"repos_meta", "repos_code", "repos_meta", "guides"}; got != want {
+		t.Errorf("default names = %q, want %q", got, want)
+	}
+
+	want := [4]string{"alt_meta", "alt_code", "alt_repos", "alt_guides"}
+	for i, key := range keys {
+		t.Setenv(key, want[i])
+	}
+	if got := names(Load()); got != want {
+		t.Errorf("configured names = %q, want %q", got, want)
+	}
+}
+
+func TestLoadGitHubTransport(t *testing.T) {
+	t.Setenv("GITHUB_MAX_IDLE_CONNS", "")
+	t.Setenv("GITHUB_MAX_IDLE_CONNS_PER_HOST", "")
+	t.Setenv("GITHUB_IDLE_CONN_TIMEOUT_SEC", "")
+	cfg := Load()
+	if cfg.GitHubMaxIdleConns != 100 || cfg.GitHubMaxIdleConnsPerHost != 20 || cfg.GitHubIdleConnTimeout != 90*time.Second {
+		t.Errorf("defaults = %d/%d/%s, want 100/20/1m30s", cfg.GitHubMaxIdleConns, cfg.GitHubMaxIdleConnsPerHost, cfg.GitHubIdleConnTimeout)
+	}
+
+	t.Setenv("GITHUB_MAX_IDLE_CONNS", "50")
+	t.Setenv("GITHUB_MAX_IDLE_CONNS_PER_HOST", "25")
+	t.Setenv("GITHUB_IDLE_CONN_TIMEOUT_SEC", "30")
+	cfg = Load()
+	if cfg.GitHubMaxIdleConns != 50 || cfg.GitHubMaxIdleConnsPerHost != 25 || cfg.GitHubIdleConnTimeout != 30*time.Second {
+		t.Errorf("configured = %d/%d/%s, want 50/25/30s", cfg.GitHubMaxIdleConns, cfg.GitHubMaxIdleConnsPerHost, cfg.GitHubIdleConnTimeout)
+	}
+}
+
+func TestLoadAllowMissingBucket(t *testing.T) {
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{"", false},
+		{"true", true},
+		{"1", true},
+		{"false", false},
+		{"maybe", false}, // invalid values keep the fail-fast default
+	}
+	for _, tt := range tests {
+		t.Setenv("GCS_ALLOW_MISSING_BUCKET", tt.env)
+		if got := Load().AllowMissingBucket; got != tt.want {
+			t.Errorf("GCS_ALLOW_MISSING_BUCKET=%q: AllowMissingBucket = %t, want %t", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSourceDedupThreshold(t *testing.T) {
+	t.Setenv("RAG_SOURCE_DEDUP_THRESHOLD", "")
+	if got := Load().SourceDedupThreshold; got != 0.6 {
+		t.Errorf("default SourceDedupThreshold = %v, want 0.6", got)
+	}
+	t.Setenv("RAG_SOURCE_DEDUP_THRESHOLD", "0")
+	if got := Load().SourceDedupThreshold; got != 0 {
+		t.Errorf("SourceDedupThreshold = %v, want 0 (disabled)", got)
+	}
+}
+
+func TestLoadMongoSearchOptions(t *testing.T) {
+	t.Setenv("MONGODB_SEARCH_URI", "mongodb://replica.example.net")
+	t.Setenv("MONGO_SEARCH_READ_PREFERENCE", "secondaryPreferred")
+	cfg := Load()
+	if cfg.MongoSearchURI != "mongodb://replica.example.net" || cfg.MongoSearchReadPreference != "secondaryPreferred" {
+		t.Errorf("search options = %q/%q, want the configured URI and secondaryPreferred", cfg.MongoSearchURI, cfg.MongoSearchReadPreference)
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks the loaded configuration and reports every problem at once:
+// missing required variables, malformed values the env helpers had to replace
+// with defaults, and URIs, ports, durations and options that can't work.
+func (c Config) Validate() error {
+	problems := append([]string(nil), c.invalidEnv...)
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, req := range []struct{ key, val string }{
+		{"PORT", c.Port},
+		{"MONGODB_URI", c.MongoURI},
+		{"FEDERATED_MONGODB_URI", c.FederatedMongoURI},
+		{"GITHUB_TOKEN", c.GitHubToken},
+		{"GCP_PROJECT_ID", c.ProjectID},
+		{"GCP_LOCATION", c.Location},
+	} {
+		if req.val == "" {
+			add("%s is required", req.key)
+		}
+	}
+
+	if c.Port != "" {
+		if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+			add("PORT=%q is not a port number (1-65535)", c.Port)
+		}
+	}
+
+	for _, uri := range []struct{ key, val string }{
+		{"MONGODB_URI", c.MongoURI},
+		{"FEDERATED_MONGODB_URI", c.FederatedMongoURI},
+		{"MONGODB_SEARCH_URI", c.MongoSearchURI},
+	} {
+		if uri.val == "" {
+			continue
+		}
+		u, err := url.Parse(uri.val)
+		if err != nil || (u.Scheme != "mongodb" && u.Scheme != "mongodb+srv") || u.Host == "" {
+			add("%s is not a mongodb:// or mongodb+srv:// URI", uri.key)
+		}
+	}
+
+	httpURLs := []struct{ key, val string }{{"GITHUB_API_URL", c.GitHubAPIURL}}
+	if c.LLMProvider == "openai" {
+		httpURLs = append(httpURLs, struct{ key, val string }{"OPENAI_CHAT_URL", c.OpenAIChatURL})
+	}
+	for _, u := range httpURLs {
+		parsed, err := url.Parse(u.val)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			add("%s=%q is not an http(s) URL", u.key, u.val)
+		}
+	}
+
+	for _, d := range []struct {
+		key      string
+		val      time.Duration
+		positive bool
+	}{
+		{"READ_TIMEOUT_SEC", c.ReadTimeout, true},
+		{"WRITE_TIMEOUT_SEC", c.WriteTimeout, true},
+		{"IDEMPOTENCY_TTL_SEC", c.IdempotencyTTL, true},
+		{"GITHUB_ISSUE_CACHE_TTL_SEC", c.GitHubIssueCacheTTL, false},
+		{"GITHUB_IDLE_CONN_TIMEOUT_SEC", c.GitHubIdleConnTimeout, false},
+		{"ADMIN_STATS_TTL_SEC", c.AdminStatsTTL, false},
+		{"VERTEX_EMBED_TIMEOUT_SEC", c.VertexEmbedTimeout, false},
+		{"LOCAL_EMBED_TIMEOUT_SEC", c.LocalEmbedTimeout, false},
+		{"EMBED_QUEUE_TIMEOUT_SEC", c.EmbedQueueTimeout, false},
+		{"LLM_QUEUE_TIMEOUT_SEC", c.LLMQueueTimeout, false},
+		{"PROMPT_RELOAD_INTERVAL_SEC", c.PromptReloadInterval, false},
+		{"REPO_LOOKUP_TIMEOUT_SEC", c.RepoLookupTimeout, false},
+	} {
+		switch {
+		case d.positive && d.val <= 0:
+			add("%s must be positive", d.key)
+		case d.val < 0:
+			add("%s must not be negative", d.key)
+		}
+	}
+
+	oneOf := func(key, val string, allowed ...string) {
+		for _, a := range allowed {
+			if val == a {
+				return
+			}
+		}
+		add("%s=%q must be one of: %s", key, val, strings.Join(allowed, ", "))
+	}
+	oneOf("LLM_PROVIDER", c.LLMProvider, "vertex", "openai")
+	oneOf("EMBEDDER_PROVIDER", c.EmbedderProvider, "local", "vertex", "gemini")
+	if c.EmbedderFallbackProvider != "" {
+		oneOf("EMBEDDER_FALLBACK_PROVIDER", c.EmbedderFallbackProvider, "local", "vertex", "gemini")
+	}
+	oneOf("SCORE_NORMALIZATION", c.ScoreNormalization, "none", "minmax", "zscore")
+	for _, rp := range []struct{ key, val string }{
+		{"MONGO_READ_PREFERENCE", c.MongoReadPreference},
+		{"MONGO_SEARCH_READ_PREFERENCE", c.MongoSearchReadPreference},
+	} {
+		if rp.val != "" {
+			oneOf(rp.key, rp.val, "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest")
+		}
+	}
+
+	for _, r := range []struct {
+		key string
+		val float64
+	}{
+		{"RAG_MIN_SOURCE_RELEVANCE", c.MinSourceRelevance},
+		{"RAG_SOURCE_DEDUP_THRESHOLD", c.SourceDedupThreshold},
+	} {
+		if r.val < 0 || r.val > 1 {
+			add("%s=%g must be between 0 and 1", r.key, r.val)
+		}
+	}
+	for _, n := range []struct {
+		key string
+		val int
+	}{
+		{"MONGO_MAX_POOL_SIZE", c.MongoMaxPoolSize},
+		{"MONGO_MIN_POOL_SIZE", c.MongoMinPoolSize},
+		{"MAX_CONCURRENT_EMBEDDINGS", c.MaxConcurrentEmbeddings},
+		{"MAX_CONCURRENT_LLM", c.MaxConcurrentLLM},
+		{"MAX_QUERY_LENGTH", c.MaxQueryLength},
+	} {
+		if n.val < 0 {
+			add("%s=%d must not be negative", n.key, n.val)
+		}
+	}
+	if c.MongoMaxPoolSize > 0 && c.MongoMinPoolSize > c.MongoMaxPoolSize {
+		add("MONGO_MIN_POOL_SIZE (%d) exceeds MONGO_MAX_POOL_SIZE (%d)", c.MongoMinPoolSize, c.MongoMaxPoolSize)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration (%d problems):\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+}
@@ -2,12 +2,25 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
+// Options tunes the MongoDB driver. Zero values keep the driver defaults (or
+// whatever the connection URI specifies).
+type Options struct {
+	MaxPoolSize    uint64 // max connections per server
+	MinPoolSize    uint64 // connections kept warm per server
+	ReadPreference string // "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"
+	WriteConcern   string // "majority" or a node count such as "1"
+}
+
 // NewMongo establishes a new MongoDB client with a 10‑second connection timeout.
 //
 // It returns:
@@ -17,17 +30,21 @@ import (
 //
 // Typical usage:
 //
-//	client, ctx, cancel, err := database.NewMongo(cfg.MongoURI)
+//	client, ctx, cancel, err := database.NewMongo(cfg.MongoURI, database.Options{})
 //	if err != nil { … }
 //	defer cancel()
 //	defer client.Disconnect(ctx)
-func NewMongo(uri string) (*mongo.Client, context.Context, context.CancelFunc, error) {
+func NewMongo(uri string, opts Options) (*mongo.Client, context.Context, context.CancelFunc, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	clientOpts := options.Client().
 		ApplyURI(uri).
 		SetServerSelectionTimeout(5 * time.Second)
 
+	if err := applyOptions(clientOpts, opts); err != nil {
+		return nil, ctx, cancel, err
+	}
+
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return nil, ctx, cancel, err
@@ -42,3 +59,49 @@ func NewMongo(uri string) (*mongo.Client, context.Context, context.CancelFunc, e
 
 	return client, ctx, cancel, nil
 }
+
+// applyOptions copies the non-zero fields of opts onto clientOpts.
+func applyOptions(clientOpts *options.ClientOptions, opts Options) error {
+	if opts.MaxPoolSize > 0 {
+		clientOpts.SetMaxPoolSize(opts.MaxPoolSize)
+	}
+	if opts.MinPoolSize > 0 {
+		clientOpts.SetMinPoolSize(opts.MinPoolSize)
+	}
+	if opts.ReadPreference != "" {
+		rp, err := ParseReadPreference(opts.ReadPreference)
+		if err != nil {
+			return err
+		}
+		clientOpts.SetReadPreference(rp)
+	}
+	if opts.WriteConcern != "" {
+		wc, err := parseWriteConcern(opts.WriteConcern)
+		if err != nil {
+			return err
+		}
+		clientOpts.SetWriteConcern(wc)
+	}
+	return nil
+}
+
+// ParseReadPreference converts a read preference mode name into a ReadPref.
+func ParseReadPreference(mode string) (*readpref.ReadPref, error) {
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read preference %q: %w", mode, err)
+	}
+	return readpref.New(m)
+}
+
+// parseWriteConcern accepts "majority" or a non-negative node count.
+func parseWriteConcern(w string) (*writeconcern.WriteConcern, error) {
+	if w == "majority" {
+		return writeconcern.Majority(), nil
+	}
+	n, err := strconv.Atoi(w)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid write concern %q: expected \"majority\" or a node count", w)
+	}
+	return &writeconcern.WriteConcern{W: n}, nil
+}
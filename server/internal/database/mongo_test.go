@@ -0,0 +1,61 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestApplyOptions(t *testing.T) {
+	t.Run("zero values keep driver defaults", func(t *testing.T) {
+		clientOpts := options.Client()
+		if err := applyOptions(clientOpts, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if clientOpts.MaxPoolSize != nil || clientOpts.MinPoolSize != nil || clientOpts.ReadPreference != nil || clientOpts.WriteConcern != nil {
+			t.Errorf("options set from zero config: %+v", clientOpts)
+		}
+	})
+
+	t.Run("all options", func(t *testing.T) {
+		clientOpts := options.Client()
+		err := applyOptions(clientOpts, Options{
+			MaxPoolSize:    50,
+			MinPoolSize:    5,
+			ReadPreference: "secondaryPreferred",
+			WriteConcern:   "majority",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clientOpts.MaxPoolSize == nil || *clientOpts.MaxPoolSize != 50 {
+			t.Errorf("MaxPoolSize = %v, want 50", clientOpts.MaxPoolSize)
+		}
+		if clientOpts.MinPoolSize == nil || *clientOpts.MinPoolSize != 5 {
+			t.Errorf("MinPoolSize = %v, want 5", clientOpts.MinPoolSize)
+		}
+		if clientOpts.ReadPreference == nil || clientOpts.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+			t.Errorf("ReadPreference = %v, want secondaryPreferred", clientOpts.ReadPreference)
+		}
+		if clientOpts.WriteConcern == nil || clientOpts.WriteConcern.W != "majority" {
+			t.Errorf("WriteConcern = %+v, want majority", clientOpts.WriteConcern)
+		}
+	})
+
+	t.Run("node count write concern", func(t *testing.T) {
+		clientOpts := options.Client()
+		if err := applyOptions(clientOpts, Options{WriteConcern: "2"}); err != nil {
+			t.Fatal(err)
+		}
+		if clientOpts.WriteConcern == nil || clientOpts.WriteConcern.W != 2 {
+			t.Errorf("WriteConcern = %+v, want w=2", clientOpts.WriteConcern)
+		}
+	})
+
+	for _, bad := range []Options{{ReadPreference: "fastest"}, {WriteConcern: "most"}, {WriteConcern: "-1"}} {
+		if err := applyOptions(options.Client(), bad); err == nil {
+			t.Errorf("applyOptions(%+v) succeeded, want an error", bad)
+		}
+	}
+}
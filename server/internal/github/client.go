@@ -1,33 +1,115 @@
 package github
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
 )
 
+// ErrNotFound is returned when GitHub answers 404 Not Found.
+var ErrNotFound = errors.New("github: not found")
+
 // Client is a minimal wrapper around GitHub's REST API v3.
 // It is intentionally light—just the endpoints our services require.
 type Client struct {
-	http  *http.Client
-	token string
+	http       *http.Client
+	baseURL    string // API root without trailing slash, e.g. https://api.github.com
+	token      string
+	userAgent  string
+	apiVersion string // sent as X-GitHub-Api-Version; empty omits the header
+	issues     *issueCache
+}
+
+// Defaults used by NewClient.
+const (
+	DefaultBaseURL    = "https://api.github.com"
+	DefaultUserAgent  = "ai-in-action-api"
+	DefaultAPIVersion = "2022-11-28"
+)
+
+// TransportConfig tunes connection reuse towards the GitHub API. All requests
+// go to one host, so MaxIdleConnsPerHost matters most: Go's default of 2 makes
+// bursts of concurrent calls open and discard connections.
+type TransportConfig struct {
+	MaxIdleConns        int           // idle connections kept in total
+	MaxIdleConnsPerHost int           // idle connections kept to the API host
+	IdleConnTimeout     time.Duration // how long an idle connection is kept
+}
+
+// DefaultTransportConfig is the transport tuning used by NewClient.
+var DefaultTransportConfig = TransportConfig{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 20,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// newTransport returns a copy of http.DefaultTransport tuned with cfg; zero
+// fields keep DefaultTransportConfig's values.
+func newTransport(cfg TransportConfig) *http.Transport {
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = DefaultTransportConfig.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = DefaultTransportConfig.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = DefaultTransportConfig.IdleConnTimeout
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+	return t
 }
 
 // NewClient returns a ready-to-use GitHub API client.
 // token may be an empty string, but you will be subject to very low rate‑limits.
 func NewClient(token string) *Client {
+	return NewClientWithBaseURL(token, DefaultBaseURL)
+}
+
+// NewClientWithBaseURL returns a client for a GitHub Enterprise Server
+// instance, whose REST API lives at e.g. https://github.example.com/api/v3.
+func NewClientWithBaseURL(token, baseURL string) *Client {
 	return &Client{
 		http: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: newTransport(DefaultTransportConfig),
 		},
-		token: token,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		userAgent:  DefaultUserAgent,
+		apiVersion: DefaultAPIVersion,
+		issues:     newIssueCache(DefaultIssueCacheTTL),
 	}
 }
 
+// SetUserAgent overrides the User-Agent sent with every request. Call it
+// before the client is shared.
+func (c *Client) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+// SetTransport replaces the client's connection pool with one tuned by cfg.
+// Call it before the client is shared.
+func (c *Client) SetTransport(cfg TransportConfig) {
+	c.http.Transport = newTransport(cfg)
+}
+
+// SetAPIVersion pins the REST API version sent in X-GitHub-Api-Version; an
+// empty version omits the header. Call it before the client is shared.
+func (c *Client) SetAPIVersion(version string) {
+	c.apiVersion = version
+}
+
 // ListRepoIssues fetches issues for a repo (excludes pull‑requests by default).
 //
 //	owner – repository owner (e.g., "torvalds")
@@ -35,7 +117,7 @@ func NewClient(token string) *Client {
 //	state – "open" | "closed" | "all"
 //	perPage – max items per page (1–100)
 func (c *Client) ListRepoIssues(owner, repo, state string, perPage int) ([]models.Issue, error) {
-	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues", url.PathEscape(owner), url.PathEscape(repo))
+	u := fmt.Sprintf("%s/repos/%s/%s/issues", c.baseURL, url.PathEscape(owner), url.PathEscape(repo))
 
 	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
@@ -62,10 +144,47 @@ func (c *Client) ListRepoIssues(owner, repo, state string, perPage int) ([]model
 	return issues, nil
 }
 
-// GetIssue retrieves a single issue by number.
+// ListIssuesClosedSince fetches closed issues updated since the given time,
+// most recently updated first. GitHub's since filter matches updated_at, so
+// callers wanting issues closed since then must also check ClosedAt.
+func (c *Client) ListIssuesClosedSince(ctx context.Context, owner, repo string, since time.Time, perPage int) ([]models.Issue, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/issues", c.baseURL, url.PathEscape(owner), url.PathEscape(repo))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Set("state", "closed")
+	q.Set("since", since.UTC().Format(time.RFC3339))
+	q.Set("sort", "updated")
+	q.Set("direction", "desc")
+	if perPage > 0 {
+		q.Set("per_page", fmt.Sprint(perPage))
+	}
+	q.Set("filter", "all")
+	req.URL.RawQuery = q.Encode()
+
+	c.addHeaders(req)
+
+	var issues []models.Issue
+	if err := c.do(req, &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+// GetIssue retrieves a single issue by number. Issues are cached for a short
+// time (see SetIssueCacheTTL); errors are not cached.
 func (c *Client) GetIssue(owner, repo string, number int) (models.Issue, error) {
-	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d",
-		url.PathEscape(owner), url.PathEscape(repo), number)
+	key := issueKey(owner, repo, number)
+	if issue, ok := c.issues.get(key); ok {
+		return issue, nil
+	}
+
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d",
+		c.baseURL, url.PathEscape(owner), url.PathEscape(repo), number)
 
 	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
@@ -78,16 +197,188 @@ func (c *Client) GetIssue(owner, repo string, number int) (models.Issue, error)
 	if err := c.do(req, &issue); err != nil {
 		return models.Issue{}, err
 	}
+	c.issues.put(key, issue)
 	return issue, nil
 }
 
-// addHeaders sets authentication and Accept headers.
+// GetRepo fetches the live star/fork/issue counters for a repository.
+func (c *Client) GetRepo(ctx context.Context, owner, repo string) (models.RepoCounts, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s",
+		c.baseURL, url.PathEscape(owner), url.PathEscape(repo))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return models.RepoCounts{}, err
+	}
+
+	c.addHeaders(req)
+
+	var counts models.RepoCounts
+	if err := c.do(req, &counts); err != nil {
+		return models.RepoCounts{}, err
+	}
+	return counts, nil
+}
+
+// GetRepoFullName resolves a numeric repository ID to its current
+// "owner/repo" name.
+func (c *Client) GetRepoFullName(ctx context.Context, id int64) (string, error) {
+	u := fmt.Sprintf("%s/repositories/%d", c.baseURL, id)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+
+	c.addHeaders(req)
+
+	var repo struct {
+		FullName string `json:"full_name"`
+	}
+	if err := c.do(req, &repo); err != nil {
+		return "", err
+	}
+	return repo.FullName, nil
+}
+
+// GetRepoLanguages returns the number of bytes of code per language in a repo,
+// e.g. {"Go": 123456, "Shell": 789}.
+func (c *Client) GetRepoLanguages(ctx context.Context, owner, repo string) (map[string]int, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/languages",
+		c.baseURL, url.PathEscape(owner), url.PathEscape(repo))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.addHeaders(req)
+
+	languages := map[string]int{}
+	if err := c.do(req, &languages); err != nil {
+		return nil, err
+	}
+	return languages, nil
+}
+
+// ListIssueTimelineConnectedPRs returns the pull requests that reference an
+// issue, taken from the issue timeline's cross-referenced events. Each PR is
+// listed once even if it references the issue several times.
+func (c *Client) ListIssueTimelineConnectedPRs(ctx context.Context, owner, repo string, number int) ([]models.PullRequestRef, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d/timeline",
+		c.baseURL, url.PathEscape(owner), url.PathEscape(repo), number)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Set("per_page", "100")
+	req.URL.RawQuery = q.Encode()
+
+	c.addHeaders(req)
+
+	var events []timelineEvent
+	if err := c.do(req, &events); err != nil {
+		return nil, err
+	}
+
+	prs := []models.PullRequestRef{}
+	seen := map[int]bool{}
+	for _, ev := range events {
+		if ev.Event != "cross-referenced" || ev.Source.Issue == nil || ev.Source.Issue.PullRequest == nil {
+			continue
+		}
+		src := ev.Source.Issue
+		if seen[src.Number] {
+			continue
+		}
+		seen[src.Number] = true
+		prs = append(prs, models.PullRequestRef{
+			Number:  src.Number,
+			Title:   src.Title,
+			State:   src.State,
+			HTMLURL: src.HTMLURL,
+			Author:  src.User.Login,
+		})
+	}
+	return prs, nil
+}
+
+// GetFileContent fetches a file's content at ref (a branch, tag or commit SHA)
+// through the contents API. An empty ref means the repository's default
+// branch. Files over GitHub's 1 MB contents limit are not supported.
+func (c *Client) GetFileContent(ctx context.Context, owner, repo, filePath, ref string) (string, error) {
+	var escaped []string
+	for _, seg := range strings.Split(strings.Trim(filePath, "/"), "/") {
+		escaped = append(escaped, url.PathEscape(seg))
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/contents/%s",
+		c.baseURL, url.PathEscape(owner), url.PathEscape(repo), strings.Join(escaped, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	if ref != "" {
+		q := req.URL.Query()
+		q.Set("ref", ref)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	c.addHeaders(req)
+
+	var file struct {
+		Type     string `json:"type"`
+		Encoding string `json:"encoding"`
+		Content  string `json:"content"`
+	}
+	if err := c.do(req, &file); err != nil {
+		return "", err
+	}
+	if file.Type != "file" {
+		return "", fmt.Errorf("github: %s is a %s, not a file", filePath, file.Type)
+	}
+	if file.Encoding != "base64" {
+		return "", fmt.Errorf("github: unsupported content encoding %q for %s", file.Encoding, filePath)
+	}
+	// GitHub wraps the base64 payload at 60 characters
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	if err != nil {
+		return "", fmt.Errorf("github: failed to decode %s: %w", filePath, err)
+	}
+	return string(content), nil
+}
+
+// timelineEvent is the subset of an issue timeline event we decode.
+type timelineEvent struct {
+	Event  string `json:"event"`
+	Source struct {
+		Issue *struct {
+			Number      int    `json:"number"`
+			Title       string `json:"title"`
+			State       string `json:"state"`
+			HTMLURL     string `json:"html_url"`
+			PullRequest *struct {
+				HTMLURL string `json:"html_url"`
+			} `json:"pull_request"`
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"issue"`
+	} `json:"source"`
+}
+
+// addHeaders sets authentication, Accept, User-Agent and API version headers.
 func (c *Client) addHeaders(req *http.Request) {
 	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.apiVersion != "" {
+		req.Header.Set("X-GitHub-Api-Version", c.apiVersion)
+	}
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
-	req.Header.Set("User-Agent", "ai-in-action-api")
+	req.Header.Set("User-Agent", c.userAgent)
 }
 
 // do executes the HTTP request and decodes JSON into v.
@@ -98,6 +389,9 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, req.URL.Path)
+	}
 	if resp.StatusCode >= 300 {
 		return fmt.Errorf("github: unexpected status %s", resp.Status)
 	}
@@ -0,0 +1,229 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// newTestClient starts a server running handler and returns a client for it.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewClientWithBaseURL("token", srv.URL)
+}
+
+func TestGetRepoLanguages(t *testing.T) {
+	var gotPath string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{"Go": 123456, "Shell": 789, "Dockerfile": 42}`))
+	})
+
+	languages, err := c.GetRepoLanguages(context.Background(), "golang", "go")
+	if err != nil {
+		t.Fatalf("GetRepoLanguages: %v", err)
+	}
+	if gotPath != "/repos/golang/go/languages" {
+		t.Errorf("requested %s, want /repos/golang/go/languages", gotPath)
+	}
+	want := map[string]int{"Go": 123456, "Shell": 789, "Dockerfile": 42}
+	if !reflect.DeepEqual(languages, want) {
+		t.Errorf("languages = %v, want %v", languages, want)
+	}
+}
+
+func TestGetRepoLanguagesNotFound(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	if _, err := c.GetRepoLanguages(context.Background(), "o", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		var got http.Header
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+			w.Write([]byte(`{}`))
+		})
+		if _, err := c.GetRepoLanguages(context.Background(), "o", "r"); err != nil {
+			t.Fatalf("GetRepoLanguages: %v", err)
+		}
+		want := map[string]string{
+			"Accept":               "application/vnd.github+json",
+			"User-Agent":           DefaultUserAgent,
+			"X-GitHub-Api-Version": DefaultAPIVersion,
+			"Authorization":        "Bearer token",
+		}
+		for k, v := range want {
+			if got.Get(k) != v {
+				t.Errorf("%s = %q, want %q", k, got.Get(k), v)
+			}
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		var got http.Header
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+			w.Write([]byte(`{}`))
+		})
+		c.SetUserAgent("acme-guides/2.0")
+		c.SetAPIVersion("2026-03-10")
+		if _, err := c.GetRepoLanguages(context.Background(), "o", "r"); err != nil {
+			t.Fatalf("GetRepoLanguages: %v", err)
+		}
+		if ua := got.Get("User-Agent"); ua != "acme-guides/2.0" {
+			t.Errorf("User-Agent = %q, want acme-guides/2.0", ua)
+		}
+		if v := got.Get("X-GitHub-Api-Version"); v != "2026-03-10" {
+			t.Errorf("X-GitHub-Api-Version = %q, want 2026-03-10", v)
+		}
+	})
+
+	t.Run("empty version omits the header", func(t *testing.T) {
+		var got http.Header
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+			w.Write([]byte(`{}`))
+		})
+		c.SetAPIVersion("")
+		if _, err := c.GetRepoLanguages(context.Background(), "o", "r"); err != nil {
+			t.Fatalf("GetRepoLanguages: %v", err)
+		}
+		if _, ok := got["X-Github-Api-Version"]; ok {
+			t.Errorf("X-GitHub-Api-Version sent with an empty version: %q", got.Get("X-GitHub-Api-Version"))
+		}
+	})
+}
+
+func TestClientUsesBaseURL(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/issues"), strings.HasSuffix(r.URL.Path, "/timeline"):
+			w.Write([]byte(`[]`))
+		case strings.Contains(r.URL.Path, "/contents/"):
+			w.Write([]byte(`{"type":"file","encoding":"base64","content":"aGk="}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	// A trailing slash, as often pasted from the admin console, is tolerated
+	c := NewClientWithBaseURL("", srv.URL+"/api/v3/")
+
+	ctx := context.Background()
+	calls := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"ListRepoIssues", func() error { _, err := c.ListRepoIssues("o", "r", "open", 10); return err }, "/api/v3/repos/o/r/issues"},
+		{"GetIssue", func() error { _, err := c.GetIssue("o", "r", 7); return err }, "/api/v3/repos/o/r/issues/7"},
+		{"GetRepo", func() error { _, err := c.GetRepo(ctx, "o", "r"); return err }, "/api/v3/repos/o/r"},
+		{"GetRepoFullName", func() error { _, err := c.GetRepoFullName(ctx, 42); return err }, "/api/v3/repositories/42"},
+		{"GetRepoLanguages", func() error { _, err := c.GetRepoLanguages(ctx, "o", "r"); return err }, "/api/v3/repos/o/r/languages"},
+		{"ListIssueTimelineConnectedPRs", func() error { _, err := c.ListIssueTimelineConnectedPRs(ctx, "o", "r", 7); return err }, "/api/v3/repos/o/r/issues/7/timeline"},
+		{"GetFileContent", func() error { _, err := c.GetFileContent(ctx, "o", "r", "cmd/main.go", ""); return err }, "/api/v3/repos/o/r/contents/cmd/main.go"},
+	}
+	for _, tt := range calls {
+		paths = nil
+		if err := tt.call(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(paths) != 1 || paths[0] != tt.want {
+			t.Errorf("%s requested %v, want %s", tt.name, paths, tt.want)
+		}
+	}
+}
+
+func TestNewClientDefaultsToPublicAPI(t *testing.T) {
+	if c := NewClient(""); c.baseURL != DefaultBaseURL {
+		t.Errorf("baseURL = %q, want %q", c.baseURL, DefaultBaseURL)
+	}
+}
+
+// transportConfig reads the pool tuning back from c's transport.
+func transportConfig(t *testing.T, c *Client) TransportConfig {
+	t.Helper()
+	tr, ok := c.http.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport = %T, want *http.Transport", c.http.Transport)
+	}
+	return TransportConfig{MaxIdleConns: tr.MaxIdleConns, MaxIdleConnsPerHost: tr.MaxIdleConnsPerHost, IdleConnTimeout: tr.IdleConnTimeout}
+}
+
+func TestClientTransport(t *testing.T) {
+	c := NewClient("")
+	if got := transportConfig(t, c); got != DefaultTransportConfig {
+		t.Errorf("default transport = %+v, want %+v", got, DefaultTransportConfig)
+	}
+
+	want := TransportConfig{MaxIdleConns: 40, MaxIdleConnsPerHost: 32, IdleConnTimeout: 30 * time.Second}
+	c.SetTransport(want)
+	if got := transportConfig(t, c); got != want {
+		t.Errorf("configured transport = %+v, want %+v", got, want)
+	}
+
+	c.SetTransport(TransportConfig{MaxIdleConnsPerHost: 8})
+	if got := transportConfig(t, c); got.MaxIdleConnsPerHost != 8 || got.MaxIdleConns != DefaultTransportConfig.MaxIdleConns || got.IdleConnTimeout != DefaultTransportConfig.IdleConnTimeout {
+		t.Errorf("partial config gave %+v, want the unset fields defaulted", got)
+	}
+	if c.http.Transport == http.DefaultTransport {
+		t.Error("client shares http.DefaultTransport")
+	}
+}
+
+const timelineFixture = `[
+  {"event": "labeled"},
+  {"event": "cross-referenced", "source": {"issue": {
+    "number": 12, "title": "Fix the crash", "state": "open",
+    "html_url": "https://github.com/o/r/pull/12",
+    "pull_request": {"html_url": "https://github.com/o/r/pull/12"},
+    "user": {"login": "alice"}}}},
+  {"event": "cross-referenced", "source": {"issue": {
+    "number": 9, "title": "Related bug report", "state": "open",
+    "html_url": "https://github.com/o/r/issues/9",
+    "user": {"login": "bob"}}}},
+  {"event": "cross-referenced", "source": {"issue": {
+    "number": 12, "title": "Fix the crash", "state": "open",
+    "html_url": "https://github.com/o/r/pull/12",
+    "pull_request": {"html_url": "https://github.com/o/r/pull/12"},
+    "user": {"login": "alice"}}}},
+  {"event": "connected"}
+]`
+
+func TestListIssueTimelineConnectedPRs(t *testing.T) {
+	var gotPath string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(timelineFixture))
+	})
+
+	prs, err := c.ListIssueTimelineConnectedPRs(context.Background(), "o", "r", 5)
+	if err != nil {
+		t.Fatalf("ListIssueTimelineConnectedPRs: %v", err)
+	}
+	if gotPath != "/repos/o/r/issues/5/timeline" {
+		t.Errorf("requested %s, want the issue timeline", gotPath)
+	}
+	want := []models.PullRequestRef{{Number: 12, Title: "Fix the crash", State: "open", HTMLURL: "https://github.com/o/r/pull/12", Author: "alice"}}
+	if !reflect.DeepEqual(prs, want) {
+		t.Errorf("prs = %+v, want only PR 12, once", prs)
+	}
+}
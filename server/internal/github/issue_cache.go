@@ -0,0 +1,101 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// DefaultIssueCacheTTL is how long GetIssue reuses a fetched issue.
+const DefaultIssueCacheTTL = 2 * time.Minute
+
+// issueCache holds recently fetched issues keyed by "owner/repo#number", so
+// the guide, RAG and summary paths handling the same issue share one fetch.
+type issueCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration // <= 0 disables caching
+	entries map[string]cachedIssue
+}
+
+type cachedIssue struct {
+	issue     models.Issue
+	fetchedAt time.Time
+}
+
+func newIssueCache(ttl time.Duration) *issueCache {
+	return &issueCache{ttl: ttl, entries: make(map[string]cachedIssue)}
+}
+
+func issueKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s/%s#%d", owner, repo, number)
+}
+
+func (c *issueCache) get(key string) (models.Issue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return models.Issue{}, false
+	}
+	if time.Since(e.fetchedAt) >= c.ttl {
+		delete(c.entries, key)
+		return models.Issue{}, false
+	}
+	return e.issue, true
+}
+
+func (c *issueCache) put(key string, issue models.Issue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	// Drop expired entries as we go so the map stays small
+	for k, e := range c.entries {
+		if time.Since(e.fetchedAt) >= c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedIssue{issue: issue, fetchedAt: time.Now()}
+}
+
+// remove drops the cached issue under key.
+func (c *issueCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// invalidate drops the cached issues whose key starts with prefix; an empty
+// prefix drops them all.
+func (c *issueCache) invalidate(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// SetIssueCacheTTL sets how long GetIssue reuses a fetched issue; 0 disables
+// the cache. Call it before the client is shared.
+func (c *Client) SetIssueCacheTTL(ttl time.Duration) {
+	c.issues = newIssueCache(ttl)
+}
+
+// InvalidateIssues makes GetIssue refetch the issues whose "owner/repo#number"
+// key starts with prefix (e.g. "owner/repo" or "owner/repo#12"); an empty
+// prefix invalidates every cached issue.
+func (c *Client) InvalidateIssues(prefix string) {
+	c.issues.invalidate(prefix)
+}
+
+// InvalidateIssue makes the next GetIssue of owner/repo#number fetch the issue
+// from GitHub. Unlike InvalidateIssues("owner/repo#1"), it leaves #12 cached.
+func (c *Client) InvalidateIssue(owner, repo string, number int) {
+	c.issues.remove(issueKey(owner, repo, number))
+}
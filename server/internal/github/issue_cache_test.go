@@ -0,0 +1,127 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issueServer answers every issue request with a title counting the fetches
+// of that issue, e.g. "o/r/issues/1 fetch 2".
+type issueServer struct {
+	mu      sync.Mutex
+	fetches map[string]int
+}
+
+func (s *issueServer) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/repos/")
+	s.mu.Lock()
+	s.fetches[path]++
+	n := s.fetches[path]
+	s.mu.Unlock()
+	fmt.Fprintf(w, `{"number": 1, "title": "%s fetch %d"}`, path, n)
+}
+
+func (s *issueServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches[path]
+}
+
+func newIssueCacheClient(t *testing.T) (*Client, *issueServer) {
+	srv := &issueServer{fetches: map[string]int{}}
+	return newTestClient(t, srv.serve), srv
+}
+
+func getTitle(t *testing.T, c *Client, number int) string {
+	t.Helper()
+	issue, err := c.GetIssue("o", "r", number)
+	if err != nil {
+		t.Fatalf("GetIssue(%d): %v", number, err)
+	}
+	return issue.Title
+}
+
+func TestIssueCacheHitAndMiss(t *testing.T) {
+	c, srv := newIssueCacheClient(t)
+
+	if got := getTitle(t, c, 1); got != "o/r/issues/1 fetch 1" {
+		t.Errorf("first GetIssue = %q, want a fetch", got)
+	}
+	if got := getTitle(t, c, 1); got != "o/r/issues/1 fetch 1" {
+		t.Errorf("second GetIssue = %q, want the cached issue", got)
+	}
+	if got := getTitle(t, c, 2); got != "o/r/issues/2 fetch 1" {
+		t.Errorf("other issue = %q, want its own fetch", got)
+	}
+	if srv.count("o/r/issues/1") != 1 || srv.count("o/r/issues/2") != 1 {
+		t.Errorf("fetched issues 1 and 2 %d and %d times, want once each", srv.count("o/r/issues/1"), srv.count("o/r/issues/2"))
+	}
+}
+
+func TestIssueCacheTTL(t *testing.T) {
+	c, srv := newIssueCacheClient(t)
+	c.SetIssueCacheTTL(time.Minute)
+
+	getTitle(t, c, 1)
+	// Age the entry past the TTL
+	c.issues.mu.Lock()
+	e := c.issues.entries["o/r#1"]
+	e.fetchedAt = time.Now().Add(-2 * time.Minute)
+	c.issues.entries["o/r#1"] = e
+	c.issues.mu.Unlock()
+
+	if got := getTitle(t, c, 1); got != "o/r/issues/1 fetch 2" {
+		t.Errorf("GetIssue after the TTL = %q, want a refetch", got)
+	}
+
+	c.SetIssueCacheTTL(0)
+	getTitle(t, c, 1)
+	getTitle(t, c, 1)
+	if n := srv.count("o/r/issues/1"); n != 4 {
+		t.Errorf("fetched %d times, want every call fetched with the cache off", n)
+	}
+}
+
+func TestIssueCacheErrorsAreNotCached(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, `{"message": "boom"}`, http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"number": 1, "title": "ok"}`)
+	})
+
+	if _, err := c.GetIssue("o", "r", 1); err == nil {
+		t.Fatal("GetIssue succeeded, want the server error")
+	}
+	fail.Store(false)
+	if got := getTitle(t, c, 1); got != "ok" {
+		t.Errorf("GetIssue after an error = %q, want a fresh fetch", got)
+	}
+}
+
+func TestInvalidateIssue(t *testing.T) {
+	c, _ := newIssueCacheClient(t)
+	getTitle(t, c, 1)
+	getTitle(t, c, 12)
+
+	c.InvalidateIssue("o", "r", 1)
+	if got := getTitle(t, c, 1); got != "o/r/issues/1 fetch 2" {
+		t.Errorf("invalidated issue = %q, want a refetch", got)
+	}
+	if got := getTitle(t, c, 12); got != "o/r/issues/12 fetch 1" {
+		t.Errorf("issue 12 = %q, want it still cached", got)
+	}
+
+	c.InvalidateIssues("o/r")
+	if got := getTitle(t, c, 12); got != "o/r/issues/12 fetch 2" {
+		t.Errorf("issue 12 after invalidating the repo = %q, want a refetch", got)
+	}
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminHandler exposes operator endpoints. Mount it on a group that is
+// protected by middleware.AdminAuth.
+type AdminHandler struct {
+	guideSvc    service.GuideService
+	feedbackSvc service.FeedbackService
+	indexingSvc *service.IndexingService
+	repoRepo    service.RepoRepository
+	prompts     *service.PromptStore
+	statsSvc    *service.StatsService
+}
+
+// NewAdminHandler creates an AdminHandler.
+func NewAdminHandler(guideSvc service.GuideService, feedbackSvc service.FeedbackService, indexingSvc *service.IndexingService, repoRepo service.RepoRepository, prompts *service.PromptStore, statsSvc *service.StatsService) *AdminHandler {
+	return &AdminHandler{guideSvc: guideSvc, feedbackSvc: feedbackSvc, indexingSvc: indexingSvc, repoRepo: repoRepo, prompts: prompts, statsSvc: statsSvc}
+}
+
+// Register mounts the admin routes on the supplied router group.
+func (h *AdminHandler) Register(r fiber.Router) {
+	r.Get("/stats", h.datasetStats)
+	r.Get("/cache/stats", h.cacheStats)
+	r.Post("/cache/clear", h.clearCache)
+	r.Get("/repos/missing-embeddings", h.missingEmbeddings)
+	r.Get("/guide-feedback", h.guideFeedback)
+	r.Get("/guides/invalid", h.invalidGuides)
+	r.Post("/migrate-embeddings", h.migrateEmbeddings)
+	r.Get("/migrate-embeddings", h.migrationStatus)
+	r.Get("/prompts", h.getPrompts)
+	r.Post("/prompts/reload", h.reloadPrompts)
+}
+
+// getPrompts handles GET /admin/prompts, returning the guide, RAG and chat
+// prompts in use.
+func (h *AdminHandler) getPrompts(c *fiber.Ctx) error {
+	return c.JSON(h.prompts.Current())
+}
+
+// reloadPrompts handles POST /admin/prompts/reload. The prompt files are
+// re-read and swapped in together; if any fails to load the active prompts
+// stay as they were.
+func (h *AdminHandler) reloadPrompts(c *fiber.Ctx) error {
+	if err := h.prompts.Reload(); err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	return c.JSON(h.prompts.Current())
+}
+
+// datasetStats handles GET /admin/stats, reporting document counts and index
+// status of the dataset collections. Counts are cached briefly; "cached" says
+// whether this response reused them.
+func (h *AdminHandler) datasetStats(c *fiber.Ctx) error {
+	return c.JSON(h.statsSvc.DatasetStats(c.UserContext()))
+}
+
+// cacheStats handles GET /admin/cache/stats
+func (h *AdminHandler) cacheStats(c *fiber.Ctx) error {
+	guides, err := h.guideSvc.CacheStats(c.UserContext())
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"caches": fiber.Map{
+			"guides": guides,
+		},
+	})
+}
+
+type clearCacheRequest struct {
+	Cache  string `json:"cache" validate:"omitempty,oneof=guides"` // cache to clear; only "guides" today
+	Prefix string `json:"prefix"`                                  // optional key prefix, e.g. "owner/repo"
+}
+
+// clearCache handles POST /admin/cache/clear  { "cache": "guides", "prefix": "owner/repo" }
+func (h *AdminHandler) clearCache(c *fiber.Ctx) error {
+	var req clearCacheRequest
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	cleared, err := h.guideSvc.ClearCache(c.UserContext(), req.Prefix)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"cleared": fiber.Map{
+			"guides": cleared,
+		},
+	})
+}
+
+// missingEmbeddings handles GET /admin/repos/missing-embeddings
+func (h *AdminHandler) missingEmbeddings(c *fiber.Ctx) error {
+	repos, err := h.repoRepo.FindReposWithoutEmbeddings(c.UserContext())
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"count":        len(repos),
+		"repositories": repos,
+	})
+}
+
+// guideFeedback handles GET /admin/guide-feedback?issue_id=&limit=&offset=
+func (h *AdminHandler) guideFeedback(c *fiber.Ctx) error {
+	limit, offset, err := parsePagination(c, defaultFeedbackLimit, maxFeedbackLimit)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	feedback, total, err := h.feedbackSvc.List(c.UserContext(), c.Query("issue_id"), limit, offset)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(pageEnvelope(feedback, total, limit, offset))
+}
+
+// invalidGuides handles GET /admin/guides/invalid?prefix=&limit=&offset=,
+// listing the cached guides that break the guide format rules with what each
+// gets wrong. Every matching guide is checked on each request.
+func (h *AdminHandler) invalidGuides(c *fiber.Ctx) error {
+	limit, offset, err := parsePagination(c, defaultFeedbackLimit, maxFeedbackLimit)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	invalid, err := h.guideSvc.InvalidGuides(c.UserContext(), c.Query("prefix"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(pageEnvelope(pageSlice(invalid, limit, offset), int64(len(invalid)), limit, offset))
+}
+
+type migrateEmbeddingsRequest struct {
+	FromModel string `json:"from_model"` // optional; only migrate vectors tagged with this model
+	ToModel   string `json:"to_model" validate:"required"`
+}
+
+// migrateEmbeddings handles POST /admin/migrate-embeddings  { "from_model": "...", "to_model": "..." }
+// The migration runs in the background; poll GET /admin/migrate-embeddings.
+func (h *AdminHandler) migrateEmbeddings(c *fiber.Ctx) error {
+	var req migrateEmbeddingsRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.indexingSvc.StartMigration(req.FromModel, req.ToModel); err != nil {
+		switch {
+		case errors.Is(err, service.ErrMigrationRunning):
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		case errors.Is(err, service.ErrInvalidMigration):
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"started":    true,
+		"from_model": req.FromModel,
+		"to_model":   req.ToModel,
+	})
+}
+
+// migrationStatus handles GET /admin/migrate-embeddings
+func (h *AdminHandler) migrationStatus(c *fiber.Ctx) error {
+	progress, err := h.indexingSvc.MigrationStatus(c.UserContext())
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"running":    h.indexingSvc.Running(),
+		"migrations": progress,
+	})
+}
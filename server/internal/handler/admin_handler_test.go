@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/middleware"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeGuideCache is a GuideService whose cache is a set of guide IDs.
+type fakeGuideCache struct {
+	service.GuideService
+	ids          map[string]bool
+	hits, misses uint64
+}
+
+func (g *fakeGuideCache) CacheStats(ctx context.Context) (service.CacheStats, error) {
+	stats := service.CacheStats{Entries: int64(len(g.ids)), Hits: g.hits, Misses: g.misses}
+	if total := g.hits + g.misses; total > 0 {
+		stats.HitRatio = float64(g.hits) / float64(total)
+	}
+	return stats, nil
+}
+
+func (g *fakeGuideCache) ClearCache(ctx context.Context, prefix string) (int64, error) {
+	var n int64
+	for id := range g.ids {
+		if strings.HasPrefix(id, prefix) {
+			delete(g.ids, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+const testAdminToken = "secret"
+
+func newAdminApp(guides service.GuideService) *fiber.App {
+	h := NewAdminHandler(guides, nil, nil, nil, nil, nil)
+	return newTestApp(func(r fiber.Router) {
+		h.Register(r.Group("/admin", middleware.AdminAuth(testAdminToken)))
+	})
+}
+
+// adminRequest builds a request carrying the admin token, with an optional
+// JSON body.
+func adminRequest(method, target, body string) *http.Request {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestCacheStatsShape(t *testing.T) {
+	guides := &fakeGuideCache{ids: map[string]bool{"o/r#1": true, "o/r#2": true}, hits: 3, misses: 1}
+	app := newAdminApp(guides)
+
+	status, body := doRequest(t, app, adminRequest(http.MethodGet, "/admin/cache/stats", ""))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", status, body)
+	}
+	var got struct {
+		Caches map[string]service.CacheStats `json:"caches"`
+	}
+	decode(t, body, &got)
+	want := service.CacheStats{Entries: 2, Hits: 3, Misses: 1, HitRatio: 0.75}
+	if got.Caches["guides"] != want {
+		t.Errorf("guides stats = %+v, want %+v", got.Caches["guides"], want)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantCleared int64
+		wantLeft    []string
+	}{
+		{"everything", "", 3, nil},
+		{"by repo prefix", `{"cache":"guides","prefix":"o/r#"}`, 2, []string{"x/y#1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guides := &fakeGuideCache{ids: map[string]bool{"o/r#1": true, "o/r#2": true, "x/y#1": true}}
+			app := newAdminApp(guides)
+
+			status, body := doRequest(t, app, adminRequest(http.MethodPost, "/admin/cache/clear", tt.body))
+			if status != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", status, body)
+			}
+			var got struct {
+				Cleared map[string]int64 `json:"cleared"`
+			}
+			decode(t, body, &got)
+			if got.Cleared["guides"] != tt.wantCleared {
+				t.Errorf("cleared %d guides, want %d", got.Cleared["guides"], tt.wantCleared)
+			}
+			if len(guides.ids) != len(tt.wantLeft) {
+				t.Errorf("left %v, want %v", guides.ids, tt.wantLeft)
+			}
+			for _, id := range tt.wantLeft {
+				if !guides.ids[id] {
+					t.Errorf("%s was cleared", id)
+				}
+			}
+		})
+	}
+}
+
+func TestClearCacheRejectsUnknownCache(t *testing.T) {
+	app := newAdminApp(&fakeGuideCache{ids: map[string]bool{}})
+	status, body := doRequest(t, app, adminRequest(http.MethodPost, "/admin/cache/clear", `{"cache":"embeddings"}`))
+	if status != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400; body %s", status, body)
+	}
+}
+
+func TestCacheRoutesRequireAdminToken(t *testing.T) {
+	guides := &fakeGuideCache{ids: map[string]bool{"o/r#1": true}}
+	app := newAdminApp(guides)
+
+	for _, target := range []string{"/admin/cache/stats", "/admin/cache/clear"} {
+		method := http.MethodGet
+		if strings.HasSuffix(target, "clear") {
+			method = http.MethodPost
+		}
+		status, _ := do(t, app, method, target, nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("%s %s without token: status = %d, want 401", method, target, status)
+		}
+	}
+	if len(guides.ids) != 1 {
+		t.Error("unauthenticated clear evicted guides")
+	}
+}
+
+// fakeMissingRepos is a RepoRepository reporting missing as the repos without
+// embeddings.
+type fakeMissingRepos struct {
+	service.RepoRepository
+	missing []string
+}
+
+func (r *fakeMissingRepos) FindReposWithoutEmbeddings(ctx context.Context) ([]string, error) {
+	return r.missing, nil
+}
+
+func TestMissingEmbeddings(t *testing.T) {
+	h := NewAdminHandler(nil, nil, nil, &fakeMissingRepos{missing: []string{"b/missing", "d/missing"}}, nil, nil)
+	app := newTestApp(func(r fiber.Router) {
+		h.Register(r.Group("/admin", middleware.AdminAuth(testAdminToken)))
+	})
+
+	status, body := doRequest(t, app, adminRequest(http.MethodGet, "/admin/repos/missing-embeddings", ""))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", status, body)
+	}
+	var got struct {
+		Count        int      `json:"count"`
+		Repositories []string `json:"repositories"`
+	}
+	decode(t, body, &got)
+	if got.Count != 2 || strings.Join(got.Repositories, ",") != "b/missing,d/missing" {
+		t.Errorf("response = %+v, want the two missing repos", got)
+	}
+}
+
+func TestMigrateEmbeddingsRequiresAdminToken(t *testing.T) {
+	app := newAdminApp(&fakeGuideCache{ids: map[string]bool{}})
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		if status, _ := do(t, app, method, "/admin/migrate-embeddings", map[string]string{"to_model": "m"}); status != http.StatusUnauthorized {
+			t.Errorf("%s /admin/migrate-embeddings without token: status = %d, want 401", method, status)
+		}
+	}
+}
+
+func TestGetPrompts(t *testing.T) {
+	prompts := service.DefaultPrompts()
+	h := NewAdminHandler(nil, nil, nil, nil, prompts, nil)
+	app := newTestApp(func(r fiber.Router) {
+		h.Register(r.Group("/admin", middleware.AdminAuth(testAdminToken)))
+	})
+
+	if status, _ := do(t, app, http.MethodGet, "/admin/prompts", nil); status != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", status)
+	}
+
+	status, body := doRequest(t, app, adminRequest(http.MethodGet, "/admin/prompts", ""))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", status, body)
+	}
+	var got struct {
+		Guide      string `json:"guide"`
+		IssueGuide string `json:"issue_guide"`
+		RAG        string `json:"rag"`
+		Chat       string `json:"chat"`
+		Version    string `json:"version"`
+	}
+	decode(t, body, &got)
+	want := prompts.Current()
+	if got.Guide != want.Guide || got.IssueGuide != want.IssueGuide || got.RAG != want.RAG || got.Chat != want.Chat {
+		t.Errorf("prompts = %+v, want the active guide, issue guide, RAG and chat templates", got)
+	}
+	if got.Guide == "" || got.IssueGuide == "" || got.RAG == "" || got.Chat == "" || got.Version != want.Version {
+		t.Errorf("prompts = %+v, want every template and version %s", got, want.Version)
+	}
+}
+
+func TestReloadPrompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rag.txt")
+	if err := os.WriteFile(path, []byte("rag v1 %s %s %s %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := service.NewPromptStore(service.PromptFiles{RAG: path})
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	h := NewAdminHandler(nil, nil, nil, nil, prompts, nil)
+	app := newTestApp(func(r fiber.Router) {
+		h.Register(r.Group("/admin", middleware.AdminAuth(testAdminToken)))
+	})
+
+	if err := os.WriteFile(path, []byte("rag v2 %s %s %s %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	status, body := doRequest(t, app, adminRequest(http.MethodPost, "/admin/prompts/reload", ""))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", status, body)
+	}
+	var got struct {
+		RAG string `json:"rag"`
+	}
+	decode(t, body, &got)
+	if got.RAG != "rag v2 %s %s %s %s" || prompts.Current().RAG != "rag v2 %s %s %s %s" {
+		t.Errorf("RAG prompt = %q (store %q) after reload, want v2", got.RAG, prompts.Current().RAG)
+	}
+
+	os.Remove(path)
+	if status, _ := doRequest(t, app, adminRequest(http.MethodPost, "/admin/prompts/reload", "")); status != http.StatusUnprocessableEntity {
+		t.Errorf("reload of a missing file: status = %d, want 422", status)
+	}
+	if prompts.Current().RAG != "rag v2 %s %s %s %s" {
+		t.Errorf("RAG prompt = %q after a failed reload, want v2 kept", prompts.Current().RAG)
+	}
+}
+
+// fixedStats reports stats for every dataset stats request.
+type fixedStats []models.CollectionStats
+
+func (s fixedStats) CollectionStats(ctx context.Context) []models.CollectionStats { return s }
+
+func TestDatasetStats(t *testing.T) {
+	stats := service.NewStatsService(fixedStats{
+		{Database: "db", Collection: "repos_meta", Documents: 120, Indexes: []string{"_id_"}},
+		{Database: "federated", Collection: "repos_meta", Documents: 5000, Indexes: []string{"_id_"}},
+	}, time.Minute)
+	h := NewAdminHandler(nil, nil, nil, nil, nil, stats)
+	app := newTestApp(func(r fiber.Router) {
+		h.Register(r.Group("/admin", middleware.AdminAuth(testAdminToken)))
+	})
+
+	if status, _ := do(t, app, http.MethodGet, "/admin/stats", nil); status != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", status)
+	}
+	for i, wantCached := range []bool{false, true} {
+		status, body := doRequest(t, app, adminRequest(http.MethodGet, "/admin/stats", ""))
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body %s", status, body)
+		}
+		var got service.DatasetStats
+		decode(t, body, &got)
+		if len(got.Collections) != 2 || got.Collections[0].Documents != 120 || got.Collections[1].Database != "federated" || got.Collections[1].Documents != 5000 {
+			t.Errorf("collections = %+v, want both counts", got.Collections)
+		}
+		if got.Cached != wantCached {
+			t.Errorf("request %d: cached = %v, want %v", i+1, got.Cached, wantCached)
+		}
+	}
+}
+
+// invalidGuideList is a GuideService reporting invalid as the invalid guides,
+// filtered by ID prefix.
+type invalidGuideList struct {
+	service.GuideService
+	invalid []service.InvalidGuide
+}
+
+func (g *invalidGuideList) InvalidGuides(ctx context.Context, prefix string) ([]service.InvalidGuide, error) {
+	matched := []service.InvalidGuide{}
+	for _, ig := range g.invalid {
+		if strings.HasPrefix(ig.ID, prefix) {
+			matched = append(matched, ig)
+		}
+	}
+	return matched, nil
+}
+
+func TestInvalidGuides(t *testing.T) {
+	app := newAdminApp(&invalidGuideList{invalid: []service.InvalidGuide{
+		{ID: "o/r#2", Violations: []string{"guide is wrapped in a code fence"}},
+		{ID: "o/r#3", Violations: []string{`line 4: numbered item uses "N." instead of "N)"`}},
+		{ID: "x/y#1", Violations: []string{"missing section: Context"}},
+	}})
+
+	if status, _ := do(t, app, http.MethodGet, "/admin/guides/invalid", nil); status != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", status)
+	}
+
+	tests := []struct {
+		query     string
+		wantIDs   string
+		wantTotal int64
+		wantMore  bool
+	}{
+		{"", "o/r#2,o/r#3,x/y#1", 3, false},
+		{"?limit=2", "o/r#2,o/r#3", 3, true},
+		{"?limit=2&offset=2", "x/y#1", 3, false},
+		{"?prefix=o/r%23", "o/r#2,o/r#3", 2, false},
+	}
+	for _, tt := range tests {
+		status, body := doRequest(t, app, adminRequest(http.MethodGet, "/admin/guides/invalid"+tt.query, ""))
+		if status != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200; body %s", tt.query, status, body)
+		}
+		var got struct {
+			Items   []service.InvalidGuide `json:"items"`
+			Total   int64                  `json:"total"`
+			HasMore bool                   `json:"has_more"`
+		}
+		decode(t, body, &got)
+		var ids []string
+		for _, ig := range got.Items {
+			ids = append(ids, ig.ID)
+			if len(ig.Violations) == 0 {
+				t.Errorf("%s: %s listed without its violations", tt.query, ig.ID)
+			}
+		}
+		if strings.Join(ids, ",") != tt.wantIDs || got.Total != tt.wantTotal || got.HasMore != tt.wantMore {
+			t.Errorf("%q: got %v of %d (more %v), want %s of %d (more %v)", tt.query, ids, got.Total, got.HasMore, tt.wantIDs, tt.wantTotal, tt.wantMore)
+		}
+	}
+
+	if status, _ := doRequest(t, app, adminRequest(http.MethodGet, "/admin/guides/invalid?limit=-1", "")); status != http.StatusBadRequest {
+		t.Errorf("limit=-1: status = %d, want 400", status)
+	}
+}
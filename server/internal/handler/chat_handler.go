@@ -25,11 +25,8 @@ func (h *ChatHandler) Register(r fiber.Router) {
 // chat handles POST /chat  { "question": "...", "context_id": "..." }
 func (h *ChatHandler) chat(c *fiber.Ctx) error {
 	var req models.ChatRequest
-	if err := c.BodyParser(&req); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
-	}
-	if req.Question == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "question is required")
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Delegate to service layer.
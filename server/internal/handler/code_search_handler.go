@@ -1,61 +1,222 @@
 package handler
 
 import (
+	"github.com/ahmednasr/ai-in-action/server/internal/middleware"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
 	"github.com/ahmednasr/ai-in-action/server/internal/service"
 
+	"errors"
 	"log"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 )
 
+// fileCacheMaxAge is how long clients may cache file content responses.
+const fileCacheMaxAge = 10 * time.Minute
+
+// defaultSnippetLength is the length in characters of code search preview
+// snippets when the request does not set one; codeSearchRequest caps it.
+const defaultSnippetLength = 200
+
 type CodeSearchHandler struct {
-	repoRepo service.RepoRepository
-	embedder service.EmbeddingClient
-	codeSvc  service.CodeService
+	repoRepo       service.RepoRepository
+	embedder       service.EmbeddingClient
+	codeSvc        service.CodeService
+	maxQueryLength int
+	maxChunkLength int // chunk text longer than this is truncated; <= 0 disables
+	normalization  service.ScoreNormalization
 }
 
-func NewCodeSearchHandler(repoRepo service.RepoRepository, embedder service.EmbeddingClient, codeSvc service.CodeService) *CodeSearchHandler {
+func NewCodeSearchHandler(repoRepo service.RepoRepository, embedder service.EmbeddingClient, codeSvc service.CodeService, maxQueryLength, maxChunkLength int, normalization service.ScoreNormalization) *CodeSearchHandler {
 	return &CodeSearchHandler{
-		repoRepo: repoRepo,
-		embedder: embedder,
-		codeSvc:  codeSvc,
+		repoRepo:       repoRepo,
+		embedder:       embedder,
+		codeSvc:        codeSvc,
+		maxQueryLength: maxQueryLength,
+		maxChunkLength: maxChunkLength,
+		normalization:  normalization,
 	}
 }
 
 func (h *CodeSearchHandler) Register(r fiber.Router) {
 	r.Post("/code_search", h.codeSearch)
-	r.Get("/file/:repo_id/*", h.getFile)
+	r.Post("/code_search/preview", h.codeSearchPreview)
+	r.Get("/file/:repo_id/*", h.fileCacheControl(), etag.New(), h.getFile)
+}
+
+// fileCacheControl returns the caching middleware for file responses. They
+// are cached publicly when every repo is public; once an access checker is in
+// place, the response depends on the caller's token and must not be shared.
+func (h *CodeSearchHandler) fileCacheControl() fiber.Handler {
+	if h.codeSvc == nil || h.codeSvc.Public() {
+		return middleware.CacheControl(fileCacheMaxAge)
+	}
+	return middleware.PrivateNoStore("X-GitHub-Token")
 }
 
 type codeSearchRequest struct {
-	RepoID string `json:"repo_id"`
-	Query  string `json:"query"`
+	RepoID    string `json:"repo_id" validate:"required"`
+	Query     string `json:"query" validate:"required"`
+	Highlight bool   `json:"highlight"` // mark the lines that best match the query
+
+	// SnippetLength is the snippet size in characters for previews, at most 2000
+	SnippetLength int `json:"snippet_length" validate:"gte=0,lte=2000"`
+
+	// ChunkTypes restricts results to these chunk types ("code", "readme",
+	// "doc"); empty returns every type
+	ChunkTypes []string `json:"chunk_types" validate:"dive,oneof=code readme doc"`
+}
+
+// codeSearchResults is how many chunks a code search returns.
+const codeSearchResults = 5
+
+// search validates req, normalising its query, and returns the matching chunks.
+func (h *CodeSearchHandler) search(c *fiber.Ctx, req *codeSearchRequest) ([]models.CodeChunk, error) {
+
+	query, err := validateQuery(req.Query, h.maxQueryLength)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	req.Query = query
+
+	embedding, err := service.EmbedContext(c.UserContext(), h.embedder, req.Query)
+	if errors.Is(err, service.ErrEmbedderBusy) {
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+	}
+	if errors.Is(err, service.ErrEmbedTimeout) {
+		return nil, fiber.NewError(fiber.StatusGatewayTimeout, err.Error())
+	}
+	if errors.Is(err, service.ErrInvalidEmbedding) {
+		return nil, fiber.NewError(fiber.StatusBadGateway, err.Error())
+	}
+	if errors.Is(err, service.ErrTextTooShort) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "embedding failed: "+err.Error())
+	}
+
+	// Over-fetch when filtering by type so enough chunks survive the filter
+	k := codeSearchResults
+	if len(req.ChunkTypes) > 0 {
+		k *= 4
+	}
+	chunks, err := h.repoRepo.CodeVectorSearch(c.UserContext(), req.RepoID, embedding, k)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "vector search failed: "+err.Error())
+	}
+	chunks = service.FilterChunksByType(chunks, req.ChunkTypes)
+	if len(chunks) > codeSearchResults {
+		chunks = chunks[:codeSearchResults]
+	}
+	return chunks, nil
+}
+
+// normalizedChunkScores returns the normalized scores of chunks, or nil when
+// normalization is disabled.
+func (h *CodeSearchHandler) normalizedChunkScores(chunks []models.CodeChunk) []float64 {
+	scores := make([]float64, len(chunks))
+	for i, chunk := range chunks {
+		scores[i] = chunk.Score
+	}
+	return service.NormalizeScores(scores, h.normalization)
 }
 
 func (h *CodeSearchHandler) codeSearch(c *fiber.Ctx) error {
 	var req codeSearchRequest
-	if err := c.BodyParser(&req); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
-	if req.RepoID == "" || req.Query == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "repo_id and query are required")
+	chunks, err := h.search(c, &req)
+	if err != nil {
+		return err
 	}
 
-	embedding, err := h.embedder.Embed(req.Query)
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "embedding failed: "+err.Error())
+	var terms []string
+	if req.Highlight {
+		terms = queryTerms(req.Query)
+	}
+	resp := models.CodeSearchResponse{
+		Query:   req.Query,
+		RepoID:  req.RepoID,
+		Results: make([]models.CodeSearchResult, len(chunks)),
+	}
+	normalized := h.normalizedChunkScores(chunks)
+	for i, chunk := range chunks {
+		result := models.CodeSearchResult{
+			File:    chunk.File,
+			Content: chunk.Text,
+			Score:   chunk.Score,
+		}
+		if normalized != nil {
+			result.NormalizedScore = &normalized[i]
+		}
+		truncateResult(&result, h.maxChunkLength)
+		if req.Highlight {
+			result.Highlights = highlightLines(result.Content, terms)
+		}
+		resp.Results[i] = result
 	}
 
-	chunks, err := h.repoRepo.CodeVectorSearch(c.UserContext(), req.RepoID, embedding, 5)
+	return c.JSON(resp)
+}
+
+// codeSearchPreview handles POST /code_search/preview. It runs the same search
+// as /code_search but returns only each chunk's file, score and the first
+// snippet_length characters, for tuning retrieval.
+func (h *CodeSearchHandler) codeSearchPreview(c *fiber.Ctx) error {
+	var req codeSearchRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	snippetLength := req.SnippetLength
+	if snippetLength == 0 {
+		snippetLength = defaultSnippetLength
+	}
+
+	chunks, err := h.search(c, &req)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "vector search failed: "+err.Error())
+		return err
 	}
 
-	return c.JSON(chunks)
+	resp := models.CodeSearchPreviewResponse{
+		Query:   req.Query,
+		RepoID:  req.RepoID,
+		Results: make([]models.CodeSearchPreviewResult, len(chunks)),
+	}
+	normalized := h.normalizedChunkScores(chunks)
+	for i, chunk := range chunks {
+		snippet := chunk.Text
+		if utf8.RuneCountInString(snippet) > snippetLength {
+			snippet = string([]rune(snippet)[:snippetLength])
+		}
+		resp.Results[i] = models.CodeSearchPreviewResult{
+			File:    chunk.File,
+			Score:   chunk.Score,
+			Snippet: snippet,
+		}
+		if normalized != nil {
+			resp.Results[i].NormalizedScore = &normalized[i]
+		}
+	}
+	return c.JSON(resp)
+}
+
+// truncateResult cuts result.Content to at most maxLen characters and sets
+// Truncated when it does. Clients fetch the full file via /file.
+func truncateResult(result *models.CodeSearchResult, maxLen int) {
+	if maxLen <= 0 || utf8.RuneCountInString(result.Content) <= maxLen {
+		return
+	}
+	result.Content = string([]rune(result.Content)[:maxLen])
+	result.Truncated = true
 }
 
-// getFile handles GET /file/:repo_id/*
+// getFile handles GET /file/:repo_id/*[?ref=branch]
 func (h *CodeSearchHandler) getFile(c *fiber.Ctx) error {
 	repoID := c.Params("repo_id")
 	filePath := c.Params("*") // This captures everything after /file/:repo_id/
@@ -67,20 +228,33 @@ func (h *CodeSearchHandler) getFile(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "repo_id and file path are required")
 	}
 
-	// Remove any duplicate repo_id from the file path
-	// The file path might contain the repo_id at the start (e.g., "vuejs/vue/path/to/file")
-	// We want to remove it if it matches the repo_id
-	parts := strings.Split(filePath, "/")
-	if len(parts) >= 2 && parts[0]+"/"+parts[1] == repoID {
-		filePath = strings.Join(parts[2:], "/")
-		log.Printf("Removed duplicate repo_id from file path. New path: %s", filePath)
+	// An explicit ref reads the file from GitHub at that branch, tag or commit
+	ref := c.Query("ref")
+	if ref != "" {
+		if err := validateRef(ref); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 	}
 
-	content, err := h.codeSvc.GetFileContent(c.UserContext(), repoID, filePath)
-	if err != nil {
+	// Private-repo access checks may verify the caller's own GitHub token
+	ctx := service.WithCallerToken(c.UserContext(), c.Get("X-GitHub-Token"))
+
+	resolved, content, err := h.codeSvc.FindFileContent(ctx, repoID, filePathCandidates(repoID, filePath), ref)
+	switch {
+	case errors.Is(err, service.ErrAccessDenied):
+		log.Printf("File access denied - RepoID: %s", repoID)
+		return fiber.NewError(fiber.StatusForbidden, "access to this repository is denied")
+	case errors.Is(err, service.ErrFileNotFound):
+		log.Printf("File not found - RepoID: %s, FilePath: %s, Error: %v", repoID, filePath, err)
+		return fiber.NewError(fiber.StatusNotFound, "file not found")
+	case err != nil:
 		log.Printf("Error fetching file content - RepoID: %s, FilePath: %s, Error: %v", repoID, filePath, err)
 		return fiber.NewError(fiber.StatusInternalServerError, "failed to get file content: "+err.Error())
 	}
+	if resolved != filePath {
+		log.Printf("Resolved file path variant - RepoID: %s, Requested: %s, Resolved: %s", repoID, filePath, resolved)
+	}
+	filePath = resolved
 
 	log.Printf("Successfully retrieved file content - RepoID: %s, FilePath: %s", repoID, filePath)
 	return c.JSON(fiber.Map{
@@ -89,3 +263,20 @@ func (h *CodeSearchHandler) getFile(c *fiber.Ctx) error {
 		"file":    filePath,
 	})
 }
+
+// filePathCandidates returns the paths a file request may be stored under.
+// Stored paths are not normalised consistently: some include the repo name
+// and some do not, so the path is tried as given and then with the repo name
+// stripped, when that leaves something.
+func filePathCandidates(repoID, filePath string) []string {
+	repoName := repoID
+	if i := strings.LastIndex(repoID, "/"); i >= 0 {
+		repoName = repoID[i+1:]
+	}
+
+	candidates := []string{filePath}
+	if stripped := strings.TrimPrefix(filePath, repoName+"/"); stripped != filePath && stripped != "" {
+		candidates = append(candidates, stripped)
+	}
+	return candidates
+}
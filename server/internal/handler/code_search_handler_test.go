@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeEmbedder returns a fixed vector and records what it embedded.
+type fakeEmbedder struct {
+	vec   []float32
+	err   error
+	texts []string
+}
+
+func (f *fakeEmbedder) Embed(text string) ([]float32, error) {
+	f.texts = append(f.texts, text)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.vec == nil {
+		return []float32{0.1, 0.2, 0.3}, nil
+	}
+	return f.vec, nil
+}
+
+// fakeRepoRepo implements the RepoRepository methods the handlers use; the
+// embedded interface panics on anything else.
+type fakeRepoRepo struct {
+	service.RepoRepository
+	chunks []models.CodeChunk
+}
+
+func (f *fakeRepoRepo) CodeVectorSearch(ctx context.Context, repoID string, queryVec []float32, k int) ([]models.CodeChunk, error) {
+	return f.chunks, nil
+}
+
+func TestCodeSearchRejectsInvalidQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"whitespace only", "  \n ", "must not be empty"},
+		{"over length", strings.Repeat("q", 17), "maximum length of 16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emb := &fakeEmbedder{}
+			h := NewCodeSearchHandler(&fakeRepoRepo{}, emb, nil, 16, 0, service.NormalizeNone)
+			status, body := do(t, newTestApp(h.Register), "POST", "/code_search", map[string]any{
+				"repo_id": "octo/repo",
+				"query":   tt.query,
+			})
+			if status != fiber.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (body %s)", status, body)
+			}
+			if !strings.Contains(string(body), tt.wantErr) {
+				t.Errorf("body = %s, want it to mention %q", body, tt.wantErr)
+			}
+			if len(emb.texts) != 0 {
+				t.Errorf("embedder called with %q for an invalid query", emb.texts)
+			}
+		})
+	}
+}
+
+func TestFilePathCandidates(t *testing.T) {
+	tests := []struct {
+		name     string
+		repoID   string
+		filePath string
+		want     []string
+	}{
+		{"plain path", "octo/repo", "src/main.go", []string{"src/main.go"}},
+		{"repo name prefix", "octo/repo", "repo/src/main.go", []string{"repo/src/main.go", "src/main.go"}},
+		{"bare repo id", "repo", "repo/src/main.go", []string{"repo/src/main.go", "src/main.go"}},
+		{"prefix is the whole path", "octo/repo", "repo/", []string{"repo/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filePathCandidates(tt.repoID, tt.filePath)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("filePathCandidates(%q, %q) = %q, want %q", tt.repoID, tt.filePath, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeCodeService serves the files in its map and records every path, and
+// the refs, asked for.
+type fakeCodeService struct {
+	files     map[string]string
+	err       error // returned for every request when set
+	requested []string
+	refs      []string
+}
+
+func (f *fakeCodeService) GetFileContent(ctx context.Context, repoID, filePath, ref string) (string, error) {
+	_, content, err := f.FindFileContent(ctx, repoID, []string{filePath}, ref)
+	return content, err
+}
+
+func (f *fakeCodeService) FindFileContent(ctx context.Context, repoID string, paths []string, ref string) (string, string, error) {
+	f.requested = append(f.requested, paths...)
+	f.refs = append(f.refs, ref)
+	if f.err != nil {
+		return "", "", f.err
+	}
+	for _, path := range paths {
+		if content, ok := f.files[path]; ok {
+			return path, content, nil
+		}
+	}
+	return "", "", service.ErrFileNotFound
+}
+
+func (f *fakeCodeService) Public() bool { return true }
+
+func TestGetFileResolvesPathLayouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    string // the path under which the file exists
+		requested string
+	}{
+		{"path as given", "src/main.go", "src/main.go"},
+		{"repo name stripped", "src/main.go", "repo/src/main.go"},
+		{"stored with repo name", "repo/src/main.go", "repo/src/main.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeCodeService{files: map[string]string{tt.stored: "package main"}}
+			h := NewCodeSearchHandler(&fakeRepoRepo{}, &fakeEmbedder{}, svc, 0, 0, service.NormalizeNone)
+			status, body := do(t, newTestApp(h.Register), "GET", "/file/repo/"+tt.requested, nil)
+			if status != fiber.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", status, body)
+			}
+			var resp struct {
+				Content string `json:"content"`
+				File    string `json:"file"`
+			}
+			decode(t, body, &resp)
+			if resp.Content != "package main" || resp.File != tt.stored {
+				t.Errorf("got file %q content %q, want file %q", resp.File, resp.Content, tt.stored)
+			}
+		})
+	}
+}
+
+func TestGetFileReportsUnresolvedPath(t *testing.T) {
+	svc := &fakeCodeService{files: map[string]string{}}
+	h := NewCodeSearchHandler(&fakeRepoRepo{}, &fakeEmbedder{}, svc, 0, 0, service.NormalizeNone)
+	status, body := do(t, newTestApp(h.Register), "GET", "/file/repo/repo/missing.go", nil)
+	if status != fiber.StatusNotFound {
+		t.Fatalf("status = %d, want 404 (body %s)", status, body)
+	}
+	if strings.Join(svc.requested, ",") != "repo/missing.go,missing.go" {
+		t.Errorf("tried %q, want every layout in order", svc.requested)
+	}
+}
+
+func TestGetFileReportsBackendError(t *testing.T) {
+	svc := &fakeCodeService{err: errors.New("storage unavailable")}
+	h := NewCodeSearchHandler(&fakeRepoRepo{}, &fakeEmbedder{}, svc, 0, 0, service.NormalizeNone)
+	status, body := do(t, newTestApp(h.Register), "GET", "/file/repo/src/main.go", nil)
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 (body %s)", status, body)
+	}
+}
+
+func TestGetFileETagRoundTrip(t *testing.T) {
+	svc := &fakeCodeService{files: map[string]string{"src/main.go": "package main"}}
+	h := NewCodeSearchHandler(&fakeRepoRepo{}, &fakeEmbedder{}, svc, 0, 0, service.NormalizeNone)
+	assertETagRoundTrip(t, newTestApp(h.Register), "/file/repo/src/main.go", "public, max-age=600")
+}
+
+func TestCodeSearchTruncatesOversizedChunks(t *testing.T) {
+	big := strings.Repeat("é", 50) // multi-byte, so truncation must count runes
+	repos := &fakeRepoRepo{chunks: []models.CodeChunk{
+		{File: "big.go", Text: big, Score: 0.9},
+		{File: "small.go", Text: "package small", Score: 0.8},
+	}}
+	h := NewCodeSearchHandler(repos, &fakeEmbedder{}, nil, 100, 20, service.NormalizeNone)
+
+	status, body := do(t, newTestApp(h.Register), "POST", "/code_search", map[string]any{
+		"repo_id": "octo/repo",
+		"query":   "parse",
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var resp models.CodeSearchResponse
+	decode(t, body, &resp)
+	if len(resp.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(resp.Results))
+	}
+	if got := resp.Results[0]; got.Content != strings.Repeat("é", 20) || !got.Truncated {
+		t.Errorf("big chunk = %q (truncated %v), want its first 20 characters, flagged", got.Content, got.Truncated)
+	}
+	if got := resp.Results[1]; got.Content != "package small" || got.Truncated {
+		t.Errorf("small chunk = %q (truncated %v), want it whole and unflagged", got.Content, got.Truncated)
+	}
+}
+
+func TestCodeSearchResponseShape(t *testing.T) {
+	repos := &fakeRepoRepo{chunks: []models.CodeChunk{
+		{ID: "internal-id", RepoID: "octo/repo", File: "parse.go", Text: "func Parse() {}", Score: 0.875, ChunkType: models.ChunkTypeCode},
+	}}
+	h := NewCodeSearchHandler(repos, &fakeEmbedder{}, nil, 100, 0, service.NormalizeNone)
+
+	status, body := do(t, newTestApp(h.Register), "POST", "/code_search", map[string]any{
+		"repo_id": "octo/repo",
+		"query":   " parse ",
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got struct {
+		Query   string           `json:"query"`
+		RepoID  string           `json:"repo_id"`
+		Results []map[string]any `json:"results"`
+	}
+	decode(t, body, &got)
+	if got.Query != "parse" || got.RepoID != "octo/repo" {
+		t.Errorf("envelope = %q, %q; want the trimmed query and the repo", got.Query, got.RepoID)
+	}
+	if len(got.Results) != 1 {
+		t.Fatalf("got %d results, want 1", len(got.Results))
+	}
+	result := got.Results[0]
+	want := map[string]any{"file": "parse.go", "content": "func Parse() {}", "score": 0.875, "truncated": false}
+	for key, value := range want {
+		if result[key] != value {
+			t.Errorf("result[%q] = %v, want %v", key, result[key], value)
+		}
+	}
+	for _, internal := range []string{"id", "_id", "text", "repo_id", "chunk_type"} {
+		if _, ok := result[internal]; ok {
+			t.Errorf("result exposes storage field %q: %v", internal, result)
+		}
+	}
+}
+
+// denyAccess is an AccessChecker refusing every repo, recording the caller's
+// token it was asked about.
+type denyAccess struct {
+	repoID, token string
+}
+
+func (d *denyAccess) CanAccess(ctx context.Context, repoID string) (bool, error) {
+	d.repoID, d.token = repoID, service.CallerToken(ctx)
+	return false, nil
+}
+
+func TestGetFileDeniedByAccessChecker(t *testing.T) {
+	checker := &denyAccess{}
+	// fakeRepoRepo panics if the file is read, so a 403 proves nothing was served
+	codeSvc := service.NewCodeService(&fakeRepoRepo{}, nil, checker)
+	h := NewCodeSearchHandler(&fakeRepoRepo{}, &fakeEmbedder{}, codeSvc, 0, 0, service.NormalizeNone)
+
+	req := httptest.NewRequest("GET", "/file/octo/private/src/main.go", nil)
+	req.Header.Set("X-GitHub-Token", "ghp_caller")
+	resp, err := newTestApp(h.Register).Test(req, -1)
+	if err != nil {
+		t.Fatalf("GET %s: %v", req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("status = %d, want 403 (body %s)", resp.StatusCode, body)
+	}
+	// Access depends on the caller, so no shared cache may keep the response
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != "private, no-store" {
+		t.Errorf("Cache-Control = %q, want private, no-store", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderVary); got != "X-GitHub-Token" {
+		t.Errorf("Vary = %q, want X-GitHub-Token", got)
+	}
+	if strings.Contains(string(body), "package") {
+		t.Errorf("denied response leaks content: %s", body)
+	}
+	if checker.repoID != "octo" || checker.token != "ghp_caller" {
+		t.Errorf("checker asked about %q with token %q, want octo with the caller's token", checker.repoID, checker.token)
+	}
+}
+
+func TestGetFileRef(t *testing.T) {
+	svc := &fakeCodeService{files: map[string]string{"src/main.go": "package main"}}
+	h := NewCodeSearchHandler(&fakeRepoRepo{}, &fakeEmbedder{}, svc, 0, 0, service.NormalizeNone)
+	app := newTestApp(h.Register)
+
+	if status, body := do(t, app, "GET", "/file/repo/src/main.go?ref=release/1.2", nil); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	if len(svc.refs) == 0 || svc.refs[0] != "release/1.2" {
+		t.Errorf("refs = %q, want release/1.2 passed through", svc.refs)
+	}
+
+	svc.requested = nil
+	if status, _ := do(t, app, "GET", "/file/repo/src/main.go?ref=..%2Fmain", nil); status != fiber.StatusBadRequest {
+		t.Errorf("invalid ref: status = %d, want 400", status)
+	}
+	if len(svc.requested) != 0 {
+		t.Errorf("invalid ref reached the service: %q", svc.requested)
+	}
+}
+
+func TestCodeSearchNormalizesScores(t *testing.T) {
+	repos := &fakeRepoRepo{chunks: []models.CodeChunk{
+		{File: "a.go", Text: "package a", Score: 0.9},
+		{File: "b.go", Text: "package b", Score: 0.6},
+		{File: "c.go", Text: "package c", Score: 0.3},
+	}}
+	h := NewCodeSearchHandler(repos, &fakeEmbedder{}, nil, 100, 0, service.NormalizeMinMax)
+
+	status, body := do(t, newTestApp(h.Register), "POST", "/code_search", map[string]any{
+		"repo_id": "octo/repo",
+		"query":   "package",
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var resp models.CodeSearchResponse
+	decode(t, body, &resp)
+	want := []float64{1, 0.5, 0}
+	for i, r := range resp.Results {
+		if r.NormalizedScore == nil || math.Abs(*r.NormalizedScore-want[i]) > 1e-9 {
+			t.Errorf("%s normalized score = %v, want %v", r.File, r.NormalizedScore, want[i])
+		}
+	}
+}
+
+func TestCodeSearchPreviewShape(t *testing.T) {
+	long := strings.Repeat("é", defaultSnippetLength+50)
+	repos := &fakeRepoRepo{chunks: []models.CodeChunk{
+		{ID: "internal-id", RepoID: "octo/repo", File: "big.go", Text: long, Score: 0.9, ChunkType: models.ChunkTypeCode},
+		{File: "small.go", Text: "package small", Score: 0.8},
+	}}
+	h := NewCodeSearchHandler(repos, &fakeEmbedder{}, nil, 100, 0, service.NormalizeNone)
+	app := newTestApp(h.Register)
+
+	status, body := do(t, app, "POST", "/code_search/preview", map[string]any{"repo_id": "octo/repo", "query": "parse"})
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got struct {
+		Query   string           `json:"query"`
+		RepoID  string           `json:"repo_id"`
+		Results []map[string]any `json:"results"`
+	}
+	decode(t, body, &got)
+	if got.Query != "parse" || got.RepoID != "octo/repo" || len(got.Results) != 2 {
+		t.Fatalf("preview = %+v, want both chunks for the query", got)
+	}
+	for _, r := range got.Results {
+		for key := range r {
+			if key != "file" && key != "score" && key != "snippet" {
+				t.Errorf("result has %q; want only file, score and snippet", key)
+			}
+		}
+	}
+	if snippet := got.Results[0]["snippet"]; snippet != strings.Repeat("é", defaultSnippetLength) {
+		t.Errorf("snippet is %d characters, want the first %d", len([]rune(snippet.(string))), defaultSnippetLength)
+	}
+	if got.Results[0]["file"] != "big.go" || got.Results[0]["score"] != 0.9 || got.Results[1]["snippet"] != "package small" {
+		t.Errorf("results = %v, want file, score and snippet of each chunk", got.Results)
+	}
+
+	status, body = do(t, app, "POST", "/code_search/preview", map[string]any{"repo_id": "octo/repo", "query": "parse", "snippet_length": 5})
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	decode(t, body, &got)
+	if got.Results[0]["snippet"] != "ééééé" {
+		t.Errorf("snippet = %v, want the first 5 characters", got.Results[0]["snippet"])
+	}
+	if status, _ := do(t, app, "POST", "/code_search/preview", map[string]any{"repo_id": "octo/repo", "query": "parse", "snippet_length": 2001}); status != fiber.StatusBadRequest {
+		t.Errorf("snippet_length 2001: status = %d, want 400", status)
+	}
+}
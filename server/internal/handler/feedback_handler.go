@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FeedbackHandler wires HTTP → FeedbackService.
+type FeedbackHandler struct {
+	svc service.FeedbackService
+}
+
+// NewFeedbackHandler creates a FeedbackHandler instance.
+func NewFeedbackHandler(svc service.FeedbackService) *FeedbackHandler {
+	return &FeedbackHandler{svc: svc}
+}
+
+// Register mounts POST /issues/:id/guide/feedback on the given router group.
+func (h *FeedbackHandler) Register(r fiber.Router) {
+	r.Post("/issues/:id/guide/feedback", h.recordFeedback)
+}
+
+type feedbackRequest struct {
+	Rating  string `json:"rating" validate:"required,oneof=up down"`
+	Comment string `json:"comment"` // optional
+}
+
+// recordFeedback handles POST /issues/:id/guide/feedback  { "rating": "up", "comment": "..." }
+func (h *FeedbackHandler) recordFeedback(c *fiber.Ctx) error {
+	issueID := issueIDParam(c)
+	if issueID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "issue id is required")
+	}
+
+	var req feedbackRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	fb, err := h.svc.Record(c.UserContext(), issueID, req.Rating, req.Comment)
+	if errors.Is(err, service.ErrInvalidFeedback) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fb)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/middleware"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// memFeedback is a FeedbackRepository keeping feedback in insertion order.
+type memFeedback struct {
+	feedback []models.GuideFeedback
+}
+
+func (r *memFeedback) Record(ctx context.Context, fb models.GuideFeedback) error {
+	r.feedback = append(r.feedback, fb)
+	return nil
+}
+
+func (r *memFeedback) List(ctx context.Context, issueID string, limit, offset int) ([]models.GuideFeedback, int64, error) {
+	var matched []models.GuideFeedback
+	for _, fb := range r.feedback {
+		if issueID == "" || fb.IssueID == issueID {
+			matched = append(matched, fb)
+		}
+	}
+	return pageSlice(matched, limit, offset), int64(len(matched)), nil
+}
+
+func newFeedbackApp(repo *memFeedback) *fiber.App {
+	svc := service.NewFeedbackService(repo)
+	admin := NewAdminHandler(nil, svc, nil, nil, nil, nil)
+	return newTestApp(func(r fiber.Router) {
+		NewFeedbackHandler(svc).Register(r)
+		admin.Register(r.Group("/admin", middleware.AdminAuth(testAdminToken)))
+	})
+}
+
+func TestRecordAndReadFeedback(t *testing.T) {
+	repo := &memFeedback{}
+	app := newFeedbackApp(repo)
+
+	for _, rating := range []string{"up", "down", "up"} {
+		status, body := do(t, app, http.MethodPost, "/issues/o%2Fr%231/guide/feedback", map[string]string{"rating": rating, "comment": "thanks"})
+		if status != fiber.StatusCreated {
+			t.Fatalf("POST feedback: status = %d, want 201 (body %s)", status, body)
+		}
+	}
+	if status, _ := do(t, app, http.MethodPost, "/issues/o%2Fr%232/guide/feedback", map[string]string{"rating": "down"}); status != fiber.StatusCreated {
+		t.Fatalf("POST feedback for o/r#2: status = %d, want 201", status)
+	}
+	if len(repo.feedback) != 4 || repo.feedback[0].IssueID != "o/r#1" || repo.feedback[0].Comment != "thanks" {
+		t.Fatalf("stored %+v, want four entries starting with o/r#1's", repo.feedback)
+	}
+
+	status, body := doRequest(t, app, adminRequest(http.MethodGet, "/admin/guide-feedback?issue_id=o/r%231&limit=2", ""))
+	if status != fiber.StatusOK {
+		t.Fatalf("GET feedback: status = %d, want 200 (body %s)", status, body)
+	}
+	var got struct {
+		Items   []models.GuideFeedback `json:"items"`
+		Total   int64                  `json:"total"`
+		HasMore bool                   `json:"has_more"`
+	}
+	decode(t, body, &got)
+	if len(got.Items) != 2 || got.Total != 3 || !got.HasMore || got.Items[0].Rating != "up" {
+		t.Errorf("feedback page = %+v, want 2 of o/r#1's 3 ratings", got)
+	}
+}
+
+func TestRecordFeedbackRejectsBadRating(t *testing.T) {
+	repo := &memFeedback{}
+	app := newFeedbackApp(repo)
+
+	for _, body := range []map[string]string{{"rating": "meh"}, {}} {
+		if status, resp := do(t, app, http.MethodPost, "/issues/o%2Fr%231/guide/feedback", body); status != fiber.StatusBadRequest {
+			t.Errorf("POST %v: status = %d, want 400 (body %s)", body, status, resp)
+		}
+	}
+	if status, _ := do(t, app, http.MethodPost, "/issues/not-an-issue/guide/feedback", map[string]string{"rating": "up"}); status != fiber.StatusBadRequest {
+		t.Errorf("malformed issue ID: status = %d, want 400", status)
+	}
+	if len(repo.feedback) != 0 {
+		t.Errorf("stored %d invalid entries", len(repo.feedback))
+	}
+}
+
+func TestGuideFeedbackRequiresAdminToken(t *testing.T) {
+	app := newFeedbackApp(&memFeedback{})
+	if status, _ := do(t, app, http.MethodGet, "/admin/guide-feedback", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+}
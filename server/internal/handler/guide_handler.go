@@ -1,36 +1,233 @@
 package handler
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
 	"github.com/ahmednasr/ai-in-action/server/internal/service"
 	"github.com/gofiber/fiber/v2"
 )
 
 // GuideHandler wires HTTP → GuideService.
 type GuideHandler struct {
-	svc service.GuideService
+	svc         service.GuideService
+	idempotency fiber.Handler // replays guide generations retried with the same Idempotency-Key
 }
 
 // NewGuideHandler creates a GuideHandler instance.
-func NewGuideHandler(svc service.GuideService) *GuideHandler {
-	return &GuideHandler{svc: svc}
+func NewGuideHandler(svc service.GuideService, idempotency fiber.Handler) *GuideHandler {
+	return &GuideHandler{svc: svc, idempotency: idempotency}
+}
+
+// issueIDParam returns the :id route parameter. Issue IDs ("owner/repo#N")
+// must be percent-encoded in the path, and Fiber doesn't decode parameters.
+func issueIDParam(c *fiber.Ctx) string {
+	id := c.Params("id")
+	if decoded, err := url.PathUnescape(id); err == nil {
+		return decoded
+	}
+	return id
 }
 
-// Register mounts GET /issues/:id/guide on the given router group.
+// Register mounts the issue guide, summary and validation routes on the given router group.
+// GET /issues/:id/guide generates a missing guide, so it takes an
+// Idempotency-Key like the POST generation routes; the stream route can't be
+// replayed and relies on the guide cache instead.
 func (h *GuideHandler) Register(r fiber.Router) {
-	r.Get("/issues/:id/guide", h.getGuide)
+	r.Get("/issues/:id/guide", h.idempotency, h.getGuide)
+	r.Get("/issues/:id/guide/stream", h.streamGuide)
+	r.Get("/issues/:id/guide/export", h.exportGuide)
+	r.Get("/issues/:id/summary", h.getSummary)
+	r.Get("/issues/:id/validate", h.validateIssue)
+	r.Get("/repos/:owner/:name/guides", h.listGuides)
 }
 
-// getGuide handles GET /issues/:id/guide
+// listGuides handles GET /repos/:owner/:name/guides?from=&to=
+// from and to are RFC 3339 timestamps or YYYY-MM-DD dates (midnight UTC);
+// guides created at or after from and before to are returned, newest first.
+func (h *GuideHandler) listGuides(c *fiber.Ctx) error {
+	owner := c.Params("owner")
+	repoName := c.Params("name")
+	if owner == "" || repoName == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "owner and repository name are required")
+	}
+
+	from, err := queryTime(c, "from")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return fiber.NewError(fiber.StatusBadRequest, "from must be before to")
+	}
+
+	guides, err := h.svc.ListGuides(c.UserContext(), owner+"/"+repoName, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"guides": guides})
+}
+
+// getGuide handles GET /issues/:id/guide[?section=how-to-fix][&format=html][&refresh=true]
+// format=html returns the guide (or section) markdown rendered as sanitized
+// HTML instead of JSON. refresh=true refetches the issue and regenerates the
+// guide instead of serving the cached one.
 func (h *GuideHandler) getGuide(c *fiber.Ctx) error {
-	issueID := c.Params("id")
+	issueID := issueIDParam(c)
 	if issueID == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "issue id is required")
 	}
+	format := c.Query("format", "markdown")
+	if format != "markdown" && format != "html" {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be markdown or html")
+	}
 
-	guide, err := h.svc.GetGuide(c.UserContext(), issueID)
+	getGuide := h.svc.GetGuide
+	if c.QueryBool("refresh") {
+		getGuide = h.svc.RefreshGuide
+	}
+	guide, err := getGuide(c.UserContext(), issueID)
 	if err != nil {
+		if errors.Is(err, service.ErrRepoNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if errors.Is(err, service.ErrLLMBusy) {
+			return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+		}
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
 
+	// Optionally return a single section so the UI can lazy-load the rest
+	if slug := c.Query("section"); slug != "" {
+		section, ok := service.FindGuideSection(guide.Answer, slug)
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "guide has no section "+slug+"; expected one of "+strings.Join(service.GuideSectionSlugs, ", "))
+		}
+		if format == "html" {
+			return sendGuideHTML(c, section.Content)
+		}
+		return c.JSON(fiber.Map{
+			"id":      guide.ID,
+			"section": section,
+		})
+	}
+
+	if format == "html" {
+		return sendGuideHTML(c, guide.Answer)
+	}
 	return c.JSON(guide)
 }
+
+// sendGuideHTML responds with md rendered as sanitized HTML.
+func sendGuideHTML(c *fiber.Ctx, md string) error {
+	html, err := service.RenderGuideHTML(md)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to render guide: "+err.Error())
+	}
+	c.Type("html", "utf-8")
+	return c.SendString(html)
+}
+
+// exportGuide handles GET /issues/:id/guide/export
+// It returns the stored guide together with the sources and prompt it was
+// generated from, for offline review; it never generates a guide.
+func (h *GuideHandler) exportGuide(c *fiber.Ctx) error {
+	issueID := issueIDParam(c)
+	if issueID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "issue id is required")
+	}
+
+	export, err := h.svc.ExportGuide(c.UserContext(), issueID)
+	if err != nil {
+		if errors.Is(err, service.ErrGuideNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(export)
+}
+
+// streamGuide handles GET /issues/:id/guide/stream
+// It answers with Server-Sent Events named after the generation stages (see
+// service.GuideEvent), ending with a "done" event carrying the guide, or an
+// "error" event if generation fails.
+func (h *GuideHandler) streamGuide(c *fiber.Ctx) error {
+	issueID := issueIDParam(c)
+	if _, err := service.ParseIssueRef(issueID); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The handler returns before the body is written, so the generation gets
+	// its own context, canceled when the client goes away
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.UserContext()))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		send := func(event string, data any) {
+			b, err := json.Marshal(data)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+			if err := w.Flush(); err != nil {
+				cancel()
+			}
+		}
+
+		_, err := h.svc.StreamGuide(ctx, issueID, func(ev service.GuideEvent) {
+			send(ev.Stage, ev)
+		})
+		if err != nil && ctx.Err() == nil {
+			send("error", fiber.Map{"error": err.Error()})
+		}
+	})
+	return nil
+}
+
+// getSummary handles GET /issues/:id/summary
+func (h *GuideHandler) getSummary(c *fiber.Ctx) error {
+	issueID := issueIDParam(c)
+	if issueID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "issue id is required")
+	}
+
+	summary, err := h.svc.SummarizeIssue(c.UserContext(), issueID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"id":      issueID,
+		"summary": summary,
+	})
+}
+
+// validateIssue handles GET /issues/:id/validate[?check_issue=false]
+// It is a cheap pre-flight check before requesting a guide: the ID is parsed,
+// the repo looked up in the dataset and, unless check_issue=false, the issue
+// looked up on GitHub.
+func (h *GuideHandler) validateIssue(c *fiber.Ctx) error {
+	issueID := issueIDParam(c)
+	if issueID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "issue id is required")
+	}
+
+	result, err := h.svc.ValidateIssue(c.UserContext(), issueID, c.QueryBool("check_issue", true))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(result)
+}
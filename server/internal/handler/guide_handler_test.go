@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeGuideService serves guides from a map, or fails with err; the embedded
+// interface panics on methods the tests don't use.
+type fakeGuideService struct {
+	service.GuideService
+	guides    map[string]models.Guide
+	err       error
+	requested []string
+	refreshed []string
+}
+
+func (f *fakeGuideService) GetGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	f.requested = append(f.requested, issueID)
+	if f.err != nil {
+		return models.Guide{}, f.err
+	}
+	return f.guides[issueID], nil
+}
+
+func (f *fakeGuideService) RefreshGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	f.refreshed = append(f.refreshed, issueID)
+	return f.guides[issueID], nil
+}
+
+func (f *fakeGuideService) ExportGuide(ctx context.Context, issueID string) (models.GuideExport, error) {
+	guide, ok := f.guides[issueID]
+	if !ok {
+		return models.GuideExport{}, service.ErrGuideNotFound
+	}
+	return models.GuideExport{Guide: guide, Sources: guide.Sources, Prompt: guide.Prompt}, nil
+}
+
+const sectionedGuide = "## Context\nThe parser panics.\n\n## How to Fix\n1) Check for empty input.\n\n## Notes\nNone."
+
+func newGuideApp(guides *fakeGuideService) *fiber.App {
+	return newTestApp(NewGuideHandler(guides, passThrough).Register)
+}
+
+func TestGetGuideSection(t *testing.T) {
+	guides := &fakeGuideService{guides: map[string]models.Guide{"o/r#1": {ID: "o/r#1", Answer: sectionedGuide}}}
+	app := newGuideApp(guides)
+
+	status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide?section=how-to-fix", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got struct {
+		ID      string               `json:"id"`
+		Section service.GuideSection `json:"section"`
+	}
+	decode(t, body, &got)
+	want := service.GuideSection{Slug: "how-to-fix", Title: "How to Fix", Content: "1) Check for empty input."}
+	if got.ID != "o/r#1" || got.Section != want {
+		t.Errorf("response = %+v, want the how-to-fix section of o/r#1", got)
+	}
+	if len(guides.requested) != 1 || guides.requested[0] != "o/r#1" {
+		t.Errorf("requested guides %q, want the decoded issue ID", guides.requested)
+	}
+
+	status, body = do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide?section=example", nil)
+	if status != fiber.StatusNotFound {
+		t.Errorf("missing section: status = %d, want 404 (body %s)", status, body)
+	}
+}
+
+func TestGetGuideWholeGuide(t *testing.T) {
+	app := newGuideApp(&fakeGuideService{guides: map[string]models.Guide{"o/r#1": {ID: "o/r#1", Answer: sectionedGuide}}})
+
+	status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got models.Guide
+	decode(t, body, &got)
+	if got.Answer != sectionedGuide {
+		t.Errorf("answer = %q, want the whole guide", got.Answer)
+	}
+}
+
+func TestGetGuideHTML(t *testing.T) {
+	answer := sectionedGuide + "\n\n<script>alert('xss')</script>\n\n[docs](javascript:alert(1))"
+	app := newGuideApp(&fakeGuideService{guides: map[string]models.Guide{"o/r#1": {ID: "o/r#1", Answer: answer}}})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/issues/o%2Fr%231/guide?format=html", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	html := string(b)
+	if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("status %d, content type %q; want 200 text/html", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(html, "How to Fix</h2>") || !strings.Contains(html, "Check for empty input.") {
+		t.Errorf("HTML lacks the rendered guide:\n%s", html)
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "javascript:") {
+		t.Errorf("HTML keeps the script:\n%s", html)
+	}
+
+	status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide?section=how-to-fix&format=html", nil)
+	if status != fiber.StatusOK || strings.Contains(string(body), "<h2") || !strings.Contains(string(body), "Check for empty input.") {
+		t.Errorf("section HTML: status %d, body %s; want only the how-to-fix section", status, body)
+	}
+
+	status, body = do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide", nil)
+	if status != fiber.StatusOK || !strings.HasPrefix(string(body), "{") {
+		t.Errorf("default format: status %d, body %s; want the JSON guide", status, body)
+	}
+	if status, _ := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide?format=pdf", nil); status != fiber.StatusBadRequest {
+		t.Errorf("format=pdf: status = %d, want 400", status)
+	}
+}
+
+func TestGetGuideMetadata(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	app := newGuideApp(&fakeGuideService{guides: map[string]models.Guide{"o/r#1": {
+		ID: "o/r#1", Answer: sectionedGuide, CreatedAt: created,
+		Model: "gemini-2.0-flash", PromptVersion: "v3",
+		TokenUsage: &models.TokenUsage{PromptTokens: 900, CompletionTokens: 300, TotalTokens: 1200},
+	}}})
+
+	status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got models.Guide
+	decode(t, body, &got)
+	if got.Model != "gemini-2.0-flash" || got.PromptVersion != "v3" || !got.CreatedAt.Equal(created) {
+		t.Errorf("guide = %+v, want its model, prompt version and timestamp", got)
+	}
+	if got.TokenUsage == nil || got.TokenUsage.TotalTokens != 1200 || got.TokenUsage.PromptTokens != 900 {
+		t.Errorf("token usage = %+v, want the stored usage", got.TokenUsage)
+	}
+}
+
+func TestExportGuide(t *testing.T) {
+	sources := []models.GuideSource{{RepoID: "o/r", FilePath: "parse.go", Content: "func Parse() {}", Relevance: 0.8}}
+	app := newGuideApp(&fakeGuideService{guides: map[string]models.Guide{"o/r#1": {
+		ID: "o/r#1", Answer: sectionedGuide, Sources: sources, Prompt: "Write a guide for o/r#1",
+	}}})
+
+	status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide/export", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var export models.GuideExport
+	decode(t, body, &export)
+	if export.Guide.ID != "o/r#1" || export.Guide.Answer != sectionedGuide {
+		t.Errorf("exported guide = %+v, want the stored guide", export.Guide)
+	}
+	if !reflect.DeepEqual(export.Sources, sources) || export.Prompt != "Write a guide for o/r#1" {
+		t.Errorf("exported context = %+v / %q, want the stored sources and prompt", export.Sources, export.Prompt)
+	}
+
+	// The plain guide route keeps the context out of its response
+	_, body = do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide", nil)
+	if strings.Contains(string(body), "parse.go") || strings.Contains(string(body), "Write a guide") {
+		t.Errorf("guide response exposes the stored context: %s", body)
+	}
+
+	if status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%232/guide/export", nil); status != fiber.StatusNotFound {
+		t.Errorf("export of an ungenerated guide: status = %d, want 404 (body %s)", status, body)
+	}
+}
+
+func TestGetGuideRefresh(t *testing.T) {
+	guides := &fakeGuideService{guides: map[string]models.Guide{"o/r#1": {ID: "o/r#1", Answer: sectionedGuide}}}
+	app := newGuideApp(guides)
+
+	for _, query := range []string{"", "?refresh=false", "?refresh=true"} {
+		if status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide"+query, nil); status != fiber.StatusOK {
+			t.Fatalf("guide%s: status = %d, want 200 (body %s)", query, status, body)
+		}
+	}
+	if len(guides.requested) != 2 || len(guides.refreshed) != 1 || guides.refreshed[0] != "o/r#1" {
+		t.Errorf("GetGuide %q, RefreshGuide %q; want only refresh=true to refresh", guides.requested, guides.refreshed)
+	}
+}
+
+func TestGetGuideRepoNotFound(t *testing.T) {
+	app := newGuideApp(&fakeGuideService{err: fmt.Errorf("%w: o/missing", service.ErrRepoNotFound)})
+
+	status, body := do(t, app, http.MethodGet, "/issues/o%2Fmissing%231/guide", nil)
+	if status != fiber.StatusNotFound {
+		t.Fatalf("status = %d, want 404 (body %s)", status, body)
+	}
+	if !strings.Contains(string(body), "repository not found in dataset") {
+		t.Errorf("body = %q, want the user-facing not-found message", body)
+	}
+}
+
+// rangeGuideService records the window it was asked to list.
+type rangeGuideService struct {
+	service.GuideService
+	repoID   string
+	from, to time.Time
+}
+
+func (f *rangeGuideService) ListGuides(ctx context.Context, repoID string, from, to time.Time) ([]models.GuideSummary, error) {
+	f.repoID, f.from, f.to = repoID, from, to
+	return []models.GuideSummary{{ID: repoID + "#1", IssueTitle: "Parser crash", CreatedAt: from}}, nil
+}
+
+func TestListGuidesDateRange(t *testing.T) {
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		from, to   time.Time
+	}{
+		{"dates", "?from=2026-03-01&to=2026-04-01", http.StatusOK, march, april},
+		{"timestamps", "?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z", http.StatusOK, march, april},
+		{"open ended", "?from=2026-03-01", http.StatusOK, march, time.Time{}},
+		{"no window", "", http.StatusOK, time.Time{}, time.Time{}},
+		{"empty window", "?from=2026-03-01&to=2026-03-01", http.StatusBadRequest, time.Time{}, time.Time{}},
+		{"reversed window", "?from=2026-04-01&to=2026-03-01", http.StatusBadRequest, time.Time{}, time.Time{}},
+		{"bad date", "?from=March", http.StatusBadRequest, time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guides := &rangeGuideService{}
+			app := newTestApp(NewGuideHandler(guides, passThrough).Register)
+
+			status, body := do(t, app, http.MethodGet, "/repos/o/r/guides"+tt.query, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", status, tt.wantStatus, body)
+			}
+			if status != http.StatusOK {
+				if guides.repoID != "" {
+					t.Error("an invalid window reached the service")
+				}
+				return
+			}
+			if guides.repoID != "o/r" || !guides.from.Equal(tt.from) || !guides.to.Equal(tt.to) {
+				t.Errorf("listed %s in [%v, %v), want o/r in [%v, %v)", guides.repoID, guides.from, guides.to, tt.from, tt.to)
+			}
+			var got struct {
+				Guides []models.GuideSummary `json:"guides"`
+			}
+			decode(t, body, &got)
+			if len(got.Guides) != 1 || got.Guides[0].ID != "o/r#1" || got.Guides[0].IssueTitle != "Parser crash" {
+				t.Errorf("guides = %+v, want the o/r#1 summary", got.Guides)
+			}
+		})
+	}
+}
+
+// streamingGuideService replays events from StreamGuide, then fails with err
+// when set.
+type streamingGuideService struct {
+	service.GuideService
+	events []service.GuideEvent
+	err    error
+}
+
+func (f *streamingGuideService) StreamGuide(ctx context.Context, issueID string, progress func(service.GuideEvent)) (models.Guide, error) {
+	for _, ev := range f.events {
+		progress(ev)
+	}
+	return models.Guide{}, f.err
+}
+
+func TestStreamGuideEvents(t *testing.T) {
+	guide := &models.Guide{ID: "o/r#1", Answer: "1) Read main.go"}
+	tests := []struct {
+		name       string
+		svc        *streamingGuideService
+		wantEvents []string
+	}{
+		{"generated", &streamingGuideService{events: []service.GuideEvent{
+			{Stage: service.GuideStageFetchingIssue},
+			{Stage: service.GuideStageRetrievingContext},
+			{Stage: service.GuideStageGenerating},
+			{Stage: service.GuideStageGenerating, Text: "1) Read main.go"},
+			{Stage: service.GuideStageDone, Guide: guide},
+		}}, []string{"fetching_issue", "retrieving_context", "generating", "generating", "done"}},
+		{"failed", &streamingGuideService{
+			events: []service.GuideEvent{{Stage: service.GuideStageFetchingIssue}},
+			err:    fmt.Errorf("github down"),
+		}, []string{"fetching_issue", "error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(NewGuideHandler(tt.svc, passThrough).Register)
+			req := httptest.NewRequest(http.MethodGet, "/issues/o%2Fr%231/guide/stream", nil)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("Content-Type = %q, want text/event-stream", ct)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			var events, data []string
+			for _, line := range strings.Split(string(body), "\n") {
+				if name, ok := strings.CutPrefix(line, "event: "); ok {
+					events = append(events, name)
+				} else if d, ok := strings.CutPrefix(line, "data: "); ok {
+					data = append(data, d)
+				}
+			}
+			if strings.Join(events, ",") != strings.Join(tt.wantEvents, ",") {
+				t.Errorf("events = %q, want %q", events, tt.wantEvents)
+			}
+			last := data[len(data)-1]
+			if tt.svc.err != nil {
+				if !strings.Contains(last, "github down") {
+					t.Errorf("error event data = %s, want the failure", last)
+				}
+				return
+			}
+			var done service.GuideEvent
+			decode(t, []byte(last), &done)
+			if done.Guide == nil || done.Guide.Answer != guide.Answer {
+				t.Errorf("done event = %s, want the guide", last)
+			}
+		})
+	}
+}
+
+func TestStreamGuideRejectsBadIssueID(t *testing.T) {
+	app := newTestApp(NewGuideHandler(&streamingGuideService{}, passThrough).Register)
+	if status, _ := do(t, app, http.MethodGet, "/issues/not-an-issue/guide/stream", nil); status != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", status)
+	}
+}
+
+func TestGetGuideIsIdempotent(t *testing.T) {
+	var wrapped []string
+	idempotency := func(c *fiber.Ctx) error {
+		wrapped = append(wrapped, c.Path())
+		return c.Next()
+	}
+	guides := &fakeGuideService{guides: map[string]models.Guide{"o/r#1": {ID: "o/r#1", Answer: "guide"}}}
+	app := newTestApp(NewGuideHandler(guides, idempotency).Register)
+
+	if status, body := do(t, app, http.MethodGet, "/issues/o%2Fr%231/guide", nil); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", status, body)
+	}
+	if len(wrapped) != 1 || wrapped[0] != "/issues/o%2Fr%231/guide" {
+		t.Errorf("idempotency ran for %q, want the guide route", wrapped)
+	}
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -10,17 +11,20 @@ import (
 type HealthHandler struct {
 	mainDB      *mongo.Client
 	federatedDB *mongo.Client
+	readiness   *service.Readiness
 }
 
-func NewHealthHandler(mainDB, federatedDB *mongo.Client) *HealthHandler {
+func NewHealthHandler(mainDB, federatedDB *mongo.Client, readiness *service.Readiness) *HealthHandler {
 	return &HealthHandler{
 		mainDB:      mainDB,
 		federatedDB: federatedDB,
+		readiness:   readiness,
 	}
 }
 
 func (h *HealthHandler) Register(r fiber.Router) {
 	r.Get("/health", h.health)
+	r.Get("/ready", h.ready)
 }
 
 func (h *HealthHandler) health(c *fiber.Ctx) error {
@@ -35,6 +39,19 @@ func (h *HealthHandler) health(c *fiber.Ctx) error {
 	return c.JSON(status)
 }
 
+// ready handles GET /ready; it returns 503 until warm-up has completed so a
+// load balancer can hold traffic on cold start.
+func (h *HealthHandler) ready(c *fiber.Ctx) error {
+	if !h.readiness.Ready() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "warming_up",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status": "ready",
+	})
+}
+
 func (h *HealthHandler) checkDB(client *mongo.Client) string {
 	if client == nil {
 		return "not_configured"
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// maxHighlights caps the ranges returned per chunk so a chunk that matches
+// everywhere doesn't highlight everything.
+const maxHighlights = 5
+
+// highlightStopwords are query words too common to signal relevance.
+var highlightStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "does": true, "do": true, "for": true, "from": true,
+	"how": true, "in": true, "is": true, "it": true, "of": true, "on": true,
+	"or": true, "the": true, "this": true, "to": true, "what": true,
+	"where": true, "which": true, "with": true,
+}
+
+// queryTerms splits a query into distinct lower-case terms, dropping
+// stopwords and single characters.
+func queryTerms(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	seen := map[string]bool{}
+	terms := []string{}
+	for _, f := range fields {
+		if len(f) < 2 || highlightStopwords[f] || seen[f] {
+			continue
+		}
+		seen[f] = true
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// highlightLines returns the line ranges of text that share the most terms
+// with the query. A line qualifies when it contains at least half as many
+// distinct terms as the best line; adjacent qualifying lines are merged and
+// the highest-scoring ranges are returned in line order.
+func highlightLines(text string, terms []string) []models.LineRange {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	lines := strings.Split(text, "\n")
+	scores := make([]int, len(lines))
+	best := 0
+	for i, line := range lines {
+		lower := strings.ToLower(line)
+		for _, t := range terms {
+			if strings.Contains(lower, t) {
+				scores[i]++
+			}
+		}
+		if scores[i] > best {
+			best = scores[i]
+		}
+	}
+	if best == 0 {
+		return nil
+	}
+
+	threshold := (best + 1) / 2
+	type scoredRange struct {
+		models.LineRange
+		score int
+	}
+	var ranges []scoredRange
+	for i, score := range scores {
+		if score < threshold {
+			continue
+		}
+		line := i + 1 // 1-based
+		if n := len(ranges); n > 0 && ranges[n-1].End == line-1 {
+			ranges[n-1].End = line
+			ranges[n-1].score += score
+			continue
+		}
+		ranges = append(ranges, scoredRange{LineRange: models.LineRange{Start: line, End: line}, score: score})
+	}
+
+	if len(ranges) > maxHighlights {
+		sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].score > ranges[j].score })
+		ranges = ranges[:maxHighlights]
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	}
+
+	out := make([]models.LineRange, len(ranges))
+	for i, r := range ranges {
+		out[i] = r.LineRange
+	}
+	return out
+}
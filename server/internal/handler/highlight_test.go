@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+func TestQueryTerms(t *testing.T) {
+	got := queryTerms("How does the Router handle a 404 route? router_test x")
+	want := []string{"router", "handle", "404", "route", "router_test"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("queryTerms = %q, want %q", got, want)
+	}
+}
+
+func TestHighlightLines(t *testing.T) {
+	chunk := strings.Join([]string{
+		"package router",                         // 1: router
+		"",                                       // 2
+		"func (r *Router) Handle(path string) {", // 3: router, handle
+		"\tr.routes[path] = handler",             // 4: handle (in "handler")
+		"}",                                      // 5
+		"",                                       // 6
+		"func notFound() int { return 404 }",     // 7: 404
+	}, "\n")
+
+	tests := []struct {
+		name  string
+		terms []string
+		want  []models.LineRange
+	}{
+		{"no terms", nil, nil},
+		{"no match", []string{"database"}, nil},
+		{"adjacent lines merge", []string{"handle"}, []models.LineRange{{Start: 3, End: 4}}},
+		{"weak lines are dropped", []string{"router", "handle", "path"}, []models.LineRange{{Start: 3, End: 4}}},
+		{"half the best score qualifies", []string{"router", "handle", "404"}, []models.LineRange{{Start: 1, End: 1}, {Start: 3, End: 4}, {Start: 7, End: 7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightLines(chunk, tt.terms); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("highlightLines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightLinesCapsRanges(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2*maxHighlights; i++ {
+		lines = append(lines, fmt.Sprintf("retry(%d)", i), "")
+	}
+	lines[16] = "retry with backoff" // line 17 is the best match
+
+	got := highlightLines(strings.Join(lines, "\n"), []string{"retry", "backoff"})
+	if len(got) != maxHighlights {
+		t.Fatalf("got %d ranges, want %d", len(got), maxHighlights)
+	}
+	found := false
+	for i, r := range got {
+		if r.Start == 17 {
+			found = true
+		}
+		if i > 0 && r.Start <= got[i-1].Start {
+			t.Errorf("ranges %v are not in line order", got)
+		}
+	}
+	if !found {
+		t.Errorf("ranges %v dropped the best line 17", got)
+	}
+}
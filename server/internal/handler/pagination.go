@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Page sizes for the list endpoints.
+const (
+	defaultReposLimit    = 100
+	maxReposLimit        = 100
+	defaultSearchLimit   = 30 // the search service returns at most 30 matches
+	maxSearchLimit       = 30
+	maxIssuesLimit       = 100 // one page of GitHub issues
+	defaultFilesLimit    = 100
+	maxFilesLimit        = 500
+	defaultFeedbackLimit = 50
+	maxFeedbackLimit     = 200
+	defaultBatchK        = 10
+	maxBatchQueries      = 10 // queries per POST /search/batch
+)
+
+// parsePagination reads ?limit and ?offset. A missing or zero limit selects
+// defaultLimit and larger values are capped at maxLimit; negative or
+// non-numeric values are rejected.
+func parsePagination(c *fiber.Ctx, defaultLimit, maxLimit int) (limit, offset int, err error) {
+	limit, err = queryInt(c, "limit")
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err = queryInt(c, "offset")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch {
+	case limit == 0:
+		limit = defaultLimit
+	case limit > maxLimit:
+		limit = maxLimit
+	}
+	return limit, offset, nil
+}
+
+// queryInt parses a non-negative integer query parameter; missing means 0.
+func queryInt(c *fiber.Ctx, key string) (int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+// queryTime parses an RFC 3339 timestamp or YYYY-MM-DD date (midnight UTC)
+// query parameter; missing means the zero time.
+func queryTime(c *fiber.Ctx, key string) (time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", key)
+}
+
+// pageEnvelope is the response shape shared by every list endpoint:
+//
+//	{ "items": [...], "total": N, "limit": L, "offset": O, "has_more": bool }
+func pageEnvelope(items any, total int64, limit, offset int) fiber.Map {
+	return fiber.Map{
+		"items":    items,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": int64(offset+limit) < total,
+	}
+}
+
+// pageSlice returns the [offset, offset+limit) window of items, for lists
+// that are already fully in memory.
+func pageSlice[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
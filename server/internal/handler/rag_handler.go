@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
@@ -9,64 +10,120 @@ import (
 )
 
 type RAGHandler struct {
-	ragService *service.RAGService
+	ragService  *service.RAGService
+	idempotency fiber.Handler // replays generations retried with the same Idempotency-Key
 }
 
-func NewRAGHandler(ragService *service.RAGService) *RAGHandler {
+func NewRAGHandler(ragService *service.RAGService, idempotency fiber.Handler) *RAGHandler {
 	return &RAGHandler{
-		ragService: ragService,
+		ragService:  ragService,
+		idempotency: idempotency,
 	}
 }
 
 func (h *RAGHandler) RegisterRoutes(app *fiber.App) {
-	app.Post("/api/v1/rag", h.HandleRAG)
-	app.Post("/api/v1/guide", h.GenerateGuide)
+	app.Post("/api/v1/rag", h.idempotency, h.HandleRAG)
+	app.Post("/api/v1/rag/retrieve", h.Retrieve)
+	app.Post("/api/v1/guide", h.idempotency, h.GenerateGuide)
 }
 
 func (h *RAGHandler) HandleRAG(c *fiber.Ctx) error {
 	var req service.RAGRequest
-	if err := c.BodyParser(&req); err != nil {
-		log.Printf("Failed to parse request body: %v", err)
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	if err := parseBody(c, &req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		return err
 	}
 
 	log.Printf("Received RAG request: %+v", req)
 
-	if req.Query == "" {
-		log.Printf("Empty query received")
-		return fiber.NewError(fiber.StatusBadRequest, "Query cannot be empty")
-	}
-
 	resp, err := h.ragService.GenerateResponse(c.Context(), req)
 	if err != nil {
-		log.Printf("Error generating response: %v", err)
-		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Error generating response: %v", err))
+		return ragError(err, "Error generating response")
 	}
 
 	log.Printf("Generated response: %+v", resp)
-	return c.JSON(resp)
+	return sendRAGResponse(c, resp, req.WantsSources())
 }
 
-func (h *RAGHandler) GenerateGuide(c *fiber.Ctx) error {
+// Retrieve returns the sources vector search finds for a RAG query without
+// running the LLM, so retrieval quality can be inspected on its own.
+func (h *RAGHandler) Retrieve(c *fiber.Ctx) error {
 	var req service.RAGRequest
-	if err := c.BodyParser(&req); err != nil {
-		log.Printf("Failed to parse request body: %v", err)
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	if err := parseBody(c, &req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		return err
 	}
 
-	log.Printf("Received guide request: %+v", req)
+	log.Printf("Received retrieve request: %+v", req)
 
-	if req.Query == "" {
-		log.Printf("Empty query received")
-		return fiber.NewError(fiber.StatusBadRequest, "Query cannot be empty")
+	sources, err := h.ragService.Retrieve(c.Context(), req)
+	if err != nil {
+		return ragError(err, "Error retrieving sources")
 	}
 
+	log.Printf("Retrieved %d sources", len(sources))
+	return c.JSON(fiber.Map{
+		"sources": sources,
+	})
+}
+
+func (h *RAGHandler) GenerateGuide(c *fiber.Ctx) error {
+	var req service.RAGRequest
+	if err := parseBody(c, &req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		return err
+	}
+
+	log.Printf("Received guide request: %+v", req)
+
 	resp, err := h.ragService.GenerateGuide(c.Context(), req)
 	if err != nil {
-		log.Printf("Error generating guide: %v", err)
-		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Error generating guide: %v", err))
+		return ragError(err, "Error generating guide")
 	}
 
 	log.Printf("Generated guide: %+v", resp)
+	return sendRAGResponse(c, resp, req.WantsSources())
+}
+
+// ragErrorStatus maps an error from the RAG service to the HTTP status it is
+// reported with.
+func ragErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrEmbedderBusy), errors.Is(err, service.ErrLLMBusy):
+		return fiber.StatusServiceUnavailable
+	case errors.Is(err, service.ErrEmbedTimeout):
+		return fiber.StatusGatewayTimeout
+	case errors.Is(err, service.ErrInvalidEmbedding):
+		return fiber.StatusBadGateway
+	case errors.Is(err, service.ErrTextTooShort), errors.Is(err, service.ErrInvalidRAGRequest):
+		return fiber.StatusBadRequest
+	}
+	return fiber.StatusInternalServerError
+}
+
+// ragError turns a RAG service error into a Fiber error with the status from
+// ragErrorStatus. Unexpected errors are logged and prefixed with action.
+func ragError(err error, action string) error {
+	status := ragErrorStatus(err)
+	if status != fiber.StatusInternalServerError {
+		return fiber.NewError(status, err.Error())
+	}
+	log.Printf("%s: %v", action, err)
+	return fiber.NewError(status, fmt.Sprintf("%s: %v", action, err))
+}
+
+// ragResponseWithoutSources hides RAGResponse.Sources: the outer field
+// shadows the embedded one and, being nil, is omitted.
+type ragResponseWithoutSources struct {
+	*service.RAGResponse
+	Sources []service.Source `json:"sources,omitempty"`
+}
+
+// sendRAGResponse writes resp, leaving out the sources field entirely when
+// the client asked for include_sources=false.
+func sendRAGResponse(c *fiber.Ctx, resp *service.RAGResponse, includeSources bool) error {
+	if !includeSources {
+		return c.JSON(ragResponseWithoutSources{RAGResponse: resp})
+	}
 	return c.JSON(resp)
 }
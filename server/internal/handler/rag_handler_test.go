@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRAGErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{service.ErrEmbedderBusy, fiber.StatusServiceUnavailable},
+		{service.ErrLLMBusy, fiber.StatusServiceUnavailable},
+		{service.ErrEmbedTimeout, fiber.StatusGatewayTimeout},
+		{service.ErrInvalidEmbedding, fiber.StatusBadGateway},
+		{service.ErrTextTooShort, fiber.StatusBadRequest},
+		{service.ErrInvalidRAGRequest, fiber.StatusBadRequest},
+		{fmt.Errorf("failed to embed query: %w", service.ErrEmbedderBusy), fiber.StatusServiceUnavailable},
+		{errors.New("mongo exploded"), fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := ragErrorStatus(tt.err); got != tt.want {
+			t.Errorf("ragErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// passThrough stands in for the idempotency middleware.
+func passThrough(c *fiber.Ctx) error { return c.Next() }
+
+// newRAGApp serves the RAG routes over a service whose embedder is e. The
+// service has no collections, so only requests that fail before vector
+// search can be sent.
+func newRAGApp(e service.Embedder) *fiber.App {
+	svc := service.NewRAGService(nil, nil, e, nil, nil, 0, "")
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	NewRAGHandler(svc, passThrough).RegisterRoutes(app)
+	return app
+}
+
+func TestRAGRoutesMapEmbedderBusyTo503(t *testing.T) {
+	app := newRAGApp(&fakeEmbedder{err: service.ErrEmbedderBusy})
+	for _, route := range []string{"/api/v1/rag", "/api/v1/rag/retrieve"} {
+		status, body := do(t, app, "POST", route, map[string]string{"query": "how are jobs scheduled?"})
+		if status != fiber.StatusServiceUnavailable {
+			t.Errorf("POST %s status = %d, want 503 (body %s)", route, status, body)
+		}
+	}
+}
+
+func TestRAGRejectsTooManySources(t *testing.T) {
+	app := newRAGApp(&fakeEmbedder{err: service.ErrEmbedderBusy})
+	status, body := do(t, app, "POST", "/api/v1/rag", map[string]interface{}{"query": "how are jobs scheduled?", "max_sources": 21})
+	if status != fiber.StatusBadRequest {
+		t.Errorf("max_sources 21: status = %d, want 400 (body %s)", status, body)
+	}
+}
+
+func TestSendRAGResponseOmitsSources(t *testing.T) {
+	resp := &service.RAGResponse{Answer: "Look at a.go", TotalSources: 1, Sources: []service.Source{{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}"}}}
+	app := newTestApp(func(r fiber.Router) {
+		r.Get("/rag", func(c *fiber.Ctx) error {
+			return sendRAGResponse(c, resp, c.QueryBool("include_sources", true))
+		})
+	})
+
+	for _, tt := range []struct {
+		query       string
+		wantSources bool
+	}{{"", true}, {"?include_sources=false", false}} {
+		status, body := do(t, app, "GET", "/rag"+tt.query, nil)
+		if status != fiber.StatusOK {
+			t.Fatalf("status = %d, want 200 (body %s)", status, body)
+		}
+		var got map[string]interface{}
+		decode(t, body, &got)
+		if _, ok := got["sources"]; ok != tt.wantSources {
+			t.Errorf("rag%s: sources present = %v, want %v (body %s)", tt.query, ok, tt.wantSources, body)
+		}
+		if got["answer"] != "Look at a.go" || got["total_sources"] != 1.0 {
+			t.Errorf("rag%s: body %s, want the answer and total_sources", tt.query, body)
+		}
+	}
+	if len(resp.Sources) != 1 {
+		t.Error("omitting the sources modified the response")
+	}
+}
@@ -1,10 +1,37 @@
 package handler
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/middleware"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
 	"github.com/ahmednasr/ai-in-action/server/internal/service"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/etag"
+)
+
+// repoCacheMaxAge is how long clients may cache repository metadata responses.
+const repoCacheMaxAge = 5 * time.Minute
+
+// Bounds for the k parameter of the context-chunks endpoint.
+const (
+	defaultContextChunks = 20 // what guide generation uses
+	maxContextChunks     = 100
 )
 
+// Bounds for the per_language parameter of the by-language endpoint.
+const (
+	defaultReposPerLanguage = 5
+	maxReposPerLanguage     = 50
+)
+
+// maxClosedWithinDays caps how far back the issues endpoint looks for
+// recently closed issues.
+const maxClosedWithinDays = 90
+
 // RepoHandler wires HTTP → RepoService.
 type RepoHandler struct {
 	svc service.RepoService
@@ -15,11 +42,19 @@ func NewRepoHandler(svc service.RepoService) *RepoHandler {
 	return &RepoHandler{svc: svc}
 }
 
-// Register mounts GET /repos/:id and GET /repos/:owner/:name/issues on the supplied router group.
+// Register mounts the repository routes (metadata, issues, languages, stats
+// and file search) on the supplied router group.
 func (h *RepoHandler) Register(r fiber.Router) {
-	r.Get("/repos/:id", h.getRepo)
-	r.Get("/repos/:owner/:name", h.getRepoByOwnerName)
+	r.Get("/repos/by-language", middleware.CacheControl(repoCacheMaxAge), etag.New(), h.getReposByLanguage)
+	r.Get("/repos/by-github-id/:github_id", middleware.CacheControl(repoCacheMaxAge), etag.New(), h.getRepoByGitHubID)
+	r.Get("/repos/:id", middleware.CacheControl(repoCacheMaxAge), etag.New(), h.getRepo)
+	r.Get("/repos/:owner/:name", middleware.CacheControl(repoCacheMaxAge), etag.New(), h.getRepoByOwnerName)
+	r.Get("/repos/:owner/:name/overview", h.getOverview)
 	r.Get("/repos/:owner/:name/issues", h.getIssues)
+	r.Get("/repos/:owner/:name/languages", h.getLanguages)
+	r.Get("/repos/:owner/:name/stats", h.getStats)
+	r.Get("/repos/:owner/:name/files/search", h.searchFiles)
+	r.Get("/repos/:owner/:name/context-chunks", h.getContextChunks)
 }
 
 // getRepo handles GET /repos/:id
@@ -37,6 +72,44 @@ func (h *RepoHandler) getRepo(c *fiber.Ctx) error {
 	return c.JSON(detail)
 }
 
+// getRepoByGitHubID handles GET /repos/by-github-id/:github_id
+func (h *RepoHandler) getRepoByGitHubID(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("github_id"), 10, 64)
+	if err != nil || id <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "github_id must be a positive integer")
+	}
+
+	repo, err := h.svc.GetRepoByGitHubID(c.UserContext(), id)
+	if errors.Is(err, service.ErrRepoNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(repo)
+}
+
+// getReposByLanguage handles GET /repos/by-language?per_language=
+func (h *RepoHandler) getReposByLanguage(c *fiber.Ctx) error {
+	perLanguage, err := queryInt(c, "per_language")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if perLanguage == 0 {
+		perLanguage = defaultReposPerLanguage
+	}
+	if perLanguage > maxReposPerLanguage {
+		return fiber.NewError(fiber.StatusBadRequest, "per_language must be at most "+strconv.Itoa(maxReposPerLanguage))
+	}
+
+	buckets, err := h.svc.ReposByLanguage(c.UserContext(), perLanguage)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"languages": buckets})
+}
+
 // getRepoByOwnerName handles GET /repos/:owner/:name
 func (h *RepoHandler) getRepoByOwnerName(c *fiber.Ctx) error {
 	owner := c.Params("owner")
@@ -54,7 +127,30 @@ func (h *RepoHandler) getRepoByOwnerName(c *fiber.Ctx) error {
 	return c.JSON(detail)
 }
 
-// getIssues handles GET /repos/:owner/:name/issues
+// getOverview handles GET /repos/:owner/:name/overview
+// Sections that could not be loaded are listed in the response's errors.
+func (h *RepoHandler) getOverview(c *fiber.Ctx) error {
+	owner := c.Params("owner")
+	repoName := c.Params("name")
+
+	if owner == "" || repoName == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "owner and repository name are required")
+	}
+
+	overview, err := h.svc.GetRepoOverview(c.UserContext(), owner, repoName)
+	if errors.Is(err, service.ErrRepoNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(overview)
+}
+
+// getIssues handles GET /repos/:owner/:name/issues?limit=&offset=&closed_within_days=
+// With closed_within_days the open issues are followed by those closed in
+// the last N days.
 func (h *RepoHandler) getIssues(c *fiber.Ctx) error {
 	owner := c.Params("owner")
 	repoName := c.Params("name")
@@ -63,10 +159,129 @@ func (h *RepoHandler) getIssues(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "owner and repository name are required")
 	}
 
-	issues, err := h.svc.ListRepoIssues(c.UserContext(), owner, repoName, "open", 100) // Default to open issues, 100 per page
+	limit, offset, err := parsePagination(c, maxIssuesLimit, maxIssuesLimit)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	closedWithinDays, err := queryInt(c, "closed_within_days")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if closedWithinDays > maxClosedWithinDays {
+		return fiber.NewError(fiber.StatusBadRequest, "closed_within_days must be at most "+strconv.Itoa(maxClosedWithinDays))
+	}
+
+	var issues []models.Issue
+	if closedWithinDays > 0 {
+		closedWithin := time.Duration(closedWithinDays) * 24 * time.Hour
+		issues, err = h.svc.ListActionableIssues(c.UserContext(), owner, repoName, closedWithin, maxIssuesLimit)
+	} else {
+		issues, err = h.svc.ListRepoIssues(c.UserContext(), owner, repoName, "open", maxIssuesLimit) // Default to open issues, 100 per page
+	}
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(issues)
+	return c.JSON(pageEnvelope(pageSlice(issues, limit, offset), int64(len(issues)), limit, offset))
+}
+
+// getLanguages handles GET /repos/:owner/:name/languages
+func (h *RepoHandler) getLanguages(c *fiber.Ctx) error {
+	owner := c.Params("owner")
+	repoName := c.Params("name")
+
+	if owner == "" || repoName == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "owner and repository name are required")
+	}
+
+	languages, err := h.svc.GetRepoLanguages(c.UserContext(), owner, repoName)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(languages)
+}
+
+// getStats handles GET /repos/:owner/:name/stats
+func (h *RepoHandler) getStats(c *fiber.Ctx) error {
+	owner := c.Params("owner")
+	name := c.Params("name")
+	if owner == "" || name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "owner and name are required")
+	}
+
+	stats, err := h.svc.GetRepoStats(c.UserContext(), owner+"/"+name)
+	if errors.Is(err, service.ErrRepoNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(stats)
+}
+
+// searchFiles handles GET /repos/:owner/:name/files/search?name=router&limit=&offset=
+func (h *RepoHandler) searchFiles(c *fiber.Ctx) error {
+	owner := c.Params("owner")
+	name := c.Params("name")
+	if owner == "" || name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "owner and name are required")
+	}
+	pattern := strings.TrimSpace(c.Query("name"))
+	if pattern == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing query parameter 'name'")
+	}
+	limit, offset, err := parsePagination(c, defaultFilesLimit, maxFilesLimit)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	files, err := h.svc.SearchFiles(c.UserContext(), owner+"/"+name, pattern)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(pageEnvelope(pageSlice(files, limit, offset), int64(len(files)), limit, offset))
+}
+
+// getContextChunks handles GET /repos/:owner/:name/context-chunks?k=20&offset=
+// It lists the chunks guide generation treats as top context for the repo,
+// to help explain which files a guide refers to.
+func (h *RepoHandler) getContextChunks(c *fiber.Ctx) error {
+	owner := c.Params("owner")
+	name := c.Params("name")
+	if owner == "" || name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "owner and name are required")
+	}
+
+	k := defaultContextChunks
+	if raw := c.Query("k"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxContextChunks {
+			return fiber.NewError(fiber.StatusBadRequest, "k must be an integer between 1 and "+strconv.Itoa(maxContextChunks))
+		}
+		k = n
+	}
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	repoID := owner + "/" + name
+	chunks, err := h.svc.GetContextChunks(c.UserContext(), repoID, k, offset)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if chunks == nil {
+		chunks = []models.CodeChunk{}
+	}
+
+	return c.JSON(fiber.Map{
+		"repo_id": repoID,
+		"k":       k,
+		"offset":  offset,
+		"chunks":  chunks,
+	})
 }
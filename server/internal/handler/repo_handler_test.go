@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeRepoService implements the RepoService methods the tests use; the
+// embedded interface panics on anything else.
+type fakeRepoService struct {
+	service.RepoService
+	detail service.RepoSDetail
+	err    error
+}
+
+func (f *fakeRepoService) GetRepo(ctx context.Context, repoID string) (service.RepoSDetail, error) {
+	return f.detail, f.err
+}
+
+// assertETagRoundTrip fetches target, then fetches it again with the ETag it
+// got and expects 304 Not Modified; both responses must be cacheable.
+func assertETagRoundTrip(t *testing.T, app *fiber.App, target, wantCacheControl string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", target, nil), -1)
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", target, resp.StatusCode)
+	}
+	etag := resp.Header.Get(fiber.HeaderETag)
+	if etag == "" {
+		t.Fatalf("GET %s returned no ETag", target)
+	}
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != wantCacheControl {
+		t.Errorf("GET %s Cache-Control = %q, want %q", target, got, wantCacheControl)
+	}
+
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set(fiber.HeaderIfNoneMatch, etag)
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("conditional GET %s: %v", target, err)
+	}
+	if resp.StatusCode != fiber.StatusNotModified {
+		t.Errorf("conditional GET %s status = %d, want 304", target, resp.StatusCode)
+	}
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != wantCacheControl {
+		t.Errorf("conditional GET %s Cache-Control = %q, want %q", target, got, wantCacheControl)
+	}
+
+	req = httptest.NewRequest("GET", target, nil)
+	req.Header.Set(fiber.HeaderIfNoneMatch, `"stale"`)
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("stale conditional GET %s: %v", target, err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("GET %s with a stale ETag status = %d, want 200", target, resp.StatusCode)
+	}
+}
+
+func TestGetRepoETagRoundTrip(t *testing.T) {
+	svc := &fakeRepoService{detail: service.RepoSDetail{Repo: models.Repo{ID: "octo/repo", Name: "repo"}}}
+	app := newTestApp(NewRepoHandler(svc).Register)
+	assertETagRoundTrip(t, app, "/repos/repo", "public, max-age=300")
+}
+
+// statsRepoService reports stats, or err, for every repo.
+type statsRepoService struct {
+	service.RepoService
+	stats service.RepoStats
+	err   error
+}
+
+func (f *statsRepoService) GetRepoStats(ctx context.Context, repoID string) (service.RepoStats, error) {
+	f.stats.RepoID = repoID
+	return f.stats, f.err
+}
+
+func TestGetStatsStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"found", nil, fiber.StatusOK},
+		{"missing repo", fmt.Errorf("%w: o/missing", service.ErrRepoNotFound), fiber.StatusNotFound},
+		{"database failure", errors.New("connection reset"), fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(NewRepoHandler(&statsRepoService{err: tt.err}).Register)
+			if status, body := do(t, app, "GET", "/repos/o/missing/stats", nil); status != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", status, tt.want, body)
+			}
+		})
+	}
+}
+
+// filesRepoService returns files as the matches of every file search.
+type filesRepoService struct {
+	service.RepoService
+	files   []string
+	repoID  string
+	pattern string
+}
+
+func (f *filesRepoService) SearchFiles(ctx context.Context, repoID, pattern string) ([]string, error) {
+	f.repoID, f.pattern = repoID, pattern
+	return f.files, nil
+}
+
+func TestSearchFiles(t *testing.T) {
+	svc := &filesRepoService{files: []string{"a/router.go", "b/router.go", "c/router.go"}}
+	app := newTestApp(NewRepoHandler(svc).Register)
+
+	status, body := do(t, app, "GET", "/repos/o/r/files/search?name=router*.go&limit=2", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	if svc.repoID != "o/r" || svc.pattern != "router*.go" {
+		t.Errorf("searched %s for %q, want o/r for router*.go", svc.repoID, svc.pattern)
+	}
+	var got struct {
+		Items   []string `json:"items"`
+		Total   int64    `json:"total"`
+		HasMore bool     `json:"has_more"`
+	}
+	decode(t, body, &got)
+	if len(got.Items) != 2 || got.Total != 3 || !got.HasMore {
+		t.Errorf("page = %+v, want 2 of 3 files with more", got)
+	}
+
+	if status, _ := do(t, app, "GET", "/repos/o/r/files/search?name=%20", nil); status != fiber.StatusBadRequest {
+		t.Errorf("blank name: status = %d, want 400", status)
+	}
+}
+
+// chunksRepoService returns chunks, highest score first as the repository
+// does, for every context-chunks request.
+type chunksRepoService struct {
+	service.RepoService
+	chunks    []models.CodeChunk
+	repoID    string
+	k, offset int
+}
+
+func (f *chunksRepoService) GetContextChunks(ctx context.Context, repoID string, k, offset int) ([]models.CodeChunk, error) {
+	f.repoID, f.k, f.offset = repoID, k, offset
+	return f.chunks, nil
+}
+
+func TestGetContextChunks(t *testing.T) {
+	svc := &chunksRepoService{chunks: []models.CodeChunk{
+		{ID: "c1", File: "auth/login.go", Score: 0.92},
+		{ID: "c2", File: "README.md", Score: 0.81},
+		{ID: "c3", File: "auth/session.go", Score: 0.4},
+	}}
+	app := newTestApp(NewRepoHandler(svc).Register)
+
+	status, body := do(t, app, "GET", "/repos/o/r/context-chunks", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got struct {
+		RepoID string             `json:"repo_id"`
+		K      int                `json:"k"`
+		Chunks []models.CodeChunk `json:"chunks"`
+	}
+	decode(t, body, &got)
+	if got.RepoID != "o/r" || svc.repoID != "o/r" || got.K != defaultContextChunks || svc.k != defaultContextChunks {
+		t.Errorf("repo %q k %d (service got %q, %d), want o/r with the default k", got.RepoID, got.K, svc.repoID, svc.k)
+	}
+	if len(got.Chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(got.Chunks))
+	}
+	for i, want := range []string{"auth/login.go", "README.md", "auth/session.go"} {
+		if got.Chunks[i].File != want || got.Chunks[i].Score != svc.chunks[i].Score {
+			t.Errorf("chunk %d = %s (%.2f), want %s (%.2f)", i, got.Chunks[i].File, got.Chunks[i].Score, want, svc.chunks[i].Score)
+		}
+	}
+	for i := 1; i < len(got.Chunks); i++ {
+		if got.Chunks[i].Score > got.Chunks[i-1].Score {
+			t.Errorf("chunks not in score order: %+v", got.Chunks)
+		}
+	}
+}
+
+func TestGetContextChunksRejectsBadK(t *testing.T) {
+	app := newTestApp(NewRepoHandler(&chunksRepoService{}).Register)
+	for _, k := range []string{"0", "101", "many"} {
+		if status, _ := do(t, app, "GET", "/repos/o/r/context-chunks?k="+k, nil); status != fiber.StatusBadRequest {
+			t.Errorf("k=%s: status = %d, want 400", k, status)
+		}
+	}
+}
+
+// languagesRepoService returns buckets for every by-language request,
+// recording the per-language limit it was given.
+type languagesRepoService struct {
+	service.RepoService
+	buckets     []models.LanguageBucket
+	perLanguage int
+}
+
+func (f *languagesRepoService) ReposByLanguage(ctx context.Context, perLanguage int) ([]models.LanguageBucket, error) {
+	f.perLanguage = perLanguage
+	return f.buckets, nil
+}
+
+func TestGetReposByLanguage(t *testing.T) {
+	buckets := []models.LanguageBucket{
+		{Language: "Go", Count: 3, Repos: []models.Repo{{ID: "a/cli", FullName: "a/cli"}}},
+		{Language: "", Count: 1, Repos: []models.Repo{{ID: "d/docs", FullName: "d/docs"}}},
+	}
+	tests := []struct {
+		query       string
+		wantStatus  int
+		wantPerLang int
+	}{
+		{"", fiber.StatusOK, defaultReposPerLanguage},
+		{"?per_language=2", fiber.StatusOK, 2},
+		{"?per_language=50", fiber.StatusOK, 50},
+		{"?per_language=51", fiber.StatusBadRequest, 0},
+		{"?per_language=-1", fiber.StatusBadRequest, 0},
+		{"?per_language=many", fiber.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			svc := &languagesRepoService{buckets: buckets}
+			app := newTestApp(NewRepoHandler(svc).Register)
+
+			status, body := do(t, app, "GET", "/repos/by-language"+tt.query, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", status, tt.wantStatus, body)
+			}
+			if svc.perLanguage != tt.wantPerLang {
+				t.Errorf("per language = %d, want %d", svc.perLanguage, tt.wantPerLang)
+			}
+			if status != fiber.StatusOK {
+				return
+			}
+			var got struct {
+				Languages []models.LanguageBucket `json:"languages"`
+			}
+			decode(t, body, &got)
+			if len(got.Languages) != 2 || got.Languages[0].Language != "Go" || got.Languages[0].Count != 3 || got.Languages[1].Repos[0].FullName != "d/docs" {
+				t.Errorf("languages = %+v, want both buckets", got.Languages)
+			}
+		})
+	}
+}
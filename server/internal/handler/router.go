@@ -1,26 +1,65 @@
 package handler
 
 import (
+	"github.com/ahmednasr/ai-in-action/server/internal/middleware"
 	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func RegisterRoutes(app *fiber.App,
-	searchSvc service.SearchService,
-	repoSvc service.RepoService,
-	guideSvc service.GuideService,
-	chatSvc service.ChatService,
-	repoRepository service.RepoRepository,
-	metadataEmbedder service.EmbeddingClient,
-	codeEmbedder service.EmbeddingClient,
-	codeSvc service.CodeService,
-) {
+// App holds every dependency the HTTP layer needs. main builds it once from
+// config; adding a handler dependency only touches this struct and main.
+type App struct {
+	// Databases and warm-up state (health checks)
+	MainClient      *mongo.Client
+	FederatedClient *mongo.Client
+	Readiness       *service.Readiness
+
+	// Services
+	SearchSvc   service.SearchService
+	RepoSvc     service.RepoService
+	GuideSvc    service.GuideService
+	ChatSvc     service.ChatService
+	CodeSvc     service.CodeService
+	FeedbackSvc service.FeedbackService
+	RAGSvc      *service.RAGService
+	IndexingSvc *service.IndexingService
+	StatsSvc    *service.StatsService
+
+	// Prompts in use, reported and reloaded by the admin API
+	Prompts *service.PromptStore
+
+	// Repositories and embedders used directly by handlers
+	RepoRepository   service.RepoRepository
+	CodeEmbedder     service.EmbeddingClient
+	IdempotencyStore middleware.IdempotencyStore
+
+	// Settings
+	MaxQueryLength     int
+	MaxChunkLength     int
+	ScoreNormalization service.ScoreNormalization
+	AdminToken         string
+}
+
+// RegisterRoutes mounts every handler on app.
+func (a *App) RegisterRoutes(app *fiber.App) {
+	// Hold traffic until warm-up finishes; probes stay reachable
+	app.Use(middleware.ReadinessGate(a.Readiness.Ready, "/health", "/ready"))
+
+	idempotency := middleware.Idempotency(a.IdempotencyStore)
+	codeSearchHandler := NewCodeSearchHandler(a.RepoRepository, a.CodeEmbedder, a.CodeSvc, a.MaxQueryLength, a.MaxChunkLength, a.ScoreNormalization)
 
 	v1 := app.Group("/api/v1")
-	NewSearchHandler(searchSvc).Register(v1)
-	NewRepoHandler(repoSvc).Register(v1)
-	NewGuideHandler(guideSvc).Register(v1)
-	NewChatHandler(chatSvc).Register(v1)
-	NewCodeSearchHandler(repoRepository, codeEmbedder, codeSvc).Register(v1)
+	NewSearchHandler(a.SearchSvc, a.MaxQueryLength).Register(v1)
+	NewRepoHandler(a.RepoSvc).Register(v1)
+	NewGuideHandler(a.GuideSvc, idempotency).Register(v1)
+	NewChatHandler(a.ChatSvc).Register(v1)
+	NewFeedbackHandler(a.FeedbackSvc).Register(v1)
+	codeSearchHandler.Register(v1)
+
+	NewHealthHandler(a.MainClient, a.FederatedClient, a.Readiness).Register(app)
+	NewRAGHandler(a.RAGSvc, idempotency).RegisterRoutes(app)
+	codeSearchHandler.Register(app)
+	NewAdminHandler(a.GuideSvc, a.FeedbackSvc, a.IndexingSvc, a.RepoRepository, a.Prompts, a.StatsSvc).Register(app.Group("/admin", middleware.AdminAuth(a.AdminToken)))
 }
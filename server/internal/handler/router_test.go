@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newRoutedApp mounts an App whose services are nil or fakes; only routing
+// and middleware run before the handlers, so nothing else is needed.
+func newRoutedApp(ready bool) *fiber.App {
+	readiness := &service.Readiness{}
+	if ready {
+		readiness.MarkReady()
+	}
+	a := &App{Readiness: readiness, AdminToken: testAdminToken, MaxQueryLength: 100}
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	a.RegisterRoutes(app)
+	return app
+}
+
+func TestRegisterRoutesMountsHandlers(t *testing.T) {
+	app := newRoutedApp(true)
+
+	mounted := make(map[string]bool)
+	for _, r := range app.GetRoutes() {
+		mounted[r.Method+" "+r.Path] = true
+	}
+	for _, want := range []string{
+		"GET /health",
+		"GET /ready",
+		"GET /api/v1/search",
+		"GET /api/v1/repos/:id",
+		"GET /api/v1/issues/:id/guide",
+		"POST /api/v1/chat",
+		"POST /api/v1/issues/:id/guide/feedback",
+		"POST /api/v1/code_search",
+		"POST /code_search",
+		"POST /api/v1/rag",
+		"POST /api/v1/rag/retrieve",
+		"POST /api/v1/guide",
+		"GET /admin/cache/stats",
+	} {
+		if !mounted[want] {
+			t.Errorf("route %s is not mounted", want)
+		}
+	}
+}
+
+func TestRegisterRoutesProtectsAdmin(t *testing.T) {
+	app := newRoutedApp(true)
+	if status, _ := do(t, app, http.MethodGet, "/admin/cache/stats", nil); status != http.StatusUnauthorized {
+		t.Errorf("admin route without token: status = %d, want 401", status)
+	}
+}
+
+func TestRegisterRoutesGatesUntilReady(t *testing.T) {
+	app := newRoutedApp(false)
+	if status, _ := do(t, app, http.MethodGet, "/api/v1/search?q=go", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("request before warm-up: status = %d, want 503", status)
+	}
+}
@@ -1,27 +1,32 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ahmednasr/ai-in-action/server/internal/service"
 	"github.com/gofiber/fiber/v2"
 )
 
 // SearchHandler exposes the search API.
 type SearchHandler struct {
-	svc service.SearchService
+	svc            service.SearchService
+	maxQueryLength int
 }
 
 // NewSearchHandler wires the service.
-func NewSearchHandler(svc service.SearchService) *SearchHandler {
-	return &SearchHandler{svc: svc}
+func NewSearchHandler(svc service.SearchService, maxQueryLength int) *SearchHandler {
+	return &SearchHandler{svc: svc, maxQueryLength: maxQueryLength}
 }
 
 // Register mounts the search routes.
 func (h *SearchHandler) Register(r fiber.Router) {
 	r.Get("/search", h.search)
+	r.Post("/search/batch", h.searchBatch)
 	r.Get("/repos", h.getAllRepos)
 }
 
-// search handles GET /api/v1/search?q=query
+// search handles GET /api/v1/search?q=query&limit=&offset=
 func (h *SearchHandler) search(c *fiber.Ctx) error {
 	query := c.Query("q")
 	if query == "" {
@@ -30,7 +35,104 @@ func (h *SearchHandler) search(c *fiber.Ctx) error {
 		})
 	}
 
-	repos, err := h.svc.Search(query)
+	query, err := validateQuery(query, h.maxQueryLength)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit, offset, err := parsePagination(c, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	repos, warnings, err := h.svc.Search(query)
+	if errors.Is(err, service.ErrEmbedderBusy) {
+		return c.Status(503).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, service.ErrEmbedTimeout) {
+		return c.Status(504).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, service.ErrInvalidEmbedding) {
+		return c.Status(502).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, service.ErrTextTooShort) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp := pageEnvelope(pageSlice(repos, limit, offset), int64(len(repos)), limit, offset)
+	if len(warnings) > 0 {
+		resp["partial"] = true
+		resp["warnings"] = warnings
+	}
+	return c.JSON(resp)
+}
+
+type searchBatchRequest struct {
+	Queries []string `json:"queries" validate:"required,min=1,max=10"` // max is maxBatchQueries
+	K       int      `json:"k" validate:"gte=0"`
+}
+
+// searchBatch handles POST /api/v1/search/batch  { "queries": ["...", "..."], "k": 10 }
+func (h *SearchHandler) searchBatch(c *fiber.Ctx) error {
+	var req searchBatchRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	switch {
+	case req.K == 0:
+		req.K = defaultBatchK
+	case req.K > maxSearchLimit:
+		req.K = maxSearchLimit
+	}
+
+	for i, q := range req.Queries {
+		query, err := validateQuery(q, h.maxQueryLength)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fmt.Sprintf("queries[%d]: %v", i, err),
+			})
+		}
+		req.Queries[i] = query
+	}
+
+	results, err := h.svc.SearchBatch(c.UserContext(), req.Queries, req.K)
+	if errors.Is(err, service.ErrEmbedderBusy) {
+		return c.Status(503).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, service.ErrEmbedTimeout) {
+		return c.Status(504).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, service.ErrInvalidEmbedding) {
+		return c.Status(502).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, service.ErrTextTooShort) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
@@ -38,20 +140,34 @@ func (h *SearchHandler) search(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"repositories": repos,
+		"k":       req.K,
+		"results": results,
 	})
 }
 
-// getAllRepos handles GET /api/v1/repos
+// getAllRepos handles GET /api/v1/repos?limit=&offset=&sort=&order=
+// sort is a repository field such as stargazers_count and order is asc or
+// desc (the default); without sort the configured default order applies.
 func (h *SearchHandler) getAllRepos(c *fiber.Ctx) error {
-	repos, err := h.svc.GetAllRepos()
+	limit, offset, err := parsePagination(c, defaultReposLimit, maxReposLimit)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	sort, err := service.ParseRepoSort(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	repos, total, err := h.svc.GetAllRepos(limit, offset, sort)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"repositories": repos,
-	})
+	return c.JSON(pageEnvelope(repos, total, limit, offset))
 }
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeSearchService records the queries it is asked to run.
+type fakeSearchService struct {
+	repos    []models.Repo
+	warnings []string
+	err      error
+	queries  []string
+	sort     models.RepoSort
+}
+
+func (f *fakeSearchService) Search(query string) ([]models.Repo, []string, error) {
+	f.queries = append(f.queries, query)
+	return f.repos, f.warnings, f.err
+}
+
+func (f *fakeSearchService) GetAllRepos(limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error) {
+	f.sort = sort
+	return f.repos, int64(len(f.repos)), f.err
+}
+
+func (f *fakeSearchService) SearchBatch(ctx context.Context, queries []string, k int) ([]service.BatchSearchResult, error) {
+	f.queries = append(f.queries, queries...)
+	results := make([]service.BatchSearchResult, len(queries))
+	for i, q := range queries {
+		results[i] = service.BatchSearchResult{Query: q, Results: f.repos}
+	}
+	return results, f.err
+}
+
+func newSearchApp(svc service.SearchService, maxQueryLength int) *fiber.App {
+	return newTestApp(NewSearchHandler(svc, maxQueryLength).Register)
+}
+
+func TestSearchRejectsInvalidQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"missing", "", "missing query parameter"},
+		{"whitespace only", "   \t ", "must not be empty"},
+		{"over length", strings.Repeat("x", 33), "maximum length of 32"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeSearchService{}
+			status, body := do(t, newSearchApp(svc, 32), "GET", "/search?q="+url.QueryEscape(tt.query), nil)
+			if status != fiber.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (body %s)", status, body)
+			}
+			if !strings.Contains(string(body), tt.wantErr) {
+				t.Errorf("body = %s, want it to mention %q", body, tt.wantErr)
+			}
+			if len(svc.queries) != 0 {
+				t.Errorf("service called with %q for an invalid query", svc.queries)
+			}
+		})
+	}
+}
+
+func TestSearchTrimsQuery(t *testing.T) {
+	svc := &fakeSearchService{}
+	status, body := do(t, newSearchApp(svc, 32), "GET", "/search?q="+url.QueryEscape("  auth bug  "), nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	if len(svc.queries) != 1 || svc.queries[0] != "auth bug" {
+		t.Errorf("service queries = %q, want [\"auth bug\"]", svc.queries)
+	}
+}
+
+func TestSearchBatchRejectsInvalidQuery(t *testing.T) {
+	svc := &fakeSearchService{}
+	status, body := do(t, newSearchApp(svc, 32), "POST", "/search/batch", map[string]any{
+		"queries": []string{"fine", "  "},
+	})
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 (body %s)", status, body)
+	}
+	if !strings.Contains(string(body), "queries[1]") {
+		t.Errorf("body = %s, want it to name queries[1]", body)
+	}
+	if len(svc.queries) != 0 {
+		t.Errorf("service called with %q", svc.queries)
+	}
+}
+
+func TestSearchBatchTwoQueries(t *testing.T) {
+	svc := &fakeSearchService{repos: reposNamed("a/cli")}
+	status, body := do(t, newSearchApp(svc, 0), "POST", "/search/batch", map[string]any{
+		"queries": []string{"cli tools", " web frameworks "},
+		"k":       5,
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got struct {
+		K       int                         `json:"k"`
+		Results []service.BatchSearchResult `json:"results"`
+	}
+	decode(t, body, &got)
+	if got.K != 5 || len(got.Results) != 2 {
+		t.Fatalf("response = %+v, want 2 result sets with k 5", got)
+	}
+	if got.Results[0].Query != "cli tools" || got.Results[1].Query != "web frameworks" {
+		t.Errorf("queries = %q, %q; want them in request order, trimmed", got.Results[0].Query, got.Results[1].Query)
+	}
+	if itemIDs(got.Results[1].Results) != "a/cli" {
+		t.Errorf("results[1] = %+v, want a/cli", got.Results[1].Results)
+	}
+}
+
+func TestSearchBatchCapsQueries(t *testing.T) {
+	svc := &fakeSearchService{}
+	queries := make([]string, maxBatchQueries+1)
+	for i := range queries {
+		queries[i] = "query"
+	}
+	status, body := do(t, newSearchApp(svc, 0), "POST", "/search/batch", map[string]any{"queries": queries})
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 (body %s)", status, body)
+	}
+	if len(svc.queries) != 0 {
+		t.Errorf("service called with %d queries", len(svc.queries))
+	}
+}
+
+func TestSearchReportsPartialResults(t *testing.T) {
+	tests := []struct {
+		name        string
+		warnings    []string
+		wantPartial bool
+	}{
+		{"complete", nil, false},
+		{"partial", []string{"metadata unavailable for a/fail; result omitted"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeSearchService{repos: []models.Repo{{ID: "b/kept"}}, warnings: tt.warnings}
+			status, body := do(t, newSearchApp(svc, 32), "GET", "/search?q=cli", nil)
+			if status != fiber.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", status, body)
+			}
+			var got struct {
+				Partial  bool     `json:"partial"`
+				Warnings []string `json:"warnings"`
+			}
+			decode(t, body, &got)
+			if got.Partial != tt.wantPartial || len(got.Warnings) != len(tt.warnings) {
+				t.Errorf("partial = %v, warnings = %q; want %v, %q", got.Partial, got.Warnings, tt.wantPartial, tt.warnings)
+			}
+		})
+	}
+}
+
+// pageBody is the paginated envelope returned by the list endpoints.
+type pageBody struct {
+	Items   []models.Repo `json:"items"`
+	Total   int64         `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+	HasMore bool          `json:"has_more"`
+}
+
+func reposNamed(names ...string) []models.Repo {
+	repos := make([]models.Repo, len(names))
+	for i, n := range names {
+		repos[i] = models.Repo{ID: n, FullName: n}
+	}
+	return repos
+}
+
+func itemIDs(repos []models.Repo) string {
+	ids := make([]string, len(repos))
+	for i, r := range repos {
+		ids[i] = r.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSearchPaginatesResults(t *testing.T) {
+	svc := &fakeSearchService{repos: reposNamed("a/1", "a/2", "a/3", "a/4", "a/5")}
+	app := newSearchApp(svc, 32)
+
+	tests := []struct {
+		target      string
+		wantItems   string
+		wantHasMore bool
+	}{
+		{"/search?q=go&limit=2", "a/1,a/2", true},
+		{"/search?q=go&limit=2&offset=2", "a/3,a/4", true},
+		{"/search?q=go&limit=2&offset=4", "a/5", false},
+		{"/search?q=go&limit=2&offset=10", "", false},
+	}
+	for _, tt := range tests {
+		status, body := do(t, app, "GET", tt.target, nil)
+		if status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d, want 200 (body %s)", tt.target, status, body)
+		}
+		var got pageBody
+		decode(t, body, &got)
+		if itemIDs(got.Items) != tt.wantItems || got.Total != 5 || got.Limit != 2 || got.HasMore != tt.wantHasMore {
+			t.Errorf("%s: page = %+v, want items %q of 5, has_more %v", tt.target, got, tt.wantItems, tt.wantHasMore)
+		}
+	}
+}
+
+// pagedSearchService pages GetAllRepos over repos like the repository does.
+type pagedSearchService struct {
+	fakeSearchService
+}
+
+func (f *pagedSearchService) GetAllRepos(limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error) {
+	if offset > len(f.repos) {
+		offset = len(f.repos)
+	}
+	end := min(offset+limit, len(f.repos))
+	return f.repos[offset:end], int64(len(f.repos)), nil
+}
+
+func TestGetAllReposEnvelope(t *testing.T) {
+	svc := &pagedSearchService{fakeSearchService{repos: reposNamed("a/1", "a/2", "a/3")}}
+	app := newSearchApp(svc, 32)
+
+	status, body := do(t, app, "GET", "/repos?limit=2&offset=1", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", status, body)
+	}
+	var got pageBody
+	decode(t, body, &got)
+	if itemIDs(got.Items) != "a/2,a/3" || got.Total != 3 || got.Limit != 2 || got.Offset != 1 || got.HasMore {
+		t.Errorf("page = %+v, want a/2,a/3 of 3 at offset 1 with nothing more", got)
+	}
+}
+
+func TestSearchInvalidEmbeddingIsBadGateway(t *testing.T) {
+	svc := &fakeSearchService{err: fmt.Errorf("failed to generate embedding: %w (length 1)", service.ErrInvalidEmbedding)}
+	app := newSearchApp(svc, 0)
+
+	if status, body := do(t, app, "GET", "/search?q=cli", nil); status != fiber.StatusBadGateway {
+		t.Errorf("GET /search status = %d, want 502 (body %s)", status, body)
+	}
+	if status, body := do(t, app, "POST", "/search/batch", map[string]any{"queries": []string{"cli"}}); status != fiber.StatusBadGateway {
+		t.Errorf("POST /search/batch status = %d, want 502 (body %s)", status, body)
+	}
+}
+
+func TestGetAllReposSort(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantSort   models.RepoSort
+	}{
+		{"", fiber.StatusOK, models.RepoSort{}}, // the service applies its default
+		{"?sort=forks_count", fiber.StatusOK, models.RepoSort{Field: "forks_count", Descending: true}},
+		{"?sort=full_name&order=asc", fiber.StatusOK, models.RepoSort{Field: "full_name"}},
+		{"?sort=embedding", fiber.StatusBadRequest, models.RepoSort{}},
+		{"?sort=full_name&order=up", fiber.StatusBadRequest, models.RepoSort{}},
+		{"?order=asc", fiber.StatusBadRequest, models.RepoSort{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			svc := &fakeSearchService{}
+			status, body := do(t, newSearchApp(svc, 0), "GET", "/repos"+tt.query, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", status, tt.wantStatus, body)
+			}
+			if svc.sort != tt.wantSort {
+				t.Errorf("sort = %+v, want %+v", svc.sort, tt.wantSort)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// gitRefChars is the character set accepted in a ?ref= branch, tag or SHA.
+var gitRefChars = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// validateQuery trims a user-supplied search query and rejects it when it is
+// empty after trimming or longer than maxLen characters (maxLen <= 0 disables
+// the length check). The trimmed query is returned on success.
+func validateQuery(query string, maxLen int) (string, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", fmt.Errorf("query must not be empty")
+	}
+	if maxLen > 0 && utf8.RuneCountInString(query) > maxLen {
+		return "", fmt.Errorf("query exceeds maximum length of %d characters", maxLen)
+	}
+	return query, nil
+}
+
+// validateRef checks a user-supplied git ref against the subset of git's
+// ref-name rules that matter for an API parameter: a safe character set, no
+// "..", no leading "-" or "/", no trailing "/" or ".lock", and at most 255
+// characters.
+func validateRef(ref string) error {
+	switch {
+	case len(ref) > 255:
+		return fmt.Errorf("ref exceeds maximum length of 255 characters")
+	case !gitRefChars.MatchString(ref):
+		return fmt.Errorf("ref contains invalid characters")
+	case strings.Contains(ref, "..") || strings.Contains(ref, "//"),
+		strings.HasPrefix(ref, "-"), strings.HasPrefix(ref, "/"),
+		strings.HasSuffix(ref, "/"), strings.HasSuffix(ref, ".lock"):
+		return fmt.Errorf("ref %q is not a valid branch, tag or commit", ref)
+	}
+	return nil
+}
+
+// validate checks request bodies against their `validate` struct tags.
+// Fields are reported by their JSON names.
+var validate = func() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}()
+
+// FieldError describes what is wrong with one request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is a 400 response listing every invalid field. ErrorHandler
+// renders it as {"error": ..., "fields": [...]}.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ErrorHandler is the app's error handler: validation errors get a JSON body
+// with per-field messages, everything else is handled as Fiber does by default.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  verr.Error(),
+			"fields": verr.Fields,
+		})
+	}
+	return fiber.DefaultErrorHandler(c, err)
+}
+
+// parseBody decodes the request body into dst and validates it. Failures are
+// returned as a *ValidationError naming the offending fields where possible.
+func parseBody(c *fiber.Ctx, dst any) error {
+	if err := c.BodyParser(dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return &ValidationError{Fields: []FieldError{{
+				Field:   typeErr.Field,
+				Message: fmt.Sprintf("%s must be %s", typeErr.Field, jsonTypeName(typeErr.Type)),
+			}}}
+		}
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+
+	err := validate.Struct(dst)
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	fields := make([]FieldError, len(verrs))
+	for i, fe := range verrs {
+		fields[i] = FieldError{Field: fe.Field(), Message: fieldMessage(fe)}
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// fieldMessage renders a failed validation rule as a sentence.
+func fieldMessage(fe validator.FieldError) string {
+	field, param := fe.Field(), fe.Param()
+	kind := fe.Kind()
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.Join(strings.Fields(param), ", "))
+	case "min", "max", "gte", "lte":
+		op := ">="
+		if fe.Tag() == "max" || fe.Tag() == "lte" {
+			op = "<="
+		}
+		switch kind {
+		case reflect.String:
+			if op == ">=" {
+				return fmt.Sprintf("%s must be at least %s characters", field, param)
+			}
+			return fmt.Sprintf("%s must be at most %s characters", field, param)
+		case reflect.Slice, reflect.Map, reflect.Array:
+			if op == ">=" {
+				return fmt.Sprintf("%s must have at least %s items", field, param)
+			}
+			return fmt.Sprintf("%s must have at most %s items", field, param)
+		}
+		return fmt.Sprintf("%s must be %s %s", field, op, param)
+	}
+	return fmt.Sprintf("%s is invalid (%s)", field, fe.Tag())
+}
+
+// jsonTypeName names t the way JSON clients think of it, with its article
+// ("an integer").
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	}
+	return "a " + t.String()
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestValidateQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		maxLen  int
+		want    string
+		wantErr string
+	}{
+		{"trims surrounding space", "  find auth  ", 10, "find auth", ""},
+		{"empty", "", 10, "", "must not be empty"},
+		{"whitespace only", " \t\n ", 10, "", "must not be empty"},
+		{"at the limit", strings.Repeat("a", 10), 10, strings.Repeat("a", 10), ""},
+		{"over the limit", strings.Repeat("a", 11), 10, "", "maximum length of 10"},
+		{"limit counts characters, not bytes", strings.Repeat("é", 10), 10, strings.Repeat("é", 10), ""},
+		{"limit measured after trimming", "  " + strings.Repeat("a", 10) + "  ", 10, strings.Repeat("a", 10), ""},
+		{"no limit", strings.Repeat("a", 5000), 0, strings.Repeat("a", 5000), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateQuery(tt.query, tt.maxLen)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validateQuery(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateQuery(%q) unexpected error: %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("validateQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRef(t *testing.T) {
+	for _, ref := range []string{"main", "develop", "release/1.2", "v1.2.0", "4f2a9c1", "feature_x-y"} {
+		if err := validateRef(ref); err != nil {
+			t.Errorf("validateRef(%q) = %v, want nil", ref, err)
+		}
+	}
+	for _, ref := range []string{"../main", "main..dev", "-x", "/main", "main/", "a//b", "main.lock", "main branch", "main;rm", strings.Repeat("a", 256)} {
+		if err := validateRef(ref); err == nil {
+			t.Errorf("validateRef(%q) = nil, want an error", ref)
+		}
+	}
+}
+
+func TestParseBodyFieldErrors(t *testing.T) {
+	rag := newRAGApp(&fakeEmbedder{err: service.ErrEmbedderBusy})
+	chat := newTestApp(NewChatHandler(nil).Register)
+	tests := []struct {
+		name       string
+		app        *fiber.App
+		target     string
+		body       string
+		wantFields map[string]string // field -> message; nil expects no field list
+	}{
+		{"missing query", rag, "/api/v1/rag", `{}`, map[string]string{"query": "query is required"}},
+		{"too many results and sources", rag, "/api/v1/rag", `{"query": "q", "max_results": 21, "max_sources": -1}`,
+			map[string]string{"max_results": "max_results must be <= 20", "max_sources": "max_sources must be >= 0"}},
+		{"wrong type", rag, "/api/v1/rag/retrieve", `{"query": "q", "max_results": "five"}`, map[string]string{"max_results": "max_results must be an integer"}},
+		{"malformed JSON", rag, "/api/v1/rag", `{"query": `, nil},
+		{"missing question", chat, "/chat", `{"context_id": "o/r#1"}`, map[string]string{"question": "question is required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			status, body := doRequest(t, tt.app, req)
+			if status != fiber.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (body %s)", status, body)
+			}
+			if tt.wantFields == nil {
+				if !strings.Contains(string(body), "invalid JSON body") {
+					t.Errorf("body = %s, want the invalid JSON message", body)
+				}
+				return
+			}
+			var got struct {
+				Error  string       `json:"error"`
+				Fields []FieldError `json:"fields"`
+			}
+			decode(t, body, &got)
+			if len(got.Fields) != len(tt.wantFields) {
+				t.Fatalf("fields = %+v, want %v", got.Fields, tt.wantFields)
+			}
+			for _, f := range got.Fields {
+				if want, ok := tt.wantFields[f.Field]; !ok || f.Message != want {
+					t.Errorf("field %s: message %q, want %q", f.Field, f.Message, want)
+				}
+				if !strings.Contains(got.Error, f.Message) {
+					t.Errorf("error %q does not mention %q", got.Error, f.Message)
+				}
+			}
+		})
+	}
+}
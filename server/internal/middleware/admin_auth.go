@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminAuth guards operator-only routes with a static bearer token.
+// When token is empty the admin API is disabled and every request is rejected.
+func AdminAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return fiber.NewError(fiber.StatusForbidden, "admin API is disabled")
+		}
+		given := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid admin token")
+		}
+		return c.Next()
+	}
+}
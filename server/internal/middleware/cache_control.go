@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CacheControl sets a public Cache-Control header with the given max-age on
+// successful (200) and not-modified (304) responses. Pair it with the fiber
+// etag middleware so browsers can revalidate with If-None-Match.
+func CacheControl(maxAge time.Duration) fiber.Handler {
+	value := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		switch c.Response().StatusCode() {
+		case fiber.StatusOK, fiber.StatusNotModified:
+			c.Set(fiber.HeaderCacheControl, value)
+		}
+		return nil
+	}
+}
+
+// PrivateNoStore marks every response, errors included, as not to be stored
+// by any cache, and as varying with the given request headers. Use it in
+// place of CacheControl on routes whose content depends on the caller.
+func PrivateNoStore(vary ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "private, no-store")
+		c.Vary(vary...)
+		return c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCacheControl(t *testing.T) {
+	app := fiber.New()
+	app.Get("/ok", CacheControl(5*time.Minute), func(c *fiber.Ctx) error {
+		return c.SendString("hello")
+	})
+	app.Get("/fail", CacheControl(5*time.Minute), func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusNotFound).SendString("missing")
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/ok", "public, max-age=300"},
+		{"/fail", ""},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		if got := resp.Header.Get(fiber.HeaderCacheControl); got != tt.want {
+			t.Errorf("GET %s Cache-Control = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPrivateNoStore(t *testing.T) {
+	app := fiber.New()
+	app.Get("/fail", PrivateNoStore("X-GitHub-Token"), func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusForbidden, "denied")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/fail", nil))
+	if err != nil {
+		t.Fatalf("GET /fail: %v", err)
+	}
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != "private, no-store" {
+		t.Errorf("Cache-Control = %q, want private, no-store", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderVary); got != "X-GitHub-Token" {
+		t.Errorf("Vary = %q, want X-GitHub-Token", got)
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyStore persists responses by idempotency key (see
+// repository.IdempotencyRepository).
+type IdempotencyStore interface {
+	Claim(ctx context.Context, id, requestHash string) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, id string) error
+}
+
+// Idempotency replays the stored response of an earlier request that carried
+// the same Idempotency-Key header for the same route, instead of running the
+// handler again. Only successful responses are stored; a failed request
+// releases its key so it can be retried. Reusing a key with a different body
+// or query string is rejected with 422, and a retry that arrives while the first request is
+// still running gets 409. Requests without the header, and all requests when
+// store is nil, pass straight through.
+func Idempotency(store IdempotencyStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" || store == nil {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return fiber.NewError(fiber.StatusBadRequest, "Idempotency-Key is too long")
+		}
+
+		id := c.Method() + " " + c.Path() + " " + key
+		// The query string is part of the request: GET routes take their
+		// options there
+		h := sha256.New()
+		h.Write(c.Request().URI().QueryString())
+		h.Write([]byte{0})
+		h.Write(c.Body())
+		hash := hex.EncodeToString(h.Sum(nil))
+
+		ctx := context.WithoutCancel(c.UserContext())
+		existing, err := store.Claim(ctx, id, hash)
+		if err != nil {
+			// Serve the request rather than fail it because the store is down
+			log.Printf("Idempotency store unavailable, handling request without it: %v", err)
+			return c.Next()
+		}
+		if existing != nil {
+			if existing.RequestHash != hash {
+				return fiber.NewError(fiber.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+			}
+			if existing.State != models.IdempotencyDone {
+				return fiber.NewError(fiber.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			}
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, existing.ContentType)
+			return c.Status(existing.StatusCode).Send(existing.Body)
+		}
+
+		err = c.Next()
+		status := c.Response().StatusCode()
+		if err != nil || status < 200 || status >= 300 {
+			if relErr := store.Release(ctx, id); relErr != nil {
+				log.Printf("%v", relErr)
+			}
+			return err
+		}
+		body := append([]byte(nil), c.Response().Body()...)
+		if err := store.Complete(ctx, id, status, string(c.Response().Header.ContentType()), body); err != nil {
+			log.Printf("%v", err)
+		}
+		return nil
+	}
+}
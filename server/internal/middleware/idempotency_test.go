@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// memIdempotencyStore is an IdempotencyStore in a map, without expiry.
+type memIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func newMemIdempotencyStore() *memIdempotencyStore {
+	return &memIdempotencyStore{records: map[string]*models.IdempotencyRecord{}}
+}
+
+func (s *memIdempotencyStore) Claim(ctx context.Context, id, requestHash string) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[id]; ok {
+		copied := *rec
+		return &copied, nil
+	}
+	s.records[id] = &models.IdempotencyRecord{ID: id, State: models.IdempotencyPending, RequestHash: requestHash}
+	return nil, nil
+}
+
+func (s *memIdempotencyStore) Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.records[id]
+	rec.State, rec.StatusCode, rec.ContentType, rec.Body = models.IdempotencyDone, statusCode, contentType, body
+	return nil
+}
+
+func (s *memIdempotencyStore) Release(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[id]; ok && rec.State == models.IdempotencyPending {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+// newIdempotentApp serves POST /generate and GET /guide behind Idempotency,
+// counting the generations they run. A request whose body or query says
+// "fail" fails.
+func newIdempotentApp(store IdempotencyStore) (*fiber.App, *atomic.Int32) {
+	var generations atomic.Int32
+	generate := func(c *fiber.Ctx) error {
+		n := generations.Add(1)
+		if strings.Contains(string(c.Body()), "fail") || c.Query("mode") == "fail" {
+			return fiber.NewError(fiber.StatusBadGateway, "generation failed")
+		}
+		return c.JSON(fiber.Map{"generation": n})
+	}
+	app := fiber.New()
+	app.Post("/generate", Idempotency(store), generate)
+	app.Get("/guide", Idempotency(store), generate)
+	return app, &generations
+}
+
+func sendIdempotent(t *testing.T, app *fiber.App, method, target, key, body string) (int, string, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b), resp.Header.Get("Idempotent-Replayed")
+}
+
+func TestIdempotencySameKeyGeneratesOnce(t *testing.T) {
+	for _, tt := range []struct{ method, target, body string }{
+		{"POST", "/generate", `{"query":"q"}`},
+		{"GET", "/guide?section=notes", ""},
+	} {
+		t.Run(tt.method, func(t *testing.T) {
+			app, generations := newIdempotentApp(newMemIdempotencyStore())
+
+			status1, body1, replayed1 := sendIdempotent(t, app, tt.method, tt.target, "key-1", tt.body)
+			status2, body2, replayed2 := sendIdempotent(t, app, tt.method, tt.target, "key-1", tt.body)
+			if n := generations.Load(); n != 1 {
+				t.Fatalf("%d generations for two requests with the same key, want 1", n)
+			}
+			if status1 != 200 || status2 != 200 || body1 != body2 {
+				t.Errorf("responses = %d %s, %d %s; want the first replayed", status1, body1, status2, body2)
+			}
+			if replayed1 != "" || replayed2 != "true" {
+				t.Errorf("Idempotent-Replayed = %q, %q; want only the retry marked", replayed1, replayed2)
+			}
+
+			// Another key, or no key, generates again
+			sendIdempotent(t, app, tt.method, tt.target, "key-2", tt.body)
+			sendIdempotent(t, app, tt.method, tt.target, "", tt.body)
+			if n := generations.Load(); n != 3 {
+				t.Errorf("%d generations, want 3", n)
+			}
+		})
+	}
+}
+
+func TestIdempotencyRejectsReusedKey(t *testing.T) {
+	app, generations := newIdempotentApp(newMemIdempotencyStore())
+
+	sendIdempotent(t, app, "POST", "/generate", "k", `{"query":"q"}`)
+	if status, _, _ := sendIdempotent(t, app, "POST", "/generate", "k", `{"query":"other"}`); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("different body: status = %d, want 422", status)
+	}
+	sendIdempotent(t, app, "GET", "/guide?section=notes", "k", "")
+	if status, _, _ := sendIdempotent(t, app, "GET", "/guide?section=context", "k", ""); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("different query: status = %d, want 422", status)
+	}
+	if n := generations.Load(); n != 2 {
+		t.Errorf("%d generations, want 2 (one per route)", n)
+	}
+}
+
+func TestIdempotencyReleasesFailedRequests(t *testing.T) {
+	store := newMemIdempotencyStore()
+	app, generations := newIdempotentApp(store)
+
+	if status, _, _ := sendIdempotent(t, app, "GET", "/guide?mode=fail", "k", ""); status != fiber.StatusBadGateway {
+		t.Fatalf("status = %d, want the 502 failure", status)
+	}
+	if status, _, replayed := sendIdempotent(t, app, "GET", "/guide?mode=fail", "k", ""); status != fiber.StatusBadGateway || replayed != "" {
+		t.Errorf("retry = %d (replayed %q), want it run again", status, replayed)
+	}
+	if n := generations.Load(); n != 2 {
+		t.Errorf("%d generations, want the failed request retried", n)
+	}
+}
+
+func TestIdempotencyInProgressConflict(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var generations atomic.Int32
+	app := fiber.New()
+	app.Post("/generate", Idempotency(newMemIdempotencyStore()), func(c *fiber.Ctx) error {
+		generations.Add(1)
+		close(started)
+		<-release
+		return c.SendString("done")
+	})
+
+	first := make(chan int)
+	go func() {
+		resp, err := app.Test(idempotentRequest("k"), -1)
+		if err != nil {
+			t.Error(err)
+			first <- 0
+			return
+		}
+		first <- resp.StatusCode
+	}()
+	<-started
+
+	resp, err := app.Test(idempotentRequest("k"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("retry during the first request: status = %d, want 409", resp.StatusCode)
+	}
+	close(release)
+	if status := <-first; status != fiber.StatusOK {
+		t.Errorf("first request status = %d, want 200", status)
+	}
+	if n := generations.Load(); n != 1 {
+		t.Errorf("%d generations, want 1", n)
+	}
+}
+
+func idempotentRequest(key string) *http.Request {
+	req := httptest.NewRequest("POST", "/generate", strings.NewReader(`{"query":"q"}`))
+	req.Header.Set("Idempotency-Key", key)
+	return req
+}
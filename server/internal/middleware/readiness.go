@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReadinessGate rejects requests with 503 until ready reports true. Paths in
+// skip (e.g. health and readiness probes) are always let through.
+func ReadinessGate(ready func() bool, skip ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ready() {
+			return c.Next()
+		}
+		for _, p := range skip {
+			if c.Path() == p {
+				return c.Next()
+			}
+		}
+		c.Set(fiber.HeaderRetryAfter, "5")
+		return fiber.NewError(fiber.StatusServiceUnavailable, "server is warming up")
+	}
+}
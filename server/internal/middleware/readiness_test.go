@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReadinessGate(t *testing.T) {
+	var ready atomic.Bool
+	app := fiber.New()
+	app.Use(ReadinessGate(ready.Load, "/ready"))
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/ready", ok)
+	app.Get("/api", ok)
+
+	status := func(path string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("/api"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("before ready: /api status = %d, want 503", got)
+	}
+	if got := status("/ready"); got != fiber.StatusOK {
+		t.Errorf("before ready: /ready status = %d, want 200 (probes skip the gate)", got)
+	}
+	ready.Store(true)
+	if got := status("/api"); got != fiber.StatusOK {
+		t.Errorf("after ready: /api status = %d, want 200", got)
+	}
+}
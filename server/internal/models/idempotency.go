@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// States of an IdempotencyRecord.
+const (
+	IdempotencyPending = "pending" // the first request is still running
+	IdempotencyDone    = "done"    // the response below can be replayed
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key header.
+type IdempotencyRecord struct {
+	ID          string    `bson:"_id"`          // method, path and key
+	State       string    `bson:"state"`        // IdempotencyPending or IdempotencyDone
+	RequestHash string    `bson:"request_hash"` // SHA-256 of the query string and body
+	StatusCode  int       `bson:"status_code,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // SearchRequest is the payload for GET /search (query parameters) or POST /search.
 type SearchRequest struct {
@@ -10,8 +14,8 @@ type SearchRequest struct {
 
 // ChatRequest is the payload for POST /chat follow‑up questions.
 type ChatRequest struct {
-	ContextID string `json:"context_id"` // ID returned from a guide or prior chat
-	Question  string `json:"question"`   // user’s natural‑language question
+	ContextID string `json:"context_id"`                   // ID returned from a guide or prior chat
+	Question  string `json:"question" validate:"required"` // user’s natural‑language question
 }
 
 // Guide represents an AI‑generated troubleshooting guide for a GitHub issue.
@@ -19,5 +23,85 @@ type Guide struct {
 	ID        string    `bson:"_id,omitempty" json:"id"` // same as "owner/repo#number"
 	Issue     Issue     `bson:"issue"          json:"issue"`
 	Answer    string    `bson:"answer"         json:"answer"`
+	State     string    `bson:"state"          json:"state"` // issue state when generated: "open" | "closed"
 	CreatedAt time.Time `bson:"created_at"     json:"created_at"`
+
+	// LowConfidence marks guides generated for an issue with an empty body,
+	// which rest on the title and code context alone.
+	LowConfidence bool `bson:"low_confidence,omitempty" json:"low_confidence,omitempty"`
+
+	// Model and PromptVersion record what generated the guide, and TokenUsage
+	// what it cost, so guides can be compared across model and prompt changes.
+	// Guides generated before they were recorded leave them empty.
+	Model         string      `bson:"model,omitempty"          json:"model,omitempty"`
+	PromptVersion string      `bson:"prompt_version,omitempty" json:"prompt_version,omitempty"`
+	TokenUsage    *TokenUsage `bson:"token_usage,omitempty"    json:"token_usage,omitempty"`
+
+	// Sources and Prompt are the code context and the exact prompt the guide
+	// was generated from, kept for audits. They are only served by the guide
+	// export; guides generated before they were recorded leave them empty.
+	Sources []GuideSource `bson:"sources,omitempty" json:"-"`
+	Prompt  string        `bson:"prompt,omitempty"  json:"-"`
+
+	// ExistingAttempts lists pull requests already linked to the issue. It is
+	// looked up live on every request rather than stored with the guide.
+	ExistingAttempts []PullRequestRef `bson:"-" json:"existing_attempts,omitempty"`
+}
+
+// GuideSource is a piece of code context a guide was generated from.
+type GuideSource struct {
+	RepoID    string  `bson:"repo_id"   json:"repo_id"`
+	FilePath  string  `bson:"file_path" json:"file_path"`
+	Content   string  `bson:"content"   json:"content"`
+	Relevance float64 `bson:"relevance" json:"relevance"`
+}
+
+// GuideExport bundles a stored guide with the context that produced it, for
+// offline review.
+type GuideExport struct {
+	Guide      Guide         `json:"guide"`
+	Sources    []GuideSource `json:"sources"`
+	Prompt     string        `json:"prompt"`
+	ExportedAt time.Time     `json:"exported_at"`
+}
+
+// TokenUsage counts the LLM tokens spent on a generation.
+type TokenUsage struct {
+	PromptTokens     int `bson:"prompt_tokens"     json:"prompt_tokens"`
+	CompletionTokens int `bson:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int `bson:"total_tokens"      json:"total_tokens"`
+}
+
+// Add returns the sum of u and other. A nil receiver counts as zero.
+func (u *TokenUsage) Add(other TokenUsage) *TokenUsage {
+	sum := other
+	if u != nil {
+		sum.PromptTokens += u.PromptTokens
+		sum.CompletionTokens += u.CompletionTokens
+		sum.TotalTokens += u.TotalTokens
+	}
+	return &sum
+}
+
+// GuideSummary is the lightweight listing form of a cached guide.
+type GuideSummary struct {
+	ID         string    `json:"id"` // "owner/repo#number"
+	IssueTitle string    `json:"issue_title"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IssueSummary is a cached short LLM summary of a GitHub issue thread.
+type IssueSummary struct {
+	ID        string    `bson:"_id,omitempty" json:"id"` // same as "owner/repo#number"
+	Summary   string    `bson:"summary"        json:"summary"`
+	CreatedAt time.Time `bson:"created_at"     json:"created_at"`
+}
+
+// GuideFeedback is a user's rating of the guide generated for an issue.
+type GuideFeedback struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	IssueID   string             `bson:"issue_id"      json:"issue_id"` // "owner/repo#number"
+	Rating    string             `bson:"rating"        json:"rating"`   // "up" | "down"
+	Comment   string             `bson:"comment,omitempty" json:"comment,omitempty"`
+	CreatedAt time.Time          `bson:"created_at"    json:"created_at"`
 }
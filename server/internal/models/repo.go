@@ -6,6 +6,7 @@ type Repo struct {
 	Owner           string    `bson:"owner" json:"owner"` // GitHub username
 	Name            string    `bson:"name" json:"name"`   // Repository name
 	FullName        string    `bson:"full_name" json:"full_name"`
+	GitHubID        int64     `bson:"id,omitempty" json:"github_id,omitempty"`
 	Description     string    `bson:"description" json:"description"`
 	StargazersCount int       `bson:"stargazers_count" json:"stargazers_count"` // Renamed and re-tagged
 	WatchersCount   int       `bson:"watchers_count" json:"watchers_count"`
@@ -22,11 +23,27 @@ type Repo struct {
 	AllowForking    bool      `bson:"allow_forking" json:"allow_forking"`
 	IsTemplate      bool      `bson:"is_template" json:"is_template"`
 	Topics          []string  `bson:"topics" json:"topics"`
+	Language        string    `bson:"language" json:"language,omitempty"` // primary language
 	Languages       []string  `bson:"languages" json:"languages"`
 	ImageURL        string    `bson:"image_url" json:"image_url"`
 	Readme          string    `bson:"readme,omitempty" json:"readme,omitempty"`
 	Embedding       []float32 `bson:"embedding" json:"-"`
 	Score           float64   `bson:"score" json:"score"`
+	NormalizedScore *float64  `bson:"-" json:"normalized_score,omitempty"` // per-query, 0–1; see service.ScoreNormalization
+}
+
+// RepoSort orders repository listings. The zero value means the listing's
+// default order.
+type RepoSort struct {
+	Field      string // bson field name, e.g. "stargazers_count"
+	Descending bool
+}
+
+// LanguageBucket is the set of repositories sharing a primary language.
+type LanguageBucket struct {
+	Language string `bson:"_id" json:"language"` // "" when the dataset records none
+	Count    int    `bson:"count" json:"count"`
+	Repos    []Repo `bson:"repos" json:"repos"` // most-starred first, limited per bucket
 }
 
 // CodeChunk represents a code snippet or documentation chunk from a repository.
@@ -36,6 +53,89 @@ type CodeChunk struct {
 	Text   string  `bson:"text" json:"text"`
 	File   string  `bson:"file" json:"file"`
 	Score  float64 `bson:"score" json:"score"`
+
+	// Language is the chunk's programming language. Chunks indexed before
+	// it was recorded leave it empty; see service.ChunkLanguage.
+	Language string `bson:"language,omitempty" json:"language,omitempty"`
+
+	// ChunkType is what the chunk was cut from: ChunkTypeCode, ChunkTypeReadme
+	// or ChunkTypeDoc. Chunks indexed before it was recorded leave it empty;
+	// see service.ChunkTypeOf.
+	ChunkType string `bson:"chunk_type,omitempty" json:"chunk_type,omitempty"`
+}
+
+// Values of CodeChunk.ChunkType.
+const (
+	ChunkTypeCode   = "code"
+	ChunkTypeReadme = "readme"
+	ChunkTypeDoc    = "doc"
+)
+
+// CodeSearchResponse is the wire format of a code search.
+type CodeSearchResponse struct {
+	Query   string             `json:"query"`
+	RepoID  string             `json:"repo_id"`
+	Results []CodeSearchResult `json:"results"`
+}
+
+// CodeSearchResult is one matching code chunk.
+type CodeSearchResult struct {
+	File    string  `json:"file"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+
+	// NormalizedScore is Score mapped to 0–1 relative to the other results
+	// of the same query, when score normalization is enabled.
+	NormalizedScore *float64 `json:"normalized_score,omitempty"`
+
+	// Truncated is set when Content was cut short; the full file is
+	// available from the file endpoint.
+	Truncated bool `json:"truncated"`
+
+	// Highlights marks the lines of Content most related to the query, when
+	// the client asked for them.
+	Highlights []LineRange `json:"highlights,omitempty"`
+}
+
+// CodeSearchPreviewResponse is the wire format of a code search preview: the
+// chunks a search would return, without their full content.
+type CodeSearchPreviewResponse struct {
+	Query   string                    `json:"query"`
+	RepoID  string                    `json:"repo_id"`
+	Results []CodeSearchPreviewResult `json:"results"`
+}
+
+// CodeSearchPreviewResult is one matching chunk of a preview.
+type CodeSearchPreviewResult struct {
+	File            string   `json:"file"`
+	Score           float64  `json:"score"`
+	NormalizedScore *float64 `json:"normalized_score,omitempty"`
+	Snippet         string   `json:"snippet"` // the start of the chunk's content
+}
+
+// LineRange is an inclusive, 1-based range of lines.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// PullRequestRef is a pull request that references an issue, as found in the
+// issue's timeline.
+type PullRequestRef struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	State   string `json:"state"` // "open" | "closed"
+	HTMLURL string `json:"html_url"`
+	Author  string `json:"author"`
+}
+
+// RepoCounts holds the popularity counters GitHub reports for a repository.
+// The JSON tags match GitHub's REST API so it can be decoded directly.
+type RepoCounts struct {
+	StargazersCount int `json:"stargazers_count"`
+	ForksCount      int `json:"forks_count"`
+	OpenIssuesCount int `json:"open_issues_count"`
+	WatchersCount   int `json:"watchers_count"`
 }
 
 // Issue captures the minimal fields we care about from GitHub's REST API.
@@ -48,7 +148,14 @@ type Issue struct {
 	HTMLURL   string `json:"html_url"   bson:"html_url"`
 	CreatedAt string `json:"created_at" bson:"created_at"`
 	UpdatedAt string `json:"updated_at" bson:"updated_at"`
+	ClosedAt  string `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
 	User      struct {
 		Login string `json:"login" bson:"login"`
 	} `json:"user" bson:"user"`
+	Labels []IssueLabel `json:"labels,omitempty" bson:"labels,omitempty"`
+}
+
+// IssueLabel is a label attached to a GitHub issue.
+type IssueLabel struct {
+	Name string `json:"name" bson:"name"`
 }
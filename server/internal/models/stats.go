@@ -0,0 +1,18 @@
+package models
+
+// CollectionStats describes one Mongo collection for the admin stats endpoint.
+type CollectionStats struct {
+	Database      string        `json:"database"`
+	Collection    string        `json:"collection"`
+	Documents     int64         `json:"documents"`
+	Indexes       []string      `json:"indexes"`
+	SearchIndexes []SearchIndex `json:"search_indexes,omitempty"`
+	Error         string        `json:"error,omitempty"` // set when counting or listing indexes failed
+}
+
+// SearchIndex is the status of an Atlas Search / Vector Search index.
+type SearchIndex struct {
+	Name      string `json:"name" bson:"name"`
+	Status    string `json:"status" bson:"status"`
+	Queryable bool   `json:"queryable" bson:"queryable"`
+}
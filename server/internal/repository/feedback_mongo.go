@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FeedbackRepository stores user ratings of guides.
+type FeedbackRepository struct {
+	col *mongo.Collection
+}
+
+// NewFeedbackRepository returns a FeedbackRepository on the feedback
+// collection named in names.
+func NewFeedbackRepository(db *mongo.Database, names CollectionNames) *FeedbackRepository {
+	return &FeedbackRepository{col: db.Collection(names.Feedback)}
+}
+
+// Record inserts one piece of feedback.
+func (r *FeedbackRepository) Record(ctx context.Context, fb models.GuideFeedback) error {
+	log.Printf("[Feedback Repository] Recording %q feedback for issue ID: %s", fb.Rating, fb.IssueID)
+	if _, err := r.col.InsertOne(ctx, fb); err != nil {
+		return fmt.Errorf("failed to record feedback: %w", err)
+	}
+	return nil
+}
+
+// List returns feedback newest first, optionally restricted to one issue,
+// along with the total number of matching entries.
+func (r *FeedbackRepository) List(ctx context.Context, issueID string, limit, offset int) ([]models.GuideFeedback, int64, error) {
+	filter := bson.M{}
+	if issueID != "" {
+		filter["issue_id"] = issueID
+	}
+
+	total, err := r.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count feedback: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find feedback: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	feedback := []models.GuideFeedback{}
+	if err := cursor.All(ctx, &feedback); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode feedback: %w", err)
+	}
+	return feedback, total, nil
+}
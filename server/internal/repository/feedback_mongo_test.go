@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFeedbackRecord(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("insert", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		repo := &FeedbackRepository{col: mt.Coll}
+
+		fb := models.GuideFeedback{ID: primitive.NewObjectID(), IssueID: "o/r#1", Rating: "up", Comment: "clear", CreatedAt: time.Now()}
+		if err := repo.Record(context.Background(), fb); err != nil {
+			mt.Fatalf("Record: %v", err)
+		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup("issue_id").StringValue() != "o/r#1" || doc.Lookup("rating").StringValue() != "up" || doc.Lookup("comment").StringValue() != "clear" {
+			mt.Errorf("inserted %s, want the feedback", doc)
+		}
+	})
+}
+
+func TestFeedbackList(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("one issue", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: int32(3)}}), // CountDocuments
+			cursorReply(
+				bson.D{{Key: "issue_id", Value: "o/r#1"}, {Key: "rating", Value: "down"}},
+				bson.D{{Key: "issue_id", Value: "o/r#1"}, {Key: "rating", Value: "up"}},
+			),
+		)
+		repo := &FeedbackRepository{col: mt.Coll}
+
+		feedback, total, err := repo.List(context.Background(), "o/r#1", 2, 1)
+		if err != nil {
+			mt.Fatalf("List: %v", err)
+		}
+		if total != 3 || len(feedback) != 2 || feedback[0].Rating != "down" {
+			mt.Errorf("List = %+v (total %d), want 2 of 3 entries", feedback, total)
+		}
+
+		mt.GetStartedEvent() // the count
+		find := mt.GetStartedEvent().Command
+		if got := find.Lookup("filter", "issue_id").StringValue(); got != "o/r#1" {
+			mt.Errorf("filter issue_id = %q, want o/r#1", got)
+		}
+		if got := find.Lookup("sort", "created_at").Int32(); got != -1 {
+			mt.Errorf("sort created_at = %d, want -1 (newest first)", got)
+		}
+		if find.Lookup("skip").Int64() != 1 || find.Lookup("limit").Int64() != 2 {
+			mt.Errorf("skip %v limit %v, want 1 and 2", find.Lookup("skip"), find.Lookup("limit"))
+		}
+	})
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"log"
+	"regexp"
+	"time"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
 
@@ -13,13 +15,16 @@ import (
 
 // GuideRepository provides Mongo-backed persistence for AI-generated guides.
 type GuideRepository struct {
-	col *mongo.Collection
+	col        *mongo.Collection
+	summaryCol *mongo.Collection
 }
 
-// NewGuideRepository returns a GuideRepository that operates on the "guides" collection.
-func NewGuideRepository(db *mongo.Database) *GuideRepository {
+// NewGuideRepository returns a GuideRepository that operates on the guides and
+// issue summaries collections named in names.
+func NewGuideRepository(db *mongo.Database, names CollectionNames) *GuideRepository {
 	return &GuideRepository{
-		col: db.Collection("guides"),
+		col:        db.Collection(names.Guides),
+		summaryCol: db.Collection(names.Summaries),
 	}
 }
 
@@ -64,3 +69,142 @@ func (r *GuideRepository) Upsert(ctx context.Context, g models.Guide) error {
 	log.Printf("[Guide Repository] Successfully upserted guide for issue ID: %s", g.ID)
 	return err
 }
+
+// FindSummaryByIssueID returns the cached summary for issueID. Like
+// FindByIssueID, a missing document yields an empty value and a nil error.
+func (r *GuideRepository) FindSummaryByIssueID(ctx context.Context, issueID string) (models.IssueSummary, error) {
+	var sum models.IssueSummary
+	err := r.summaryCol.FindOne(ctx, bson.M{"_id": issueID}).Decode(&sum)
+	if err == mongo.ErrNoDocuments {
+		return models.IssueSummary{}, nil
+	}
+	if err != nil {
+		log.Printf("[Guide Repository] Error finding summary by issue ID %s: %v", issueID, err)
+		return models.IssueSummary{}, err
+	}
+	return sum, nil
+}
+
+// UpsertSummary inserts or replaces the summary with the same _id.
+func (r *GuideRepository) UpsertSummary(ctx context.Context, sum models.IssueSummary) error {
+	_, err := r.summaryCol.ReplaceOne(
+		ctx,
+		bson.M{"_id": sum.ID},
+		sum,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("[Guide Repository] Error upserting summary for issue ID %s: %v", sum.ID, err)
+	}
+	return err
+}
+
+// Count returns the number of cached guides whose ID starts with prefix.
+// An empty prefix counts every guide.
+func (r *GuideRepository) Count(ctx context.Context, prefix string) (int64, error) {
+	return r.col.CountDocuments(ctx, idPrefixFilter(prefix))
+}
+
+// FindByRepoAndDateRange returns the guides of repoID ("owner/repo") created
+// in [from, to), newest first. A zero from or to leaves that end open. Only
+// the ID, issue title and creation time are loaded.
+func (r *GuideRepository) FindByRepoAndDateRange(ctx context.Context, repoID string, from, to time.Time) ([]models.Guide, error) {
+	filter := idPrefixFilter(repoID + "#")
+	created := bson.M{}
+	if !from.IsZero() {
+		created["$gte"] = from
+	}
+	if !to.IsZero() {
+		created["$lt"] = to
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"_id": 1, "issue.title": 1, "created_at": 1})
+	cursor, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("[Guide Repository] Error listing guides for %s: %v", repoID, err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	guides := []models.Guide{}
+	if err := cursor.All(ctx, &guides); err != nil {
+		return nil, err
+	}
+	return guides, nil
+}
+
+// ListIDs returns the IDs of the cached guides whose ID starts with prefix.
+func (r *GuideRepository) ListIDs(ctx context.Context, prefix string) ([]string, error) {
+	cursor, err := r.col.Find(ctx, idPrefixFilter(prefix), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids, nil
+}
+
+// EachAnswer calls fn with the ID and answer of every cached guide whose ID
+// starts with prefix, in ID order, stopping at the first error fn returns.
+func (r *GuideRepository) EachAnswer(ctx context.Context, prefix string, fn func(id, answer string) error) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"_id": 1, "answer": 1})
+	cursor, err := r.col.Find(ctx, idPrefixFilter(prefix), opts)
+	if err != nil {
+		log.Printf("[Guide Repository] Error scanning guides with ID prefix %q: %v", prefix, err)
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID     string `bson:"_id"`
+			Answer string `bson:"answer"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc.ID, doc.Answer); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// DeleteByPrefix removes every cached guide whose ID starts with prefix
+// (e.g. "owner/repo#") and returns how many were deleted. An empty prefix
+// deletes every guide.
+func (r *GuideRepository) DeleteByPrefix(ctx context.Context, prefix string) (int64, error) {
+	log.Printf("[Guide Repository] Deleting guides with ID prefix: %q", prefix)
+	res, err := r.col.DeleteMany(ctx, idPrefixFilter(prefix))
+	if err != nil {
+		log.Printf("[Guide Repository] Error deleting guides with ID prefix %q: %v", prefix, err)
+		return 0, err
+	}
+	log.Printf("[Guide Repository] Deleted %d guides with ID prefix: %q", res.DeletedCount, prefix)
+	return res.DeletedCount, nil
+}
+
+// idPrefixFilter matches documents whose _id starts with prefix.
+func idPrefixFilter(prefix string) bson.M {
+	if prefix == "" {
+		return bson.M{}
+	}
+	return bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}
+}
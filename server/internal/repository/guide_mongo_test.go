@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFindByRepoAndDateRange(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		from, to         time.Time
+		wantGTE, wantLT  bool
+		wantCreatedRange bool
+	}{
+		{"both bounds", from, to, true, true, true},
+		{"from only", from, time.Time{}, true, false, true},
+		{"to only", time.Time{}, to, false, true, true},
+		{"open", time.Time{}, time.Time{}, false, false, false},
+	}
+	mt := newMockMongo(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			created := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+			mt.AddMockResponses(cursorReply(bson.D{
+				{Key: "_id", Value: "o/r#1"},
+				{Key: "issue", Value: bson.D{{Key: "title", Value: "Parser crash"}}},
+				{Key: "created_at", Value: created},
+			}))
+			repo := &GuideRepository{col: mt.Coll}
+
+			guides, err := repo.FindByRepoAndDateRange(context.Background(), "o/r", tt.from, tt.to)
+			if err != nil {
+				mt.Fatalf("FindByRepoAndDateRange: %v", err)
+			}
+			if len(guides) != 1 || guides[0].ID != "o/r#1" || guides[0].Issue.Title != "Parser crash" || !guides[0].CreatedAt.Equal(created) {
+				mt.Errorf("guides = %+v, want the o/r#1 summary", guides)
+			}
+
+			cmd := mt.GetStartedEvent().Command
+			filter := cmd.Lookup("filter").Document()
+			if re := filter.Lookup("_id", "$regex").StringValue(); re != "^o/r#" {
+				mt.Errorf("_id regex = %q, want ^o/r#", re)
+			}
+			createdFilter, hasRange := filter.Lookup("created_at").DocumentOK()
+			if hasRange != tt.wantCreatedRange {
+				mt.Fatalf("created_at filter present = %v, want %v", hasRange, tt.wantCreatedRange)
+			}
+			if !hasRange {
+				return
+			}
+			// from is inclusive and to exclusive, so adjacent windows don't
+			// overlap
+			if gte, ok := createdFilter.Lookup("$gte").TimeOK(); ok != tt.wantGTE || (ok && !gte.Equal(from)) {
+				mt.Errorf("$gte = %v (present %v), want %v", gte, ok, tt.wantGTE)
+			}
+			if lt, ok := createdFilter.Lookup("$lt").TimeOK(); ok != tt.wantLT || (ok && !lt.Equal(to)) {
+				mt.Errorf("$lt = %v (present %v), want %v", lt, ok, tt.wantLT)
+			}
+			if _, ok := createdFilter.Lookup("$lte").TimeOK(); ok {
+				mt.Error("to is inclusive, want $lt")
+			}
+			if dir := cmd.Lookup("sort", "created_at").Int32(); dir != -1 {
+				mt.Errorf("sort created_at = %d, want -1 (newest first)", dir)
+			}
+		})
+	}
+}
+
+func TestEachAnswer(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("scans by prefix in ID order", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply(
+			bson.D{{Key: "_id", Value: "o/r#1"}, {Key: "answer", Value: "## Context\nok"}},
+			bson.D{{Key: "_id", Value: "o/r#2"}, {Key: "answer", Value: "no headers"}},
+		))
+		repo := &GuideRepository{col: mt.Coll}
+
+		got := map[string]string{}
+		err := repo.EachAnswer(context.Background(), "o/r#", func(id, answer string) error {
+			got[id] = answer
+			return nil
+		})
+		if err != nil {
+			mt.Fatalf("EachAnswer: %v", err)
+		}
+		if len(got) != 2 || got["o/r#2"] != "no headers" {
+			mt.Errorf("answers = %v, want both guides", got)
+		}
+
+		find := mt.GetStartedEvent().Command
+		if re := find.Lookup("filter", "_id", "$regex").StringValue(); re != `^o/r#` {
+			mt.Errorf("_id regex = %q, want the quoted prefix", re)
+		}
+		if find.Lookup("sort", "_id").Int32() != 1 {
+			mt.Errorf("sort = %s, want _id ascending", find.Lookup("sort"))
+		}
+		if _, err := find.LookupErr("projection", "answer"); err != nil {
+			mt.Errorf("projection = %s, want only the answer", find.Lookup("projection"))
+		}
+	})
+	mt.Run("stops at the first error", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: "a"}}, bson.D{{Key: "_id", Value: "b"}}))
+		repo := &GuideRepository{col: mt.Coll}
+
+		stop := errors.New("stop")
+		var calls int
+		err := repo.EachAnswer(context.Background(), "", func(id, answer string) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			mt.Errorf("EachAnswer = %v after %d calls, want stop after 1", err, calls)
+		}
+	})
+}
+
+func TestGuideContextRoundTrip(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("sources and prompt", func(mt *mtest.T) {
+		repo := &GuideRepository{col: mt.Coll}
+		guide := models.Guide{
+			ID:      "o/r#1",
+			Answer:  "1) Read parse.go",
+			Sources: []models.GuideSource{{RepoID: "o/r", FilePath: "parse.go", Content: "func Parse() {}", Relevance: 0.8}},
+			Prompt:  "Write a guide for o/r#1",
+		}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		if err := repo.Upsert(context.Background(), guide); err != nil {
+			mt.Fatalf("Upsert: %v", err)
+		}
+		replacement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		if got := replacement.Lookup("prompt").StringValue(); got != guide.Prompt {
+			mt.Errorf("stored prompt = %q, want %q", got, guide.Prompt)
+		}
+		if got := replacement.Lookup("sources").Array().Index(0).Value().Document().Lookup("file_path").StringValue(); got != "parse.go" {
+			mt.Errorf("stored source file = %q, want parse.go", got)
+		}
+
+		mt.AddMockResponses(cursorReply(bson.D{
+			{Key: "_id", Value: "o/r#1"},
+			{Key: "answer", Value: guide.Answer},
+			{Key: "sources", Value: bson.A{bson.D{{Key: "repo_id", Value: "o/r"}, {Key: "file_path", Value: "parse.go"}, {Key: "content", Value: "func Parse() {}"}, {Key: "relevance", Value: 0.8}}}},
+			{Key: "prompt", Value: guide.Prompt},
+		}))
+		got, err := repo.FindByIssueID(context.Background(), "o/r#1")
+		if err != nil {
+			mt.Fatalf("FindByIssueID: %v", err)
+		}
+		if !reflect.DeepEqual(got.Sources, guide.Sources) || got.Prompt != guide.Prompt {
+			mt.Errorf("loaded context = %+v / %q, want %+v / %q", got.Sources, got.Prompt, guide.Sources, guide.Prompt)
+		}
+	})
+}
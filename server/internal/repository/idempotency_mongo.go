@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IdempotencyRepository stores responses by idempotency key for a limited
+// time, so retried requests can be answered without redoing the work.
+type IdempotencyRepository struct {
+	col *mongo.Collection
+	ttl time.Duration
+}
+
+// NewIdempotencyRepository returns an IdempotencyRepository on the collection
+// named in names whose records expire after ttl.
+func NewIdempotencyRepository(db *mongo.Database, names CollectionNames, ttl time.Duration) *IdempotencyRepository {
+	return &IdempotencyRepository{col: db.Collection(names.Idempotency), ttl: ttl}
+}
+
+// EnsureIndexes creates the TTL index that lets Mongo purge expired records.
+// Expiry is also enforced by Claim, so the index only keeps the collection
+// small.
+func (r *IdempotencyRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(r.ttl.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency TTL index: %w", err)
+	}
+	return nil
+}
+
+// Claim reserves id for a new request. It returns nil when the caller now
+// owns the key and must Complete or Release it, or the existing unexpired
+// record when the key has been used before.
+func (r *IdempotencyRepository) Claim(ctx context.Context, id, requestHash string) (*models.IdempotencyRecord, error) {
+	rec := models.IdempotencyRecord{
+		ID:          id,
+		State:       models.IdempotencyPending,
+		RequestHash: requestHash,
+		CreatedAt:   time.Now(),
+	}
+	_, err := r.col.InsertOne(ctx, rec)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	var existing models.IdempotencyRecord
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err != nil {
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	if time.Since(existing.CreatedAt) < r.ttl {
+		return &existing, nil
+	}
+
+	// Expired but not yet purged; take it over unless another request just did
+	res, err := r.col.ReplaceOne(ctx, bson.M{"_id": id, "created_at": existing.CreatedAt}, rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if res.ModifiedCount == 0 {
+		return r.Claim(ctx, id, requestHash)
+	}
+	return nil, nil
+}
+
+// Complete stores the response of the request that claimed id.
+func (r *IdempotencyRepository) Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"state":        models.IdempotencyDone,
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"body":         body,
+	}})
+	if err != nil {
+		log.Printf("[Idempotency Repository] Error storing response for %s: %v", id, err)
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release drops a pending claim so the request can be retried, e.g. after it
+// failed.
+func (r *IdempotencyRepository) Release(ctx context.Context, id string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id, "state": models.IdempotencyPending})
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -2,18 +2,23 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
 type vectorSearchResult struct {
@@ -28,16 +33,65 @@ type vectorSearchResult struct {
 	RelevanceScore  float64  `bson:"relevance_score"`
 }
 
+// toRepo builds a Repo from the fields projected by the vector search, for
+// when the full metadata cannot be loaded in time.
+func (v vectorSearchResult) toRepo() models.Repo {
+	repo := models.Repo{
+		ID:              v.ID,
+		FullName:        v.ID,
+		Name:            v.Name,
+		Description:     v.Description,
+		StargazersCount: v.StargazersCount,
+		ForksCount:      v.ForksCount,
+		Topics:          v.Topics,
+		Languages:       v.Languages,
+		Score:           v.Score,
+	}
+	if owner, name, ok := strings.Cut(v.ID, "/"); ok {
+		repo.Owner = owner
+		if repo.Name == "" {
+			repo.Name = name
+		}
+	}
+	return repo
+}
+
+// DefaultLookupTimeout bounds each federated metadata lookup in VectorSearch.
+const DefaultLookupTimeout = 3 * time.Second
+
+// repoBucket is the GCS bucket holding the indexed repository files.
+const repoBucket = "ai-in-action-repo-bucket"
+
+// CollectionNames lists the Mongo collections the repositories operate on.
+type CollectionNames struct {
+	Meta          string // repository embeddings in the primary DB
+	Code          string // code chunk embeddings in the primary DB
+	FederatedMeta string // full repository metadata in the federated DB
+	Guides        string // cached AI-generated guides
+	Summaries     string // cached issue summaries
+	Feedback      string // user ratings of guides
+	Idempotency   string // responses stored by Idempotency-Key
+}
+
 // RepoMongo implements the repository interface for MongoDB.
 type RepoMongo struct {
 	metaColl          *mongo.Collection // repos_meta collection from primary DB (for repository embeddings)
 	codeColl          *mongo.Collection // repos_code collection from primary DB (for code chunks)
 	federatedMetaColl *mongo.Collection // repos collection from federated DB (for full metadata)
+	searchMetaColl    *mongo.Collection // metaColl as read by vector searches; may be a replica
+	searchCodeColl    *mongo.Collection // codeColl as read by vector searches and chunk lookups
 	storageClient     *storage.Client
+	lookupTimeout     time.Duration
+	aggregateAttempts int
+	maxEnriched       int // VectorSearch results given full metadata; 0 enriches all
+
+	// findMeta replaces FindByID for VectorSearch's metadata lookups; tests
+	// set it to simulate slow lookups
+	findMeta func(ctx context.Context, id string) (*models.Repo, error)
 }
 
 // NewRepoRepository creates a new MongoDB repository instance.
-func NewRepoRepository(primaryDB, federatedDB *mongo.Database, storageClient *storage.Client) (*RepoMongo, error) {
+func NewRepoRepository(primaryDB, federatedDB *mongo.Database, storageClient *storage.Client, names CollectionNames) (*RepoMongo, error) {
 	// Verify repos_meta collection exists in primaryDB
 	collections, err := primaryDB.ListCollectionNames(context.Background(), bson.M{})
 	if err != nil {
@@ -46,13 +100,13 @@ func NewRepoRepository(primaryDB, federatedDB *mongo.Database, storageClient *st
 
 	hasPrimaryMeta := false
 	for _, coll := range collections {
-		if coll == "repos_meta" {
+		if coll == names.Meta {
 			hasPrimaryMeta = true
 		}
 	}
 
 	if !hasPrimaryMeta {
-		log.Printf("Warning: repos_meta collection not found in primaryDB. Vector search may not work.")
+		log.Printf("Warning: %s collection not found in primaryDB. Vector search may not work.", names.Meta)
 	}
 
 	// Verify repos_code collection exists in primaryDB
@@ -63,13 +117,13 @@ func NewRepoRepository(primaryDB, federatedDB *mongo.Database, storageClient *st
 
 	hasPrimaryCode := false
 	for _, coll := range collections {
-		if coll == "repos_code" {
+		if coll == names.Code {
 			hasPrimaryCode = true
 		}
 	}
 
 	if !hasPrimaryCode {
-		log.Printf("Warning: repos_code collection not found in primaryDB. Code search may not work.")
+		log.Printf("Warning: %s collection not found in primaryDB. Code search may not work.", names.Code)
 	}
 
 	// Verify repos collection exists in federatedDB
@@ -80,33 +134,108 @@ func NewRepoRepository(primaryDB, federatedDB *mongo.Database, storageClient *st
 
 	hasFederatedRepos := false
 	for _, coll := range collections {
-		if coll == "repos_meta" {
+		if coll == names.FederatedMeta {
 			hasFederatedRepos = true
 		}
 	}
 
 	if !hasFederatedRepos {
-		log.Printf("Warning: repos_meta collection not found in federatedDB. Full repository details may not be available.")
+		log.Printf("Warning: %s collection not found in federatedDB. Full repository details may not be available.", names.FederatedMeta)
 	}
 
+	metaColl := primaryDB.Collection(names.Meta)
+	codeColl := primaryDB.Collection(names.Code)
 	return &RepoMongo{
-		metaColl:          primaryDB.Collection("repos_meta"),
-		codeColl:          primaryDB.Collection("repos_code"),
-		federatedMetaColl: federatedDB.Collection("repos_meta"),
+		metaColl:          metaColl,
+		codeColl:          codeColl,
+		federatedMetaColl: federatedDB.Collection(names.FederatedMeta),
+		searchMetaColl:    metaColl,
+		searchCodeColl:    codeColl,
 		storageClient:     storageClient,
+		lookupTimeout:     DefaultLookupTimeout,
+		aggregateAttempts: DefaultAggregateAttempts,
 	}, nil
 }
 
-// FindByID retrieves a repository by its ID.
+// SetSearchDatabase sends the read-heavy search queries (vector searches and
+// code chunk lookups) to the same collections in db, typically one opened
+// with a secondary read preference or on a read-only replica connection.
+// Writes and reads that must see them, such as cached READMEs, stay on the
+// primary database.
+func (r *RepoMongo) SetSearchDatabase(db *mongo.Database) {
+	r.searchMetaColl = db.Collection(r.metaColl.Name())
+	r.searchCodeColl = db.Collection(r.codeColl.Name())
+}
+
+// SetAggregateAttempts sets how many times a vector search aggregation is
+// tried when it fails with a transient error; 1 disables retries.
+func (r *RepoMongo) SetAggregateAttempts(n int) {
+	if n > 0 {
+		r.aggregateAttempts = n
+	}
+}
+
+// lookupMeta fetches a VectorSearch result's full metadata.
+func (r *RepoMongo) lookupMeta(ctx context.Context, id string) (*models.Repo, error) {
+	if r.findMeta != nil {
+		return r.findMeta(ctx, id)
+	}
+	return r.FindByID(ctx, id)
+}
+
+// SetLookupTimeout bounds each federated metadata lookup in VectorSearch; a
+// lookup that takes longer falls back to the vector index's own fields.
+func (r *RepoMongo) SetLookupTimeout(d time.Duration) {
+	if d > 0 {
+		r.lookupTimeout = d
+	}
+}
+
+// SetMaxEnrichedResults limits the federated metadata lookups of VectorSearch
+// to its n most relevant results; the rest keep the fields stored with the
+// embedding. 0 enriches every result.
+func (r *RepoMongo) SetMaxEnrichedResults(n int) {
+	if n >= 0 {
+		r.maxEnriched = n
+	}
+}
+
+// FindByID retrieves a repository by its ID (full name). Re-ingestion can
+// leave several documents with the same full_name; the most recently pushed
+// one wins (ties broken by _id) and the duplication is logged.
 func (r *RepoMongo) FindByID(ctx context.Context, id string) (*models.Repo, error) {
 	filter := bson.M{"full_name": id}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "pushed_at", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(2)
+	cursor, err := r.federatedMetaColl.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find repository by full_name: %w", err)
+	}
+	var repos []models.Repo
+	if err := cursor.All(ctx, &repos); err != nil {
+		return nil, fmt.Errorf("failed to find repository by full_name: %w", err)
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("repository with full_name '%s' not found: %w", id, mongo.ErrNoDocuments)
+	}
+	if len(repos) > 1 {
+		log.Printf("Warning: duplicate repository documents for full_name %q; using _id %s (pushed_at %s)",
+			id, repos[0].ID, repos[0].PushedAt)
+	}
+	return &repos[0], nil
+}
+
+// FindByGitHubID retrieves a single repository from the federated database by
+// its numeric GitHub ID.
+func (r *RepoMongo) FindByGitHubID(ctx context.Context, id int64) (*models.Repo, error) {
 	var repo models.Repo
-	err := r.federatedMetaColl.FindOne(ctx, filter).Decode(&repo)
+	err := r.federatedMetaColl.FindOne(ctx, bson.M{"id": id}).Decode(&repo)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("repository with full_name '%s' not found", id)
+			return nil, fmt.Errorf("repository with GitHub id %d not found: %w", id, err)
 		}
-		return nil, fmt.Errorf("failed to find repository by full_name: %w", err)
+		return nil, fmt.Errorf("failed to find repository by GitHub id: %w", err)
 	}
 	return &repo, nil
 }
@@ -126,11 +255,14 @@ func (r *RepoMongo) FindByName(ctx context.Context, name string) (*models.Repo,
 }
 
 // VectorSearch performs a vector similarity search on the repository embeddings.
-func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k int) ([]models.Repo, error) {
+// Repositories whose full metadata cannot be loaded from the federated DB are
+// left out of the results and reported in the returned warnings, so callers
+// can tell a partial result set from a complete one.
+func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k int) ([]models.Repo, []string, error) {
 	log.Printf("Building vector search pipeline with query vector length: %d", len(queryVector))
 
 	// First, let's check what's in the primary meta collection (repos_meta)
-	count, err := r.metaColl.CountDocuments(ctx, bson.M{})
+	count, err := r.searchMetaColl.CountDocuments(ctx, bson.M{})
 	if err != nil {
 		log.Printf("Error counting documents in primary meta collection: %v", err)
 	} else {
@@ -142,7 +274,7 @@ func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k i
 		ID        string    `bson:"_id"`
 		Embedding []float32 `bson:"embedding"`
 	}
-	err = r.metaColl.FindOne(ctx, bson.M{}).Decode(&sampleDoc)
+	err = r.searchMetaColl.FindOne(ctx, bson.M{}).Decode(&sampleDoc)
 	if err != nil {
 		log.Printf("Error sampling document from primary meta collection: %v", err)
 	} else {
@@ -172,31 +304,26 @@ func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k i
 				"topics":           1,
 				"languages":        1,
 				"score":            bson.M{"$meta": "vectorSearchScore"},
-				// Add relevance score calculation
+				// Add relevance score calculation. Missing counts count as 0 so
+				// sparsely populated documents rank low instead of yielding null
 				"relevance_score": bson.M{
 					"$add": []interface{}{
 						bson.M{"$multiply": []interface{}{bson.M{"$meta": "vectorSearchScore"}, 0.7}},
-						bson.M{"$multiply": []interface{}{bson.M{"$divide": []interface{}{"$stargazers_count", 1000}}, 0.2}},
-						bson.M{"$multiply": []interface{}{bson.M{"$divide": []interface{}{"$forks_count", 100}}, 0.1}},
+						bson.M{"$multiply": []interface{}{bson.M{"$divide": []interface{}{bson.M{"$ifNull": []interface{}{"$stargazers_count", 0}}, 1000}}, 0.2}},
+						bson.M{"$multiply": []interface{}{bson.M{"$divide": []interface{}{bson.M{"$ifNull": []interface{}{"$forks_count", 0}}, 100}}, 0.1}},
 					},
 				},
 			}},
 		},
 		{
-			{"$sort", bson.M{"relevance_score": -1}},
+			{Key: "$sort", Value: bson.D{{Key: "relevance_score", Value: -1}, {Key: "_id", Value: 1}}},
 		},
 	}
 
 	log.Printf("Executing vector search pipeline")
-	cursor, err := r.metaColl.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, fmt.Errorf("vector search failed: %w", err)
-	}
-	defer cursor.Close(ctx)
-
 	var results []vectorSearchResult
-	if err := cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("vector search failed: failed to decode results: %w", err)
+	if err := aggregateAll(ctx, r.searchMetaColl, pipeline, &results, r.aggregateAttempts); err != nil {
+		return nil, nil, fmt.Errorf("vector search failed: %w", err)
 	}
 
 	log.Printf("Vector search returned %d initial results", len(results))
@@ -211,12 +338,21 @@ func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k i
 	}
 	var (
 		enriched  []repoWithIndex
+		warnings  []string
 		mu        sync.Mutex
 		wg        sync.WaitGroup
 		semaphore = make(chan struct{}, 10)
 	)
 
 	for i, result := range results {
+		// Results come sorted by relevance; past the limit, skip the lookup
+		if r.maxEnriched > 0 && i >= r.maxEnriched {
+			mu.Lock()
+			enriched = append(enriched, repoWithIndex{i, result.toRepo()})
+			mu.Unlock()
+			continue
+		}
+
 		wg.Add(1)
 		semaphore <- struct{}{}
 
@@ -225,9 +361,24 @@ func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k i
 			defer func() { <-semaphore }()
 
 			log.Printf("Looking up metadata for full_name: %s", result.ID)
-			fullRepo, err := r.FindByID(ctx, result.ID)
+			lookupCtx, cancel := context.WithTimeout(ctx, r.lookupTimeout)
+			fullRepo, err := r.lookupMeta(lookupCtx, result.ID)
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				// One slow lookup must not hold up the rest; degrade to the
+				// fields stored alongside the embedding
+				log.Printf("Warning: Metadata lookup for repo %s timed out after %s", result.ID, r.lookupTimeout)
+				mu.Lock()
+				enriched = append(enriched, repoWithIndex{i, result.toRepo()})
+				warnings = append(warnings, fmt.Sprintf("metadata lookup timed out for %s; partial metadata returned", result.ID))
+				mu.Unlock()
+				return
+			}
 			if err != nil {
 				log.Printf("Warning: Could not find full metadata for repo %s from federated DB: %v", result.ID, err)
+				mu.Lock()
+				warnings = append(warnings, fmt.Sprintf("metadata unavailable for %s; result omitted", result.ID))
+				mu.Unlock()
 				return
 			}
 			fullRepo.Score = result.Score
@@ -262,7 +413,12 @@ func (r *RepoMongo) VectorSearch(ctx context.Context, queryVector []float32, k i
 		log.Printf("Result #%d: %s (score: %.4f)", i+1, repo.Name, repo.Score)
 	}
 
-	return finalResults, nil
+	if len(warnings) > 0 {
+		sort.Strings(warnings)
+		log.Printf("Vector search dropped %d of %d results", len(warnings), len(results))
+	}
+
+	return finalResults, warnings, nil
 }
 
 // CodeVectorSearch performs a vector similarity search on code chunks.
@@ -283,11 +439,13 @@ func (r *RepoMongo) CodeVectorSearch(ctx context.Context, repoID string, queryVe
 		},
 		{
 			{"$project", bson.M{
-				"_id":     1,
-				"repo_id": 1,
-				"text":    1,
-				"file":    1,
-				"score":   bson.M{"$meta": "vectorSearchScore"},
+				"_id":        1,
+				"repo_id":    1,
+				"text":       1,
+				"file":       1,
+				"language":   1,
+				"chunk_type": 1,
+				"score":      bson.M{"$meta": "vectorSearchScore"},
 			}},
 		},
 		{
@@ -296,15 +454,9 @@ func (r *RepoMongo) CodeVectorSearch(ctx context.Context, repoID string, queryVe
 	}
 
 	log.Printf("Executing code vector search pipeline for repo %s", repoID)
-	cursor, err := r.codeColl.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, fmt.Errorf("code vector search failed: %w", err)
-	}
-	defer cursor.Close(ctx)
-
 	var results []models.CodeChunk
-	if err := cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("code vector search failed: failed to decode results: %w", err)
+	if err := aggregateAll(ctx, r.searchCodeColl, pipeline, &results, r.aggregateAttempts); err != nil {
+		return nil, fmt.Errorf("code vector search failed: %w", err)
 	}
 
 	log.Printf("Code vector search returned %d initial results for repo %s", len(results), repoID)
@@ -358,13 +510,16 @@ func (r *RepoMongo) CodeVectorSearch(ctx context.Context, repoID string, queryVe
 	return finalResults, nil
 }
 
-// GetTopContextChunks retrieves the most relevant code chunks for a repository.
-func (r *RepoMongo) GetTopContextChunks(ctx context.Context, repoID string, k int) ([]models.CodeChunk, error) {
+// GetTopContextChunks retrieves the most relevant code chunks for a repository,
+// skipping the first offset. Ties on score are broken by _id so pages are
+// stable across calls.
+func (r *RepoMongo) GetTopContextChunks(ctx context.Context, repoID string, k, offset int) ([]models.CodeChunk, error) {
 	opts := options.Find().
-		SetSort(bson.M{"score": -1}).
+		SetSort(bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
 		SetLimit(int64(k))
 
-	cursor, err := r.codeColl.Find(ctx, bson.M{"repo_id": repoID}, opts)
+	cursor, err := r.searchCodeColl.Find(ctx, bson.M{"repo_id": repoID}, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find code chunks: %w", err)
 	}
@@ -377,28 +532,228 @@ func (r *RepoMongo) GetTopContextChunks(ctx context.Context, repoID string, k in
 	return chunks, nil
 }
 
-// GetAllRepos retrieves all repositories from the federated database.
-func (r *RepoMongo) GetAllRepos(ctx context.Context) ([]models.Repo, error) {
-	cursor, err := r.federatedMetaColl.Find(ctx, bson.M{})
+// GetTopContextChunksByType is GetTopContextChunks restricted to chunks of
+// chunkType. README chunks indexed before chunk_type was recorded are matched
+// by file name.
+func (r *RepoMongo) GetTopContextChunksByType(ctx context.Context, repoID, chunkType string, k int) ([]models.CodeChunk, error) {
+	typeFilter := bson.A{bson.M{"chunk_type": chunkType}}
+	if chunkType == models.ChunkTypeReadme {
+		typeFilter = append(typeFilter, bson.M{
+			"chunk_type": bson.M{"$exists": false},
+			"file":       bson.M{"$regex": `(^|/)readme[^/]*$`, "$options": "i"},
+		})
+	}
+	filter := bson.M{"repo_id": repoID, "$or": typeFilter}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(k))
+
+	cursor, err := r.searchCodeColl.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s chunks: %w", chunkType, err)
+	}
+	defer cursor.Close(ctx)
+
+	var chunks []models.CodeChunk
+	if err := cursor.All(ctx, &chunks); err != nil {
+		return nil, fmt.Errorf("failed to decode %s chunks: %w", chunkType, err)
+	}
+	return chunks, nil
+}
+
+// GetAllRepos retrieves one page of repositories from the federated database,
+// ordered by sort (ties broken by _id so pages are stable), together with the
+// total number of repositories. A zero sort leaves the natural order.
+func (r *RepoMongo) GetAllRepos(ctx context.Context, limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error) {
+	total, err := r.federatedMetaColl.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count repositories: %w", err)
+	}
+
+	opts := options.Find().SetSkip(int64(offset)).SetLimit(int64(limit))
+	if sort.Field != "" {
+		direction := 1
+		if sort.Descending {
+			direction = -1
+		}
+		opts.SetSort(bson.D{{Key: sort.Field, Value: direction}, {Key: "_id", Value: 1}})
+	}
+	cursor, err := r.federatedMetaColl.Find(ctx, bson.M{}, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find repositories: %w", err)
+		return nil, 0, fmt.Errorf("failed to find repositories: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var repos []models.Repo
+	repos := []models.Repo{}
 	if err := cursor.All(ctx, &repos); err != nil {
-		return nil, fmt.Errorf("failed to decode repositories: %w", err)
+		return nil, 0, fmt.Errorf("failed to decode repositories: %w", err)
+	}
+	return repos, total, nil
+}
+
+// FindReadme returns the README cached for a repository by SetReadme, or ""
+// when none has been cached.
+func (r *RepoMongo) FindReadme(ctx context.Context, id string) (string, error) {
+	var doc struct {
+		Readme string `bson:"readme"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"readme": 1})
+	err := r.metaColl.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find cached readme: %w", err)
+	}
+	return doc.Readme, nil
+}
+
+// SetReadme caches a repository's README. The federated collection FindByID
+// reads from is read-only, so it is stored on the repository's document in
+// the primary repos_meta collection (created if missing).
+func (r *RepoMongo) SetReadme(ctx context.Context, id, readme string) error {
+	_, err := r.metaColl.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"readme": readme}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to cache readme: %w", err)
+	}
+	return nil
+}
+
+// GroupByLanguage buckets the federated repositories by primary language
+// (the language field, else the first of languages), largest bucket first.
+// Each bucket lists up to perBucket of its most-starred repositories.
+func (r *RepoMongo) GroupByLanguage(ctx context.Context, perBucket int) ([]models.LanguageBucket, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{
+			"_id":              0,
+			"full_name":        1,
+			"owner":            1,
+			"name":             1,
+			"description":      1,
+			"stargazers_count": 1,
+			"image_url":        1,
+			"primary_language": bson.M{"$ifNull": bson.A{"$language", bson.M{"$arrayElemAt": bson.A{"$languages", 0}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "stargazers_count", Value: -1}, {Key: "full_name", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{"$primary_language", ""}},
+			"count": bson.M{"$sum": 1},
+			"repos": bson.M{"$push": bson.M{
+				"_id":              "$full_name",
+				"full_name":        "$full_name",
+				"owner":            "$owner",
+				"name":             "$name",
+				"description":      "$description",
+				"stargazers_count": "$stargazers_count",
+				"image_url":        "$image_url",
+				"language":         "$primary_language",
+			}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"count": 1,
+			"repos": bson.M{"$slice": bson.A{"$repos", perBucket}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	buckets := []models.LanguageBucket{}
+	if err := aggregateAll(ctx, r.federatedMetaColl, pipeline, &buckets, r.aggregateAttempts); err != nil {
+		return nil, fmt.Errorf("failed to group repositories by language: %w", err)
+	}
+	return buckets, nil
+}
+
+// FindReposWithoutEmbeddings returns the full names of repositories present in
+// the federated dataset that have no embedding in the primary repos_meta
+// collection, and so can never be returned by VectorSearch.
+func (r *RepoMongo) FindReposWithoutEmbeddings(ctx context.Context) ([]string, error) {
+	embedded, err := r.metaColl.Distinct(ctx, "_id", bson.M{
+		"embedding": bson.M{"$exists": true, "$ne": bson.A{}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedded repositories: %w", err)
+	}
+	hasEmbedding := make(map[string]bool, len(embedded))
+	for _, id := range embedded {
+		if name, ok := id.(string); ok {
+			hasEmbedding[name] = true
+		}
+	}
+
+	all, err := r.federatedMetaColl.Distinct(ctx, "full_name", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list federated repositories: %w", err)
+	}
+
+	missing := []string{}
+	for _, v := range all {
+		name, ok := v.(string)
+		if !ok || name == "" || hasEmbedding[name] {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+
+	log.Printf("Found %d of %d repositories without embeddings", len(missing), len(all))
+	return missing, nil
+}
+
+// CheckBucket verifies that the repository files bucket exists and this
+// server may read it, so a misconfiguration shows at startup rather than on
+// the first file request.
+func (r *RepoMongo) CheckBucket(ctx context.Context) error {
+	_, err := r.storageClient.Bucket(repoBucket).Attrs(ctx)
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrBucketNotExist):
+		return fmt.Errorf("GCS bucket %s does not exist", repoBucket)
+	case errors.As(err, &apiErr) && (apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusUnauthorized):
+		return fmt.Errorf("access to GCS bucket %s denied: %w", repoBucket, err)
+	}
+	return fmt.Errorf("failed to check GCS bucket %s: %w", repoBucket, err)
+}
+
+// ListFiles returns the paths of every file stored in the GCS bucket for a
+// repository ("owner/name"), relative to the repository root and sorted.
+func (r *RepoMongo) ListFiles(ctx context.Context, repoID string) ([]string, error) {
+	owner, name, ok := strings.Cut(repoID, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid repo id: %s", repoID)
+	}
+	prefix := fmt.Sprintf("input/repos/%s--%s/", owner, name)
+
+	it := r.storageClient.Bucket(repoBucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	files := []string{}
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		files = append(files, strings.TrimPrefix(attrs.Name, prefix))
 	}
-	return repos, nil
+	sort.Strings(files)
+
+	log.Printf("Listed %d files for repo %s", len(files), repoID)
+	return files, nil
 }
 
-// GetFileContent retrieves the content of a file from the GCS bucket.
+// GetFileContent retrieves the content of a file from the GCS bucket. A
+// missing file is reported wrapping storage.ErrObjectNotExist.
 func (r *RepoMongo) GetFileContent(ctx context.Context, repoID string, filePath string) (string, error) {
 	// Extract owner and repo name from the filePath
 	parts := strings.SplitN(filePath, "/", 2)
 	if len(parts) != 2 {
 		log.Printf("Invalid file path format - FilePath: %s", filePath)
-		return "", fmt.Errorf("invalid file path format: %s", filePath)
+		return "", fmt.Errorf("invalid file path format: %s: %w", filePath, storage.ErrObjectNotExist)
 	}
 
 	// Construct the normalized repoID (owner--repo)
@@ -410,15 +765,15 @@ func (r *RepoMongo) GetFileContent(ctx context.Context, repoID string, filePath
 	fullPath := fmt.Sprintf("input/repos/%s/%s", normalizedRepoID, restOfPath)
 
 	// Log the exact GCS path being accessed
-	log.Printf("Accessing GCS bucket:\nBucket: ai-in-action-repo-bucket\nPath: %s", fullPath)
+	log.Printf("Accessing GCS bucket:\nBucket: %s\nPath: %s", repoBucket, fullPath)
 
 	// Get the object from GCS
-	obj := r.storageClient.Bucket("ai-in-action-repo-bucket").Object(fullPath)
+	obj := r.storageClient.Bucket(repoBucket).Object(fullPath)
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
 			log.Printf("File not found in GCS bucket - Path: %s", fullPath)
-			return "", fmt.Errorf("file not found: %s in repo %s", filePath, repoID)
+			return "", fmt.Errorf("file not found: %s in repo %s: %w", filePath, repoID, err)
 		}
 		log.Printf("GCS error while reading file - Path: %s, Error: %v", fullPath, err)
 		return "", fmt.Errorf("failed to read file: %w", err)
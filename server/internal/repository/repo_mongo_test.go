@@ -0,0 +1,761 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"google.golang.org/api/option"
+)
+
+// newMockMongo returns a mock-mode mtest.T; tests queue server replies on it
+// with AddMockResponses.
+func newMockMongo(t *testing.T) *mtest.T {
+	return mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+}
+
+// newMockRepo returns a RepoMongo whose collections all send their commands
+// to mt's mock deployment.
+func newMockRepo(mt *mtest.T) *RepoMongo {
+	return &RepoMongo{
+		metaColl:          mt.Coll,
+		codeColl:          mt.Coll,
+		federatedMetaColl: mt.Coll,
+		searchMetaColl:    mt.Coll,
+		searchCodeColl:    mt.Coll,
+		lookupTimeout:     DefaultLookupTimeout,
+		aggregateAttempts: 1,
+	}
+}
+
+// distinctReply is the server reply to a distinct command.
+func distinctReply(values ...any) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A(values)})
+}
+
+func TestFindReposWithoutEmbeddings(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("mixed", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			distinctReply("a/embedded", "c/embedded"),                               // repos_meta with embeddings
+			distinctReply("c/embedded", "b/missing", "a/embedded", "d/missing", ""), // federated repos
+		)
+
+		missing, err := newMockRepo(mt).FindReposWithoutEmbeddings(context.Background())
+		if err != nil {
+			mt.Fatalf("FindReposWithoutEmbeddings: %v", err)
+		}
+		if want := []string{"b/missing", "d/missing"}; !reflect.DeepEqual(missing, want) {
+			mt.Errorf("missing = %v, want %v", missing, want)
+		}
+	})
+	mt.Run("all embedded", func(mt *mtest.T) {
+		mt.AddMockResponses(distinctReply("a/r"), distinctReply("a/r"))
+
+		missing, err := newMockRepo(mt).FindReposWithoutEmbeddings(context.Background())
+		if err != nil {
+			mt.Fatalf("FindReposWithoutEmbeddings: %v", err)
+		}
+		if missing == nil || len(missing) != 0 {
+			mt.Errorf("missing = %#v, want an empty, non-nil list", missing)
+		}
+	})
+}
+
+// cursorReply is the server reply to a find or aggregate returning docs.
+func cursorReply(docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, docs...)
+}
+
+func TestVectorSearchReportsFailedEnrichment(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("partial", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: 2}}),          // CountDocuments
+			cursorReply(bson.D{{Key: "_id", Value: "a/fail"}}), // sample document
+			cursorReply(
+				bson.D{{Key: "_id", Value: "a/fail"}, {Key: "score", Value: 0.9}, {Key: "relevance_score", Value: 0.9}},
+				bson.D{{Key: "_id", Value: "b/kept"}, {Key: "score", Value: 0.8}, {Key: "relevance_score", Value: 0.8}},
+			), // vector search
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Name: "BadValue", Message: "federated source unavailable"}), // lookup of a/fail
+		)
+		repo := newMockRepo(mt)
+		repo.SetMaxEnrichedResults(1) // only a/fail is looked up, so the mock replies stay in order
+
+		repos, warnings, err := repo.VectorSearch(context.Background(), []float32{0.1, 0.2}, 2)
+		if err != nil {
+			mt.Fatalf("VectorSearch: %v", err)
+		}
+		if len(repos) != 1 || repos[0].ID != "b/kept" {
+			mt.Errorf("repos = %+v, want only b/kept", repos)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "a/fail") {
+			mt.Errorf("warnings = %q, want one naming a/fail", warnings)
+		}
+	})
+	mt.Run("complete", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: 1}}),
+			cursorReply(bson.D{{Key: "_id", Value: "a/r"}}),
+			cursorReply(bson.D{{Key: "_id", Value: "a/r"}, {Key: "score", Value: 0.9}}),
+			cursorReply(bson.D{{Key: "_id", Value: "a/r"}, {Key: "full_name", Value: "a/r"}, {Key: "name", Value: "r"}}),
+		)
+
+		repos, warnings, err := newMockRepo(mt).VectorSearch(context.Background(), []float32{0.1, 0.2}, 1)
+		if err != nil {
+			mt.Fatalf("VectorSearch: %v", err)
+		}
+		if len(repos) != 1 || repos[0].Name != "r" || repos[0].Score != 0.9 {
+			mt.Errorf("repos = %+v, want the enriched a/r", repos)
+		}
+		if len(warnings) != 0 {
+			mt.Errorf("warnings = %q, want none", warnings)
+		}
+	})
+}
+
+func TestVectorSearchAbandonsSlowLookup(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("one lookup hangs", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: 3}}),
+			cursorReply(bson.D{{Key: "_id", Value: "a/fast"}}),
+			cursorReply(
+				bson.D{{Key: "_id", Value: "a/fast"}, {Key: "name", Value: "fast"}, {Key: "score", Value: 0.9}},
+				bson.D{{Key: "_id", Value: "b/slow"}, {Key: "name", Value: "slow"}, {Key: "score", Value: 0.8}},
+				bson.D{{Key: "_id", Value: "c/fast"}, {Key: "name", Value: "fast2"}, {Key: "score", Value: 0.7}},
+			),
+		)
+		repo := newMockRepo(mt)
+		repo.SetLookupTimeout(50 * time.Millisecond)
+		repo.findMeta = func(ctx context.Context, id string) (*models.Repo, error) {
+			if id == "b/slow" {
+				<-ctx.Done() // a federated query that never answers
+				return nil, ctx.Err()
+			}
+			return &models.Repo{ID: id, FullName: id, Description: "enriched"}, nil
+		}
+
+		start := time.Now()
+		repos, warnings, err := repo.VectorSearch(context.Background(), []float32{0.1, 0.2}, 3)
+		if err != nil {
+			mt.Fatalf("VectorSearch: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			mt.Errorf("VectorSearch took %s; the slow lookup was not abandoned", elapsed)
+		}
+		if len(repos) != 3 {
+			mt.Fatalf("got %d repos, want all 3", len(repos))
+		}
+		for _, r := range repos {
+			switch r.ID {
+			case "b/slow":
+				if r.Name != "slow" || r.Description != "" {
+					mt.Errorf("slow repo = %+v, want the vector-only fields", r)
+				}
+			default:
+				if r.Description != "enriched" {
+					mt.Errorf("%s = %+v, want its full metadata", r.ID, r)
+				}
+			}
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "b/slow") {
+			mt.Errorf("warnings = %q, want one naming b/slow", warnings)
+		}
+	})
+}
+
+// customNames are collection names that differ from every default.
+var customNames = CollectionNames{
+	Meta:          "alt_meta",
+	Code:          "alt_code",
+	FederatedMeta: "alt_repos",
+	Guides:        "alt_guides",
+	Summaries:     "alt_summaries",
+	Feedback:      "alt_feedback",
+	Idempotency:   "alt_idempotency",
+}
+
+func TestRepositoriesUseConfiguredCollections(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("repos", func(mt *mtest.T) {
+		listing := cursorReply(bson.D{{Key: "name", Value: "alt_meta"}}, bson.D{{Key: "name", Value: "alt_code"}}, bson.D{{Key: "name", Value: "alt_repos"}})
+		mt.AddMockResponses(listing, listing, listing)
+
+		repo, err := NewRepoRepository(mt.DB, mt.DB, nil, customNames)
+		if err != nil {
+			mt.Fatalf("NewRepoRepository: %v", err)
+		}
+		for _, c := range []struct{ got, want string }{
+			{repo.metaColl.Name(), "alt_meta"},
+			{repo.searchMetaColl.Name(), "alt_meta"},
+			{repo.codeColl.Name(), "alt_code"},
+			{repo.searchCodeColl.Name(), "alt_code"},
+			{repo.federatedMetaColl.Name(), "alt_repos"},
+		} {
+			if c.got != c.want {
+				mt.Errorf("collection = %q, want %q", c.got, c.want)
+			}
+		}
+	})
+	mt.Run("guides", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply(), cursorReply())
+		guides := NewGuideRepository(mt.DB, customNames)
+
+		guides.FindByIssueID(context.Background(), "o/r#1")
+		if got := mt.GetStartedEvent().Command.Lookup("find").StringValue(); got != "alt_guides" {
+			mt.Errorf("guide lookup queried %q, want alt_guides", got)
+		}
+		guides.FindSummaryByIssueID(context.Background(), "o/r#1")
+		if got := mt.GetStartedEvent().Command.Lookup("find").StringValue(); got != "alt_summaries" {
+			mt.Errorf("summary lookup queried %q, want alt_summaries", got)
+		}
+	})
+	mt.Run("feedback and idempotency", func(mt *mtest.T) {
+		if got := NewFeedbackRepository(mt.DB, customNames).col.Name(); got != "alt_feedback" {
+			mt.Errorf("feedback collection = %q, want alt_feedback", got)
+		}
+		if got := NewIdempotencyRepository(mt.DB, customNames, time.Hour).col.Name(); got != "alt_idempotency" {
+			mt.Errorf("idempotency collection = %q, want alt_idempotency", got)
+		}
+	})
+}
+
+func TestGetTopContextChunksStableOrder(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("tied scores", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(
+				bson.D{{Key: "_id", Value: "c3"}, {Key: "file", Value: "c.go"}, {Key: "score", Value: 0.5}},
+				bson.D{{Key: "_id", Value: "c4"}, {Key: "file", Value: "d.go"}, {Key: "score", Value: 0.5}},
+			),
+		)
+
+		chunks, err := newMockRepo(mt).GetTopContextChunks(context.Background(), "o/r", 2, 2)
+		if err != nil {
+			mt.Fatalf("GetTopContextChunks: %v", err)
+		}
+		if len(chunks) != 2 || chunks[0].ID != "c3" || chunks[1].ID != "c4" {
+			mt.Errorf("chunks = %+v, want c3 then c4", chunks)
+		}
+
+		find := mt.GetStartedEvent().Command
+		if got := find.Lookup("filter", "repo_id").StringValue(); got != "o/r" {
+			mt.Errorf("filter repo_id = %q, want o/r", got)
+		}
+		sort, err := find.Lookup("sort").Document().Elements()
+		if err != nil {
+			mt.Fatalf("sort: %v", err)
+		}
+		if len(sort) != 2 || sort[0].Key() != "score" || sort[0].Value().Int32() != -1 ||
+			sort[1].Key() != "_id" || sort[1].Value().Int32() != 1 {
+			mt.Errorf("sort = %v, want score descending then _id ascending", sort)
+		}
+		if find.Lookup("skip").Int64() != 2 || find.Lookup("limit").Int64() != 2 {
+			mt.Errorf("skip %v limit %v, want 2 and 2", find.Lookup("skip"), find.Lookup("limit"))
+		}
+	})
+}
+
+func TestFindByIDMatchesFullName(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("found", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: "r1"}, {Key: "name", Value: "widgets"}, {Key: "full_name", Value: "octo/widgets"}}))
+
+		repo, err := newMockRepo(mt).FindByID(context.Background(), "octo/widgets")
+		if err != nil {
+			mt.Fatalf("FindByID: %v", err)
+		}
+		if repo.FullName != "octo/widgets" {
+			mt.Errorf("repo = %+v, want octo/widgets", repo)
+		}
+		if got := mt.GetStartedEvent().Command.Lookup("filter", "full_name").StringValue(); got != "octo/widgets" {
+			mt.Errorf("filter full_name = %q, want octo/widgets", got)
+		}
+	})
+	mt.Run("bare name is not found", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply())
+
+		if _, err := newMockRepo(mt).FindByID(context.Background(), "widgets"); !errors.Is(err, mongo.ErrNoDocuments) {
+			mt.Errorf("err = %v, want ErrNoDocuments", err)
+		}
+	})
+}
+
+func TestFindByGitHubID(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("found", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: "r1"}, {Key: "full_name", Value: "octo/widgets"}, {Key: "id", Value: int64(1296269)}}))
+
+		repo, err := newMockRepo(mt).FindByGitHubID(context.Background(), 1296269)
+		if err != nil {
+			mt.Fatalf("FindByGitHubID: %v", err)
+		}
+		if repo.FullName != "octo/widgets" || repo.GitHubID != 1296269 {
+			mt.Errorf("repo = %+v, want octo/widgets with its GitHub id", repo)
+		}
+		if got := mt.GetStartedEvent().Command.Lookup("filter", "id").Int64(); got != 1296269 {
+			mt.Errorf("filter id = %d, want 1296269", got)
+		}
+	})
+	mt.Run("missing", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply())
+
+		if _, err := newMockRepo(mt).FindByGitHubID(context.Background(), 7); !errors.Is(err, mongo.ErrNoDocuments) {
+			mt.Errorf("err = %v, want ErrNoDocuments", err)
+		}
+	})
+}
+
+func TestFindByIDDuplicateFullName(t *testing.T) {
+	var logs bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	mt := newMockMongo(t)
+	mt.Run("duplicates", func(mt *mtest.T) {
+		// The server applies the sort; the reply is in the order it returns
+		mt.AddMockResponses(cursorReply(
+			bson.D{{Key: "_id", Value: "reingested"}, {Key: "full_name", Value: "octo/widgets"}, {Key: "pushed_at", Value: "2026-05-02T00:00:00Z"}},
+			bson.D{{Key: "_id", Value: "original"}, {Key: "full_name", Value: "octo/widgets"}, {Key: "pushed_at", Value: "2025-01-09T00:00:00Z"}},
+		))
+
+		repo, err := newMockRepo(mt).FindByID(context.Background(), "octo/widgets")
+		if err != nil {
+			mt.Fatalf("FindByID: %v", err)
+		}
+		if repo.ID != "reingested" {
+			mt.Errorf("picked %s, want the most recently pushed document", repo.ID)
+		}
+
+		cmd := mt.GetStartedEvent().Command
+		sort := cmd.Lookup("sort").Document()
+		keys, _ := sort.Elements()
+		if len(keys) != 2 || keys[0].Key() != "pushed_at" || keys[0].Value().Int32() != -1 || keys[1].Key() != "_id" || keys[1].Value().Int32() != 1 {
+			mt.Errorf("sort = %s, want pushed_at descending then _id ascending", sort)
+		}
+		if limit := cmd.Lookup("limit").Int64(); limit != 2 {
+			mt.Errorf("limit = %d, want 2 (enough to detect a duplicate)", limit)
+		}
+		if !strings.Contains(logs.String(), `duplicate repository documents for full_name "octo/widgets"`) {
+			mt.Errorf("log = %q, want a duplicate warning", logs.String())
+		}
+	})
+	mt.Run("unique", func(mt *mtest.T) {
+		logs.Reset()
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: "only"}, {Key: "full_name", Value: "octo/widgets"}}))
+
+		if _, err := newMockRepo(mt).FindByID(context.Background(), "octo/widgets"); err != nil {
+			mt.Fatalf("FindByID: %v", err)
+		}
+		if strings.Contains(logs.String(), "duplicate") {
+			mt.Errorf("log = %q, want no duplicate warning", logs.String())
+		}
+	})
+}
+
+func TestGroupByLanguage(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("buckets", func(mt *mtest.T) {
+		repo := func(name string, stars int) bson.D {
+			return bson.D{{Key: "_id", Value: name}, {Key: "full_name", Value: name}, {Key: "stargazers_count", Value: stars}}
+		}
+		mt.AddMockResponses(cursorReply(
+			bson.D{{Key: "_id", Value: "Go"}, {Key: "count", Value: 3}, {Key: "repos", Value: bson.A{repo("a/cli", 900), repo("b/proxy", 40)}}},
+			bson.D{{Key: "_id", Value: "Python"}, {Key: "count", Value: 1}, {Key: "repos", Value: bson.A{repo("c/ml", 10)}}},
+			bson.D{{Key: "_id", Value: ""}, {Key: "count", Value: 1}, {Key: "repos", Value: bson.A{repo("d/docs", 2)}}},
+		))
+
+		buckets, err := newMockRepo(mt).GroupByLanguage(context.Background(), 2)
+		if err != nil {
+			mt.Fatalf("GroupByLanguage: %v", err)
+		}
+		if len(buckets) != 3 {
+			mt.Fatalf("got %d buckets, want 3", len(buckets))
+		}
+		if b := buckets[0]; b.Language != "Go" || b.Count != 3 || len(b.Repos) != 2 || b.Repos[0].FullName != "a/cli" || b.Repos[0].StargazersCount != 900 {
+			mt.Errorf("Go bucket = %+v, want 3 repos with the 2 most-starred listed", b)
+		}
+		if b := buckets[2]; b.Language != "" || b.Count != 1 {
+			mt.Errorf("last bucket = %+v, want the repos without a language", b)
+		}
+
+		stages, _ := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Values()
+		primary := stages[0].Document().Lookup("$project", "primary_language", "$ifNull").Array()
+		if first := primary.Index(0).Value().StringValue(); first != "$language" {
+			mt.Errorf("primary language = %s, want language first", primary)
+		}
+		if fallback := primary.Index(1).Value().Document().Lookup("$arrayElemAt").Array(); fallback.Index(0).Value().StringValue() != "$languages" || fallback.Index(1).Value().Int32() != 0 {
+			mt.Errorf("primary language fallback = %s, want the first of languages", fallback)
+		}
+		if id := stages[2].Document().Lookup("$group", "_id", "$ifNull").Array(); id.Index(1).Value().StringValue() != "" {
+			mt.Errorf("group _id = %s, want a missing language grouped as \"\"", id)
+		}
+		if limit := stages[3].Document().Lookup("$project", "repos", "$slice").Array().Index(1).Value().Int32(); limit != 2 {
+			mt.Errorf("repos per bucket = %d, want 2", limit)
+		}
+		sort, _ := stages[4].Document().Lookup("$sort").Document().Elements()
+		if len(sort) != 2 || sort[0].Key() != "count" || sort[0].Value().Int32() != -1 {
+			mt.Errorf("bucket sort = %v, want the largest bucket first", sort)
+		}
+	})
+}
+
+// evalExpr evaluates the arithmetic aggregation operators the relevance score
+// uses against doc, with vectorSearchScore as the $meta score. A missing
+// field evaluates to nil, which the arithmetic operators propagate as Mongo
+// does.
+func evalExpr(t *testing.T, v bson.RawValue, doc map[string]any, vectorSearchScore float64) any {
+	t.Helper()
+	switch v.Type {
+	case bson.TypeString:
+		field, ok := strings.CutPrefix(v.StringValue(), "$")
+		if !ok {
+			t.Fatalf("unexpected string %q", v.StringValue())
+		}
+		return doc[field]
+	case bson.TypeInt32:
+		return float64(v.Int32())
+	case bson.TypeInt64:
+		return float64(v.Int64())
+	case bson.TypeDouble:
+		return v.Double()
+	case bson.TypeEmbeddedDocument:
+		elems, _ := v.Document().Elements()
+		op := elems[0]
+		if op.Key() == "$meta" {
+			return vectorSearchScore
+		}
+		args, _ := op.Value().Array().Values()
+		vals := make([]any, len(args))
+		for i, a := range args {
+			vals[i] = evalExpr(t, a, doc, vectorSearchScore)
+		}
+		if op.Key() == "$ifNull" {
+			if vals[0] == nil {
+				return vals[1]
+			}
+			return vals[0]
+		}
+		for _, x := range vals {
+			if x == nil {
+				return nil
+			}
+		}
+		result := vals[0].(float64)
+		for _, x := range vals[1:] {
+			switch op.Key() {
+			case "$add":
+				result += x.(float64)
+			case "$multiply":
+				result *= x.(float64)
+			case "$divide":
+				result /= x.(float64)
+			default:
+				t.Fatalf("unexpected operator %s", op.Key())
+			}
+		}
+		return result
+	}
+	t.Fatalf("unexpected expression %s", v)
+	return nil
+}
+
+func TestVectorSearchRanksReposMissingCounts(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("sparse", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: 2}}),
+			cursorReply(bson.D{{Key: "_id", Value: "a/full"}}),
+			cursorReply(
+				bson.D{{Key: "_id", Value: "a/full"}, {Key: "score", Value: 0.8}, {Key: "relevance_score", Value: 0.8}},
+				bson.D{{Key: "_id", Value: "b/sparse"}, {Key: "score", Value: 0.8}, {Key: "relevance_score", Value: 0.56}},
+			),
+			cursorReply(bson.D{{Key: "_id", Value: "a/full"}, {Key: "full_name", Value: "a/full"}}),
+		)
+		repo := newMockRepo(mt)
+		repo.SetMaxEnrichedResults(1) // only a/full is looked up, so the mock replies stay in order
+
+		repos, _, err := repo.VectorSearch(context.Background(), []float32{0.1, 0.2}, 2)
+		if err != nil {
+			mt.Fatalf("VectorSearch: %v", err)
+		}
+		if len(repos) != 2 {
+			mt.Fatalf("repos = %+v, want both, including the one without counts", repos)
+		}
+
+		// The aggregate is the third command: after the count and the sample
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		var project bson.RawValue
+		stages, _ := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Values()
+		for _, stage := range stages {
+			if p, err := stage.Document().LookupErr("$project", "relevance_score"); err == nil {
+				project = p
+			}
+		}
+		full := evalExpr(t, project, map[string]any{"stargazers_count": 1000.0, "forks_count": 100.0}, 0.8)
+		sparse := evalExpr(t, project, map[string]any{}, 0.8)
+		if sparse == nil {
+			mt.Fatal("relevance score of a document without star/fork counts is null")
+		}
+		if sparse.(float64) >= full.(float64) {
+			mt.Errorf("relevance scores: sparse %v, full %v; want the sparse document ranked below", sparse, full)
+		}
+		if want := 0.8 * 0.7; math.Abs(sparse.(float64)-want) > 1e-9 {
+			mt.Errorf("sparse relevance score = %v, want %v (similarity only)", sparse, want)
+		}
+	})
+}
+
+func TestGetAllReposSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     models.RepoSort
+		wantSort bson.D // nil: no sort sent
+	}{
+		{"natural order", models.RepoSort{}, nil},
+		{"most starred", models.RepoSort{Field: "stargazers_count", Descending: true}, bson.D{{Key: "stargazers_count", Value: int32(-1)}, {Key: "_id", Value: int32(1)}}},
+		{"by name", models.RepoSort{Field: "full_name"}, bson.D{{Key: "full_name", Value: int32(1)}, {Key: "_id", Value: int32(1)}}},
+	}
+	mt := newMockMongo(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(cursorReply(bson.D{{Key: "n", Value: 1}}), cursorReply(bson.D{{Key: "_id", Value: "a/r"}}))
+
+			repos, total, err := newMockRepo(mt).GetAllRepos(context.Background(), 10, 20, tt.sort)
+			if err != nil {
+				mt.Fatalf("GetAllRepos: %v", err)
+			}
+			if total != 1 || len(repos) != 1 {
+				mt.Errorf("got %d of %d repos, want 1 of 1", len(repos), total)
+			}
+			mt.GetStartedEvent() // count
+			find := mt.GetStartedEvent().Command
+			if find.Lookup("skip").Int64() != 20 || find.Lookup("limit").Int64() != 10 {
+				mt.Errorf("find = %s, want skip 20 limit 10", find)
+			}
+			sortValue, err := find.LookupErr("sort")
+			if tt.wantSort == nil {
+				if err == nil {
+					mt.Errorf("sort = %s, want none", sortValue)
+				}
+				return
+			}
+			var got bson.D
+			if err := sortValue.Unmarshal(&got); err != nil || !reflect.DeepEqual(got, tt.wantSort) {
+				mt.Errorf("sort = %v, want %v", got, tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestGetTopContextChunksByType(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("readme matches untyped README files", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply(bson.D{{Key: "_id", Value: "c1"}, {Key: "file", Value: "README.md"}, {Key: "chunk_type", Value: "readme"}}))
+
+		chunks, err := newMockRepo(mt).GetTopContextChunksByType(context.Background(), "o/r", models.ChunkTypeReadme, 2)
+		if err != nil {
+			mt.Fatalf("GetTopContextChunksByType: %v", err)
+		}
+		if len(chunks) != 1 || chunks[0].ChunkType != models.ChunkTypeReadme {
+			mt.Errorf("chunks = %+v, want the README chunk", chunks)
+		}
+		find := mt.GetStartedEvent().Command
+		if find.Lookup("limit").Int64() != 2 {
+			mt.Errorf("limit = %s, want 2", find.Lookup("limit"))
+		}
+		filter := find.Lookup("filter").Document()
+		if filter.Lookup("repo_id").StringValue() != "o/r" {
+			mt.Errorf("filter = %s, want repo o/r", filter)
+		}
+		alts, _ := filter.Lookup("$or").Array().Values()
+		if len(alts) != 2 || alts[0].Document().Lookup("chunk_type").StringValue() != "readme" ||
+			alts[1].Document().Lookup("file", "$regex").StringValue() == "" {
+			mt.Errorf("$or = %s, want the readme type or an untyped README file", filter.Lookup("$or"))
+		}
+	})
+	mt.Run("other types match chunk_type only", func(mt *mtest.T) {
+		mt.AddMockResponses(cursorReply())
+
+		if _, err := newMockRepo(mt).GetTopContextChunksByType(context.Background(), "o/r", models.ChunkTypeDoc, 3); err != nil {
+			mt.Fatalf("GetTopContextChunksByType: %v", err)
+		}
+		alts, _ := mt.GetStartedEvent().Command.Lookup("filter", "$or").Array().Values()
+		if len(alts) != 1 || alts[0].Document().Lookup("chunk_type").StringValue() != "doc" {
+			mt.Errorf("$or = %v, want chunk_type doc only", alts)
+		}
+	})
+}
+
+func TestVectorSearchEnrichesOnlyTopResults(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("top 2 of 3", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: 3}}),
+			cursorReply(bson.D{{Key: "_id", Value: "a/one"}}),
+			cursorReply(
+				bson.D{{Key: "_id", Value: "a/one"}, {Key: "name", Value: "one"}, {Key: "score", Value: 0.9}, {Key: "relevance_score", Value: 0.9}},
+				bson.D{{Key: "_id", Value: "b/two"}, {Key: "name", Value: "two"}, {Key: "score", Value: 0.8}, {Key: "relevance_score", Value: 0.8}},
+				bson.D{{Key: "_id", Value: "c/three"}, {Key: "name", Value: "three"}, {Key: "description", Value: "from the index"}, {Key: "score", Value: 0.7}, {Key: "relevance_score", Value: 0.7}},
+			),
+		)
+		repo := newMockRepo(mt)
+		repo.SetMaxEnrichedResults(2)
+		var mu sync.Mutex
+		var lookups []string
+		repo.findMeta = func(ctx context.Context, id string) (*models.Repo, error) {
+			mu.Lock()
+			lookups = append(lookups, id)
+			mu.Unlock()
+			return &models.Repo{ID: id, FullName: id, Description: "federated " + id}, nil
+		}
+
+		repos, _, err := repo.VectorSearch(context.Background(), []float32{0.1, 0.2}, 3)
+		if err != nil {
+			mt.Fatalf("VectorSearch: %v", err)
+		}
+		sort.Strings(lookups)
+		if strings.Join(lookups, ",") != "a/one,b/two" {
+			mt.Errorf("looked up %v, want only the top 2", lookups)
+		}
+		if len(repos) != 3 {
+			mt.Fatalf("got %d repos, want all 3", len(repos))
+		}
+		if repos[0].Description != "federated a/one" || repos[1].Description != "federated b/two" {
+			mt.Errorf("top repos = %+v, want federated metadata", repos[:2])
+		}
+		if repos[2].ID != "c/three" || repos[2].Description != "from the index" || repos[2].Score != 0.7 {
+			mt.Errorf("third repo = %+v, want its vector-search fields", repos[2])
+		}
+	})
+}
+
+// newFakeStorage returns a storage client talking to a fake GCS JSON API that
+// answers every bucket lookup with status (and a bucket body on 200).
+func newFakeStorage(t *testing.T, status int) *storage.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			fmt.Fprintf(w, `{"name": %q}`, repoBucket)
+			return
+		}
+		fmt.Fprintf(w, `{"error": {"code": %d, "message": "fake error"}}`, status)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("storage.NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestCheckBucket(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{"bucket exists", http.StatusOK, ""},
+		{"bucket missing", http.StatusNotFound, "does not exist"},
+		{"access denied", http.StatusForbidden, "denied"},
+		{"unauthorized", http.StatusUnauthorized, "denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RepoMongo{storageClient: newFakeStorage(t, tt.status)}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := r.CheckBucket(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckBucket: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), repoBucket) {
+				t.Errorf("CheckBucket error = %v, want one naming %s and saying %q", err, repoBucket, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSearchQueriesUseSearchReadPreference(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("search reads", func(mt *mtest.T) {
+		r := newMockRepo(mt)
+		r.SetSearchDatabase(mt.Client.Database(mt.DB.Name(), options.Database().SetReadPreference(readpref.Secondary())))
+		ctx := context.Background()
+
+		readMode := func() string {
+			mode, _ := mt.GetStartedEvent().Command.Lookup("$readPreference", "mode").StringValueOK()
+			return mode
+		}
+		searches := []struct {
+			name string
+			run  func() error
+		}{
+			{"CodeVectorSearch", func() error {
+				_, err := r.CodeVectorSearch(ctx, "o/r", []float32{0.1, 0.2}, 3)
+				return err
+			}},
+			{"GetTopContextChunks", func() error {
+				_, err := r.GetTopContextChunks(ctx, "o/r", 3, 0)
+				return err
+			}},
+			{"GetTopContextChunksByType", func() error {
+				_, err := r.GetTopContextChunksByType(ctx, "o/r", models.ChunkTypeReadme, 3)
+				return err
+			}},
+		}
+		for _, s := range searches {
+			mt.AddMockResponses(cursorReply())
+			if err := s.run(); err != nil {
+				mt.Fatalf("%s: %v", s.name, err)
+			}
+			if mode := readMode(); mode != "secondary" {
+				mt.Errorf("%s read with preference %q, want secondary", s.name, mode)
+			}
+		}
+
+		// Cached READMEs are written and read back on the primary
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), cursorReply())
+		if err := r.SetReadme(ctx, "o/r", "# Readme"); err != nil {
+			mt.Fatalf("SetReadme: %v", err)
+		}
+		if mode := readMode(); mode == "secondary" {
+			mt.Errorf("SetReadme sent with read preference %q, want the primary connection", mode)
+		}
+		if _, err := r.FindReadme(ctx, "o/r"); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			mt.Fatalf("FindReadme: %v", err)
+		}
+		if mode := readMode(); mode == "secondary" {
+			mt.Errorf("FindReadme read with preference %q, want the primary connection", mode)
+		}
+	})
+}
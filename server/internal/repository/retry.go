@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultAggregateAttempts is how many times a vector search aggregation is
+// tried before its error is returned.
+const DefaultAggregateAttempts = 3
+
+// aggregateBaseBackoff is the backoff ceiling before the first retry; it
+// doubles on every further retry and the actual wait is a random fraction
+// of it ("full jitter"), so concurrent requests do not retry in lockstep.
+const aggregateBaseBackoff = 100 * time.Millisecond
+
+// retryableServerCodes are server error codes seen while a node restarts or
+// a replica set elects a new primary.
+var retryableServerCodes = map[int]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	262:   true, // ExceededTimeLimit
+	9001:  true, // SocketException
+	10107: true, // NotWritablePrimary
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotPrimaryNoSecondaryOk
+	13436: true, // NotPrimaryOrSecondary
+}
+
+// isRetryableMongoError reports whether err is a transient failure worth
+// retrying: network errors, timeouts, and errors the server labels or codes
+// as transient.
+func isRetryableMongoError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		if se.HasErrorLabel("RetryableError") || se.HasErrorLabel("TransientTransactionError") {
+			return true
+		}
+		for code := range retryableServerCodes {
+			if se.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aggregateAll runs pipeline on coll and decodes every result into results,
+// retrying up to attempts times in total on transient errors. It gives up
+// early when ctx is done.
+func aggregateAll(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, results interface{}, attempts int) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := aggregateBaseBackoff
+	for attempt := 1; ; attempt++ {
+		err := aggregateOnce(ctx, coll, pipeline, results)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || !isRetryableMongoError(err) {
+			return err
+		}
+
+		wait := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		log.Printf("Aggregation on %s failed (attempt %d/%d), retrying in %s: %v", coll.Name(), attempt, attempts, wait, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func aggregateOnce(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, results interface{}) error {
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
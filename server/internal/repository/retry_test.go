@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// commandError is the server reply to a command failing with code.
+func commandError(code int32, name string) bson.D {
+	return mtest.CreateCommandErrorResponse(mtest.CommandError{Code: code, Name: name, Message: name})
+}
+
+// newNoRetryMongo is newMockMongo with the driver's own read retry turned
+// off, so every reply queued is seen by aggregateAll.
+func newNoRetryMongo(t *testing.T) *mtest.T {
+	return mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetRetryReads(false)))
+}
+
+// startedCommands counts the commands sent to mt's mock deployment.
+func startedCommands(mt *mtest.T) int {
+	n := 0
+	for mt.GetStartedEvent() != nil {
+		n++
+	}
+	return n
+}
+
+func TestAggregateAllRetriesTransientErrors(t *testing.T) {
+	mt := newNoRetryMongo(t)
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{}}}}
+
+	mt.Run("fails once then succeeds", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			commandError(91, "ShutdownInProgress"),
+			cursorReply(bson.D{{Key: "_id", Value: "a/r"}}),
+		)
+		var results []bson.M
+		if err := aggregateAll(context.Background(), mt.Coll, pipeline, &results, 3); err != nil {
+			mt.Fatalf("aggregateAll: %v", err)
+		}
+		if len(results) != 1 || results[0]["_id"] != "a/r" {
+			mt.Errorf("results = %v, want a/r", results)
+		}
+		if n := startedCommands(mt); n != 2 {
+			mt.Errorf("sent %d aggregations, want 2", n)
+		}
+	})
+	mt.Run("permanent error is not retried", func(mt *mtest.T) {
+		mt.AddMockResponses(commandError(2, "BadValue"), cursorReply())
+		var results []bson.M
+		if err := aggregateAll(context.Background(), mt.Coll, pipeline, &results, 3); err == nil {
+			mt.Fatal("aggregateAll succeeded, want the BadValue error")
+		}
+		if n := startedCommands(mt); n != 1 {
+			mt.Errorf("sent %d aggregations, want 1", n)
+		}
+	})
+	mt.Run("gives up after the configured attempts", func(mt *mtest.T) {
+		mt.AddMockResponses(commandError(189, "PrimarySteppedDown"), commandError(189, "PrimarySteppedDown"), cursorReply())
+		var results []bson.M
+		if err := aggregateAll(context.Background(), mt.Coll, pipeline, &results, 2); err == nil {
+			mt.Fatal("aggregateAll succeeded, want an error after 2 attempts")
+		}
+		if n := startedCommands(mt); n != 2 {
+			mt.Errorf("sent %d aggregations, want 2", n)
+		}
+	})
+	mt.Run("canceled context stops retrying", func(mt *mtest.T) {
+		mt.AddMockResponses(commandError(91, "ShutdownInProgress"), cursorReply())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var results []bson.M
+		if err := aggregateAll(ctx, mt.Coll, pipeline, &results, 3); !errors.Is(err, context.Canceled) {
+			mt.Errorf("err = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestCodeVectorSearchRetriesTransientErrors(t *testing.T) {
+	mt := newNoRetryMongo(t)
+	mt.Run("transient", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			commandError(11600, "InterruptedAtShutdown"),
+			cursorReply(bson.D{{Key: "_id", Value: "c1"}, {Key: "file", Value: "main.go"}, {Key: "score", Value: 0.9}}),
+		)
+		repo := newMockRepo(mt)
+		repo.SetAggregateAttempts(2)
+
+		chunks, err := repo.CodeVectorSearch(context.Background(), "o/r", []float32{0.1, 0.2}, 5)
+		if err != nil {
+			mt.Fatalf("CodeVectorSearch: %v", err)
+		}
+		if len(chunks) != 1 || chunks[0].File != "main.go" {
+			mt.Errorf("chunks = %+v, want main.go", chunks)
+		}
+	})
+}
+
+func TestIsRetryableMongoError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"primary stepped down", mongo.CommandError{Code: 189}, true},
+		{"retryable label", mongo.CommandError{Code: 2, Labels: []string{"RetryableError"}}, true},
+		{"bad value", mongo.CommandError{Code: 2}, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := isRetryableMongoError(tt.err); got != tt.want {
+			t.Errorf("%s: isRetryableMongoError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
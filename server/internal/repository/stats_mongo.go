@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StatsRepository reports document counts and index status for the dataset
+// collections.
+type StatsRepository struct {
+	colls []*mongo.Collection
+}
+
+// NewStatsRepository covers the primary repos_meta, repos_code and guides
+// collections and the federated repos_meta collection.
+func NewStatsRepository(primaryDB, federatedDB *mongo.Database, names CollectionNames) *StatsRepository {
+	return &StatsRepository{colls: []*mongo.Collection{
+		primaryDB.Collection(names.Meta),
+		primaryDB.Collection(names.Code),
+		primaryDB.Collection(names.Guides),
+		federatedDB.Collection(names.FederatedMeta),
+	}}
+}
+
+// CollectionStats counts the documents of every collection concurrently. A
+// collection that fails reports its error instead of failing the whole call.
+func (r *StatsRepository) CollectionStats(ctx context.Context) []models.CollectionStats {
+	stats := make([]models.CollectionStats, len(r.colls))
+	var wg sync.WaitGroup
+	for i, coll := range r.colls {
+		wg.Add(1)
+		go func(i int, coll *mongo.Collection) {
+			defer wg.Done()
+			stats[i] = collectionStats(ctx, coll)
+		}(i, coll)
+	}
+	wg.Wait()
+	return stats
+}
+
+func collectionStats(ctx context.Context, coll *mongo.Collection) models.CollectionStats {
+	s := models.CollectionStats{
+		Database:   coll.Database().Name(),
+		Collection: coll.Name(),
+		Indexes:    []string{},
+	}
+
+	count, err := coll.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		s.Error = fmt.Sprintf("failed to count documents: %v", err)
+		return s
+	}
+	s.Documents = count
+
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		s.Error = fmt.Sprintf("failed to list indexes: %v", err)
+		return s
+	}
+	for _, spec := range specs {
+		s.Indexes = append(s.Indexes, spec.Name)
+	}
+
+	// Only Atlas clusters have search indexes; elsewhere the command fails and
+	// the section is left out
+	cursor, err := coll.SearchIndexes().List(ctx, nil)
+	if err == nil {
+		_ = cursor.All(ctx, &s.SearchIndexes)
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCollectionStats(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("counts and indexes", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: int32(42)}}),
+			cursorReply(bson.D{{Key: "name", Value: "_id_"}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "v", Value: 2}},
+				bson.D{{Key: "name", Value: "repo_id_1"}, {Key: "key", Value: bson.D{{Key: "repo_id", Value: 1}}}, {Key: "v", Value: 2}}),
+			cursorReply(bson.D{{Key: "name", Value: "vector_index"}, {Key: "status", Value: "READY"}, {Key: "queryable", Value: true}}),
+		)
+		repo := &StatsRepository{colls: []*mongo.Collection{mt.Coll}}
+
+		stats := repo.CollectionStats(context.Background())
+		if len(stats) != 1 {
+			mt.Fatalf("got %d collection stats, want 1", len(stats))
+		}
+		s := stats[0]
+		if s.Collection != mt.Coll.Name() || s.Documents != 42 || s.Error != "" {
+			mt.Errorf("stats = %+v, want 42 documents", s)
+		}
+		if !reflect.DeepEqual(s.Indexes, []string{"_id_", "repo_id_1"}) {
+			mt.Errorf("indexes = %q, want _id_ and repo_id_1", s.Indexes)
+		}
+		if len(s.SearchIndexes) != 1 || s.SearchIndexes[0].Name != "vector_index" || !s.SearchIndexes[0].Queryable {
+			mt.Errorf("search indexes = %+v, want the ready vector index", s.SearchIndexes)
+		}
+	})
+	mt.Run("count fails", func(mt *mtest.T) {
+		mt.AddMockResponses(commandError(13, "Unauthorized"))
+		repo := &StatsRepository{colls: []*mongo.Collection{mt.Coll}}
+
+		s := repo.CollectionStats(context.Background())[0]
+		if s.Error == "" || s.Documents != 0 {
+			mt.Errorf("stats = %+v, want the count error reported", s)
+		}
+	})
+	mt.Run("no search indexes outside Atlas", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			cursorReply(bson.D{{Key: "n", Value: int32(7)}}),
+			cursorReply(),
+			commandError(40324, "Location40324"),
+		)
+		repo := &StatsRepository{colls: []*mongo.Collection{mt.Coll}}
+
+		s := repo.CollectionStats(context.Background())[0]
+		if s.Documents != 7 || s.Error != "" || s.SearchIndexes != nil {
+			mt.Errorf("stats = %+v, want the count without a search index section", s)
+		}
+	})
+}
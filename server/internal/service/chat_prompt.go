@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// ChatTurn is one prior message in a chat follow-up conversation.
+type ChatTurn struct {
+	Role    string // "user" or "assistant"
+	Content string
+}
+
+// ChatPromptData is what the chat prompt template is rendered with.
+type ChatPromptData struct {
+	IssueID    string
+	IssueTitle string
+	Guide      string // the cached contributor guide the chat builds on
+	History    []ChatTurn
+	Question   string
+}
+
+// defaultChatPromptTemplate is tuned for short conversational follow-ups,
+// unlike the long-form guide and RAG prompts.
+const defaultChatPromptTemplate = `You are helping a developer who is working on GitHub issue {{.IssueID}}{{if .IssueTitle}} ("{{.IssueTitle}}"){{end}}. They have already read the contributor guide below and are asking a follow-up question.
+
+Contributor guide:
+{{.Guide}}
+{{if .History}}
+Conversation so far:
+{{range .History}}{{.Role}}: {{.Content}}
+{{end}}{{end}}
+Question: {{.Question}}
+
+Answer conversationally and concisely—a few sentences, or a short snippet if code is needed. Build on the guide and the earlier turns instead of repeating them, and say so plainly if the guide doesn't cover the question.`
+
+// ChatPrompt renders the chat follow-up prompt.
+type ChatPrompt struct {
+	text string
+	tmpl *template.Template
+}
+
+// parseChatPrompt parses a chat prompt template, in text/template syntax over
+// ChatPromptData. PromptStore loads the template and parses it with this.
+func parseChatPrompt(text string) (*ChatPrompt, error) {
+	tmpl, err := template.New("chat").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chat prompt template: %w", err)
+	}
+	return &ChatPrompt{text: text, tmpl: tmpl}, nil
+}
+
+// Text returns the template source.
+func (p *ChatPrompt) Text() string {
+	return p.text
+}
+
+// Render fills the template with data.
+func (p *ChatPrompt) Render(data ChatPromptData) (string, error) {
+	var sb strings.Builder
+	if err := p.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render chat prompt: %w", err)
+	}
+	return sb.String(), nil
+}
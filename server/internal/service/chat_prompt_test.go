@@ -0,0 +1,73 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChatPromptRendersHistoryAndQuestion(t *testing.T) {
+	p := DefaultPrompts().Current().ChatPrompt()
+	got, err := p.Render(ChatPromptData{
+		IssueID:    "o/r#3",
+		IssueTitle: "Parser crash",
+		Guide:      "1) Open parser.go",
+		History: []ChatTurn{
+			{Role: "user", Content: "Where is the parser?"},
+			{Role: "assistant", Content: "In parser.go."},
+		},
+		Question: "How do I run its tests?",
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, want := range []string{
+		`GitHub issue o/r#3 ("Parser crash")`,
+		"Contributor guide:\n1) Open parser.go",
+		"Conversation so far:\nuser: Where is the parser?\nassistant: In parser.go.\n",
+		"Question: How do I run its tests?",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestChatPromptOmitsEmptyHistory(t *testing.T) {
+	p := DefaultPrompts().Current().ChatPrompt()
+	got, err := p.Render(ChatPromptData{IssueID: "o/r#3", Guide: "g", Question: "q"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if strings.Contains(got, "Conversation so far") || strings.Contains(got, `o/r#3 (`) {
+		t.Errorf("prompt renders empty history or title:\n%s", got)
+	}
+}
+
+func TestChatPromptOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.tmpl")
+	if err := os.WriteFile(path, []byte("{{.IssueID}}|{{len .History}}|{{.Question}}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPromptStore(PromptFiles{Chat: path})
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	got, err := store.Current().ChatPrompt().Render(ChatPromptData{IssueID: "o/r#3", History: []ChatTurn{{Role: "user", Content: "hi"}}, Question: "why?"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got != "o/r#3|1|why?" {
+		t.Errorf("rendered %q, want the override", got)
+	}
+
+	for _, bad := range []string{"{{.Question", "{{.Questoin}}"} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Reload(); err == nil {
+			t.Errorf("Reload accepted the malformed template %q", bad)
+		}
+	}
+}
@@ -13,11 +13,12 @@ type ChatService interface {
 // to GuideService and then runs the RAG pipeline (placeholder for now).
 type chatService struct {
 	guideSvc GuideService
+	prompts  *PromptStore // follow-up prompt, rendered once the LLM call is wired in
 }
 
 // NewChatService wires dependencies and returns ChatService.
-func NewChatService(guideSvc GuideService) ChatService {
-	return &chatService{guideSvc: guideSvc}
+func NewChatService(guideSvc GuideService, prompts *PromptStore) ChatService {
+	return &chatService{guideSvc: guideSvc, prompts: prompts}
 }
 
 // Ask fetches the original guide/context and passes it—together with the
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"path"
+	"strings"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// languageByExt maps source file extensions to GitHub language names. Files
+// not listed (docs, config, data) have no language and are never filtered out.
+var languageByExt = map[string]string{
+	".go":    "Go",
+	".py":    "Python",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".swift": "Swift",
+	".c":     "C",
+	".h":     "C",
+	".cpp":   "C++",
+	".cc":    "C++",
+	".cxx":   "C++",
+	".hpp":   "C++",
+	".rs":    "Rust",
+	".cs":    "C#",
+	".rb":    "Ruby",
+	".php":   "PHP",
+	".dart":  "Dart",
+	".lua":   "Lua",
+	".scala": "Scala",
+	".hs":    "Haskell",
+	".ex":    "Elixir",
+	".exs":   "Elixir",
+	".erl":   "Erlang",
+	".r":     "R",
+	".jl":    "Julia",
+	".clj":   "Clojure",
+	".ml":    "OCaml",
+	".sh":    "Shell",
+}
+
+// minLanguageChunks is the fewest chunks a language filter must keep;
+// otherwise the filter is judged too aggressive and every chunk is used.
+const minLanguageChunks = 3
+
+// ChunkLanguage returns chunk's language, inferring it from the file
+// extension for chunks indexed without one. "" means no programming language.
+func ChunkLanguage(chunk models.CodeChunk) string {
+	if chunk.Language != "" {
+		return chunk.Language
+	}
+	return languageByExt[strings.ToLower(path.Ext(chunk.File))]
+}
+
+// issueLanguages infers the languages an issue is about: languages named by
+// its labels (e.g. "go", "lang: python", "language/rust"), else the repo's
+// primary language. nil means there is nothing to go on.
+func issueLanguages(issue models.Issue, repo *models.Repo) []string {
+	known := make(map[string]string, len(languageByExt))
+	for _, lang := range languageByExt {
+		known[strings.ToLower(lang)] = lang
+	}
+
+	var langs []string
+	seen := map[string]bool{}
+	for _, label := range issue.Labels {
+		name := strings.ToLower(strings.TrimSpace(label.Name))
+		for _, prefix := range []string{"language:", "language/", "lang:", "lang/"} {
+			name = strings.TrimSpace(strings.TrimPrefix(name, prefix))
+		}
+		if lang, ok := known[name]; ok && !seen[lang] {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+	if len(langs) > 0 {
+		return langs
+	}
+	if repo != nil && repo.Language != "" {
+		return []string{repo.Language}
+	}
+	return nil
+}
+
+// filterChunksByLanguage keeps the chunks in one of langs plus those with no
+// language (READMEs, docs, config). With no langs, or when fewer than
+// minLanguageChunks chunks would remain, chunks is returned unchanged.
+func filterChunksByLanguage(chunks []models.CodeChunk, langs []string) []models.CodeChunk {
+	if len(langs) == 0 {
+		return chunks
+	}
+	want := make(map[string]bool, len(langs))
+	for _, lang := range langs {
+		want[strings.ToLower(lang)] = true
+	}
+
+	kept := make([]models.CodeChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		lang := ChunkLanguage(chunk)
+		if lang == "" || want[strings.ToLower(lang)] {
+			kept = append(kept, chunk)
+		}
+	}
+	if len(kept) < minLanguageChunks {
+		return chunks
+	}
+	return kept
+}
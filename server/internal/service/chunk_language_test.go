@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+func TestChunkLanguage(t *testing.T) {
+	tests := []struct {
+		chunk models.CodeChunk
+		want  string
+	}{
+		{models.CodeChunk{File: "cmd/main.go"}, "Go"},
+		{models.CodeChunk{File: "app/View.TSX"}, "TypeScript"},
+		{models.CodeChunk{File: "README.md"}, ""},
+		{models.CodeChunk{File: "Makefile"}, ""},
+		{models.CodeChunk{File: "build.py", Language: "Starlark"}, "Starlark"}, // the indexed language wins
+	}
+	for _, tt := range tests {
+		if got := ChunkLanguage(tt.chunk); got != tt.want {
+			t.Errorf("ChunkLanguage(%s) = %q, want %q", tt.chunk.File, got, tt.want)
+		}
+	}
+}
+
+func TestIssueLanguages(t *testing.T) {
+	labels := func(names ...string) []models.IssueLabel {
+		var ls []models.IssueLabel
+		for _, n := range names {
+			ls = append(ls, models.IssueLabel{Name: n})
+		}
+		return ls
+	}
+	goRepo := &models.Repo{Language: "Go"}
+	tests := []struct {
+		name   string
+		labels []models.IssueLabel
+		repo   *models.Repo
+		want   []string
+	}{
+		{"plain label", labels("bug", "python"), goRepo, []string{"Python"}},
+		{"prefixed labels", labels("lang: Rust", "language/typescript", "lang/rust"), goRepo, []string{"Rust", "TypeScript"}},
+		{"repo primary language", labels("bug", "good first issue"), goRepo, []string{"Go"}},
+		{"nothing to go on", labels("bug"), &models.Repo{}, nil},
+		{"no repo", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueLanguages(models.Issue{Labels: tt.labels}, tt.repo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("issueLanguages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// files lists the files of chunks, comma-separated.
+func files(chunks []models.CodeChunk) string {
+	var names []string
+	for _, c := range chunks {
+		names = append(names, c.File)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestFilterChunksByLanguage(t *testing.T) {
+	chunks := []models.CodeChunk{
+		{File: "a.go"}, {File: "b.go"}, {File: "c.py"}, {File: "README.md"}, {File: "d.ts"}, {File: "e.go"},
+	}
+	tests := []struct {
+		name  string
+		langs []string
+		want  string
+	}{
+		{"go hint keeps go and docs", []string{"go"}, "a.go,b.go,README.md,e.go"},
+		{"several languages", []string{"Python", "TypeScript"}, "c.py,README.md,d.ts"},
+		{"no hint keeps everything", nil, "a.go,b.go,c.py,README.md,d.ts,e.go"},
+		{"too few matches falls back", []string{"Rust"}, "a.go,b.go,c.py,README.md,d.ts,e.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := files(filterChunksByLanguage(chunks, tt.langs)); got != tt.want {
+				t.Errorf("kept %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetGuideFiltersContextByIssueLanguage(t *testing.T) {
+	llm := &stubLLM{answer: "1) Read main.go"}
+	svc, _, gh := newTestGuideService(t, llm)
+	svc.repoRepo.(*stubRepoRepo).chunks = []models.CodeChunk{
+		{RepoID: "o/r", File: "main.go", Text: "package main"},
+		{RepoID: "o/r", File: "server.go", Text: "package server"},
+		{RepoID: "o/r", File: "tools/gen.py", Text: "import os"},
+		{RepoID: "o/r", File: "README.md", Text: "# Widgets"},
+	}
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open", Labels: []models.IssueLabel{{Name: "lang: go"}}})
+
+	guide, err := svc.GetGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	prompt := llm.prompts[0]
+	if strings.Contains(prompt, "import os") {
+		t.Errorf("guide prompt holds the Python chunk for a Go issue:\n%s", prompt)
+	}
+	for _, want := range []string{"package main", "package server", "# Widgets"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("guide prompt is missing %q", want)
+		}
+	}
+	if len(guide.Sources) != 3 {
+		t.Errorf("sources = %+v, want the 3 kept chunks", guide.Sources)
+	}
+}
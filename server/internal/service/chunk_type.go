@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// docExts are the extensions of documentation files.
+var docExts = map[string]bool{".md": true, ".mdx": true, ".rst": true, ".txt": true, ".adoc": true}
+
+// ChunkTypeOf returns chunk's type, inferring it from the file path for chunks
+// indexed without one: README files are readme, other documentation files and
+// anything under a docs directory are doc, the rest is code.
+func ChunkTypeOf(chunk models.CodeChunk) string {
+	if chunk.ChunkType != "" {
+		return chunk.ChunkType
+	}
+	base := strings.ToLower(path.Base(chunk.File))
+	if strings.HasPrefix(base, "readme") {
+		return models.ChunkTypeReadme
+	}
+	if docExts[path.Ext(base)] {
+		return models.ChunkTypeDoc
+	}
+	for _, dir := range strings.Split(strings.ToLower(path.Dir(chunk.File)), "/") {
+		if dir == "doc" || dir == "docs" {
+			return models.ChunkTypeDoc
+		}
+	}
+	return models.ChunkTypeCode
+}
+
+// FilterChunksByType keeps the chunks whose type is one of types. With no
+// types, chunks is returned unchanged.
+func FilterChunksByType(chunks []models.CodeChunk, types []string) []models.CodeChunk {
+	if len(types) == 0 {
+		return chunks
+	}
+	want := make(map[string]bool, len(types))
+	for _, t := range types {
+		want[t] = true
+	}
+	kept := make([]models.CodeChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if want[ChunkTypeOf(chunk)] {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept
+}
+
+// boostChunksByType multiplies each chunk's score by the boost for its type
+// (1 when none is set) and re-sorts by the boosted score, keeping the
+// original order among equal scores.
+func boostChunksByType(chunks []models.CodeChunk, boosts map[string]float64) []models.CodeChunk {
+	if len(boosts) == 0 {
+		return chunks
+	}
+	boosted := make([]models.CodeChunk, len(chunks))
+	for i, chunk := range chunks {
+		if b, ok := boosts[ChunkTypeOf(chunk)]; ok {
+			chunk.Score *= b
+		}
+		boosted[i] = chunk
+	}
+	sort.SliceStable(boosted, func(i, j int) bool {
+		return boosted[i].Score > boosted[j].Score
+	})
+	return boosted
+}
+
+// ensureChunkType puts extra chunks of chunkType ahead of chunks until at
+// least min chunks of that type are included, skipping ones already present.
+func ensureChunkType(chunks, extra []models.CodeChunk, chunkType string, min int) []models.CodeChunk {
+	have := 0
+	seen := make(map[string]bool, len(chunks))
+	for _, chunk := range chunks {
+		seen[chunk.ID] = true
+		if ChunkTypeOf(chunk) == chunkType {
+			have++
+		}
+	}
+	var added []models.CodeChunk
+	for _, chunk := range extra {
+		if have >= min {
+			break
+		}
+		if seen[chunk.ID] || ChunkTypeOf(chunk) != chunkType {
+			continue
+		}
+		seen[chunk.ID] = true
+		added = append(added, chunk)
+		have++
+	}
+	if len(added) == 0 {
+		return chunks
+	}
+	return append(added, chunks...)
+}
+
+// ParseChunkTypeBoosts parses boosts written as "readme=1.5,doc=1.2".
+func ParseChunkTypeBoosts(s string) (map[string]float64, error) {
+	boosts := map[string]float64{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		chunkType, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid chunk type boost %q (expected type=factor)", part)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid boost factor for chunk type %q: %q", chunkType, value)
+		}
+		boosts[strings.TrimSpace(chunkType)] = f
+	}
+	return boosts, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+func TestChunkTypeOf(t *testing.T) {
+	tests := []struct {
+		chunk models.CodeChunk
+		want  string
+	}{
+		{models.CodeChunk{File: "main.go", ChunkType: models.ChunkTypeReadme}, models.ChunkTypeReadme},
+		{models.CodeChunk{File: "README.md"}, models.ChunkTypeReadme},
+		{models.CodeChunk{File: "pkg/readme.rst"}, models.ChunkTypeReadme},
+		{models.CodeChunk{File: "CONTRIBUTING.md"}, models.ChunkTypeDoc},
+		{models.CodeChunk{File: "docs/setup.go"}, models.ChunkTypeDoc},
+		{models.CodeChunk{File: "cmd/main.go"}, models.ChunkTypeCode},
+	}
+	for _, tt := range tests {
+		if got := ChunkTypeOf(tt.chunk); got != tt.want {
+			t.Errorf("ChunkTypeOf(%+v) = %q, want %q", tt.chunk, got, tt.want)
+		}
+	}
+}
+
+func TestFilterChunksByType(t *testing.T) {
+	chunks := []models.CodeChunk{{File: "main.go"}, {File: "README.md"}, {File: "docs/guide.md"}, {File: "x.go", ChunkType: models.ChunkTypeDoc}}
+	if got := FilterChunksByType(chunks, nil); len(got) != len(chunks) {
+		t.Errorf("no types kept %d chunks, want all %d", len(got), len(chunks))
+	}
+	if got := files(FilterChunksByType(chunks, []string{models.ChunkTypeReadme, models.ChunkTypeDoc})); got != "README.md,docs/guide.md,x.go" {
+		t.Errorf("readme and doc kept %s", got)
+	}
+	if got := FilterChunksByType(chunks, []string{"image"}); len(got) != 0 {
+		t.Errorf("unknown type kept %s", files(got))
+	}
+}
+
+func TestBoostChunksByType(t *testing.T) {
+	chunks := []models.CodeChunk{{File: "a.go", Score: 0.9}, {File: "b.go", Score: 0.7}, {File: "README.md", Score: 0.6}}
+
+	if got := files(boostChunksByType(chunks, nil)); got != "a.go,b.go,README.md" {
+		t.Errorf("no boosts reordered to %s", got)
+	}
+	boosted := boostChunksByType(chunks, map[string]float64{models.ChunkTypeReadme: 2})
+	if got := files(boosted); got != "README.md,a.go,b.go" {
+		t.Errorf("boosted order = %s, want the README first", got)
+	}
+	if boosted[0].Score != 1.2 || chunks[2].Score != 0.6 {
+		t.Errorf("README score = %v (input %v), want 1.2 without touching the input", boosted[0].Score, chunks[2].Score)
+	}
+}
+
+func TestEnsureChunkType(t *testing.T) {
+	chunks := []models.CodeChunk{{ID: "1", File: "a.go"}, {ID: "2", File: "README.md"}}
+	extra := []models.CodeChunk{{ID: "2", File: "README.md"}, {ID: "3", File: "docs/README.md"}, {ID: "4", File: "b.go"}, {ID: "5", File: "pkg/README"}}
+
+	if got := files(ensureChunkType(chunks, extra, models.ChunkTypeReadme, 1)); got != "a.go,README.md" {
+		t.Errorf("min already met: got %s", got)
+	}
+	if got := files(ensureChunkType(chunks, extra, models.ChunkTypeReadme, 3)); got != "docs/README.md,pkg/README,a.go,README.md" {
+		t.Errorf("min 3: got %s, want the two new READMEs first", got)
+	}
+	if got := files(ensureChunkType(chunks, nil, models.ChunkTypeReadme, 3)); got != "a.go,README.md" {
+		t.Errorf("no extras: got %s", got)
+	}
+}
+
+func TestParseChunkTypeBoosts(t *testing.T) {
+	boosts, err := ParseChunkTypeBoosts(" readme=1.5, doc = 1.2 ,")
+	if err != nil || len(boosts) != 2 || boosts["readme"] != 1.5 || boosts["doc"] != 1.2 {
+		t.Errorf("ParseChunkTypeBoosts = %v, %v; want readme 1.5 and doc 1.2", boosts, err)
+	}
+	if boosts, err := ParseChunkTypeBoosts(""); err != nil || len(boosts) != 0 {
+		t.Errorf("ParseChunkTypeBoosts(\"\") = %v, %v; want none", boosts, err)
+	}
+	for _, bad := range []string{"readme", "readme=big", "doc=-1"} {
+		if _, err := ParseChunkTypeBoosts(bad); err == nil {
+			t.Errorf("ParseChunkTypeBoosts(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+// readmeRepoChunks is a stubRepoRepo that also serves readme as the
+// repository's top README chunks.
+type readmeRepoChunks struct {
+	*stubRepoRepo
+	readme []models.CodeChunk
+}
+
+func (r *readmeRepoChunks) GetTopContextChunksByType(ctx context.Context, repoID, chunkType string, k int) ([]models.CodeChunk, error) {
+	if chunkType != models.ChunkTypeReadme {
+		return nil, nil
+	}
+	if k < len(r.readme) {
+		return r.readme[:k], nil
+	}
+	return r.readme, nil
+}
+
+func TestGetGuideIncludesReadmeContext(t *testing.T) {
+	llm := &stubLLM{answer: "1) Read main.go"}
+	svc, _, gh := newTestGuideService(t, llm)
+	svc.repoRepo = &readmeRepoChunks{
+		stubRepoRepo: svc.repoRepo.(*stubRepoRepo),
+		readme:       []models.CodeChunk{{ID: "r1", RepoID: "o/r", File: "README.md", Text: "# Widgets: build with make", ChunkType: models.ChunkTypeReadme}},
+	}
+	svc.minReadmeChunks = 1
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+	if _, err := svc.GetGuide(context.Background(), "o/r#1"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	prompt := llm.prompts[0]
+	for _, want := range []string{"# Widgets: build with make", "package main"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("guide prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+	if strings.Index(prompt, "# Widgets") > strings.Index(prompt, "package main") {
+		t.Error("README context comes after the code it was meant to lead")
+	}
+}
@@ -2,25 +2,178 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/ahmednasr/ai-in-action/server/internal/github"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrFileNotFound is returned when a requested file is in neither the
+// snapshot nor GitHub. Handlers map it to 404 Not Found.
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrAccessDenied is returned when the AccessChecker refuses a file request.
+// Handlers map it to 403 Forbidden.
+var ErrAccessDenied = errors.New("access denied")
+
+// AccessChecker decides whether the caller may read files of a repository.
+// Deployments serving private repos plug in a checker that verifies the
+// caller's GitHub token (see CallerToken) against the repo's permissions.
+type AccessChecker interface {
+	CanAccess(ctx context.Context, repoID string) (bool, error)
+}
+
+// AllowAll is the default AccessChecker; every repo is public.
+type AllowAll struct{}
+
+// CanAccess always allows access.
+func (AllowAll) CanAccess(context.Context, string) (bool, error) { return true, nil }
+
+type callerTokenKey struct{}
+
+// WithCallerToken returns a copy of ctx carrying the caller's GitHub token.
+func WithCallerToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, callerTokenKey{}, token)
+}
+
+// CallerToken returns the caller's GitHub token from ctx, or "" if none was sent.
+func CallerToken(ctx context.Context) string {
+	token, _ := ctx.Value(callerTokenKey{}).(string)
+	return token
+}
+
 // CodeService handles file content retrieval operations
 type CodeService interface {
-	GetFileContent(ctx context.Context, repoID string, filePath string) (string, error)
+	// GetFileContent returns a file of repoID. An empty ref serves the
+	// indexed snapshot of the default branch; any other ref (branch, tag or
+	// commit) is fetched from GitHub.
+	GetFileContent(ctx context.Context, repoID, filePath, ref string) (string, error)
+
+	// FindFileContent is GetFileContent for a file stored under one of
+	// several paths, returning the path that resolved with its content.
+	FindFileContent(ctx context.Context, repoID string, paths []string, ref string) (path, content string, err error)
+
+	// Public reports whether every caller may read every repo, so that file
+	// responses do not depend on who asked.
+	Public() bool
 }
 
 type codeService struct {
 	repoRepo RepoRepository
+	gh       *github.Client
+	access   AccessChecker
 }
 
-// NewCodeService creates a new instance of CodeService
-func NewCodeService(repoRepo RepoRepository) CodeService {
+// NewCodeService creates a new instance of CodeService. A nil access checker
+// allows every request.
+func NewCodeService(repoRepo RepoRepository, gh *github.Client, access AccessChecker) CodeService {
+	if access == nil {
+		access = AllowAll{}
+	}
 	return &codeService{
 		repoRepo: repoRepo,
+		gh:       gh,
+		access:   access,
 	}
 }
 
-// GetFileContent retrieves the content of a file from the repository
-func (s *codeService) GetFileContent(ctx context.Context, repoID string, filePath string) (string, error) {
-	return s.repoRepo.GetFileContent(ctx, repoID, filePath)
+// GetFileContent retrieves the content of a file from the repository. Files
+// missing from the snapshot are fetched from GitHub at the repo's
+// DefaultBranch.
+func (s *codeService) GetFileContent(ctx context.Context, repoID, filePath, ref string) (string, error) {
+	_, content, err := s.FindFileContent(ctx, repoID, []string{filePath}, ref)
+	return content, err
+}
+
+// FindFileContent serves the first of paths found in the snapshot. When none
+// is there, GitHub is asked once, for the first path, at the repo's
+// DefaultBranch; a file GitHub does not have either is ErrFileNotFound.
+func (s *codeService) FindFileContent(ctx context.Context, repoID string, paths []string, ref string) (string, string, error) {
+	ok, err := s.access.CanAccess(ctx, repoID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check access to %s: %w", repoID, err)
+	}
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrAccessDenied, repoID)
+	}
+	if len(paths) == 0 {
+		return "", "", fmt.Errorf("%w: no path given", ErrFileNotFound)
+	}
+
+	if ref != "" {
+		content, err := s.githubFileContent(ctx, repoID, paths[0], ref)
+		if errors.Is(err, github.ErrNotFound) {
+			return "", "", fmt.Errorf("%w: %s at %s: %v", ErrFileNotFound, paths[0], ref, err)
+		}
+		return paths[0], content, err
+	}
+
+	// snapshotErr keeps the first failure other than a missing object, which
+	// is reported if GitHub cannot serve the file either
+	var snapshotErr error
+	for _, path := range paths {
+		content, err := s.repoRepo.GetFileContent(ctx, repoID, path)
+		if err == nil {
+			return path, content, nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotExist) && snapshotErr == nil {
+			snapshotErr = err
+		}
+	}
+
+	// Fall back to GitHub, pinned to the branch the dataset recorded
+	notFound := fmt.Errorf("%w: %s in repo %s", ErrFileNotFound, paths[0], repoID)
+	if snapshotErr != nil {
+		notFound = snapshotErr
+	}
+	owner, name, path, ok := splitRepoFile(repoID, paths[0])
+	if !ok {
+		return "", "", notFound
+	}
+	repoDoc, err := s.repoRepo.FindByID(ctx, owner+"/"+name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", "", notFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up %s/%s for the GitHub fallback: %w", owner, name, err)
+	}
+	log.Printf("File %s not in snapshot of %s/%s; fetching from GitHub at %q", path, owner, name, repoDoc.DefaultBranch)
+	content, err := s.gh.GetFileContent(ctx, owner, name, path, repoDoc.DefaultBranch)
+	if errors.Is(err, github.ErrNotFound) {
+		return "", "", fmt.Errorf("%w (GitHub fallback: %v)", notFound, err)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch %s from GitHub: %w", path, err)
+	}
+	return paths[0], content, nil
+}
+
+// Public reports whether the service checks access with AllowAll.
+func (s *codeService) Public() bool {
+	_, ok := s.access.(AllowAll)
+	return ok
+}
+
+// githubFileContent fetches filePath from GitHub at ref.
+func (s *codeService) githubFileContent(ctx context.Context, repoID, filePath, ref string) (string, error) {
+	owner, name, path, ok := splitRepoFile(repoID, filePath)
+	if !ok {
+		return "", fmt.Errorf("invalid file path %q for repo %q", filePath, repoID)
+	}
+	return s.gh.GetFileContent(ctx, owner, name, path, ref)
+}
+
+// splitRepoFile resolves the GitHub owner, repo and in-repo path of a file
+// request. The file endpoint's repo ID is either the owner, with the repo
+// name as the path's first segment (the snapshot layout), or owner/repo.
+func splitRepoFile(repoID, filePath string) (owner, name, path string, ok bool) {
+	if owner, name, ok = strings.Cut(repoID, "/"); ok {
+		return owner, name, strings.TrimPrefix(filePath, name+"/"), true
+	}
+	name, path, ok = strings.Cut(filePath, "/")
+	return repoID, name, path, ok && name != "" && path != ""
 }
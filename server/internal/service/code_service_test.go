@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// snapshotRepoRepo is a RepoRepository whose snapshot holds files, keyed
+// "repoID:path", and which knows the repos in repos.
+type snapshotRepoRepo struct {
+	RepoRepository
+	files map[string]string
+	repos map[string]*models.Repo
+}
+
+func (r *snapshotRepoRepo) GetFileContent(ctx context.Context, repoID, filePath string) (string, error) {
+	if content, ok := r.files[repoID+":"+filePath]; ok {
+		return content, nil
+	}
+	return "", fmt.Errorf("file not found: %w", storage.ErrObjectNotExist)
+}
+
+func (r *snapshotRepoRepo) FindByID(ctx context.Context, repoID string) (*models.Repo, error) {
+	if repo, ok := r.repos[repoID]; ok {
+		return repo, nil
+	}
+	return nil, fmt.Errorf("repository %s not found: %w", repoID, mongo.ErrNoDocuments)
+}
+
+// contentsServer is a fake GitHub contents API answering every file with
+// its path and ref, recording the requests.
+type contentsServer struct {
+	mu       sync.Mutex
+	requests []string // "path@ref"
+}
+
+func (s *contentsServer) handle(w http.ResponseWriter, r *http.Request) {
+	ref := r.URL.Query().Get("ref")
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path+"@"+ref)
+	s.mu.Unlock()
+	content := base64.StdEncoding.EncodeToString([]byte("from github at " + ref))
+	fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, content)
+}
+
+func TestGetFileContentDefaultBranch(t *testing.T) {
+	gh := &contentsServer{}
+	repos := &snapshotRepoRepo{
+		files: map[string]string{"octo:widgets/main.go": "from the snapshot"},
+		repos: map[string]*models.Repo{"octo/widgets": {ID: "octo/widgets", FullName: "octo/widgets", DefaultBranch: "develop"}},
+	}
+	svc := NewCodeService(repos, newGitHubStub(t, gh.handle), nil)
+
+	got, err := svc.GetFileContent(context.Background(), "octo", "widgets/main.go", "")
+	if err != nil || got != "from the snapshot" {
+		t.Errorf("snapshot file = %q, %v; want the snapshot content", got, err)
+	}
+	if len(gh.requests) != 0 {
+		t.Errorf("GitHub called for a file in the snapshot: %q", gh.requests)
+	}
+
+	got, err = svc.GetFileContent(context.Background(), "octo", "widgets/docs/new.md", "")
+	if err != nil {
+		t.Fatalf("GetFileContent: %v", err)
+	}
+	if got != "from github at develop" {
+		t.Errorf("fallback content = %q, want it read at the default branch", got)
+	}
+	if len(gh.requests) != 1 || gh.requests[0] != "/repos/octo/widgets/contents/docs/new.md@develop" {
+		t.Errorf("GitHub requests = %q, want docs/new.md at develop", gh.requests)
+	}
+}
+
+func TestFindFileContentFallsBackToGitHubOnce(t *testing.T) {
+	gh := &contentsServer{}
+	repos := &snapshotRepoRepo{
+		files: map[string]string{"octo:widgets/docs/guide.md": "from the snapshot"},
+		repos: map[string]*models.Repo{"octo/widgets": {ID: "octo/widgets", FullName: "octo/widgets", DefaultBranch: "develop"}},
+	}
+	svc := NewCodeService(repos, newGitHubStub(t, gh.handle), nil)
+
+	// A later candidate in the snapshot wins over GitHub
+	path, content, err := svc.FindFileContent(context.Background(), "octo", []string{"widgets/widgets/docs/guide.md", "widgets/docs/guide.md"}, "")
+	if err != nil || path != "widgets/docs/guide.md" || content != "from the snapshot" {
+		t.Errorf("FindFileContent = %q, %q, %v; want the second candidate from the snapshot", path, content, err)
+	}
+	if len(gh.requests) != 0 {
+		t.Errorf("GitHub called although a candidate was in the snapshot: %q", gh.requests)
+	}
+
+	path, content, err = svc.FindFileContent(context.Background(), "octo", []string{"widgets/new.md", "new.md"}, "")
+	if err != nil || path != "widgets/new.md" || content != "from github at develop" {
+		t.Errorf("FindFileContent = %q, %q, %v; want the first candidate from GitHub", path, content, err)
+	}
+	if len(gh.requests) != 1 || gh.requests[0] != "/repos/octo/widgets/contents/new.md@develop" {
+		t.Errorf("GitHub requests = %q, want one, for new.md at develop", gh.requests)
+	}
+}
+
+func TestFindFileContentNotFound(t *testing.T) {
+	var requests int
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+	repos := &snapshotRepoRepo{
+		repos: map[string]*models.Repo{"octo/widgets": {ID: "octo/widgets", FullName: "octo/widgets", DefaultBranch: "develop"}},
+	}
+	svc := NewCodeService(repos, newGitHubStub(t, notFound), nil)
+
+	for _, paths := range [][]string{{"widgets/missing.go", "missing.go"}, {"unknown/missing.go"}} {
+		if _, _, err := svc.FindFileContent(context.Background(), "octo", paths, ""); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("FindFileContent(%q) error = %v, want ErrFileNotFound", paths, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("GitHub asked %d times, want once for the known repo", requests)
+	}
+
+	// A failing snapshot is not a missing file
+	failing := &failingRepoRepo{snapshotRepoRepo: repos}
+	_, _, err := NewCodeService(failing, newGitHubStub(t, notFound), nil).FindFileContent(context.Background(), "octo", []string{"widgets/main.go"}, "")
+	if err == nil || errors.Is(err, ErrFileNotFound) {
+		t.Errorf("FindFileContent error = %v, want the storage failure", err)
+	}
+}
+
+// failingRepoRepo is a snapshotRepoRepo whose storage is unavailable.
+type failingRepoRepo struct {
+	*snapshotRepoRepo
+}
+
+func (r *failingRepoRepo) GetFileContent(ctx context.Context, repoID, filePath string) (string, error) {
+	return "", errors.New("storage unavailable")
+}
+
+func TestGetFileContentExplicitRef(t *testing.T) {
+	gh := &contentsServer{}
+	repos := &snapshotRepoRepo{
+		files: map[string]string{"octo/widgets:main.go": "from the snapshot"},
+		repos: map[string]*models.Repo{"octo/widgets": {ID: "octo/widgets", FullName: "octo/widgets", DefaultBranch: "develop"}},
+	}
+	svc := NewCodeService(repos, newGitHubStub(t, gh.handle), nil)
+
+	got, err := svc.GetFileContent(context.Background(), "octo/widgets", "main.go", "v1.2.0")
+	if err != nil {
+		t.Fatalf("GetFileContent: %v", err)
+	}
+	if got != "from github at v1.2.0" {
+		t.Errorf("content = %q, want the file at v1.2.0 rather than the snapshot", got)
+	}
+	if len(gh.requests) != 1 || gh.requests[0] != "/repos/octo/widgets/contents/main.go@v1.2.0" {
+		t.Errorf("GitHub requests = %q, want main.go at v1.2.0", gh.requests)
+	}
+}
+
+// recordingAccess allows the repos in allowed, recording the caller's token.
+type recordingAccess struct {
+	allowed map[string]bool
+	err     error
+	token   string
+}
+
+func (a *recordingAccess) CanAccess(ctx context.Context, repoID string) (bool, error) {
+	a.token = CallerToken(ctx)
+	return a.allowed[repoID], a.err
+}
+
+func TestGetFileContentAccessControl(t *testing.T) {
+	repos := &snapshotRepoRepo{files: map[string]string{"octo:widgets/main.go": "package main"}}
+	ctx := WithCallerToken(context.Background(), "ghp_caller")
+
+	for _, ref := range []string{"", "develop"} {
+		t.Run("denied at ref "+ref, func(t *testing.T) {
+			// A nil GitHub client panics if the denied file is fetched
+			access := &recordingAccess{}
+			_, err := NewCodeService(repos, nil, access).GetFileContent(ctx, "octo", "widgets/main.go", ref)
+			if !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("err = %v, want ErrAccessDenied", err)
+			}
+			if access.token != "ghp_caller" {
+				t.Errorf("checker saw token %q, want the caller's", access.token)
+			}
+		})
+	}
+	t.Run("checker error", func(t *testing.T) {
+		access := &recordingAccess{err: errors.New("github unavailable")}
+		_, err := NewCodeService(repos, nil, access).GetFileContent(ctx, "octo", "widgets/main.go", "")
+		if err == nil || errors.Is(err, ErrAccessDenied) {
+			t.Errorf("err = %v, want the checker's failure, not a denial", err)
+		}
+	})
+	t.Run("nil checker allows all", func(t *testing.T) {
+		got, err := NewCodeService(repos, nil, nil).GetFileContent(ctx, "octo", "widgets/main.go", "")
+		if err != nil || got != "package main" {
+			t.Errorf("GetFileContent = %q, %v; want the file", got, err)
+		}
+	})
+}
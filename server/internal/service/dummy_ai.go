@@ -1,7 +1,11 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
 )
@@ -12,10 +16,22 @@ func (d dummyEmbedder) Embed(text string) ([]float32, error) {
 	if text == "" {
 		return nil, fmt.Errorf("empty text provided")
 	}
-	// Return a fixed-size embedding vector with some non-zero values
+	// Derive a reproducible pseudo-random unit vector from the text so that
+	// different inputs rank differently in vector search tests.
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
 	embedding := make([]float32, 768)
+	var norm float64
+	for i := range embedding {
+		v := rng.Float64()*2 - 1
+		embedding[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
 	for i := range embedding {
-		embedding[i] = 0.1 // Small non-zero value
+		embedding[i] = float32(float64(embedding[i]) / norm)
 	}
 	return embedding, nil
 }
@@ -30,6 +46,10 @@ func (d dummyLLM) GenerateGuide(issue models.Issue, ctx []string) (string, error
 	return "<placeholder answer>", nil
 }
 
+func (d dummyLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	return "<placeholder answer>", nil
+}
+
 func NewDummyLLM() LLMClient {
 	return dummyLLM{}
 }
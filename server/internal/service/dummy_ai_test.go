@@ -0,0 +1,42 @@
+package service
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDummyEmbedderIsDeterministicPerText(t *testing.T) {
+	e := NewDummyEmbedder()
+
+	a1, err := e.Embed("parse the config file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, _ := e.Embed("parse the config file")
+	b, _ := e.Embed("render the landing page")
+
+	if len(a1) != 768 || len(b) != 768 {
+		t.Fatalf("dimensions = %d, %d, want 768", len(a1), len(b))
+	}
+	if !reflect.DeepEqual(a1, a2) {
+		t.Error("same text embedded to different vectors")
+	}
+	if reflect.DeepEqual(a1, b) {
+		t.Error("different texts embedded to the same vector")
+	}
+
+	var norm float64
+	for _, v := range a1 {
+		norm += float64(v) * float64(v)
+	}
+	if math.Abs(norm-1) > 1e-4 {
+		t.Errorf("squared norm = %f, want a unit vector", norm)
+	}
+}
+
+func TestDummyEmbedderRejectsEmptyText(t *testing.T) {
+	if _, err := NewDummyEmbedder().Embed(""); err == nil {
+		t.Error("Embed(\"\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrEmbedderBusy is returned when no embedding slot frees up within the
+// limiter's queue timeout. Handlers map it to 503 Service Unavailable.
+var ErrEmbedderBusy = errors.New("embedder is busy, try again later")
+
+// BatchEmbedder is implemented by embedders that can embed several texts in
+// one call (the Vertex and Gemini embedders).
+type BatchEmbedder interface {
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedLimiter bounds how many embeddings run at once across every embedder it
+// wraps. Each local embedding spawns a Python process, so without a bound a
+// burst of searches can exhaust the host.
+type EmbedLimiter struct {
+	slotLimiter
+}
+
+// NewEmbedLimiter allows maxConcurrent embeddings at a time. Callers beyond
+// that wait up to queueTimeout for a slot before failing with ErrEmbedderBusy;
+// a zero queueTimeout fails fast.
+func NewEmbedLimiter(maxConcurrent int, queueTimeout time.Duration) *EmbedLimiter {
+	return &EmbedLimiter{newSlotLimiter(maxConcurrent, queueTimeout, ErrEmbedderBusy)}
+}
+
+// Wrap returns e guarded by l; every call acquires a slot first.
+func (l *EmbedLimiter) Wrap(e EmbeddingClient) *LimitedEmbedder {
+	return &LimitedEmbedder{inner: e, limiter: l}
+}
+
+// LimitedEmbedder is an EmbeddingClient guarded by an EmbedLimiter.
+type LimitedEmbedder struct {
+	inner   EmbeddingClient
+	limiter *EmbedLimiter
+}
+
+// Embed embeds text once a slot is available.
+func (e *LimitedEmbedder) Embed(text string) ([]float32, error) {
+	if err := e.limiter.acquire(context.Background()); err != nil {
+		return nil, err
+	}
+	defer e.limiter.release()
+	return e.inner.Embed(text)
+}
+
+// EmbedWithContext embeds text once a slot is available, giving up when ctx
+// is canceled while queued or while the wrapped embedder runs.
+func (e *LimitedEmbedder) EmbedWithContext(ctx context.Context, text string) ([]float32, error) {
+	if err := e.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer e.limiter.release()
+	return EmbedContext(ctx, e.inner, text)
+}
+
+// EmbedBatch embeds texts while holding a single slot, using the wrapped
+// embedder's batch API when it has one and embedding one by one otherwise.
+func (e *LimitedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := e.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer e.limiter.release()
+
+	if batch, ok := e.inner.(BatchEmbedder); ok {
+		return batch.EmbedBatch(ctx, texts)
+	}
+	embeddings := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vec, err := EmbedContext(ctx, e.inner, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vec)
+	}
+	return embeddings, nil
+}
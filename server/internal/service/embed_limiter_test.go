@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gaugeEmbedder records the most embeddings it ever ran at once. Each
+// embedding holds for hold, or until release is closed when it is set.
+type gaugeEmbedder struct {
+	hold    time.Duration
+	release chan struct{}
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (e *gaugeEmbedder) Embed(text string) ([]float32, error) {
+	n := e.running.Add(1)
+	defer e.running.Add(-1)
+	for {
+		peak := e.peak.Load()
+		if n <= peak || e.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	if e.release != nil {
+		<-e.release
+	} else {
+		time.Sleep(e.hold)
+	}
+	return []float32{0.1, 0.2}, nil
+}
+
+func TestEmbedLimiterCapsConcurrency(t *testing.T) {
+	const limit = 3
+	inner := &gaugeEmbedder{hold: 20 * time.Millisecond}
+	e := NewEmbedLimiter(limit, time.Minute).Wrap(inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = e.Embed("text")
+			} else {
+				_, err = e.EmbedBatch(context.Background(), []string{"a", "b"})
+			}
+			if err != nil {
+				t.Errorf("embed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak := inner.peak.Load(); peak > limit {
+		t.Errorf("%d embeddings ran at once, want at most %d", peak, limit)
+	} else if peak < limit {
+		t.Errorf("at most %d embeddings ran at once; the limiter should allow %d", peak, limit)
+	}
+}
+
+func TestEmbedLimiterFailsFastWhenSaturated(t *testing.T) {
+	inner := &gaugeEmbedder{release: make(chan struct{})}
+	e := NewEmbedLimiter(1, 0).Wrap(inner)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Embed("holds the only slot")
+	}()
+	for inner.running.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := e.Embed("rejected"); !errors.Is(err, ErrEmbedderBusy) {
+		t.Errorf("err = %v, want ErrEmbedderBusy", err)
+	}
+	close(inner.release)
+	<-done
+
+	if _, err := e.Embed("slot is free again"); err != nil {
+		t.Errorf("embed after release: %v", err)
+	}
+}
+
+func TestEmbedLimiterQueueTimeout(t *testing.T) {
+	inner := &gaugeEmbedder{release: make(chan struct{})}
+	defer close(inner.release)
+	e := NewEmbedLimiter(1, 50*time.Millisecond).Wrap(inner)
+
+	go e.Embed("holds the only slot")
+	for inner.running.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := e.EmbedWithContext(context.Background(), "queued"); !errors.Is(err, ErrEmbedderBusy) {
+		t.Errorf("err = %v, want ErrEmbedderBusy", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("gave up after %s, want to wait the 50ms queue timeout", waited)
+	}
+}
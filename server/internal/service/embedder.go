@@ -1,7 +1,132 @@
 package service
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
 // Embedder defines the interface for text embedding services
 type Embedder interface {
 	// Embed converts a text string into a vector embedding
 	Embed(text string) ([]float32, error)
 }
+
+// ContextEmbedder is implemented by embedders whose work can be abandoned when
+// the caller's context is canceled (the local embedder kills its Python
+// process).
+type ContextEmbedder interface {
+	EmbedWithContext(ctx context.Context, text string) ([]float32, error)
+}
+
+// EmbedContext embeds text with e, honouring ctx when e is a ContextEmbedder.
+func EmbedContext(ctx context.Context, e EmbeddingClient, text string) ([]float32, error) {
+	if ce, ok := e.(ContextEmbedder); ok {
+		return ce.EmbedWithContext(ctx, text)
+	}
+	return e.Embed(text)
+}
+
+// ErrInvalidEmbedding is returned when an embedder produces an empty or
+// one-element vector, which is never a real embedding and would only make
+// $vectorSearch fail or match nothing. Handlers map it to 502 Bad Gateway.
+var ErrInvalidEmbedding = errors.New("embedder returned empty/invalid vector")
+
+// checkEmbedding rejects vectors with fewer than two values.
+func checkEmbedding(vec []float32) error {
+	if len(vec) <= 1 {
+		return fmt.Errorf("%w (length %d)", ErrInvalidEmbedding, len(vec))
+	}
+	return nil
+}
+
+// sanitizeUTF8 replaces invalid UTF-8 sequences in text with U+FFFD, logging a
+// warning when it does. Invalid bytes break the JSON sent to the Python worker
+// and the Vertex request, so every embedder cleans its input this way.
+func sanitizeUTF8(text string) string {
+	if utf8.ValidString(text) {
+		return text
+	}
+	clean := strings.ToValidUTF8(text, string(utf8.RuneError))
+	log.Printf("Warning: embedding input contains invalid UTF-8; replaced invalid sequences in %d-byte text", len(text))
+	return clean
+}
+
+// Embedding providers accepted by NewEmbedder.
+const (
+	EmbedderLocal  = "local"
+	EmbedderVertex = "vertex"
+	EmbedderGemini = "gemini"
+)
+
+// EmbedderConfig selects and configures an embedding backend.
+type EmbedderConfig struct {
+	Provider string // EmbedderLocal (default), EmbedderVertex or EmbedderGemini
+
+	// Local embedder
+	ModelType string // "metadata" or "code"
+	PythonBin string
+	ModelName string
+	Dimension int
+	MinLength int // shortest text embedded; shorter input fails with ErrTextTooShort
+	PoolSize  int // persistent Python workers per model; 0 spawns one per call
+
+	// LocalTimeout is the hard limit per local embedding, after which its
+	// Python process is killed; 0 selects DefaultLocalEmbedTimeout
+	LocalTimeout time.Duration
+
+	// Vertex / Gemini embedders
+	ProjectID   string
+	Location    string
+	Timeout     time.Duration
+	MaxAttempts int
+}
+
+// ClosableEmbedder is an Embedder that holds resources to release on shutdown.
+type ClosableEmbedder interface {
+	Embedder
+	Close() error
+}
+
+// NewEmbedder constructs the embedder for cfg.Provider.
+func NewEmbedder(cfg EmbedderConfig) (ClosableEmbedder, error) {
+	switch cfg.Provider {
+	case EmbedderLocal, "":
+		local, err := NewLocalEmbedder(cfg.ModelType, cfg.PythonBin, cfg.ModelName, cfg.Dimension, cfg.MinLength, cfg.PoolSize)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.LocalTimeout > 0 {
+			local.SetTimeout(cfg.LocalTimeout)
+		}
+		return local, nil
+	case EmbedderVertex:
+		return NewVertexEmbedder(cfg.ProjectID, cfg.Location, cfg.Timeout, cfg.MaxAttempts)
+	case EmbedderGemini:
+		return NewGeminiEmbedder(cfg.Timeout, cfg.MaxAttempts)
+	default:
+		return nil, fmt.Errorf("unknown embedder provider %q (expected %q, %q or %q)",
+			cfg.Provider, EmbedderLocal, EmbedderVertex, EmbedderGemini)
+	}
+}
+
+// EmbedderModelName returns the name of the model NewEmbedder(cfg) embeds with.
+func EmbedderModelName(cfg EmbedderConfig) string {
+	switch cfg.Provider {
+	case EmbedderVertex:
+		return "text-embedding-005"
+	case EmbedderGemini:
+		return "gemini-embedding-001"
+	}
+	if cfg.ModelName != "" {
+		return cfg.ModelName
+	}
+	if cfg.ModelType == "code" {
+		return defaultCodeModel
+	}
+	return defaultMetadataModel
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// fakeGoogleCredentials points the Google clients at placeholder credentials;
+// they are only read, never used, as no request is made.
+func fakeGoogleCredentials(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "creds.json")
+	creds := `{"type":"authorized_user","client_id":"id","client_secret":"secret","refresh_token":"token"}`
+	if err := os.WriteFile(path, []byte(creds), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	return path
+}
+
+func TestNewEmbedderSelectsProvider(t *testing.T) {
+	creds := fakeGoogleCredentials(t)
+	// NewGeminiEmbedder reads server-key.json from the working directory.
+	dir := t.TempDir()
+	data, err := os.ReadFile(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "server-key.json"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	tests := []struct {
+		provider string
+		check    func(ClosableEmbedder) bool
+	}{
+		{"", func(e ClosableEmbedder) bool { _, ok := e.(*LocalEmbedder); return ok }},
+		{EmbedderLocal, func(e ClosableEmbedder) bool { _, ok := e.(*LocalEmbedder); return ok }},
+		{EmbedderVertex, func(e ClosableEmbedder) bool { _, ok := e.(*VertexEmbedder); return ok }},
+		{EmbedderGemini, func(e ClosableEmbedder) bool { _, ok := e.(*GeminiEmbedder); return ok }},
+	}
+	for _, tt := range tests {
+		t.Run("provider="+tt.provider, func(t *testing.T) {
+			e, err := NewEmbedder(EmbedderConfig{Provider: tt.provider, ModelType: "code", ProjectID: "p"})
+			if err != nil {
+				t.Fatalf("NewEmbedder: %v", err)
+			}
+			defer e.Close()
+			if !tt.check(e) {
+				t.Errorf("NewEmbedder(%q) built a %T", tt.provider, e)
+			}
+		})
+	}
+}
+
+func TestNewEmbedderAppliesLocalTimeout(t *testing.T) {
+	e, err := NewEmbedder(EmbedderConfig{Provider: EmbedderLocal, ModelType: "metadata", LocalTimeout: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("NewEmbedder: %v", err)
+	}
+	defer e.Close()
+	if got := e.(*LocalEmbedder).timeout; got != 3*time.Second {
+		t.Errorf("timeout = %s, want 3s", got)
+	}
+}
+
+func TestNewEmbedderRejectsUnknownProvider(t *testing.T) {
+	_, err := NewEmbedder(EmbedderConfig{Provider: "openai"})
+	if err == nil || !strings.Contains(err.Error(), `"openai"`) {
+		t.Errorf("err = %v, want an unknown-provider error", err)
+	}
+}
+
+func TestSanitizeUTF8(t *testing.T) {
+	logs := captureLog(t)
+	if got := sanitizeUTF8("héllo wörld"); got != "héllo wörld" || logs.Len() != 0 {
+		t.Errorf("valid text = %q (log %q), want it unchanged and unlogged", got, logs)
+	}
+	got := sanitizeUTF8("caf\xe9 \xff\xfe latte")
+	if !utf8.ValidString(got) || got != "caf� � latte" {
+		t.Errorf("sanitized = %q, want each invalid run replaced with U+FFFD", got)
+	}
+	if !strings.Contains(logs.String(), "invalid UTF-8") {
+		t.Errorf("log = %q, want a warning", logs)
+	}
+}
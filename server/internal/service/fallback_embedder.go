@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// FallbackEmbedder embeds with a primary embedder and, when that fails, with a
+// fallback one, so searches keep working through a primary outage.
+//
+// A fallback model often embeds into a different dimension than the primary,
+// and its vectors can't be searched against the primary's index. When dimension is set, fallback vectors are truncated
+// or zero-padded to it. That keeps a single index usable but the projected
+// vectors only roughly match the primary's, so it is logged loudly.
+type FallbackEmbedder struct {
+	primary   ClosableEmbedder
+	fallback  ClosableEmbedder
+	dimension int // fallback vectors are projected to this length; 0 leaves them as they are
+
+	warnOnce sync.Once
+}
+
+// NewFallbackEmbedder returns an embedder that uses fallback whenever primary
+// fails. A positive dimension projects fallback vectors to that length.
+func NewFallbackEmbedder(primary, fallback ClosableEmbedder, dimension int) *FallbackEmbedder {
+	return &FallbackEmbedder{primary: primary, fallback: fallback, dimension: dimension}
+}
+
+// Embed embeds text with the primary embedder, or the fallback when it fails.
+func (e *FallbackEmbedder) Embed(text string) ([]float32, error) {
+	return e.EmbedWithContext(context.Background(), text)
+}
+
+// EmbedWithContext is Embed honouring ctx. Input the primary rejects as too
+// short and canceled requests are not retried with the fallback.
+func (e *FallbackEmbedder) EmbedWithContext(ctx context.Context, text string) ([]float32, error) {
+	vec, err := EmbedContext(ctx, e.primary, text)
+	if err == nil || errors.Is(err, ErrTextTooShort) || ctx.Err() != nil {
+		return vec, err
+	}
+	log.Printf("Warning: primary embedder failed, using fallback: %v", err)
+
+	vec, fallbackErr := EmbedContext(ctx, e.fallback, text)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("primary embedder failed: %v; fallback embedder failed: %w", err, fallbackErr)
+	}
+	return e.project(vec), nil
+}
+
+// EmbedBatch embeds texts with the primary embedder's batch API when it has
+// one, falling back to embedding each text on its own when the batch fails.
+func (e *FallbackEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if batch, ok := e.primary.(BatchEmbedder); ok {
+		embeddings, err := batch.EmbedBatch(ctx, texts)
+		if err == nil || ctx.Err() != nil {
+			return embeddings, err
+		}
+		log.Printf("Warning: primary embedder batch of %d failed, embedding one by one: %v", len(texts), err)
+	}
+
+	embeddings := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vec, err := e.EmbedWithContext(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vec)
+	}
+	return embeddings, nil
+}
+
+// project fits vec to e.dimension, warning the first time it has to.
+func (e *FallbackEmbedder) project(vec []float32) []float32 {
+	if e.dimension <= 0 || len(vec) == e.dimension {
+		return vec
+	}
+	e.warnOnce.Do(func() {
+		log.Printf("WARNING: fallback embedder produces %d-dimensional vectors; projecting them to %d dimensions. Search quality is degraded until the primary embedder recovers.", len(vec), e.dimension)
+	})
+	return projectEmbedding(vec, e.dimension)
+}
+
+// projectEmbedding returns vec cut to dim values, or zero-padded to dim when
+// shorter. vec itself is never modified.
+func projectEmbedding(vec []float32, dim int) []float32 {
+	out := make([]float32, dim)
+	copy(out, vec)
+	return out
+}
+
+// Close releases both embedders.
+func (e *FallbackEmbedder) Close() error {
+	return errors.Join(e.primary.Close(), e.fallback.Close())
+}
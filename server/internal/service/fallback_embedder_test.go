@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixedEmbedder returns vec, or err, for every text, counting its calls.
+type fixedEmbedder struct {
+	vec    []float32
+	err    error
+	calls  int
+	closed bool
+}
+
+func (e *fixedEmbedder) Embed(text string) ([]float32, error) {
+	e.calls++
+	return e.vec, e.err
+}
+
+func (e *fixedEmbedder) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestProjectEmbedding(t *testing.T) {
+	vec := []float32{0.1, 0.2, 0.3, 0.4}
+	tests := []struct {
+		name string
+		dim  int
+		want []float32
+	}{
+		{"truncate", 2, []float32{0.1, 0.2}},
+		{"zero-pad", 6, []float32{0.1, 0.2, 0.3, 0.4, 0, 0}},
+		{"same length", 4, []float32{0.1, 0.2, 0.3, 0.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := projectEmbedding(vec, tt.dim)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("projectEmbedding(%v, %d) = %v, want %v", vec, tt.dim, got, tt.want)
+			}
+			got[0] = 9
+			if vec[0] != 0.1 {
+				t.Error("projectEmbedding shares memory with its input")
+			}
+		})
+	}
+}
+
+func TestFallbackEmbedderProjectsFallbackVectors(t *testing.T) {
+	down := errors.New("vertex unavailable")
+	tests := []struct {
+		name     string
+		fallback []float32
+		dim      int
+		want     []float32
+	}{
+		{"pads shorter vectors", []float32{0.5, 0.6}, 4, []float32{0.5, 0.6, 0, 0}},
+		{"truncates longer vectors", []float32{0.5, 0.6, 0.7, 0.8, 0.9}, 3, []float32{0.5, 0.6, 0.7}},
+		{"no dimension keeps them", []float32{0.5, 0.6}, 0, []float32{0.5, 0.6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			e := NewFallbackEmbedder(&fixedEmbedder{err: down}, &fixedEmbedder{vec: tt.fallback}, tt.dim)
+
+			for i := 0; i < 2; i++ {
+				vec, err := e.Embed("query")
+				if err != nil {
+					t.Fatalf("Embed: %v", err)
+				}
+				if !reflect.DeepEqual(vec, tt.want) {
+					t.Errorf("Embed = %v, want %v", vec, tt.want)
+				}
+			}
+			warnings := strings.Count(logs.String(), "Search quality is degraded")
+			if tt.dim > 0 && warnings != 1 {
+				t.Errorf("logged %d projection warnings, want exactly 1:\n%s", warnings, logs)
+			}
+			if tt.dim == 0 && warnings != 0 {
+				t.Errorf("logged a projection warning without a dimension:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestFallbackEmbedderLeavesPrimaryVectors(t *testing.T) {
+	primary := &fixedEmbedder{vec: []float32{0.1, 0.2, 0.3}}
+	fallback := &fixedEmbedder{vec: []float32{0.5, 0.6}}
+	e := NewFallbackEmbedder(primary, fallback, 2)
+
+	vec, err := e.Embed("query")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if !reflect.DeepEqual(vec, primary.vec) || fallback.calls != 0 {
+		t.Errorf("Embed = %v with %d fallback calls, want the primary vector untouched", vec, fallback.calls)
+	}
+}
+
+func TestFallbackEmbedderDoesNotRetryShortText(t *testing.T) {
+	fallback := &fixedEmbedder{vec: []float32{0.5, 0.6}}
+	e := NewFallbackEmbedder(&fixedEmbedder{err: ErrTextTooShort}, fallback, 2)
+
+	if _, err := e.Embed("a"); !errors.Is(err, ErrTextTooShort) {
+		t.Errorf("Embed error = %v, want ErrTextTooShort", err)
+	}
+	if fallback.calls != 0 {
+		t.Errorf("fallback called %d times for text the primary rejected", fallback.calls)
+	}
+}
+
+func TestFallbackEmbedderBatchProjects(t *testing.T) {
+	e := NewFallbackEmbedder(&fixedEmbedder{err: errors.New("down")}, &fixedEmbedder{vec: []float32{0.5, 0.6}}, 3)
+
+	vecs, err := e.EmbedBatch(context.Background(), []string{"a text", "another text"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	want := [][]float32{{0.5, 0.6, 0}, {0.5, 0.6, 0}}
+	if !reflect.DeepEqual(vecs, want) {
+		t.Errorf("EmbedBatch = %v, want %v", vecs, want)
+	}
+}
+
+func TestFallbackEmbedderReportsBothErrors(t *testing.T) {
+	fallbackErr := errors.New("local model missing")
+	e := NewFallbackEmbedder(&fixedEmbedder{err: errors.New("vertex unavailable")}, &fixedEmbedder{err: fallbackErr}, 2)
+
+	_, err := e.Embed("query")
+	if !errors.Is(err, fallbackErr) || !strings.Contains(err.Error(), "vertex unavailable") {
+		t.Errorf("Embed error = %v, want both failures", err)
+	}
+
+	primary, fallback := &fixedEmbedder{}, &fixedEmbedder{}
+	NewFallbackEmbedder(primary, fallback, 0).Close()
+	if !primary.closed || !fallback.closed {
+		t.Error("Close did not close both embedders")
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FeedbackRepository persists guide ratings.
+type FeedbackRepository interface {
+	Record(ctx context.Context, fb models.GuideFeedback) error
+	List(ctx context.Context, issueID string, limit, offset int) ([]models.GuideFeedback, int64, error)
+}
+
+// ErrInvalidFeedback wraps validation failures (bad issue ID or a rating
+// other than "up" or "down"). Handlers map it to 400 Bad Request.
+var ErrInvalidFeedback = errors.New("invalid feedback")
+
+// maxFeedbackComment caps stored comments (characters).
+const maxFeedbackComment = 2000
+
+// FeedbackService records and lists user ratings of guides.
+type FeedbackService interface {
+	Record(ctx context.Context, issueID, rating, comment string) (models.GuideFeedback, error)
+	List(ctx context.Context, issueID string, limit, offset int) ([]models.GuideFeedback, int64, error)
+}
+
+type feedbackService struct {
+	repo FeedbackRepository
+}
+
+// NewFeedbackService wires the repository.
+func NewFeedbackService(repo FeedbackRepository) FeedbackService {
+	return &feedbackService{repo: repo}
+}
+
+// Record validates and stores a rating for the guide of issueID.
+func (s *feedbackService) Record(ctx context.Context, issueID, rating, comment string) (models.GuideFeedback, error) {
+	if _, _, _, err := parseIssueID(issueID); err != nil {
+		return models.GuideFeedback{}, fmt.Errorf("%w: %v", ErrInvalidFeedback, err)
+	}
+	rating = strings.ToLower(strings.TrimSpace(rating))
+	if rating != "up" && rating != "down" {
+		return models.GuideFeedback{}, fmt.Errorf(`%w: rating must be "up" or "down"`, ErrInvalidFeedback)
+	}
+	comment = strings.TrimSpace(comment)
+	if r := []rune(comment); len(r) > maxFeedbackComment {
+		comment = string(r[:maxFeedbackComment])
+	}
+
+	fb := models.GuideFeedback{
+		ID:        primitive.NewObjectID(),
+		IssueID:   issueID,
+		Rating:    rating,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.Record(ctx, fb); err != nil {
+		return models.GuideFeedback{}, err
+	}
+	return fb, nil
+}
+
+// List returns feedback newest first, for one issue or, with an empty
+// issueID, for all guides.
+func (s *feedbackService) List(ctx context.Context, issueID string, limit, offset int) ([]models.GuideFeedback, int64, error) {
+	return s.repo.List(ctx, issueID, limit, offset)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// memFeedbackRepo is a FeedbackRepository keeping feedback in a slice.
+type memFeedbackRepo struct {
+	feedback []models.GuideFeedback
+}
+
+func (r *memFeedbackRepo) Record(ctx context.Context, fb models.GuideFeedback) error {
+	r.feedback = append(r.feedback, fb)
+	return nil
+}
+
+func (r *memFeedbackRepo) List(ctx context.Context, issueID string, limit, offset int) ([]models.GuideFeedback, int64, error) {
+	var matched []models.GuideFeedback
+	for i := len(r.feedback) - 1; i >= 0; i-- { // newest first
+		if issueID == "" || r.feedback[i].IssueID == issueID {
+			matched = append(matched, r.feedback[i])
+		}
+	}
+	total := int64(len(matched))
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	return matched[offset:min(offset+limit, len(matched))], total, nil
+}
+
+func TestRecordFeedback(t *testing.T) {
+	repo := &memFeedbackRepo{}
+	svc := NewFeedbackService(repo)
+
+	fb, err := svc.Record(context.Background(), "o/r#3", " UP ", "  "+strings.Repeat("a", maxFeedbackComment+10)+"  ")
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if fb.Rating != "up" || len(fb.Comment) != maxFeedbackComment || fb.ID.IsZero() || fb.CreatedAt.IsZero() {
+		t.Errorf("feedback = rating %q, %d-character comment, id %s, created %s; want a normalized, stamped entry",
+			fb.Rating, len(fb.Comment), fb.ID.Hex(), fb.CreatedAt)
+	}
+	if len(repo.feedback) != 1 || repo.feedback[0].ID != fb.ID {
+		t.Errorf("stored %+v, want the returned feedback", repo.feedback)
+	}
+}
+
+func TestRecordFeedbackRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name, issueID, rating string
+	}{
+		{"malformed issue", "o/r", "up"},
+		{"unknown rating", "o/r#3", "meh"},
+		{"missing rating", "o/r#3", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memFeedbackRepo{}
+			if _, err := NewFeedbackService(repo).Record(context.Background(), tt.issueID, tt.rating, ""); !errors.Is(err, ErrInvalidFeedback) {
+				t.Errorf("err = %v, want ErrInvalidFeedback", err)
+			}
+			if len(repo.feedback) != 0 {
+				t.Error("invalid feedback was stored")
+			}
+		})
+	}
+}
+
+func TestListFeedback(t *testing.T) {
+	repo := &memFeedbackRepo{}
+	svc := NewFeedbackService(repo)
+	for _, r := range []struct{ issue, rating string }{{"o/r#1", "up"}, {"o/r#2", "down"}, {"o/r#1", "down"}} {
+		if _, err := svc.Record(context.Background(), r.issue, r.rating, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, total, err := svc.List(context.Background(), "o/r#1", 10, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 || len(got) != 2 || got[0].Rating != "down" || got[1].Rating != "up" {
+		t.Errorf("List(o/r#1) = %+v (total %d), want its two ratings newest first", got, total)
+	}
+	if _, total, _ := svc.List(context.Background(), "", 1, 0); total != 3 {
+		t.Errorf("List of all feedback: total = %d, want 3", total)
+	}
+}
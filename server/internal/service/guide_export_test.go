@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestExportGuideIncludesStoredContext(t *testing.T) {
+	llm := &stubLLM{answer: "1) Read main.go"}
+	svc, guides, gh := newTestGuideService(t, llm)
+	svc.repoRepo.(*stubRepoRepo).chunks = []models.CodeChunk{
+		{RepoID: "o/r", File: "main.go", Text: "package main", Score: 0.9},
+		{RepoID: "o/r", File: "server.go", Text: "package server", Score: 0.7},
+	}
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+	if _, err := svc.GetGuide(context.Background(), "o/r#1"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	stored, _ := guides.FindByIssueID(context.Background(), "o/r#1")
+	if stored.Prompt != llm.prompts[0] {
+		t.Errorf("stored prompt = %q, want the prompt sent to the LLM", stored.Prompt)
+	}
+
+	export, err := svc.ExportGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("ExportGuide: %v", err)
+	}
+	wantSources := []models.GuideSource{
+		{RepoID: "o/r", FilePath: "main.go", Content: "package main", Relevance: 0.9},
+		{RepoID: "o/r", FilePath: "server.go", Content: "package server", Relevance: 0.7},
+	}
+	if !reflect.DeepEqual(export.Sources, wantSources) {
+		t.Errorf("exported sources = %+v, want %+v", export.Sources, wantSources)
+	}
+	if export.Prompt != llm.prompts[0] || !strings.Contains(export.Prompt, "package server") {
+		t.Errorf("exported prompt = %q, want the prompt sent to the LLM", export.Prompt)
+	}
+	if export.Guide.ID != "o/r#1" || export.Guide.Answer != "1) Read main.go" || export.ExportedAt.IsZero() {
+		t.Errorf("export = %+v, want the stored guide and an export time", export)
+	}
+	if llm.calls() != 1 {
+		t.Errorf("LLM called %d times, want only the one generation", llm.calls())
+	}
+
+	// The context stays out of the guide's own JSON
+	b, _ := json.Marshal(stored)
+	if strings.Contains(string(b), "package server") || strings.Contains(string(b), `"prompt"`) {
+		t.Errorf("guide JSON exposes the stored context: %s", b)
+	}
+}
+
+func TestExportGuideNotGenerated(t *testing.T) {
+	llm := &stubLLM{}
+	svc, guides, _ := newTestGuideService(t, llm)
+
+	if _, err := svc.ExportGuide(context.Background(), "o/r#1"); !errors.Is(err, ErrGuideNotFound) {
+		t.Errorf("ExportGuide error = %v, want ErrGuideNotFound", err)
+	}
+	if llm.calls() != 0 {
+		t.Errorf("LLM called %d times, want export never to generate", llm.calls())
+	}
+
+	// Guides stored before the context was recorded export empty sources
+	guides.Upsert(context.Background(), models.Guide{ID: "o/r#2", Answer: "1) Old guide"})
+	export, err := svc.ExportGuide(context.Background(), "o/r#2")
+	if err != nil {
+		t.Fatalf("ExportGuide: %v", err)
+	}
+	if export.Sources == nil || len(export.Sources) != 0 || export.Prompt != "" {
+		t.Errorf("export = %+v, want empty (non-nil) sources and no prompt", export)
+	}
+}
+
+func TestChunkSourcesFollowsBudget(t *testing.T) {
+	chunks := []models.CodeChunk{
+		{RepoID: "o/r", File: "a.go", Text: "aaaa", Score: 0.9},
+		{RepoID: "o/r", File: "big.go", Text: strings.Repeat("b", 100), Score: 0.8},
+		{RepoID: "o/r", File: "c.go", Text: "cc", Score: 0.7},
+		{RepoID: "o/r", File: "d.go", Text: "dddddd", Score: 0.6},
+	}
+	// big.go was dropped and d.go cut short to fit the budget
+	got := chunkSources(chunks, []string{"aaaa", "cc", "ddd"})
+	want := []models.GuideSource{
+		{RepoID: "o/r", FilePath: "a.go", Content: "aaaa", Relevance: 0.9},
+		{RepoID: "o/r", FilePath: "c.go", Content: "cc", Relevance: 0.7},
+		{RepoID: "o/r", FilePath: "d.go", Content: "ddd", Relevance: 0.6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunkSources = %+v, want %+v", got, want)
+	}
+}
+
+func TestRAGGuideStoresContext(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("stored", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		guides := &fakeGuides{issue: models.Issue{Number: 12, Title: "Crash", State: "open"}}
+		llm := &stubLLM{answer: "1. Read a.go"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		if _, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"}); err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		if len(guides.upserted) != 1 {
+			mt.Fatalf("cached %d guides, want 1", len(guides.upserted))
+		}
+		stored := guides.upserted[0]
+		want := []models.GuideSource{{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}}
+		if !reflect.DeepEqual(stored.Sources, want) {
+			mt.Errorf("stored sources = %+v, want %+v", stored.Sources, want)
+		}
+		if stored.Prompt == "" || stored.Prompt != llm.prompts[len(llm.prompts)-1] || !strings.Contains(stored.Prompt, "func A() {}") {
+			mt.Errorf("stored prompt = %q, want the guide prompt sent to the LLM", stored.Prompt)
+		}
+	})
+}
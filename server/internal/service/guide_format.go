@@ -0,0 +1,232 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// stripMarkdownFence removes a ```markdown (or ```md / bare ```) fence that the
+// LLM sometimes wraps around an entire guide despite being told not to, which
+// would otherwise render as one big code block. Fences around real code
+// snippets inside the guide are left alone.
+func stripMarkdownFence(md string) string {
+	lines := strings.Split(strings.TrimSpace(md), "\n")
+	first := strings.ToLower(strings.TrimSpace(lines[0]))
+	lastIsFence := len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "```"
+
+	switch {
+	case first == "```markdown" || first == "```md":
+		// Opening wrapper; the closing fence may be missing if the model was cut off.
+		lines = lines[1:]
+		if lastIsFence && countFences(lines)%2 == 1 {
+			lines = lines[:len(lines)-1]
+		}
+	case first == "```" && lastIsFence:
+		// Bare wrapper: only strip it if what's inside is balanced on its own.
+		if inner := lines[1 : len(lines)-1]; countFences(inner)%2 == 0 {
+			lines = inner
+		}
+	case lastIsFence && countFences(lines)%2 == 1:
+		// Stray closing fence with no opener.
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// countFences counts lines that open or close a fenced code block.
+func countFences(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			n++
+		}
+	}
+	return n
+}
+
+var (
+	// "1. Do the thing" -> "1) Do the thing"
+	dottedListItem = regexp.MustCompile(`^(\s*)(\d+)\.\s+(\S.*)$`)
+	// A list marker left alone on its line: "1)", "1." or "•"
+	bareListMarker = regexp.MustCompile(`^(\s*)(\d+[.)]|•|-|\*)\s*$`)
+)
+
+// normalizeGuideFormatting enforces the list style the prompts ask for:
+// numbered items use "N)" rather than "N.", and a marker the model left on its
+// own line is joined with the text that follows. Fenced code is not touched.
+func normalizeGuideFormatting(md string) string {
+	lines := strings.Split(md, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			out = append(out, line)
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+
+		if m := bareListMarker.FindStringSubmatch(line); m != nil {
+			// Pull up the next non-blank line, unless it starts a code block.
+			j := i + 1
+			for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+				j++
+			}
+			if j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j]), "```") {
+				line = m[1] + m[2] + " " + strings.TrimSpace(lines[j])
+				i = j
+			}
+		}
+		if m := dottedListItem.FindStringSubmatch(line); m != nil {
+			line = m[1] + m[2] + ") " + m[3]
+		}
+		out = append(out, line)
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// GuideSection is one "## " section of a generated guide.
+type GuideSection struct {
+	Slug    string `json:"slug"` // e.g. "how-to-fix"
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// GuideSectionSlugs lists the sections the guide prompt asks for, in order.
+var GuideSectionSlugs = []string{
+	"purpose-of-this-contribution",
+	"context",
+	"files-to-review",
+	"how-to-fix",
+	"how-to-test",
+	"example",
+	"notes",
+}
+
+// SplitGuideSections splits a guide on its level-2 headers. Text before the
+// first header is dropped, and headers inside fenced code are ignored.
+func SplitGuideSections(md string) []GuideSection {
+	var (
+		sections []GuideSection
+		body     []string
+		inFence  bool
+	)
+	flush := func() {
+		if len(sections) > 0 {
+			sections[len(sections)-1].Content = strings.TrimSpace(strings.Join(body, "\n"))
+		}
+		body = body[:0]
+	}
+
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(trimmed, "## ") {
+			flush()
+			title := strings.TrimSpace(strings.TrimPrefix(trimmed, "## "))
+			sections = append(sections, GuideSection{Slug: sectionSlug(title), Title: title})
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return sections
+}
+
+// FindGuideSection returns the section of md whose slug is slug.
+func FindGuideSection(md, slug string) (GuideSection, bool) {
+	for _, sec := range SplitGuideSections(md) {
+		if sec.Slug == slug {
+			return sec, true
+		}
+	}
+	return GuideSection{}, false
+}
+
+// sectionSlug turns a header like "How to Fix" into "how-to-fix".
+func sectionSlug(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-")
+}
+
+// validateGuideMarkdown checks a guide against the format rules of the guide
+// prompt and returns a description of every rule it breaks; nil means it
+// follows them all. Guides are normalized with normalizeGuideFormatting when
+// generated, so this mostly flags guides cached before a rule was enforced.
+func validateGuideMarkdown(md string) []string {
+	var violations []string
+	lines := strings.Split(strings.TrimSpace(md), "\n")
+
+	if first := strings.TrimSpace(lines[0]); strings.HasPrefix(first, "```") {
+		violations = append(violations, "guide is wrapped in a code fence")
+	}
+	if countFences(lines)%2 == 1 {
+		violations = append(violations, "unbalanced code fence")
+	}
+
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if dottedListItem.MatchString(line) {
+			violations = append(violations, fmt.Sprintf("line %d: numbered item uses \"N.\" instead of \"N)\"", i+1))
+		}
+		if bareListMarker.MatchString(line) {
+			violations = append(violations, fmt.Sprintf("line %d: list marker without its text on the same line", i+1))
+		}
+	}
+
+	// The prompt asks for exactly these sections, in this order
+	var slugs []string
+	for _, sec := range SplitGuideSections(md) {
+		slugs = append(slugs, sec.Slug)
+	}
+	if slices.Equal(slugs, GuideSectionSlugs) {
+		return violations
+	}
+	sectionsOK := true
+	for _, want := range GuideSectionSlugs {
+		if !slices.Contains(slugs, want) {
+			violations = append(violations, "missing section: "+want)
+			sectionsOK = false
+		}
+	}
+	for _, got := range slugs {
+		if !slices.Contains(GuideSectionSlugs, got) {
+			violations = append(violations, "unexpected section: "+got)
+			sectionsOK = false
+		}
+	}
+	if sectionsOK {
+		// Every section is there, so some are repeated or out of order
+		violations = append(violations, "sections are repeated or out of order")
+	}
+	return violations
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+func TestStripMarkdownFence(t *testing.T) {
+	const guide = "## Context\n\nUse `go test`.\n\n```go\nfunc main() {}\n```\n\n## Notes\nDone."
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"clean", guide, guide},
+		{"markdown wrapper", "```markdown\n" + guide + "\n```", guide},
+		{"md wrapper with padding", "\n  ```md\n" + guide + "\n```\n\n", guide},
+		{"uppercase language", "```Markdown\n" + guide + "\n```", guide},
+		{"bare wrapper", "```\n" + guide + "\n```", guide},
+		{"opening fence only (truncated)", "```markdown\n## Context\nCut off", "## Context\nCut off"},
+		{"stray closing fence", guide + "\n```", guide},
+		{"guide ending in a code block", "## Example\n```go\nx := 1\n```", "## Example\n```go\nx := 1\n```"},
+		{"bare fence around unbalanced content is kept", "```\nx := 1\n```go\n```", "```\nx := 1\n```go\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripMarkdownFence(tt.in); got != tt.want {
+				t.Errorf("stripMarkdownFence(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeGuideFormatting(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"already normalized", "1) Clone\n2) Build", "1) Clone\n2) Build"},
+		{"dotted markers", "1. Clone the repo\n2. Run make", "1) Clone the repo\n2) Run make"},
+		{"indented dotted marker", "  3. Nested step", "  3) Nested step"},
+		{"marker on its own line", "1)\nClone the repo", "1) Clone the repo"},
+		{"dotted marker on its own line", "2.\n\nRun make", "2) Run make"},
+		{"bullet on its own line", "-\nA note", "- A note"},
+		{"marker before a code block stays", "1)\n```sh\nmake\n```", "1)\n```sh\nmake\n```"},
+		{"fenced code untouched", "```\n1. not a list\n2.\nstill code\n```", "```\n1. not a list\n2.\nstill code\n```"},
+		{"version numbers untouched", "Requires Go 1.24 or later", "Requires Go 1.24 or later"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeGuideFormatting(tt.in); got != tt.want {
+				t.Errorf("normalizeGuideFormatting(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// documentedGuide uses every header the guide prompt asks for.
+const documentedGuide = `Intro the model added before the first header.
+
+## Purpose of This Contribution
+Fix the crash.
+
+## Context
+The parser panics on empty input.
+
+## Files to Review
+- [parser.go](o/r/parser.go)
+
+## How to Fix
+1) Return an error for empty input.
+
+` + "```go\n## not a header inside code\nif len(b) == 0 {\n```" + `
+
+## How to Test
+Run go test ./...
+
+## Example
+See the snippet above.
+
+## Notes
+None.`
+
+func TestSplitGuideSections(t *testing.T) {
+	sections := SplitGuideSections(documentedGuide)
+	if len(sections) != len(GuideSectionSlugs) {
+		t.Fatalf("got %d sections, want %d", len(sections), len(GuideSectionSlugs))
+	}
+	for i, sec := range sections {
+		if sec.Slug != GuideSectionSlugs[i] {
+			t.Errorf("section %d slug = %q, want %q", i, sec.Slug, GuideSectionSlugs[i])
+		}
+	}
+	if sections[0].Title != "Purpose of This Contribution" || sections[0].Content != "Fix the crash." {
+		t.Errorf("first section = %+v, want the purpose without the intro", sections[0])
+	}
+	want := "1) Return an error for empty input.\n\n```go\n## not a header inside code\nif len(b) == 0 {\n```"
+	if sections[3].Content != want {
+		t.Errorf("how-to-fix content = %q, want %q", sections[3].Content, want)
+	}
+}
+
+func TestFindGuideSection(t *testing.T) {
+	sec, ok := FindGuideSection(documentedGuide, "how-to-test")
+	if !ok || sec.Title != "How to Test" || sec.Content != "Run go test ./..." {
+		t.Errorf("FindGuideSection(how-to-test) = %+v, %v", sec, ok)
+	}
+	if _, ok := FindGuideSection(documentedGuide, "summary"); ok {
+		t.Error("found a section the guide does not have")
+	}
+	if _, ok := FindGuideSection("no headers at all", "context"); ok {
+		t.Error("found a section in a guide without headers")
+	}
+}
+
+func TestSectionSlug(t *testing.T) {
+	tests := map[string]string{
+		"How to Fix":                     "how-to-fix",
+		"Files to Review:":               "files-to-review",
+		"  Purpose of This Contribution": "purpose-of-this-contribution",
+		"Notes & Caveats":                "notes-caveats",
+	}
+	for title, want := range tests {
+		if got := sectionSlug(title); got != want {
+			t.Errorf("sectionSlug(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestInvalidGuides(t *testing.T) {
+	svc, guides, _ := newTestGuideService(t, &stubLLM{})
+	for id, answer := range map[string]string{
+		"o/r#1": documentedGuide,
+		"o/r#2": "```markdown\n" + documentedGuide + "\n```",
+		"o/r#3": strings.Replace(documentedGuide, "1) Return", "1. Return", 1),
+		"x/y#1": "Just do it.",
+	} {
+		guides.guides[id] = models.Guide{ID: id, Answer: answer}
+	}
+
+	invalid, err := svc.InvalidGuides(context.Background(), "")
+	if err != nil {
+		t.Fatalf("InvalidGuides: %v", err)
+	}
+	var ids []string
+	for _, g := range invalid {
+		ids = append(ids, g.ID)
+		if len(g.Violations) == 0 {
+			t.Errorf("%s is listed without violations", g.ID)
+		}
+	}
+	if strings.Join(ids, ",") != "o/r#2,o/r#3,x/y#1" {
+		t.Errorf("invalid guides = %v, want o/r#2, o/r#3 and x/y#1 in ID order", ids)
+	}
+	if len(invalid) > 1 && !strings.Contains(strings.Join(invalid[1].Violations, ";"), `"N."`) {
+		t.Errorf("o/r#3 violations = %q, want the dotted list item", invalid[1].Violations)
+	}
+
+	invalid, _ = svc.InvalidGuides(context.Background(), "o/r#")
+	if len(invalid) != 2 {
+		t.Errorf("prefix o/r#: %d invalid guides, want 2", len(invalid))
+	}
+	if invalid, _ := svc.InvalidGuides(context.Background(), "o/r#1"); len(invalid) != 0 {
+		t.Errorf("valid guide listed: %+v", invalid)
+	}
+}
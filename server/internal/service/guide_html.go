@@ -0,0 +1,27 @@
+package service
+
+import (
+	"bytes"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	// guideMarkdown renders guides as GitHub-flavoured markdown. Raw HTML in
+	// the markdown is dropped (goldmark's default), and guideHTMLPolicy cleans
+	// whatever the LLM smuggles through links and attributes.
+	guideMarkdown   = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	guideHTMLPolicy = bluemonday.UGCPolicy()
+)
+
+// RenderGuideHTML renders guide markdown as sanitized HTML, safe to embed in a
+// page or an email: scripts, event handlers and javascript: URLs are removed.
+func RenderGuideHTML(md string) (string, error) {
+	var buf bytes.Buffer
+	if err := guideMarkdown.Convert([]byte(md), &buf); err != nil {
+		return "", err
+	}
+	return guideHTMLPolicy.Sanitize(buf.String()), nil
+}
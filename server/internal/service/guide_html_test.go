@@ -0,0 +1,52 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderGuideHTML(t *testing.T) {
+	html, err := RenderGuideHTML("## How to Fix\n1) Check **empty** input in [parser.go](https://github.com/o/r/blob/main/parser.go).\n\n```go\nif len(b) == 0 {}\n```\n\n| a | b |\n|---|---|\n| 1 | 2 |")
+	if err != nil {
+		t.Fatalf("RenderGuideHTML: %v", err)
+	}
+	for _, want := range []string{
+		"<h2", "How to Fix</h2>",
+		"<strong>empty</strong>",
+		`<a href="https://github.com/o/r/blob/main/parser.go"`,
+		"<code", "if len(b) == 0 {}",
+		"<table>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML lacks %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestRenderGuideHTMLStripsScripts(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+	}{
+		{"script tag", "## Notes\n<script>alert(1)</script>\nDone."},
+		{"inline script", "Done <script>alert(1)</script> here."},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`},
+		{"javascript link", "[click](javascript:alert(1))"},
+		{"entity-encoded scheme", "[click](javascript&#58;alert(1))"},
+		{"iframe", `<iframe src="https://evil.example"></iframe>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := RenderGuideHTML(tt.md)
+			if err != nil {
+				t.Fatalf("RenderGuideHTML: %v", err)
+			}
+			lower := strings.ToLower(html)
+			for _, bad := range []string{"<script", "onerror", "javascript:", "<iframe"} {
+				if strings.Contains(lower, bad) {
+					t.Errorf("HTML keeps %q:\n%s", bad, html)
+				}
+			}
+		})
+	}
+}
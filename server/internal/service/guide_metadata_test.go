@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// meteredLLM is a stubLLM reporting model "test-model" and usage for every
+// generation.
+type meteredLLM struct {
+	*stubLLM
+	usage models.TokenUsage
+}
+
+func (l *meteredLLM) ModelName() string { return "test-model" }
+
+func (l *meteredLLM) GenerateMetered(ctx context.Context, prompt string) (LLMGeneration, error) {
+	text, err := l.GenerateResponse(ctx, prompt)
+	usage := l.usage
+	return LLMGeneration{Text: text, Model: l.ModelName(), Usage: &usage}, err
+}
+
+func TestGetGuideRecordsMetadata(t *testing.T) {
+	llm := &meteredLLM{stubLLM: &stubLLM{answer: "1. Read main.go"}, usage: models.TokenUsage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150}}
+	svc, guides, gh := newTestGuideService(t, llm)
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+	guide, err := svc.GetGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	version := DefaultPrompts().Current().Version
+	check := func(what string, g models.Guide) {
+		t.Helper()
+		if g.Model != "test-model" || g.PromptVersion != version || g.CreatedAt.IsZero() {
+			t.Errorf("%s: model %q, prompt version %q, created %v; want test-model, %s and a timestamp", what, g.Model, g.PromptVersion, g.CreatedAt, version)
+		}
+		if g.TokenUsage == nil || *g.TokenUsage != llm.usage {
+			t.Errorf("%s: token usage = %+v, want %+v", what, g.TokenUsage, llm.usage)
+		}
+	}
+	check("returned guide", guide)
+	check("stored guide", guides.guides["o/r#1"])
+
+	cached, err := svc.GetGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	check("cached guide", cached)
+}
+
+func TestRAGGuideRecordsMetadata(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("usage of both calls", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		llm := &meteredLLM{stubLLM: &stubLLM{answer: "1. Read a.go"}, usage: models.TokenUsage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120}}
+		guides := &fakeGuides{issue: models.Issue{Number: 12, Title: "Crash", Body: "It panics", State: "open"}}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"})
+		if err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		want := models.TokenUsage{PromptTokens: 200, CompletionTokens: 40, TotalTokens: 240}
+		if llm.calls() != 2 || resp.TokenUsage == nil || *resp.TokenUsage != want {
+			mt.Errorf("token usage = %+v after %d LLM calls, want %+v for both", resp.TokenUsage, llm.calls(), want)
+		}
+		if resp.Model != "test-model" || resp.PromptVersion != DefaultPrompts().Current().Version {
+			mt.Errorf("model %q, prompt version %q; want test-model and the active prompts", resp.Model, resp.PromptVersion)
+		}
+		if len(guides.upserted) != 1 {
+			mt.Fatalf("cached %d guides, want 1", len(guides.upserted))
+		}
+		stored := guides.upserted[0]
+		if stored.Model != resp.Model || stored.PromptVersion != resp.PromptVersion || stored.TokenUsage == nil || *stored.TokenUsage != want || stored.CreatedAt.IsZero() {
+			mt.Errorf("stored guide metadata = %q, %q, %+v, %v; want the response's", stored.Model, stored.PromptVersion, stored.TokenUsage, stored.CreatedAt)
+		}
+	})
+}
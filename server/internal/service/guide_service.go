@@ -2,22 +2,41 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/github"
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrRepoNotFound is returned when a guide is requested for a repository
+// that is not in the dataset. Handlers map it to 404 Not Found.
+var ErrRepoNotFound = errors.New("repository not found in dataset")
+
+// ErrGuideNotFound is returned when no guide has been generated for an issue
+// yet. Handlers map it to 404 Not Found.
+var ErrGuideNotFound = errors.New("no guide has been generated for this issue")
+
 // ---- Repository layer contracts -------------------------------------------
 
 // GuideRepository handles persistence of AI‑generated guides & chat history.
 type GuideRepository interface {
 	FindByIssueID(ctx context.Context, issueID string) (models.Guide, error)
 	Upsert(ctx context.Context, g models.Guide) error
+	Count(ctx context.Context, prefix string) (int64, error)
+	ListIDs(ctx context.Context, prefix string) ([]string, error)
+	EachAnswer(ctx context.Context, prefix string, fn func(id, answer string) error) error
+	FindByRepoAndDateRange(ctx context.Context, repoID string, from, to time.Time) ([]models.Guide, error)
+	DeleteByPrefix(ctx context.Context, prefix string) (int64, error)
+	FindSummaryByIssueID(ctx context.Context, issueID string) (models.IssueSummary, error)
+	UpsertSummary(ctx context.Context, sum models.IssueSummary) error
 }
 
 // ---- Repository contract ---------------------------------------------------
@@ -25,17 +44,80 @@ type GuideRepository interface {
 // RepoRepository lets us pull README / code snippets vectors for RAG.
 type RepoRepository interface {
 	FindByID(ctx context.Context, repoID string) (*models.Repo, error)
-	GetTopContextChunks(ctx context.Context, repoID string, k int) ([]models.CodeChunk, error)
+	FindByGitHubID(ctx context.Context, id int64) (*models.Repo, error)
+	GetTopContextChunks(ctx context.Context, repoID string, k, offset int) ([]models.CodeChunk, error)
+	GetTopContextChunksByType(ctx context.Context, repoID, chunkType string, k int) ([]models.CodeChunk, error)
 	CodeVectorSearch(ctx context.Context, repoID string, queryVec []float32, k int) ([]models.CodeChunk, error)
 	GetFileContent(ctx context.Context, repoID string, filePath string) (string, error)
+	ListFiles(ctx context.Context, repoID string) ([]string, error)
+	FindReposWithoutEmbeddings(ctx context.Context) ([]string, error)
+	GroupByLanguage(ctx context.Context, perBucket int) ([]models.LanguageBucket, error)
+	FindReadme(ctx context.Context, id string) (string, error)
+	SetReadme(ctx context.Context, id, readme string) error
 }
 
 // ---- Service implementation ------------------------------------------------
 
+// closedIssueAnswer is returned instead of a generated guide for closed issues.
+const closedIssueAnswer = "This issue has already been closed, so no contributor guide was generated. Check the issue thread on GitHub for how it was resolved, or pick an open issue to work on."
+
 // GuideService generates or retrieves an AI guide for a GitHub issue.
 type GuideService interface {
 	GetGuide(ctx context.Context, issueID string) (models.Guide, error)
+	RefreshGuide(ctx context.Context, issueID string) (models.Guide, error)
+	CachedGuide(ctx context.Context, issueID string) (models.Guide, error)
+	GetIssue(ctx context.Context, issueID string) (models.Issue, error)
+	InvalidateIssue(issueID string)
+	ValidateIssue(ctx context.Context, issueID string, checkGitHub bool) (IssueValidation, error)
 	Upsert(ctx context.Context, guide models.Guide) error
+	CacheStats(ctx context.Context) (CacheStats, error)
+	ListGuides(ctx context.Context, repoID string, from, to time.Time) ([]models.GuideSummary, error)
+	ClearCache(ctx context.Context, prefix string) (int64, error)
+	InvalidGuides(ctx context.Context, prefix string) ([]InvalidGuide, error)
+	ExportGuide(ctx context.Context, issueID string) (models.GuideExport, error)
+	SummarizeIssue(ctx context.Context, issueID string) (string, error)
+	StreamGuide(ctx context.Context, issueID string, progress func(GuideEvent)) (models.Guide, error)
+}
+
+// Stages reported by StreamGuide, in order. A cached guide goes straight to
+// GuideStageDone.
+const (
+	GuideStageFetchingIssue     = "fetching_issue"
+	GuideStageRetrievingContext = "retrieving_context"
+	GuideStageGenerating        = "generating"
+	GuideStageDone              = "done"
+)
+
+// GuideEvent is one progress update of a streamed guide generation. During
+// GuideStageGenerating, Text carries the next piece of the guide when the LLM
+// streams; the final GuideStageDone event carries the finished guide.
+type GuideEvent struct {
+	Stage string        `json:"stage"`
+	Text  string        `json:"text,omitempty"`
+	Guide *models.Guide `json:"guide,omitempty"`
+}
+
+// CacheStats describes the state of a cache for the admin API.
+type CacheStats struct {
+	Entries  int64   `json:"entries"`
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// InvalidGuide is a cached guide that breaks the guide format rules.
+type InvalidGuide struct {
+	ID         string   `json:"id"`
+	Violations []string `json:"violations"`
+}
+
+// IssueValidation is the result of ValidateIssue. IssueExists is nil when
+// GitHub was not asked or could not be reached.
+type IssueValidation struct {
+	Valid       bool   `json:"valid"`
+	RepoExists  bool   `json:"repo_exists"`
+	IssueExists *bool  `json:"issue_exists"`
+	Error       string `json:"error,omitempty"`
 }
 
 type guideService struct {
@@ -44,27 +126,116 @@ type guideService struct {
 	gh        *github.Client
 	embedder  EmbeddingClient // local model for generating embeddings
 	llm       LLMClient       // local LLM for generation
+
+	contextBudget int // max total characters of context chunks per guide; <= 0 is unbounded
+
+	// Context chunk ranking: score multipliers per chunk type, and how many
+	// README chunks every guide's context includes
+	chunkBoosts     map[string]float64
+	minReadmeChunks int
+
+	prompts       *PromptStore // issue guide prompt, read once per generation
+	emptyBodyNote string       // stands in for an empty issue body in prompts
+
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
+
+	prMu    sync.Mutex
+	prCache map[string]linkedPRs // issueID → linked PRs
+}
+
+// linkedPRsTTL is how long an issue's linked pull requests are cached.
+const linkedPRsTTL = 10 * time.Minute
+
+type linkedPRs struct {
+	prs       []models.PullRequestRef
+	fetchedAt time.Time
 }
 
-// NewGuideService wires dependencies.
+// NewGuideService wires dependencies. Context chunks are re-ranked with
+// chunkBoosts (score multipliers by chunk type) and at least minReadmeChunks
+// README chunks are included when the repository has them. Guides are
+// generated with the issue guide prompt of prompts; nil selects the built-in
+// prompts. emptyBodyNote describes issues without a body in prompts; ""
+// selects the built-in note.
 func NewGuideService(
 	guideRepo GuideRepository,
 	gh *github.Client,
 	repoRepo RepoRepository,
 	embedder EmbeddingClient,
 	llm LLMClient,
+	contextBudget int,
+	chunkBoosts map[string]float64,
+	minReadmeChunks int,
+	prompts *PromptStore,
+	emptyBodyNote string,
 ) GuideService {
+	if prompts == nil {
+		prompts = DefaultPrompts()
+	}
+	if emptyBodyNote == "" {
+		emptyBodyNote = defaultEmptyIssueBodyNote
+	}
 	return &guideService{
-		guideRepo: guideRepo,
-		repoRepo:  repoRepo,
-		gh:        gh,
-		embedder:  embedder,
-		llm:       llm,
+		guideRepo:       guideRepo,
+		repoRepo:        repoRepo,
+		gh:              gh,
+		embedder:        embedder,
+		llm:             llm,
+		contextBudget:   contextBudget,
+		chunkBoosts:     chunkBoosts,
+		minReadmeChunks: minReadmeChunks,
+		prompts:         prompts,
+		emptyBodyNote:   emptyBodyNote,
+		prCache:         make(map[string]linkedPRs),
 	}
 }
 
-// GetGuide returns a cached guide or generates a new one via RAG.
+// GetGuide returns a cached guide or generates a new one via RAG, with the
+// pull requests already linked to the issue attached.
 func (s *guideService) GetGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	guide, err := s.loadGuide(ctx, issueID, false, nil)
+	if err != nil {
+		return guide, err
+	}
+	guide.ExistingAttempts = s.existingAttempts(ctx, issueID)
+	return guide, nil
+}
+
+// RefreshGuide is GetGuide bypassing both caches: the issue is fetched from
+// GitHub again and the guide regenerated, replacing the cached one.
+func (s *guideService) RefreshGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	guide, err := s.loadGuide(ctx, issueID, true, nil)
+	if err != nil {
+		return guide, err
+	}
+	guide.ExistingAttempts = s.existingAttempts(ctx, issueID)
+	return guide, nil
+}
+
+// StreamGuide is GetGuide reporting its progress to progress as it goes,
+// ending with a GuideStageDone event holding the guide. When the LLM can
+// stream, the guide text is reported piece by piece while it is generated.
+func (s *guideService) StreamGuide(ctx context.Context, issueID string, progress func(GuideEvent)) (models.Guide, error) {
+	guide, err := s.loadGuide(ctx, issueID, false, progress)
+	if err != nil {
+		return guide, err
+	}
+	guide.ExistingAttempts = s.existingAttempts(ctx, issueID)
+	progress(GuideEvent{Stage: GuideStageDone, Guide: &guide})
+	return guide, nil
+}
+
+// loadGuide returns a cached guide or generates a new one via RAG, reporting
+// the stages it goes through to progress when it is non-nil. With refresh the
+// cached guide and issue are skipped.
+func (s *guideService) loadGuide(ctx context.Context, issueID string, refresh bool, progress func(GuideEvent)) (models.Guide, error) {
+	report := func(ev GuideEvent) {
+		if progress != nil {
+			progress(ev)
+		}
+	}
+
 	log.Printf("[Guide Service] Getting guide for issue: %s", issueID)
 
 	// Split the issue ID into repo and number parts
@@ -82,12 +253,18 @@ func (s *guideService) GetGuide(ctx context.Context, issueID string) (models.Gui
 	log.Printf("[Guide Service] Looking up guide with cache key: %s", cacheKey)
 
 	// 1. Check cache.
-	guide, err := s.guideRepo.FindByIssueID(ctx, cacheKey)
-	if err == nil && guide.ID != "" {
-		log.Printf("[Guide Service] Found cached guide for issue: %s", cacheKey)
-		return guide, nil
+	if refresh {
+		log.Printf("[Guide Service] Refreshing guide for issue: %s", cacheKey)
+	} else {
+		guide, err := s.guideRepo.FindByIssueID(ctx, cacheKey)
+		if err == nil && guide.ID != "" {
+			s.cacheHits.Add(1)
+			log.Printf("[Guide Service] Found cached guide for issue: %s", cacheKey)
+			return guide, nil
+		}
+		s.cacheMisses.Add(1)
+		log.Printf("[Guide Service] No cached guide found for issue: %s", cacheKey)
 	}
-	log.Printf("[Guide Service] No cached guide found for issue: %s", cacheKey)
 
 	// 2. Fetch issue info from GitHub.
 	repoParts := strings.Split(repoPart, "/")
@@ -103,6 +280,22 @@ func (s *guideService) GetGuide(ctx context.Context, issueID string) (models.Gui
 		return models.Guide{}, fmt.Errorf("invalid issue number: %w", err)
 	}
 
+	// Guides need the repo's indexed code; check it exists before any GitHub
+	// or LLM work. FindByID matches full_name, so pass owner/repo.
+	repoDoc, err := s.repoRepo.FindByID(ctx, repoPart)
+	if err != nil {
+		log.Printf("[Guide Service] Error finding repo document: %v", err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Guide{}, fmt.Errorf("%w: %s", ErrRepoNotFound, repoPart)
+		}
+		return models.Guide{}, err
+	}
+	log.Printf("[Guide Service] Found repo document: %s", repoDoc.ID)
+
+	report(GuideEvent{Stage: GuideStageFetchingIssue})
+	if refresh {
+		s.gh.InvalidateIssue(owner, repo, num)
+	}
 	log.Printf("[Guide Service] Fetching issue info from GitHub: owner=%s, repo=%s, number=%d", owner, repo, num)
 	issue, err := s.gh.GetIssue(owner, repo, num)
 	if err != nil {
@@ -111,43 +304,99 @@ func (s *guideService) GetGuide(ctx context.Context, issueID string) (models.Gui
 	}
 	log.Printf("[Guide Service] Successfully fetched issue from GitHub")
 
-	// 3. Retrieve top‑k context chunks (code, README) from Mongo vector index.
-	repoDoc, err := s.repoRepo.FindByID(ctx, repo)
-	if err != nil {
-		log.Printf("[Guide Service] Error finding repo document: %v", err)
-		return models.Guide{}, err
+	// Closed issues don't need a contributor guide; return a notice without
+	// caching it so a reopened issue still gets a full guide later.
+	if issue.State == "closed" {
+		log.Printf("[Guide Service] Issue %s is closed; skipping guide generation", issueID)
+		return models.Guide{
+			ID:        issueID,
+			Issue:     issue,
+			Answer:    closedIssueAnswer,
+			State:     issue.State,
+			CreatedAt: time.Now(),
+		}, nil
 	}
-	log.Printf("[Guide Service] Found repo document: %s", repoDoc.ID)
 
-	chunks, err := s.repoRepo.GetTopContextChunks(ctx, repoDoc.ID, 20)
+	// 3. Retrieve top‑k context chunks (code, README) from Mongo vector index.
+	report(GuideEvent{Stage: GuideStageRetrievingContext})
+	chunks, err := s.repoRepo.GetTopContextChunks(ctx, repoDoc.ID, 20, 0)
 	if err != nil {
 		log.Printf("[Guide Service] Error getting context chunks: %v", err)
 		return models.Guide{}, err
 	}
 	log.Printf("[Guide Service] Retrieved %d context chunks", len(chunks))
 
+	chunks = boostChunksByType(chunks, s.chunkBoosts)
+	if s.minReadmeChunks > 0 {
+		readme, err := s.repoRepo.GetTopContextChunksByType(ctx, repoDoc.ID, models.ChunkTypeReadme, s.minReadmeChunks)
+		if err != nil {
+			// README context is a nice-to-have; carry on without it
+			log.Printf("[Guide Service] Error getting README chunks: %v", err)
+		} else {
+			chunks = ensureChunkType(chunks, readme, models.ChunkTypeReadme, s.minReadmeChunks)
+		}
+	}
+
+	// Keep the chunks in the issue's language(s) when they can be inferred
+	if langs := issueLanguages(issue, repoDoc); len(langs) > 0 {
+		filtered := filterChunksByLanguage(chunks, langs)
+		log.Printf("[Guide Service] Kept %d of %d context chunks for languages %v", len(filtered), len(chunks), langs)
+		chunks = filtered
+	}
+
 	// Convert CodeChunks to strings for the LLM
 	chunkTexts := make([]string, len(chunks))
 	for i, chunk := range chunks {
 		chunkTexts[i] = chunk.Text
 	}
 
+	// Keep the prompt within the context budget
+	var trimmed, dropped int
+	chunkTexts, trimmed, dropped = fitContextBudget(chunkTexts, s.contextBudget)
+	if trimmed > 0 {
+		log.Printf("[Guide Service] Trimmed %d characters of context (%d chunks dropped) to fit budget of %d", trimmed, dropped, s.contextBudget)
+	}
+
 	// 4. Run local LLM with RAG prompt.
 	log.Printf("[Guide Service] Generating guide using LLM")
-	answer, err := s.llm.GenerateGuide(issue, chunkTexts)
+	report(GuideEvent{Stage: GuideStageGenerating})
+	// The prompt and the version recorded with the guide come from the same
+	// snapshot, so a reload between them cannot mislabel the guide
+	prompts := s.prompts.Current()
+	prompt := issueGuidePrompt(prompts.IssueGuide, issue, chunkTexts, s.emptyBodyNote)
+	var gen LLMGeneration
+	if streamer, ok := s.llm.(StreamingLLM); ok && progress != nil {
+		// Streamed generations don't report token usage
+		gen.Model = llmModelName(s.llm)
+		gen.Text, err = streamer.GenerateStream(ctx, prompt, func(text string) {
+			report(GuideEvent{Stage: GuideStageGenerating, Text: text})
+		})
+	} else if _, ok := s.llm.(MeteredLLM); ok {
+		gen, err = generateMetered(ctx, s.llm, prompt)
+	} else {
+		gen.Text, err = s.llm.GenerateResponse(ctx, prompt)
+	}
 	if err != nil {
 		log.Printf("[Guide Service] Error generating guide with LLM: %v", err)
 		return models.Guide{}, err
 	}
 	log.Printf("[Guide Service] Successfully generated guide with LLM")
+	answer := sanitizeMarkdown(normalizeGuideFormatting(stripMarkdownFence(gen.Text)))
 	log.Printf("[Guide Service] Generated guide length: %d", len(answer))
 
 	// 5. Persist guide.
-	guide = models.Guide{
-		ID:        issueID,
-		Answer:    answer,
-		Issue:     issue,
-		CreatedAt: time.Now(),
+	guide := models.Guide{
+		ID:            issueID,
+		Answer:        answer,
+		Issue:         issue,
+		State:         issue.State,
+		CreatedAt:     time.Now(),
+		LowConfidence: issueBodyIsEmpty(issue.Body),
+		Model:         gen.Model,
+		PromptVersion: prompts.Version,
+		TokenUsage:    gen.Usage,
+		Sources:       chunkSources(chunks, chunkTexts),
+		Prompt:        prompt,
 	}
 	log.Printf("[Guide Service] Attempting to persist guide to MongoDB")
 	log.Printf("[Guide Service] Guide ID: %s", guide.ID)
@@ -162,12 +411,305 @@ func (s *guideService) GetGuide(ctx context.Context, issueID string) (models.Gui
 	return guide, nil
 }
 
+// chunkSources records the context chunks sent to the LLM as guide sources.
+// texts holds the chunk texts as sent: fitContextBudget keeps them in order
+// but may drop chunks or cut one short.
+func chunkSources(chunks []models.CodeChunk, texts []string) []models.GuideSource {
+	sources := make([]models.GuideSource, 0, len(texts))
+	for _, chunk := range chunks {
+		if len(sources) == len(texts) {
+			break
+		}
+		text := texts[len(sources)]
+		if !strings.HasPrefix(chunk.Text, text) {
+			continue
+		}
+		sources = append(sources, models.GuideSource{
+			RepoID:    chunk.RepoID,
+			FilePath:  chunk.File,
+			Content:   text,
+			Relevance: chunk.Score,
+		})
+	}
+	return sources
+}
+
+// ExportGuide returns the stored guide for issueID with the sources and
+// prompt it was generated from, or ErrGuideNotFound. It never generates a
+// guide.
+func (s *guideService) ExportGuide(ctx context.Context, issueID string) (models.GuideExport, error) {
+	guide, err := s.guideRepo.FindByIssueID(ctx, issueID)
+	if err != nil {
+		return models.GuideExport{}, err
+	}
+	if guide.ID == "" {
+		return models.GuideExport{}, fmt.Errorf("%w: %s", ErrGuideNotFound, issueID)
+	}
+	sources := guide.Sources
+	if sources == nil {
+		sources = []models.GuideSource{}
+	}
+	return models.GuideExport{
+		Guide:      guide,
+		Sources:    sources,
+		Prompt:     guide.Prompt,
+		ExportedAt: time.Now(),
+	}, nil
+}
+
+// CachedGuide returns the stored guide for issueID without generating one on
+// a miss, so callers that must not reach the LLM can still reuse it.
+func (s *guideService) CachedGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	return s.guideRepo.FindByIssueID(ctx, issueID)
+}
+
+// existingAttempts returns the pull requests linked to issueID, from cache
+// when fresh. Lookup failures are logged and yield no attempts: the guide is
+// still useful without them.
+func (s *guideService) existingAttempts(ctx context.Context, issueID string) []models.PullRequestRef {
+	s.prMu.Lock()
+	cached, ok := s.prCache[issueID]
+	s.prMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < linkedPRsTTL {
+		return cached.prs
+	}
+
+	owner, repo, number, err := parseIssueID(issueID)
+	if err != nil {
+		return nil
+	}
+	prs, err := s.gh.ListIssueTimelineConnectedPRs(ctx, owner, repo, number)
+	if err != nil {
+		log.Printf("[Guide Service] Failed to fetch linked PRs for %s: %v", issueID, err)
+		return nil
+	}
+	log.Printf("[Guide Service] Found %d linked PRs for %s", len(prs), issueID)
+
+	s.prMu.Lock()
+	s.prCache[issueID] = linkedPRs{prs: prs, fetchedAt: time.Now()}
+	s.prMu.Unlock()
+	return prs
+}
+
+// minContextTail is the smallest partial chunk worth keeping when the budget
+// runs out part-way through a chunk.
+const minContextTail = 200
+
+// fitContextBudget keeps chunks, in rank order, until their combined length
+// reaches budget characters. The chunk that crosses the budget is truncated,
+// or dropped if less than minContextTail would remain. It returns the kept
+// chunks, the number of characters removed and the number of chunks dropped.
+func fitContextBudget(chunks []string, budget int) ([]string, int, int) {
+	if budget <= 0 {
+		return chunks, 0, 0
+	}
+
+	kept := make([]string, 0, len(chunks))
+	remaining, trimmed := budget, 0
+	for _, chunk := range chunks {
+		runes := []rune(chunk)
+		switch {
+		case len(runes) <= remaining:
+			kept = append(kept, chunk)
+			remaining -= len(runes)
+		case remaining >= minContextTail:
+			kept = append(kept, string(runes[:remaining]))
+			trimmed += len(runes) - remaining
+			remaining = 0
+		default:
+			trimmed += len(runes)
+		}
+	}
+	return kept, trimmed, len(chunks) - len(kept)
+}
+
+// GetIssue fetches the issue behind issueID ("owner/repo#number") from GitHub.
+func (s *guideService) GetIssue(ctx context.Context, issueID string) (models.Issue, error) {
+	owner, repo, number, err := parseIssueID(issueID)
+	if err != nil {
+		return models.Issue{}, err
+	}
+	return s.gh.GetIssue(owner, repo, number)
+}
+
+// InvalidateIssue makes the next GetIssue of issueID fetch it from GitHub
+// rather than the client's issue cache. Malformed IDs are ignored.
+func (s *guideService) InvalidateIssue(issueID string) {
+	if owner, repo, number, err := parseIssueID(issueID); err == nil {
+		s.gh.InvalidateIssue(owner, repo, number)
+	}
+}
+
 // Upsert inserts or replaces a guide in the repository.
 func (s *guideService) Upsert(ctx context.Context, guide models.Guide) error {
 	log.Printf("[Guide Service] Upserting guide for issue: %s", guide.ID)
 	return s.guideRepo.Upsert(ctx, guide)
 }
 
+// SummarizeIssue returns a cached 2–3 sentence TL;DR of an issue, asking the
+// LLM for one on a cache miss.
+func (s *guideService) SummarizeIssue(ctx context.Context, issueID string) (string, error) {
+	log.Printf("[Guide Service] Getting summary for issue: %s", issueID)
+
+	owner, repo, num, err := parseIssueID(issueID)
+	if err != nil {
+		return "", err
+	}
+
+	// 1. Check cache.
+	cached, err := s.guideRepo.FindSummaryByIssueID(ctx, issueID)
+	if err == nil && cached.ID != "" {
+		log.Printf("[Guide Service] Found cached summary for issue: %s", issueID)
+		return cached.Summary, nil
+	}
+
+	// 2. Fetch issue info from GitHub.
+	issue, err := s.gh.GetIssue(owner, repo, num)
+	if err != nil {
+		log.Printf("[Guide Service] Error fetching issue from GitHub: %v", err)
+		return "", err
+	}
+
+	// 3. Summarize.
+	prompt := fmt.Sprintf(`Summarize the following GitHub issue in 2-3 plain sentences for a developer deciding whether to work on it. State the problem, the expected behavior, and any constraints mentioned. Do not use headers, lists, or markdown formatting.
+
+Issue Title: %s
+Issue State: %s
+
+Issue Description:
+%s`, issue.Title, issue.State, formatIssueBody(issue.Body, s.emptyBodyNote))
+
+	summary, err := s.llm.GenerateResponse(ctx, prompt)
+	if err != nil {
+		log.Printf("[Guide Service] Error summarizing issue with LLM: %v", err)
+		return "", err
+	}
+	summary = strings.TrimSpace(summary)
+
+	// 4. Persist summary.
+	if err := s.guideRepo.UpsertSummary(ctx, models.IssueSummary{
+		ID:        issueID,
+		Summary:   summary,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		log.Printf("[Guide Service] Error persisting summary to MongoDB: %v", err)
+		return summary, err // summary still has value
+	}
+
+	return summary, nil
+}
+
+// parseIssueID splits an "owner/repo#number" issue ID into its parts.
+func parseIssueID(issueID string) (owner, repo string, number int, err error) {
+	ref, err := ParseIssueRef(issueID)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return ref.Owner, ref.Repo, ref.Number, nil
+}
+
+// ValidateIssue checks that issueID is well formed and its repository is in
+// the dataset and, with checkGitHub, that the issue exists on GitHub. It does
+// no LLM work, so clients can call it before requesting a guide.
+func (s *guideService) ValidateIssue(ctx context.Context, issueID string, checkGitHub bool) (IssueValidation, error) {
+	ref, err := ParseIssueRef(issueID)
+	if err != nil {
+		return IssueValidation{Error: err.Error()}, nil
+	}
+
+	var result IssueValidation
+	_, err = s.repoRepo.FindByID(ctx, ref.RepoID())
+	switch {
+	case err == nil:
+		result.RepoExists = true
+	case errors.Is(err, mongo.ErrNoDocuments):
+		result.Error = fmt.Sprintf("%v: %s", ErrRepoNotFound, ref.RepoID())
+		return result, nil
+	default:
+		return IssueValidation{}, err
+	}
+
+	if checkGitHub {
+		_, err := s.gh.GetIssue(ref.Owner, ref.Repo, ref.Number)
+		switch {
+		case err == nil:
+			exists := true
+			result.IssueExists = &exists
+		case errors.Is(err, github.ErrNotFound):
+			exists := false
+			result.IssueExists = &exists
+			result.Error = "issue not found on GitHub"
+			return result, nil
+		default:
+			// GitHub unreachable or rate-limited: leave IssueExists unknown
+			log.Printf("[Guide Service] Could not check issue %s on GitHub: %v", issueID, err)
+		}
+	}
+
+	result.Valid = true
+	return result, nil
+}
+
+// ListGuides returns summaries of the guides cached for repoID that were
+// created in [from, to); a zero bound is open.
+func (s *guideService) ListGuides(ctx context.Context, repoID string, from, to time.Time) ([]models.GuideSummary, error) {
+	guides, err := s.guideRepo.FindByRepoAndDateRange(ctx, repoID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list guides for %s: %w", repoID, err)
+	}
+	summaries := make([]models.GuideSummary, len(guides))
+	for i, g := range guides {
+		summaries[i] = models.GuideSummary{ID: g.ID, IssueTitle: g.Issue.Title, CreatedAt: g.CreatedAt}
+	}
+	return summaries, nil
+}
+
+// CacheStats reports how many guides are cached and the hit/miss counts
+// observed by GetGuide since startup.
+func (s *guideService) CacheStats(ctx context.Context) (CacheStats, error) {
+	entries, err := s.guideRepo.Count(ctx, "")
+	if err != nil {
+		return CacheStats{}, err
+	}
+	stats := CacheStats{
+		Entries: entries,
+		Hits:    s.cacheHits.Load(),
+		Misses:  s.cacheMisses.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats, nil
+}
+
+// ClearCache evicts cached guides whose ID starts with prefix (e.g. a repo
+// ID); an empty prefix clears every guide.
+func (s *guideService) ClearCache(ctx context.Context, prefix string) (int64, error) {
+	log.Printf("[Guide Service] Clearing guide cache with prefix: %q", prefix)
+	// Regenerated guides should see the issues as they are now
+	s.gh.InvalidateIssues(prefix)
+	return s.guideRepo.DeleteByPrefix(ctx, prefix)
+}
+
+// InvalidGuides checks every cached guide whose ID starts with prefix against
+// the guide format rules and returns the ones that break any, in ID order.
+func (s *guideService) InvalidGuides(ctx context.Context, prefix string) ([]InvalidGuide, error) {
+	invalid := []InvalidGuide{}
+	var checked int
+	err := s.guideRepo.EachAnswer(ctx, prefix, func(id, answer string) error {
+		checked++
+		if violations := validateGuideMarkdown(answer); len(violations) > 0 {
+			invalid = append(invalid, InvalidGuide{ID: id, Violations: violations})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan guides: %w", err)
+	}
+	log.Printf("[Guide Service] %d of %d cached guides break the format rules", len(invalid), checked)
+	return invalid, nil
+}
+
 // ---- Helpers & local interfaces -------------------------------------------
 
 // EmbeddingClient abstracts your local embedding model.
@@ -178,4 +720,45 @@ type EmbeddingClient interface {
 // LLMClient abstracts the local LLM you'll plug in.
 type LLMClient interface {
 	GenerateGuide(issue models.Issue, context []string) (string, error)
+	GenerateResponse(ctx context.Context, prompt string) (string, error)
+}
+
+// StreamingLLM is implemented by LLM clients that can return a response
+// incrementally (the Vertex LLM).
+type StreamingLLM interface {
+	GenerateStream(ctx context.Context, prompt string, onChunk func(string)) (string, error)
+}
+
+// LLMGeneration is a generated response with the model that produced it and
+// the tokens it took.
+type LLMGeneration struct {
+	Text  string
+	Model string             // "" when the client does not report it
+	Usage *models.TokenUsage // nil when the client does not report it
+}
+
+// MeteredLLM is implemented by LLM clients that report the model and token
+// usage of each generation (the Vertex and OpenAI LLMs).
+type MeteredLLM interface {
+	ModelName() string
+	GenerateMetered(ctx context.Context, prompt string) (LLMGeneration, error)
+}
+
+// generateMetered generates a response to prompt with llm, recording the model
+// and token usage when llm is a MeteredLLM.
+func generateMetered(ctx context.Context, llm LLM, prompt string) (LLMGeneration, error) {
+	if metered, ok := llm.(MeteredLLM); ok {
+		return metered.GenerateMetered(ctx, prompt)
+	}
+	text, err := llm.GenerateResponse(ctx, prompt)
+	return LLMGeneration{Text: text}, err
+}
+
+// llmModelName returns the model llm generates with, or "" when it does not
+// say.
+func llmModelName(llm LLM) string {
+	if metered, ok := llm.(MeteredLLM); ok {
+		return metered.ModelName()
+	}
+	return ""
 }
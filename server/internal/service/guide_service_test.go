@@ -0,0 +1,610 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/github"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memGuideRepo is a GuideRepository holding guides in memory.
+type memGuideRepo struct {
+	GuideRepository
+	mu        sync.Mutex
+	guides    map[string]models.Guide
+	summaries map[string]models.IssueSummary
+}
+
+func newMemGuideRepo() *memGuideRepo {
+	return &memGuideRepo{guides: make(map[string]models.Guide), summaries: make(map[string]models.IssueSummary)}
+}
+
+func (r *memGuideRepo) FindByIssueID(ctx context.Context, issueID string) (models.Guide, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.guides[issueID], nil // a miss is an empty guide, as in Mongo
+}
+
+func (r *memGuideRepo) Upsert(ctx context.Context, g models.Guide) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guides[g.ID] = g
+	return nil
+}
+
+func (r *memGuideRepo) ListIDs(ctx context.Context, prefix string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id := range r.guides {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memGuideRepo) EachAnswer(ctx context.Context, prefix string, fn func(id, answer string) error) error {
+	ids, _ := r.ListIDs(ctx, prefix)
+	sort.Strings(ids)
+	for _, id := range ids {
+		r.mu.Lock()
+		answer := r.guides[id].Answer
+		r.mu.Unlock()
+		if err := fn(id, answer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memGuideRepo) FindSummaryByIssueID(ctx context.Context, issueID string) (models.IssueSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.summaries[issueID], nil
+}
+
+func (r *memGuideRepo) UpsertSummary(ctx context.Context, sum models.IssueSummary) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summaries[sum.ID] = sum
+	return nil
+}
+
+// stubRepoRepo is a RepoRepository that knows the repos in repos, keyed by
+// full_name as in Mongo, and returns chunks as every repo's context. It
+// records the IDs it was asked to find.
+type stubRepoRepo struct {
+	RepoRepository
+	repos  map[string]*models.Repo
+	chunks []models.CodeChunk
+
+	mu      sync.Mutex
+	lookups []string
+}
+
+func (r *stubRepoRepo) FindByID(ctx context.Context, repoID string) (*models.Repo, error) {
+	r.mu.Lock()
+	r.lookups = append(r.lookups, repoID)
+	r.mu.Unlock()
+	if repo, ok := r.repos[repoID]; ok {
+		return repo, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *stubRepoRepo) GetTopContextChunks(ctx context.Context, repoID string, k, offset int) ([]models.CodeChunk, error) {
+	return r.chunks, nil
+}
+
+// GenerateGuide makes stubLLM an LLMClient, recording the guide prompt.
+func (l *stubLLM) GenerateGuide(issue models.Issue, snippets []string) (string, error) {
+	return l.GenerateResponse(context.Background(), issueGuidePrompt(issueGuidePromptFormat, issue, snippets, defaultEmptyIssueBodyNote))
+}
+
+// fakeGitHub serves the issues in issues (keyed "owner/repo/issues/n"), the
+// JSON in raw for other paths and an empty list for every other GET, counting
+// the requests for each.
+type fakeGitHub struct {
+	mu         sync.Mutex
+	issues     map[string]models.Issue
+	issueCalls int
+	raw        map[string]string
+	rawCalls   map[string]int
+}
+
+func (f *fakeGitHub) setIssue(path string, issue models.Issue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issues[path] = issue
+}
+
+func (f *fakeGitHub) setRaw(path, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.raw[path] = body
+}
+
+func (f *fakeGitHub) rawCallsTo(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rawCalls[path]
+}
+
+func (f *fakeGitHub) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issueCalls
+}
+
+// newFakeGitHub starts a fake GitHub API and returns it with a client for it.
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *github.Client) {
+	t.Helper()
+	f := &fakeGitHub{issues: make(map[string]models.Issue), raw: make(map[string]string), rawCalls: make(map[string]int)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/repos/")
+		f.mu.Lock()
+		issue, ok := f.issues[path]
+		if ok {
+			f.issueCalls++
+		}
+		raw, rawOK := f.raw[path]
+		if rawOK {
+			f.rawCalls[path]++
+		}
+		f.mu.Unlock()
+		switch {
+		case ok:
+			json.NewEncoder(w).Encode(issue)
+		case rawOK:
+			w.Write([]byte(raw))
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return f, github.NewClientWithBaseURL("", srv.URL)
+}
+
+// newTestGuideService returns a guide service for the repo o/r with one code
+// chunk of context.
+func newTestGuideService(t *testing.T, llm LLMClient) (*guideService, *memGuideRepo, *fakeGitHub) {
+	t.Helper()
+	gh, client := newFakeGitHub(t)
+	guides := newMemGuideRepo()
+	repos := &stubRepoRepo{
+		repos:  map[string]*models.Repo{"o/r": {ID: "o/r", FullName: "o/r"}},
+		chunks: []models.CodeChunk{{RepoID: "o/r", File: "main.go", Text: "package main"}},
+	}
+	svc := NewGuideService(guides, client, repos, &stubEmbedder{}, llm, 0, nil, 0, nil, "").(*guideService)
+	return svc, guides, gh
+}
+
+func TestGetGuideIssueState(t *testing.T) {
+	t.Run("open issue gets a generated guide", func(t *testing.T) {
+		llm := &stubLLM{answer: "1. Read main.go"}
+		svc, guides, gh := newTestGuideService(t, llm)
+		gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+		guide, err := svc.GetGuide(context.Background(), "o/r#1")
+		if err != nil {
+			t.Fatalf("GetGuide: %v", err)
+		}
+		if guide.State != "open" || guide.Answer == closedIssueAnswer {
+			t.Errorf("guide = %+v, want a generated guide for an open issue", guide)
+		}
+		if llm.calls() != 1 {
+			t.Errorf("LLM called %d times, want 1", llm.calls())
+		}
+		if _, ok := guides.guides["o/r#1"]; !ok {
+			t.Error("open issue guide was not cached")
+		}
+	})
+
+	t.Run("closed issue skips generation", func(t *testing.T) {
+		llm := &stubLLM{answer: "1. Read main.go"}
+		svc, guides, gh := newTestGuideService(t, llm)
+		gh.setIssue("o/r/issues/2", models.Issue{Number: 2, Title: "Done", State: "closed"})
+
+		guide, err := svc.GetGuide(context.Background(), "o/r#2")
+		if err != nil {
+			t.Fatalf("GetGuide: %v", err)
+		}
+		if guide.State != "closed" || guide.Answer != closedIssueAnswer {
+			t.Errorf("guide = %+v, want the closed-issue notice", guide)
+		}
+		if llm.calls() != 0 {
+			t.Errorf("LLM called %d times, want 0", llm.calls())
+		}
+		if _, ok := guides.guides["o/r#2"]; ok {
+			t.Error("closed-issue notice was cached; a reopened issue would never get a guide")
+		}
+	})
+}
+
+func TestSummarizeIssueIsCached(t *testing.T) {
+	llm := &stubLLM{answer: "  The parser crashes on empty input. It should return an error instead.  \n"}
+	svc, guides, gh := newTestGuideService(t, llm)
+	gh.setIssue("o/r/issues/7", models.Issue{Number: 7, Title: "Parser crash", Body: "Empty input panics", State: "open"})
+
+	for i := 0; i < 2; i++ {
+		summary, err := svc.SummarizeIssue(context.Background(), "o/r#7")
+		if err != nil {
+			t.Fatalf("SummarizeIssue #%d: %v", i+1, err)
+		}
+		if want := "The parser crashes on empty input. It should return an error instead."; summary != want {
+			t.Errorf("summary #%d = %q, want %q", i+1, summary, want)
+		}
+	}
+	if llm.calls() != 1 {
+		t.Errorf("LLM called %d times, want 1 (second summary from cache)", llm.calls())
+	}
+	if !strings.Contains(llm.prompts[0], "Parser crash") {
+		t.Errorf("prompt does not include the issue title:\n%s", llm.prompts[0])
+	}
+	if _, ok := guides.summaries["o/r#7"]; !ok {
+		t.Error("summary was not stored")
+	}
+	if gh.calls() != 1 {
+		t.Errorf("issue fetched %d times, want 1", gh.calls())
+	}
+}
+
+func TestSummarizeIssueRejectsBadID(t *testing.T) {
+	llm := &stubLLM{}
+	svc, _, _ := newTestGuideService(t, llm)
+	if _, err := svc.SummarizeIssue(context.Background(), "not-an-issue"); err == nil {
+		t.Error("SummarizeIssue accepted a malformed issue ID")
+	}
+	if llm.calls() != 0 {
+		t.Error("LLM called for a malformed issue ID")
+	}
+}
+
+func TestGetGuideStripsFenceBeforeCaching(t *testing.T) {
+	llm := &stubLLM{answer: "```markdown\n## Context\nRead main.go\n```"}
+	svc, guides, gh := newTestGuideService(t, llm)
+	gh.setIssue("o/r/issues/3", models.Issue{Number: 3, Title: "Bug", Body: "Broken", State: "open"})
+
+	if _, err := svc.GetGuide(context.Background(), "o/r#3"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	if got := guides.guides["o/r#3"].Answer; got != "## Context\nRead main.go" {
+		t.Errorf("cached answer = %q, want the guide without its fence", got)
+	}
+}
+
+func TestFitContextBudget(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	tests := []struct {
+		name        string
+		chunks      []string
+		budget      int
+		wantLens    []int
+		wantTrimmed int
+		wantDropped int
+	}{
+		{"unbounded", []string{long, long}, 0, []int{1000, 1000}, 0, 0},
+		{"fits", []string{"abc", "de"}, 10, []int{3, 2}, 0, 0},
+		{"truncates the crossing chunk", []string{long, long}, 1500, []int{1000, 500}, 500, 0},
+		{"drops a tail too short to keep", []string{long, long, long}, 1100, []int{1000}, 2000, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, trimmed, dropped := fitContextBudget(tt.chunks, tt.budget)
+			var lens []int
+			for _, c := range kept {
+				lens = append(lens, len(c))
+			}
+			if fmt.Sprint(lens) != fmt.Sprint(tt.wantLens) || trimmed != tt.wantTrimmed || dropped != tt.wantDropped {
+				t.Errorf("kept lengths %v, trimmed %d, dropped %d; want %v, %d, %d", lens, trimmed, dropped, tt.wantLens, tt.wantTrimmed, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestGetGuideTrimsContextToBudget(t *testing.T) {
+	gh, client := newFakeGitHub(t)
+	gh.setIssue("o/r/issues/4", models.Issue{Number: 4, Title: "Slow", Body: "Too slow", State: "open"})
+	var chunks []models.CodeChunk
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, models.CodeChunk{RepoID: "o/r", File: fmt.Sprintf("f%d.go", i), Text: strings.Repeat("ж", 1000)})
+	}
+	repos := &stubRepoRepo{repos: map[string]*models.Repo{"o/r": {ID: "o/r", FullName: "o/r"}}, chunks: chunks}
+	llm := &stubLLM{answer: "1. Profile it"}
+	svc := NewGuideService(newMemGuideRepo(), client, repos, &stubEmbedder{}, llm, 2500, nil, 0, nil, "")
+
+	if _, err := svc.GetGuide(context.Background(), "o/r#4"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	if llm.calls() != 1 {
+		t.Fatalf("LLM called %d times, want 1", llm.calls())
+	}
+	if n := strings.Count(llm.prompts[0], "ж"); n != 2500 {
+		t.Errorf("prompt carries %d characters of context, want the budget of 2500", n)
+	}
+}
+
+func TestGetGuideAttachesExistingAttempts(t *testing.T) {
+	svc, _, gh := newTestGuideService(t, &stubLLM{answer: "1. Read main.go"})
+	gh.setIssue("o/r/issues/5", models.Issue{Number: 5, Title: "Crash", Body: "It crashes", State: "open"})
+	gh.setRaw("o/r/issues/5/timeline", `[
+		{"event": "cross-referenced", "source": {"issue": {
+			"number": 12, "title": "Fix the crash", "state": "open",
+			"html_url": "https://github.com/o/r/pull/12",
+			"pull_request": {"html_url": "https://github.com/o/r/pull/12"},
+			"user": {"login": "alice"}}}}
+	]`)
+
+	for i := 0; i < 2; i++ {
+		guide, err := svc.GetGuide(context.Background(), "o/r#5")
+		if err != nil {
+			t.Fatalf("GetGuide #%d: %v", i+1, err)
+		}
+		if len(guide.ExistingAttempts) != 1 || guide.ExistingAttempts[0].Number != 12 || guide.ExistingAttempts[0].Author != "alice" {
+			t.Errorf("GetGuide #%d: existing attempts = %+v, want PR 12 by alice", i+1, guide.ExistingAttempts)
+		}
+	}
+	if n := gh.rawCallsTo("o/r/issues/5/timeline"); n != 1 {
+		t.Errorf("timeline fetched %d times, want 1 (second from cache)", n)
+	}
+}
+
+func TestGetGuideLooksUpRepoByFullName(t *testing.T) {
+	gh, client := newFakeGitHub(t)
+	gh.setIssue("octo/widgets/issues/3", models.Issue{Number: 3, Title: "Crash", State: "open"})
+	// The repo's name and full_name differ; only the full_name is a key
+	repos := &stubRepoRepo{
+		repos:  map[string]*models.Repo{"octo/widgets": {ID: "octo/widgets", Name: "widgets", FullName: "octo/widgets"}},
+		chunks: []models.CodeChunk{{RepoID: "octo/widgets", File: "main.go", Text: "package main"}},
+	}
+	svc := NewGuideService(newMemGuideRepo(), client, repos, &stubEmbedder{}, &stubLLM{answer: "1. Read main.go"}, 0, nil, 0, nil, "")
+
+	if _, err := svc.GetGuide(context.Background(), "octo/widgets#3"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	if len(repos.lookups) == 0 {
+		t.Fatal("repo was never looked up")
+	}
+	for _, id := range repos.lookups {
+		if id != "octo/widgets" {
+			t.Errorf("looked up %q, want the full name octo/widgets", id)
+		}
+	}
+}
+
+func TestGetGuideMissingRepoSkipsGitHubAndLLM(t *testing.T) {
+	llm := &stubLLM{answer: "1. Read main.go"}
+	svc, _, gh := newTestGuideService(t, llm)
+	gh.setIssue("o/missing/issues/1", models.Issue{Number: 1, Title: "Crash", State: "open"})
+
+	_, err := svc.GetGuide(context.Background(), "o/missing#1")
+	if !errors.Is(err, ErrRepoNotFound) {
+		t.Fatalf("err = %v, want ErrRepoNotFound", err)
+	}
+	if gh.calls() != 0 || llm.calls() != 0 {
+		t.Errorf("GitHub called %d times and the LLM %d times, want neither", gh.calls(), llm.calls())
+	}
+}
+
+func TestGetGuideEmptyIssueBody(t *testing.T) {
+	llm := &stubLLM{answer: "1. Read main.go"}
+	svc, guides, gh := newTestGuideService(t, llm)
+	gh.setIssue("o/r/issues/4", models.Issue{Number: 4, Title: "Add dark mode", State: "open"})
+
+	guide, err := svc.GetGuide(context.Background(), "o/r#4")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	if !guide.LowConfidence || !guides.guides["o/r#4"].LowConfidence {
+		t.Errorf("guide LowConfidence = %v (cached %v), want true for an empty body", guide.LowConfidence, guides.guides["o/r#4"].LowConfidence)
+	}
+	if llm.calls() != 1 || !strings.Contains(llm.prompts[0], defaultEmptyIssueBodyNote) {
+		t.Errorf("prompts = %q, want one carrying the default empty-body note", llm.prompts)
+	}
+
+	// A configured note replaces the default
+	llm = &stubLLM{answer: "1. Read main.go"}
+	custom := NewGuideService(newMemGuideRepo(), svc.gh, svc.repoRepo, &stubEmbedder{}, llm, 0, nil, 0, nil, "(no description)")
+	if _, err := custom.GetGuide(context.Background(), "o/r#4"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	if llm.calls() != 1 || !strings.Contains(llm.prompts[0], "(no description)") || strings.Contains(llm.prompts[0], defaultEmptyIssueBodyNote) {
+		t.Errorf("prompts = %q, want one carrying the configured note", llm.prompts)
+	}
+}
+
+func TestValidateIssue(t *testing.T) {
+	var ghPaths []string
+	gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		ghPaths = append(ghPaths, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/o/r/issues/1":
+			w.Write([]byte(`{"number": 1, "title": "Crash", "state": "open"}`))
+		case "/repos/o/r/issues/3":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	repos := &stubRepoRepo{repos: map[string]*models.Repo{"o/r": {ID: "o/r", FullName: "o/r"}}}
+	llm := &stubLLM{}
+	svc := NewGuideService(newMemGuideRepo(), gh, repos, &stubEmbedder{}, llm, 0, nil, 0, nil, "")
+
+	yes, no := true, false
+	tests := []struct {
+		name        string
+		issueID     string
+		checkGitHub bool
+		want        IssueValidation
+		wantGitHub  int
+	}{
+		{"valid", "o/r#1", true, IssueValidation{Valid: true, RepoExists: true, IssueExists: &yes}, 1},
+		{"valid without GitHub", "o/r#1", false, IssueValidation{Valid: true, RepoExists: true}, 0},
+		{"malformed", "o/r-1", true, IssueValidation{Error: "invalid issue ID: expected owner/repo#number"}, 0},
+		{"bad number", "o/r#0", true, IssueValidation{Error: "invalid issue ID: issue number must be a positive integer"}, 0},
+		{"repo not in dataset", "o/missing#1", true, IssueValidation{Error: "repository not found in dataset: o/missing"}, 0},
+		{"issue not on GitHub", "o/r#2", true, IssueValidation{RepoExists: true, IssueExists: &no, Error: "issue not found on GitHub"}, 1},
+		{"GitHub unreachable", "o/r#3", true, IssueValidation{Valid: true, RepoExists: true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghPaths = nil
+			got, err := svc.ValidateIssue(context.Background(), tt.issueID, tt.checkGitHub)
+			if err != nil {
+				t.Fatalf("ValidateIssue: %v", err)
+			}
+			if got.Valid != tt.want.Valid || got.RepoExists != tt.want.RepoExists || got.Error != tt.want.Error {
+				t.Errorf("ValidateIssue = %+v, want %+v", got, tt.want)
+			}
+			if (got.IssueExists == nil) != (tt.want.IssueExists == nil) ||
+				(got.IssueExists != nil && *got.IssueExists != *tt.want.IssueExists) {
+				t.Errorf("IssueExists = %v, want %v", got.IssueExists, tt.want.IssueExists)
+			}
+			if len(ghPaths) != tt.wantGitHub {
+				t.Errorf("GitHub requests = %q, want %d", ghPaths, tt.wantGitHub)
+			}
+		})
+	}
+	if llm.calls() != 0 {
+		t.Errorf("LLM called %d times during validation", llm.calls())
+	}
+}
+
+// streamingStubLLM streams its answer in the given pieces.
+type streamingStubLLM struct {
+	stubLLM
+	pieces []string
+}
+
+func (l *streamingStubLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(string)) (string, error) {
+	l.mu.Lock()
+	l.prompts = append(l.prompts, prompt)
+	l.mu.Unlock()
+	for _, p := range l.pieces {
+		onChunk(p)
+	}
+	return strings.Join(l.pieces, ""), nil
+}
+
+func TestStreamGuideReportsStages(t *testing.T) {
+	t.Run("generated", func(t *testing.T) {
+		llm := &streamingStubLLM{pieces: []string{"1) Read ", "main.go"}}
+		svc, _, gh := newTestGuideService(t, llm)
+		gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+		var events []GuideEvent
+		guide, err := svc.StreamGuide(context.Background(), "o/r#1", func(ev GuideEvent) {
+			events = append(events, ev)
+		})
+		if err != nil {
+			t.Fatalf("StreamGuide: %v", err)
+		}
+		want := []GuideEvent{
+			{Stage: GuideStageFetchingIssue},
+			{Stage: GuideStageRetrievingContext},
+			{Stage: GuideStageGenerating},
+			{Stage: GuideStageGenerating, Text: "1) Read "},
+			{Stage: GuideStageGenerating, Text: "main.go"},
+		}
+		if len(events) != len(want)+1 {
+			t.Fatalf("events = %+v, want %d progress events and done", events, len(want))
+		}
+		for i, ev := range want {
+			if events[i].Stage != ev.Stage || events[i].Text != ev.Text || events[i].Guide != nil {
+				t.Errorf("event %d = %+v, want %+v", i, events[i], ev)
+			}
+		}
+		done := events[len(events)-1]
+		if done.Stage != GuideStageDone || done.Guide == nil || done.Guide.Answer != "1) Read main.go" || guide.Answer != done.Guide.Answer {
+			t.Errorf("last event = %+v, want done carrying the streamed guide", done)
+		}
+		if llm.calls() != 1 {
+			t.Errorf("LLM streamed %d times, want 1", llm.calls())
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		llm := &streamingStubLLM{}
+		svc, guides, _ := newTestGuideService(t, llm)
+		guides.guides["o/r#1"] = models.Guide{ID: "o/r#1", Answer: "cached guide"}
+
+		var stages []string
+		if _, err := svc.StreamGuide(context.Background(), "o/r#1", func(ev GuideEvent) {
+			stages = append(stages, ev.Stage)
+		}); err != nil {
+			t.Fatalf("StreamGuide: %v", err)
+		}
+		if len(stages) != 1 || stages[0] != GuideStageDone {
+			t.Errorf("stages = %q, want only done for a cached guide", stages)
+		}
+		if llm.calls() != 0 {
+			t.Errorf("LLM called %d times for a cached guide", llm.calls())
+		}
+	})
+}
+
+func TestRefreshGuideBypassesCaches(t *testing.T) {
+	llm := &stubLLM{answer: "1. Read main.go"}
+	svc, guides, gh := newTestGuideService(t, llm)
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+	if _, err := svc.GetGuide(context.Background(), "o/r#1"); err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	// The issue is edited on GitHub after the guide was generated
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash on start", Body: "It crashes at boot", State: "open"})
+
+	guide, err := svc.GetGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	if guide.Issue.Title != "Crash" || llm.calls() != 1 || gh.calls() != 1 {
+		t.Fatalf("cached GetGuide: title %q, %d LLM calls, %d issue fetches; want the cached guide", guide.Issue.Title, llm.calls(), gh.calls())
+	}
+	if issue, _ := svc.GetIssue(context.Background(), "o/r#1"); issue.Title != "Crash" || gh.calls() != 1 {
+		t.Fatalf("GetIssue = %q after %d fetches, want the cached issue", issue.Title, gh.calls())
+	}
+
+	guide, err = svc.RefreshGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("RefreshGuide: %v", err)
+	}
+	if guide.Issue.Title != "Crash on start" || gh.calls() != 2 {
+		t.Errorf("refreshed guide has issue %q after %d fetches, want the edited issue refetched", guide.Issue.Title, gh.calls())
+	}
+	if llm.calls() != 2 || !strings.Contains(llm.prompts[1], "It crashes at boot") {
+		t.Errorf("LLM called %d times, want the guide regenerated from the edited issue", llm.calls())
+	}
+	if cached := guides.guides["o/r#1"]; cached.Issue.Title != "Crash on start" {
+		t.Errorf("cached guide has issue %q, want the refreshed guide stored", cached.Issue.Title)
+	}
+}
+
+func TestInvalidateIssue(t *testing.T) {
+	svc, _, gh := newTestGuideService(t, &stubLLM{})
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash"})
+
+	for i := 0; i < 2; i++ {
+		svc.GetIssue(context.Background(), "o/r#1")
+	}
+	svc.InvalidateIssue("not an issue id") // ignored
+	if gh.calls() != 1 {
+		t.Fatalf("fetched %d times, want the second GetIssue cached", gh.calls())
+	}
+	svc.InvalidateIssue("o/r#1")
+	svc.GetIssue(context.Background(), "o/r#1")
+	if gh.calls() != 2 {
+		t.Errorf("fetched %d times, want a refetch after InvalidateIssue", gh.calls())
+	}
+}
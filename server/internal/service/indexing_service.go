@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrMigrationRunning is returned when a migration is started while another
+// one is still in progress. Handlers map it to 409 Conflict.
+var ErrMigrationRunning = errors.New("an embedding migration is already running")
+
+// ErrInvalidMigration is returned when the target model is not one the
+// server is configured to embed with. Handlers map it to 400 Bad Request.
+var ErrInvalidMigration = errors.New("invalid embedding migration")
+
+// Migration batching; progress is saved after every batch.
+const (
+	migrationBatchSize = 100
+	maxMetadataBytes   = 32 * 1024 // matches MAX_METADATA_BYTES in scripts/embed.py
+)
+
+// MigrationProgress is the resumable state of one collection's migration to
+// a model. It is stored so an interrupted run continues after LastID.
+type MigrationProgress struct {
+	ID         string    `bson:"_id"         json:"id"` // "<collection>:<to model>"
+	Collection string    `bson:"collection"  json:"collection"`
+	FromModel  string    `bson:"from_model"  json:"from_model,omitempty"`
+	ToModel    string    `bson:"to_model"    json:"to_model"`
+	LastID     string    `bson:"last_id"     json:"last_id"`
+	Migrated   int64     `bson:"migrated"    json:"migrated"`
+	Failed     int64     `bson:"failed"      json:"failed"`
+	Done       bool      `bson:"done"        json:"done"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	UpdatedAt  time.Time `bson:"updated_at"  json:"updated_at"`
+}
+
+// embeddingTarget is a collection of stored embeddings and the embedder
+// (and model) that currently produces them.
+type embeddingTarget struct {
+	coll     *mongo.Collection
+	embedder Embedder
+	model    string
+	// sourceText returns the text that was embedded for doc.
+	sourceText func(ctx context.Context, doc bson.M) (string, error)
+}
+
+// IndexingService maintains the stored embeddings.
+type IndexingService struct {
+	progressColl *mongo.Collection
+	targets      []embeddingTarget
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewIndexingService wires the code chunk and repository embedding
+// collections with the embedders and model names that now produce them.
+// Repository embeddings are rebuilt from the full metadata in federatedMetaColl,
+// the same text scripts/embed.py embeds.
+func NewIndexingService(
+	codeColl *mongo.Collection, codeEmbedder Embedder, codeModel string,
+	metaColl, federatedMetaColl *mongo.Collection, metadataEmbedder Embedder, metadataModel string,
+	progressColl *mongo.Collection,
+) *IndexingService {
+	return &IndexingService{
+		progressColl: progressColl,
+		targets: []embeddingTarget{
+			{
+				coll:     codeColl,
+				embedder: codeEmbedder,
+				model:    codeModel,
+				sourceText: func(_ context.Context, doc bson.M) (string, error) {
+					text, _ := doc["text"].(string)
+					return text, nil
+				},
+			},
+			{
+				coll:     metaColl,
+				embedder: metadataEmbedder,
+				model:    metadataModel,
+				sourceText: func(ctx context.Context, doc bson.M) (string, error) {
+					var repo bson.D
+					err := federatedMetaColl.FindOne(ctx, bson.M{"full_name": doc["_id"]}).Decode(&repo)
+					if err != nil {
+						return "", fmt.Errorf("failed to load metadata for %v: %w", doc["_id"], err)
+					}
+					return stringifyRepo(repo), nil
+				},
+			},
+		},
+	}
+}
+
+// MigrateEmbeddings re-embeds every stored vector whose embedding_model is not
+// toModel, in each collection whose configured model is toModel. With a
+// non-empty fromModel only vectors tagged fromModel (or untagged ones, which
+// predate tagging) are migrated. Progress is saved after each batch, and a
+// later call with the same toModel resumes from the last processed ID.
+func (s *IndexingService) MigrateEmbeddings(ctx context.Context, fromModel, toModel string) error {
+	targets, err := s.begin(toModel)
+	if err != nil {
+		return err
+	}
+	defer s.end()
+	return s.migrate(ctx, targets, fromModel, toModel)
+}
+
+// StartMigration validates the request and runs MigrateEmbeddings in the
+// background, returning immediately. Follow it with MigrationStatus.
+func (s *IndexingService) StartMigration(fromModel, toModel string) error {
+	targets, err := s.begin(toModel)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer s.end()
+		if err := s.migrate(context.Background(), targets, fromModel, toModel); err != nil {
+			log.Printf("[Indexing] Migration to %s failed: %v", toModel, err)
+		}
+	}()
+	return nil
+}
+
+// begin claims the single migration slot and returns the targets for toModel.
+func (s *IndexingService) begin(toModel string) ([]embeddingTarget, error) {
+	var targets []embeddingTarget
+	for _, t := range s.targets {
+		if t.model == toModel {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: %q is not the configured embedding model of any collection", ErrInvalidMigration, toModel)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return nil, ErrMigrationRunning
+	}
+	s.running = true
+	return targets, nil
+}
+
+func (s *IndexingService) end() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+func (s *IndexingService) migrate(ctx context.Context, targets []embeddingTarget, fromModel, toModel string) error {
+	for _, t := range targets {
+		if err := s.migrateTarget(ctx, t, fromModel, toModel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Running reports whether a migration is in progress.
+func (s *IndexingService) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// MigrationStatus returns the saved progress of every migration.
+func (s *IndexingService) MigrationStatus(ctx context.Context) ([]MigrationProgress, error) {
+	cursor, err := s.progressColl.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migration progress: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	progress := []MigrationProgress{}
+	if err := cursor.All(ctx, &progress); err != nil {
+		return nil, fmt.Errorf("failed to decode migration progress: %w", err)
+	}
+	return progress, nil
+}
+
+func (s *IndexingService) migrateTarget(ctx context.Context, t embeddingTarget, fromModel, toModel string) error {
+	name := t.coll.Name()
+	progress := MigrationProgress{ID: name + ":" + toModel}
+	err := s.progressColl.FindOne(ctx, bson.M{"_id": progress.ID}).Decode(&progress)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to load migration progress: %w", err)
+	}
+	if progress.Done || progress.FromModel != fromModel {
+		// Finished runs and runs from another source model start over
+		progress = MigrationProgress{ID: progress.ID}
+	}
+	progress.Collection, progress.FromModel, progress.ToModel = name, fromModel, toModel
+	progress.Done, progress.Error = false, ""
+
+	filter := bson.M{"embedding_model": bson.M{"$ne": toModel}}
+	if fromModel != "" {
+		filter = bson.M{"$or": bson.A{
+			bson.M{"embedding_model": fromModel},
+			bson.M{"embedding_model": bson.M{"$exists": false}},
+		}}
+	}
+
+	log.Printf("[Indexing] Migrating %s embeddings to %s (resuming after %q)", name, toModel, progress.LastID)
+	for {
+		page := bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": progress.LastID}}}}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(migrationBatchSize).
+			SetProjection(bson.M{"embedding": 0})
+		cursor, err := t.coll.Find(ctx, page, opts)
+		if err != nil {
+			return s.failMigration(ctx, progress, fmt.Errorf("failed to read %s: %w", name, err))
+		}
+		var docs []bson.M
+		err = cursor.All(ctx, &docs)
+		cursor.Close(ctx)
+		if err != nil {
+			return s.failMigration(ctx, progress, fmt.Errorf("failed to decode %s: %w", name, err))
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		for _, doc := range docs {
+			id, _ := doc["_id"].(string)
+			if err := s.reembed(ctx, t, doc, toModel); err != nil {
+				if ctx.Err() != nil {
+					return s.failMigration(ctx, progress, ctx.Err())
+				}
+				log.Printf("[Indexing] Failed to re-embed %s %s: %v", name, id, err)
+				progress.Failed++
+			} else {
+				progress.Migrated++
+			}
+			progress.LastID = id
+		}
+
+		if err := s.saveProgress(ctx, progress); err != nil {
+			return err
+		}
+		log.Printf("[Indexing] %s: %d migrated, %d failed (last %q)", name, progress.Migrated, progress.Failed, progress.LastID)
+	}
+
+	progress.Done = true
+	if err := s.saveProgress(ctx, progress); err != nil {
+		return err
+	}
+	log.Printf("[Indexing] Finished migrating %s to %s: %d migrated, %d failed", name, toModel, progress.Migrated, progress.Failed)
+	return nil
+}
+
+// reembed embeds the source text of doc and stores the vector with its model.
+func (s *IndexingService) reembed(ctx context.Context, t embeddingTarget, doc bson.M, toModel string) error {
+	text, err := t.sourceText(ctx, doc)
+	if err != nil {
+		return err
+	}
+	vec, err := EmbedContext(ctx, t.embedder, text)
+	if err != nil {
+		return err
+	}
+	_, err = t.coll.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": bson.M{
+		"embedding":       vec,
+		"embedding_model": toModel,
+	}})
+	return err
+}
+
+func (s *IndexingService) saveProgress(ctx context.Context, p MigrationProgress) error {
+	p.UpdatedAt = time.Now()
+	_, err := s.progressColl.ReplaceOne(ctx, bson.M{"_id": p.ID}, p, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save migration progress: %w", err)
+	}
+	return nil
+}
+
+// failMigration records err on the progress document and returns it.
+func (s *IndexingService) failMigration(ctx context.Context, p MigrationProgress, err error) error {
+	p.Error = err.Error()
+	if saveErr := s.saveProgress(context.WithoutCancel(ctx), p); saveErr != nil {
+		log.Printf("[Indexing] %v", saveErr)
+	}
+	return err
+}
+
+// stringifyRepo flattens every primitive value of a repository document into
+// one space-separated string, truncated to maxMetadataBytes, mirroring
+// stringify_repo in scripts/embed.py.
+func stringifyRepo(repo bson.D) string {
+	var parts []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case nil:
+		case string:
+			parts = append(parts, val)
+		case bool, int32, int64, float64:
+			parts = append(parts, fmt.Sprint(val))
+		case bson.A:
+			for _, item := range val {
+				walk(item)
+			}
+		case bson.D:
+			for _, e := range val {
+				walk(e.Value)
+			}
+		case bson.M:
+			for _, item := range val {
+				walk(item)
+			}
+		}
+	}
+	for _, e := range repo {
+		if e.Key == "_id" {
+			continue
+		}
+		walk(e.Value)
+	}
+
+	text := strings.Join(parts, " ")
+	if len(text) > maxMetadataBytes {
+		text = strings.ToValidUTF8(text[:maxMetadataBytes], "")
+	}
+	return text
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newMockIndexing returns an IndexingService whose collections all talk to
+// mt. Only the code chunks embed with "code-v2", so a migration to it runs
+// against a single target and its commands arrive in a predictable order.
+func newMockIndexing(mt *mtest.T, embedder Embedder) *IndexingService {
+	return NewIndexingService(mt.Coll, embedder, "code-v2", mt.Coll, mt.Coll, embedder, "meta-v1", mt.Coll)
+}
+
+// collNS is the namespace of mt's collection, for cursor replies.
+func collNS(mt *mtest.T) string {
+	return mt.Coll.Database().Name() + "." + mt.Coll.Name()
+}
+
+func TestMigrateEmbeddings(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("fresh", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, collNS(mt), mtest.FirstBatch), // no saved progress
+			mtest.CreateCursorResponse(0, collNS(mt), mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "o/r/a.go::chunk_0"}, {Key: "text", Value: "func A() {}"}},
+				bson.D{{Key: "_id", Value: "o/r/b.go::chunk_0"}, {Key: "text", Value: "func B() {}"}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),     // save progress
+			mtest.CreateCursorResponse(0, collNS(mt), mtest.FirstBatch), // nothing left
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),     // save done
+		)
+		embedder := &stubEmbedder{}
+		svc := newMockIndexing(mt, embedder)
+
+		if err := svc.MigrateEmbeddings(context.Background(), "", "code-v2"); err != nil {
+			mt.Fatalf("MigrateEmbeddings: %v", err)
+		}
+		if len(embedder.texts) != 2 || embedder.texts[0] != "func A() {}" || embedder.texts[1] != "func B() {}" {
+			mt.Errorf("embedded %q, want both chunk texts", embedder.texts)
+		}
+
+		mt.GetStartedEvent() // progress lookup
+		find := mt.GetStartedEvent().Command
+		if got := find.Lookup("filter", "$and").Array().Index(0).Value().Document().Lookup("embedding_model", "$ne").StringValue(); got != "code-v2" {
+			mt.Errorf("find selects embedding_model != %q, want code-v2", got)
+		}
+		for i := 0; i < 2; i++ {
+			set := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			vec, _ := set.Lookup("embedding").Array().Values()
+			if set.Lookup("embedding_model").StringValue() != "code-v2" || len(vec) != 3 {
+				mt.Errorf("update %d sets %s, want the new vector tagged code-v2", i+1, set)
+			}
+		}
+		saved := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		if saved.Lookup("last_id").StringValue() != "o/r/b.go::chunk_0" || saved.Lookup("migrated").Int64() != 2 {
+			mt.Errorf("saved progress %s, want 2 migrated up to b.go", saved)
+		}
+		mt.GetStartedEvent() // empty page
+		done := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		if !done.Lookup("done").Boolean() {
+			mt.Errorf("final progress %s, want done", done)
+		}
+	})
+
+	mt.Run("resumes after the last processed ID", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, collNS(mt), mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: mt.Coll.Name() + ":code-v2"},
+				{Key: "last_id", Value: "o/r/b.go::chunk_0"},
+				{Key: "migrated", Value: int64(2)},
+			}),
+			mtest.CreateCursorResponse(0, collNS(mt), mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		embedder := &stubEmbedder{}
+		svc := newMockIndexing(mt, embedder)
+
+		if err := svc.MigrateEmbeddings(context.Background(), "", "code-v2"); err != nil {
+			mt.Fatalf("MigrateEmbeddings: %v", err)
+		}
+		mt.GetStartedEvent()
+		find := mt.GetStartedEvent().Command
+		if got := find.Lookup("filter", "$and").Array().Index(1).Value().Document().Lookup("_id", "$gt").StringValue(); got != "o/r/b.go::chunk_0" {
+			mt.Errorf("find resumes after %q, want o/r/b.go::chunk_0", got)
+		}
+		done := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		if done.Lookup("migrated").Int64() != 2 || !done.Lookup("done").Boolean() {
+			mt.Errorf("final progress %s, want the earlier 2 kept and done", done)
+		}
+		if len(embedder.texts) != 0 {
+			mt.Errorf("re-embedded %q on resume", embedder.texts)
+		}
+	})
+}
+
+func TestMigrateEmbeddingsRejects(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("unknown model", func(mt *mtest.T) {
+		svc := newMockIndexing(mt, &stubEmbedder{})
+		if err := svc.MigrateEmbeddings(context.Background(), "", "other-model"); !errors.Is(err, ErrInvalidMigration) {
+			mt.Errorf("err = %v, want ErrInvalidMigration", err)
+		}
+	})
+	mt.Run("already running", func(mt *mtest.T) {
+		svc := newMockIndexing(mt, &stubEmbedder{})
+		svc.running = true
+		if err := svc.StartMigration("", "code-v2"); !errors.Is(err, ErrMigrationRunning) {
+			mt.Errorf("err = %v, want ErrMigrationRunning", err)
+		}
+	})
+}
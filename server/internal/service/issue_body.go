@@ -0,0 +1,126 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlComment   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownTitle = regexp.MustCompile(`^#{1,6}\s+\S`)
+	extraNewlines = regexp.MustCompile(`\n{3,}`)
+)
+
+// defaultEmptyIssueBodyNote replaces the description of an issue whose body
+// is empty (or only an unfilled template) in LLM prompts, so the model leans
+// on the title and code context instead of inventing details. The guide and
+// RAG services take their own note, falling back to this one.
+const defaultEmptyIssueBodyNote = "(The issue has no description. Infer the task from the title and rely on the code context; " +
+	"state any assumptions you make, and do not invent requirements the title does not support.)"
+
+// issueCodeBlock is a fenced code block lifted out of an issue body.
+type issueCodeBlock struct {
+	Lang string
+	Code string
+}
+
+// prepareIssueBody cleans an issue body for use in a prompt: HTML comments
+// are removed, issue-template headings left with nothing under them are
+// dropped, and fenced code blocks are pulled out (replaced by a "[code block
+// N]" marker) so they can be given to the model as labelled context.
+func prepareIssueBody(body string) (string, []issueCodeBlock) {
+	body = htmlComment.ReplaceAllString(strings.ReplaceAll(body, "\r\n", "\n"), "")
+
+	var (
+		text   []string
+		blocks []issueCodeBlock
+		code   []string
+		lang   string
+		inCode bool
+	)
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inCode && strings.HasPrefix(trimmed, "```"):
+			inCode = true
+			lang = strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			code = code[:0]
+		case inCode && trimmed == "```":
+			inCode = false
+			blocks = append(blocks, issueCodeBlock{Lang: lang, Code: strings.Join(code, "\n")})
+			text = append(text, fmt.Sprintf("[code block %d]", len(blocks)))
+		case inCode:
+			code = append(code, line)
+		default:
+			text = append(text, line)
+		}
+	}
+	if inCode {
+		// Unterminated fence: keep what we saw as a block
+		blocks = append(blocks, issueCodeBlock{Lang: lang, Code: strings.Join(code, "\n")})
+		text = append(text, fmt.Sprintf("[code block %d]", len(blocks)))
+	}
+
+	cleaned := dropEmptySections(text)
+	return strings.TrimSpace(extraNewlines.ReplaceAllString(strings.Join(cleaned, "\n"), "\n\n")), blocks
+}
+
+// dropEmptySections removes markdown headings that have no content before the
+// next heading or the end of the body, e.g. an unfilled "### Steps to
+// reproduce" from an issue template.
+func dropEmptySections(lines []string) []string {
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if markdownTitle.MatchString(strings.TrimSpace(line)) && sectionIsEmpty(lines[i+1:]) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// sectionIsEmpty reports whether lines are blank up to the next heading.
+func sectionIsEmpty(lines []string) bool {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if markdownTitle.MatchString(trimmed) {
+			return true
+		}
+		if trimmed != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// issueBodyIsEmpty reports whether body has no content once prepared.
+func issueBodyIsEmpty(body string) bool {
+	text, blocks := prepareIssueBody(body)
+	return text == "" && len(blocks) == 0
+}
+
+// formatIssueBody returns the prepared issue body followed by its code blocks,
+// each labelled to match its marker in the text. An empty body is replaced by
+// emptyNote.
+func formatIssueBody(body, emptyNote string) string {
+	text, blocks := prepareIssueBody(body)
+	if text == "" && len(blocks) == 0 {
+		return emptyNote
+	}
+	if len(blocks) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	sb.WriteString(text)
+	sb.WriteString("\n\nCode from the issue:\n")
+	for i, b := range blocks {
+		label := fmt.Sprintf("Code block %d", i+1)
+		if b.Lang != "" {
+			label += " (" + b.Lang + ")"
+		}
+		sb.WriteString(fmt.Sprintf("\n%s:\n```%s\n%s\n```\n", label, b.Lang, b.Code))
+	}
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepareIssueBodyStripsTemplateNoise(t *testing.T) {
+	body := "<!-- Thanks for filing an issue!\nPlease fill in the sections below. -->\r\n" +
+		"### Describe the bug\r\n" +
+		"Login fails with a 500.\r\n" +
+		"\r\n" +
+		"### Steps to reproduce\r\n" +
+		"<!-- 1. Go to ... -->\r\n" +
+		"\r\n" +
+		"### Expected behavior\r\n" +
+		"A redirect to the dashboard.\r\n"
+
+	text, blocks := prepareIssueBody(body)
+	want := "### Describe the bug\nLogin fails with a 500.\n\n### Expected behavior\nA redirect to the dashboard."
+	if text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("got %d code blocks, want none", len(blocks))
+	}
+}
+
+func TestPrepareIssueBodyExtractsCodeBlocks(t *testing.T) {
+	body := "It panics:\n```go\nvar m map[string]int\nm[\"a\"] = 1\n```\nand logs:\n```\npanic: assignment to entry in nil map\n"
+
+	text, blocks := prepareIssueBody(body)
+	if text != "It panics:\n[code block 1]\nand logs:\n[code block 2]" {
+		t.Errorf("text = %q, want the blocks replaced by markers", text)
+	}
+	want := []issueCodeBlock{
+		{Lang: "go", Code: "var m map[string]int\nm[\"a\"] = 1"},
+		{Lang: "", Code: "panic: assignment to entry in nil map\n"}, // unterminated fence
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(want))
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("block %d = %+v, want %+v", i+1, blocks[i], want[i])
+		}
+	}
+
+	formatted := formatIssueBody(body, defaultEmptyIssueBodyNote)
+	if !strings.Contains(formatted, "Code block 1 (go):\n```go\nvar m map[string]int") || !strings.Contains(formatted, "Code block 2:\n```\npanic:") {
+		t.Errorf("formatted body lacks the labelled blocks:\n%s", formatted)
+	}
+}
+
+func TestFormatIssueBodyEmptyTemplate(t *testing.T) {
+	body := "<!-- describe the issue -->\n### Summary\n\n### Steps to reproduce\n"
+	if got := formatIssueBody(body, "(no description)"); got != "(no description)" {
+		t.Errorf("formatIssueBody = %q, want the empty-body note", got)
+	}
+}
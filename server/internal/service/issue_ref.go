@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidIssueID is returned for issue IDs that are not "owner/repo#number".
+var ErrInvalidIssueID = errors.New("invalid issue ID")
+
+// IssueRef identifies a GitHub issue.
+type IssueRef struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// ParseIssueRef parses an "owner/repo#number" issue ID.
+func ParseIssueRef(issueID string) (IssueRef, error) {
+	repoPart, numberPart, ok := strings.Cut(issueID, "#")
+	if !ok {
+		return IssueRef{}, fmt.Errorf("%w: expected owner/repo#number", ErrInvalidIssueID)
+	}
+	owner, repo, ok := strings.Cut(repoPart, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return IssueRef{}, fmt.Errorf("%w: invalid repo format", ErrInvalidIssueID)
+	}
+	number, err := strconv.Atoi(numberPart)
+	if err != nil || number <= 0 {
+		return IssueRef{}, fmt.Errorf("%w: issue number must be a positive integer", ErrInvalidIssueID)
+	}
+	return IssueRef{Owner: owner, Repo: repo, Number: number}, nil
+}
+
+// RepoID returns the "owner/repo" full name.
+func (r IssueRef) RepoID() string {
+	return r.Owner + "/" + r.Repo
+}
+
+// String returns the issue ID in "owner/repo#number" form.
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
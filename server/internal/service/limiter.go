@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// slotLimiter bounds how many calls hold a slot at once. It is the shared
+// core of EmbedLimiter and LLMLimiter, which differ only in what they wrap
+// and the error a caller gets when no slot frees up.
+type slotLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+	errBusy      error
+}
+
+// newSlotLimiter allows maxConcurrent slots at a time. Callers beyond that
+// wait up to queueTimeout for a slot before failing with errBusy; a zero
+// queueTimeout fails fast.
+func newSlotLimiter(maxConcurrent int, queueTimeout time.Duration, errBusy error) slotLimiter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	return slotLimiter{
+		slots:        make(chan struct{}, maxConcurrent),
+		queueTimeout: queueTimeout,
+		errBusy:      errBusy,
+	}
+}
+
+func (l *slotLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return l.errBusy
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return l.errBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *slotLimiter) release() {
+	<-l.slots
+}
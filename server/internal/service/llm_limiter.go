@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// ErrLLMBusy is returned when no LLM slot frees up within the limiter's queue
+// timeout. Handlers map it to 503 Service Unavailable.
+var ErrLLMBusy = errors.New("LLM is busy, try again later")
+
+// LLMLimiter bounds how many LLM generations run at once across every caller
+// sharing the wrapped client (RAG answers, guides, chat), so a traffic spike
+// can't exhaust the model quota.
+type LLMLimiter struct {
+	slotLimiter
+}
+
+// NewLLMLimiter allows maxConcurrent generations at a time. Callers beyond
+// that wait up to queueTimeout for a slot before failing with ErrLLMBusy; a
+// zero queueTimeout fails fast.
+func NewLLMLimiter(maxConcurrent int, queueTimeout time.Duration) *LLMLimiter {
+	return &LLMLimiter{newSlotLimiter(maxConcurrent, queueTimeout, ErrLLMBusy)}
+}
+
+// Wrap returns llm guarded by l; every generation acquires a slot first.
+func (l *LLMLimiter) Wrap(llm LLMClient) *LimitedLLM {
+	return &LimitedLLM{inner: llm, limiter: l}
+}
+
+// LimitedLLM is an LLMClient guarded by an LLMLimiter.
+type LimitedLLM struct {
+	inner   LLMClient
+	limiter *LLMLimiter
+}
+
+// GenerateResponse generates once a slot is available.
+func (m *LimitedLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	if err := m.limiter.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer m.limiter.release()
+	return m.inner.GenerateResponse(ctx, prompt)
+}
+
+// GenerateMetered generates once a slot is available, reporting the model and
+// token usage when the wrapped client does.
+func (m *LimitedLLM) GenerateMetered(ctx context.Context, prompt string) (LLMGeneration, error) {
+	if err := m.limiter.acquire(ctx); err != nil {
+		return LLMGeneration{}, err
+	}
+	defer m.limiter.release()
+	return generateMetered(ctx, m.inner, prompt)
+}
+
+// ModelName returns the wrapped client's model, or "" when it does not say.
+func (m *LimitedLLM) ModelName() string {
+	return llmModelName(m.inner)
+}
+
+// GenerateGuide generates once a slot is available.
+func (m *LimitedLLM) GenerateGuide(issue models.Issue, snippets []string) (string, error) {
+	if err := m.limiter.acquire(context.Background()); err != nil {
+		return "", err
+	}
+	defer m.limiter.release()
+	return m.inner.GenerateGuide(issue, snippets)
+}
+
+// GenerateStream streams once a slot is available, holding it until the
+// stream ends. A wrapped client that can't stream answers in one piece.
+func (m *LimitedLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(string)) (string, error) {
+	if err := m.limiter.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer m.limiter.release()
+
+	if streamer, ok := m.inner.(StreamingLLM); ok {
+		return streamer.GenerateStream(ctx, prompt, onChunk)
+	}
+	text, err := m.inner.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	onChunk(text)
+	return text, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// gaugeLLM records the most generations it ever ran at once, using a
+// gaugeEmbedder's counters and hold.
+type gaugeLLM struct {
+	gauge gaugeEmbedder
+}
+
+func (l *gaugeLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	l.gauge.Embed(prompt)
+	return "answer", nil
+}
+
+func (l *gaugeLLM) GenerateGuide(issue models.Issue, snippets []string) (string, error) {
+	l.gauge.Embed(issue.Title)
+	return "guide", nil
+}
+
+func TestLLMLimiterCapsConcurrency(t *testing.T) {
+	const limit = 3
+	inner := &gaugeLLM{gauge: gaugeEmbedder{hold: 20 * time.Millisecond}}
+	llm := NewLLMLimiter(limit, time.Minute).Wrap(inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			switch i % 4 {
+			case 0:
+				_, err = llm.GenerateResponse(context.Background(), "q")
+			case 1:
+				_, err = llm.GenerateMetered(context.Background(), "q")
+			case 2:
+				_, err = llm.GenerateGuide(models.Issue{Title: "t"}, nil)
+			default:
+				_, err = llm.GenerateStream(context.Background(), "q", func(string) {})
+			}
+			if err != nil {
+				t.Errorf("generate: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak := inner.gauge.peak.Load(); peak > limit {
+		t.Errorf("%d generations ran at once, want at most %d", peak, limit)
+	} else if peak < limit {
+		t.Errorf("at most %d generations ran at once; the limiter should allow %d", peak, limit)
+	}
+}
+
+func TestLLMLimiterRejectsWhenSaturated(t *testing.T) {
+	inner := &gaugeLLM{gauge: gaugeEmbedder{release: make(chan struct{})}}
+	llm := NewLLMLimiter(1, 20*time.Millisecond).Wrap(inner)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		llm.GenerateResponse(context.Background(), "holds the only slot")
+	}()
+	for inner.gauge.running.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := llm.GenerateResponse(context.Background(), "rejected"); !errors.Is(err, ErrLLMBusy) {
+		t.Errorf("err = %v, want ErrLLMBusy", err)
+	}
+	close(inner.gauge.release)
+	<-done
+
+	if _, err := llm.GenerateResponse(context.Background(), "slot is free again"); err != nil {
+		t.Errorf("generate after release: %v", err)
+	}
+}
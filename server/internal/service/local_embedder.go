@@ -2,75 +2,205 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Defaults for the local embedding models.
+const (
+	defaultMetadataModel = "all-mpnet-base-v2"
+	defaultCodeModel     = "intfloat/multilingual-e5-large"
+
+	metadataEmbeddingDim = 768  // all-mpnet-base-v2
+	codeEmbeddingDim     = 1024 // intfloat/multilingual-e5-large
 )
 
 // LocalEmbedder uses local models to generate embeddings
 type LocalEmbedder struct {
-	modelType string // "metadata" or "code"
-}
+	modelType string      // "metadata" or "code"
+	modelName string      // sentence-transformers model to load
+	pythonBin string      // Python executable; empty means auto-detect
+	dimension int         // expected length of every embedding
+	minLength int         // trimmed texts shorter than this are rejected with ErrTextTooShort
+	pool      *workerPool // shared warm workers; nil spawns a process per call
 
-// NewLocalEmbedder creates a new embedder using local models
-func NewLocalEmbedder(modelType string) (*LocalEmbedder, error) {
-	if modelType != "metadata" && modelType != "code" {
-		return nil, fmt.Errorf("invalid model type: %s", modelType)
-	}
-	return &LocalEmbedder{modelType: modelType}, nil
+	timeout time.Duration // hard limit per embedding; 0 waits as long as the caller does
 }
 
-// Embed generates an embedding vector for a single input text
-func (l *LocalEmbedder) Embed(text string) ([]float32, error) {
-	// Log the input
-	log.Printf("Generating embedding for text (first 100 chars): %s...", text[:min(100, len(text))])
-	log.Printf("Using model type: %s", l.modelType)
+// ErrTextTooShort is returned for input that is empty, whitespace or shorter
+// than the embedder's minimum length once trimmed; an embedding of it would
+// be meaningless. Handlers map it to 400 Bad Request.
+var ErrTextTooShort = errors.New("text is too short to embed")
+
+// ErrEmbedTimeout is returned when a local embedding runs past the embedder's
+// timeout and its Python process is killed. Handlers map it to 504 Gateway
+// Timeout.
+var ErrEmbedTimeout = errors.New("embedding timed out")
 
-	// Properly escape the text for Python
-	escapedText := strings.ReplaceAll(text, "'", "\\'")
-	escapedText = strings.ReplaceAll(escapedText, "\n", "\\n")
-	escapedText = strings.ReplaceAll(escapedText, "\r", "\\r")
+// DefaultLocalEmbedTimeout bounds a local embedding when no timeout is
+// configured. It is generous because the first call may download the model.
+const DefaultLocalEmbedTimeout = 5 * time.Minute
 
-	// Prepare Python script
-	pythonScript := fmt.Sprintf(`
-import sys
+// embedWaitDelay is how long a killed embedding process gets to release its
+// output before the embedding gives up on it.
+const embedWaitDelay = time.Second
+
+// embedScript embeds the JSON string read from stdin with the
+// sentence-transformers model named by its first argument and prints the
+// vector as comma-separated values. User text only ever reaches Python as
+// data, so it cannot change what the script runs.
+const embedScript = `
+import sys, json
 from sentence_transformers import SentenceTransformer
 
-model_name = 'all-mpnet-base-v2' if '%s' == 'metadata' else 'intfloat/multilingual-e5-large'
+model_name = sys.argv[1]
+text = json.loads(sys.stdin.read())
 print(f"DEBUG: Using model: {model_name}", file=sys.stderr)
 model = SentenceTransformer(model_name)
 print(f"DEBUG: Model loaded successfully", file=sys.stderr)
-embedding = model.encode('%s', normalize_embeddings=True)
+embedding = model.encode(text, normalize_embeddings=True)
 print(f"DEBUG: Generated embedding of length: {len(embedding.tolist())}", file=sys.stderr)
 print(','.join(map(str, embedding.tolist())))
-`, l.modelType, escapedText)
+`
 
-	// Log the command we're about to run
-	log.Printf("Executing Python script with model type: %s", l.modelType)
+// NewLocalEmbedder creates a new embedder using local models.
+// pythonBin may be empty to auto-detect the interpreter, modelName may be empty
+// to use the default model for modelType, and dimension may be 0 to use the
+// default model's dimension. minLength is the shortest trimmed text that will
+// be embedded; values below 1 are treated as 1 so blank input is always
+// rejected. With poolSize > 0 embeddings run on at most poolSize persistent
+// Python workers per model, shared with every other LocalEmbedder of the same
+// interpreter and model; 0 starts a fresh process for every call.
+func NewLocalEmbedder(modelType, pythonBin, modelName string, dimension, minLength, poolSize int) (*LocalEmbedder, error) {
+	var defaultModel string
+	var defaultDim int
+	switch modelType {
+	case "metadata":
+		defaultModel, defaultDim = defaultMetadataModel, metadataEmbeddingDim
+	case "code":
+		defaultModel, defaultDim = defaultCodeModel, codeEmbeddingDim
+	default:
+		return nil, fmt.Errorf("invalid model type: %s", modelType)
+	}
+	if modelName == "" {
+		modelName = defaultModel
+	}
+	if dimension <= 0 {
+		dimension = defaultDim
+	}
+	if minLength < 1 {
+		minLength = 1
+	}
+	l := &LocalEmbedder{
+		modelType: modelType,
+		modelName: modelName,
+		pythonBin: pythonBin,
+		dimension: dimension,
+		minLength: minLength,
+		timeout:   DefaultLocalEmbedTimeout,
+	}
+	if poolSize > 0 {
+		l.pool = acquireWorkerPool(l.python(), modelName, poolSize)
+	}
+	return l, nil
+}
 
-	// Get Python path from environment or use appropriate default
-	pythonPath := os.Getenv("PYTHON_PATH")
-	if pythonPath == "" {
-		// Check if we're in a Docker container
-		if _, err := os.Stat("/app/venv/bin/python"); err == nil {
-			pythonPath = "/app/venv/bin/python"
-		} else {
-			// Use system Python in development
-			pythonPath = "python3"
+// SetTimeout sets how long one embedding may take, including waiting for a
+// pooled worker, before its Python process is killed and ErrEmbedTimeout is
+// returned; 0 removes the limit. Call it before the embedder is shared.
+func (l *LocalEmbedder) SetTimeout(d time.Duration) {
+	l.timeout = d
+}
+
+// Embed generates an embedding vector for a single input text
+func (l *LocalEmbedder) Embed(text string) ([]float32, error) {
+	return l.EmbedWithContext(context.Background(), text)
+}
+
+// EmbedWithContext is Embed bound to ctx: when ctx is canceled the Python
+// process doing the work is killed and ctx's error is returned, so abandoned
+// requests don't leave interpreters running. The embedder's timeout kills it
+// the same way, returning ErrEmbedTimeout.
+func (l *LocalEmbedder) EmbedWithContext(ctx context.Context, text string) ([]float32, error) {
+	text = strings.TrimSpace(sanitizeUTF8(text))
+	if utf8.RuneCountInString(text) < l.minLength {
+		return nil, ErrTextTooShort
+	}
+
+	if l.timeout <= 0 {
+		return l.embed(ctx, text)
+	}
+	embedCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	result, err := l.embed(embedCtx, text)
+	if err != nil && ctx.Err() == nil && errors.Is(embedCtx.Err(), context.DeadlineExceeded) {
+		log.Printf("Embedding timed out after %s, Python process killed (model: %s)", l.timeout, l.modelName)
+		return nil, fmt.Errorf("%w after %s", ErrEmbedTimeout, l.timeout)
+	}
+	return result, err
+}
+
+// embed generates the embedding of the already validated text, stopping when
+// ctx is done.
+func (l *LocalEmbedder) embed(ctx context.Context, text string) ([]float32, error) {
+
+	// Log the input
+	log.Printf("Generating embedding for text (first 100 chars): %s...", text[:min(100, len(text))])
+	log.Printf("Using model type: %s (model: %s)", l.modelType, l.modelName)
+
+	if l.pool != nil {
+		result, err := l.pool.embed(ctx, text)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate embedding: %w", err)
+		}
+		if err := checkEmbedding(result); err != nil {
+			return nil, err
+		}
+		if len(result) != l.dimension {
+			return nil, fmt.Errorf("embedding has dimension %d, expected %d", len(result), l.dimension)
 		}
+		return result, nil
 	}
 
-	// Call Python script to generate embedding
-	cmd := exec.Command(pythonPath, "-c", pythonScript)
+	// The text goes to the script as JSON on stdin, never into its source
+	input, err := json.Marshal(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text for embedding: %w", err)
+	}
+
+	// Log the command we're about to run
+	log.Printf("Executing Python script with model type: %s", l.modelType)
+
+	pythonPath := l.python()
+
+	// Call Python script to generate embedding; the process is killed if ctx
+	// is canceled
+	cmd := exec.CommandContext(ctx, pythonPath, "-c", embedScript, l.modelName)
+	cmd.Stdin = bytes.NewReader(input)
+	// Don't wait on output pipes held open by children of a killed process
+	cmd.WaitDelay = embedWaitDelay
 
 	// Capture both stdout and stderr
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		log.Printf("Embedding canceled, Python process killed: %v", ctx.Err())
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		log.Printf("Python script error: %v", err)
 		log.Printf("Python stderr: %s", stderr.String())
@@ -81,25 +211,120 @@ print(','.join(map(str, embedding.tolist())))
 	log.Printf("Python stdout: %s", stdout.String())
 	log.Printf("Python stderr: %s", stderr.String())
 
-	// Parse the comma-separated output into float32 slice
-	values := strings.Split(strings.TrimSpace(stdout.String()), ",")
+	result, err := parseEmbeddingOutput(stdout.String(), stderr.String(), l.dimension)
+	if err != nil {
+		var parseErr *EmbedParseError
+		if errors.As(err, &parseErr) {
+			log.Printf("Error parsing embedding output: %v\nraw output:\n%s", parseErr.Err, parseErr.Raw)
+		} else {
+			log.Printf("Invalid embedding output: %v", err)
+		}
+		return nil, err
+	}
+
+	log.Printf("Successfully generated embedding of length: %d", len(result))
+	return result, nil
+}
+
+// python returns the configured interpreter, falling back to the Docker venv
+// when present and to the system python3 otherwise.
+func (l *LocalEmbedder) python() string {
+	if l.pythonBin != "" {
+		return l.pythonBin
+	}
+	// Check if we're in a Docker container
+	if _, err := os.Stat("/app/venv/bin/python"); err == nil {
+		return "/app/venv/bin/python"
+	}
+	// Use system Python in development
+	return "python3"
+}
+
+// maxEmbedParseRaw bounds the Python output kept in an EmbedParseError.
+const maxEmbedParseRaw = 2000
+
+// EmbedParseError reports embedding script output that is not a vector. Raw
+// holds what Python wrote to stdout and stderr (truncated), so operators can
+// see what went wrong.
+type EmbedParseError struct {
+	Raw string
+	Err error
+}
+
+func (e *EmbedParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EmbedParseError) Unwrap() error {
+	return e.Err
+}
+
+// newEmbedParseError wraps err with the script's output.
+func newEmbedParseError(stdout, stderr string, err error) *EmbedParseError {
+	raw := "stdout: " + strings.TrimSpace(stdout) + "\nstderr: " + strings.TrimSpace(stderr)
+	if len(raw) > maxEmbedParseRaw {
+		raw = strings.ToValidUTF8(raw[:maxEmbedParseRaw], "") + "... (truncated)"
+	}
+	return &EmbedParseError{Raw: raw, Err: err}
+}
+
+// parseEmbeddingOutput converts the comma-separated stdout of the embedding
+// script into a vector of exactly dim values. Empty or malformed output is
+// reported together with any non-debug lines Python wrote to stderr, so a
+// Python-side failure is not mistaken for a (garbage) embedding. Output that
+// cannot be parsed yields an *EmbedParseError.
+func parseEmbeddingOutput(stdout, stderr string, dim int) ([]float32, error) {
+	out := strings.TrimSpace(stdout)
+	if out == "" {
+		if msg := pythonErrorOutput(stderr); msg != "" {
+			return nil, newEmbedParseError(stdout, stderr, fmt.Errorf("%w: no output: python reported: %s", ErrInvalidEmbedding, msg))
+		}
+		return nil, newEmbedParseError(stdout, stderr, fmt.Errorf("%w: no output", ErrInvalidEmbedding))
+	}
+
+	values := strings.Split(out, ",")
 	result := make([]float32, len(values))
 	for i, v := range values {
 		var f float32
-		_, err := fmt.Sscanf(v, "%f", &f)
-		if err != nil {
-			log.Printf("Failed to parse value '%s': %v", v, err)
-			return nil, fmt.Errorf("failed to parse embedding value: %w", err)
+		if _, err := fmt.Sscanf(strings.TrimSpace(v), "%f", &f); err != nil {
+			if msg := pythonErrorOutput(stderr); msg != "" {
+				return nil, newEmbedParseError(stdout, stderr, fmt.Errorf("failed to parse embedding value %q: %w (python reported: %s)", v, err, msg))
+			}
+			return nil, newEmbedParseError(stdout, stderr, fmt.Errorf("failed to parse embedding value %q: %w", v, err))
 		}
 		result[i] = f
 	}
 
-	log.Printf("Successfully generated embedding of length: %d", len(result))
+	if err := checkEmbedding(result); err != nil {
+		return nil, err
+	}
+	if dim > 0 && len(result) != dim {
+		return nil, fmt.Errorf("embedding has dimension %d, expected %d", len(result), dim)
+	}
 	return result, nil
 }
 
-// Close is a no-op for local embedder
+// pythonErrorOutput returns the stderr lines that are not the script's own
+// DEBUG logging, i.e. warnings and tracebacks emitted by Python.
+func pythonErrorOutput(stderr string) string {
+	var lines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "DEBUG:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "; ")
+}
+
+// Close releases the embedder's share of its worker pool; the workers stop
+// once every embedder using them is closed.
 func (l *LocalEmbedder) Close() error {
+	if l.pool != nil {
+		releaseWorkerPool(l.pool)
+		l.pool = nil
+	}
 	return nil
 }
 
@@ -0,0 +1,669 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParseEmbeddingOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		stdout      string
+		stderr      string
+		dim         int
+		want        []float32
+		wantErr     string
+		wantInvalid bool // error must wrap ErrInvalidEmbedding
+	}{
+		{
+			name:   "valid vector",
+			stdout: "0.1, 0.2,0.3\n",
+			dim:    3,
+			want:   []float32{0.1, 0.2, 0.3},
+		},
+		{
+			name:   "debug stderr is ignored",
+			stdout: "0.5,0.5",
+			stderr: "DEBUG: Using model: x\nDEBUG: Model loaded successfully",
+			dim:    2,
+			want:   []float32{0.5, 0.5},
+		},
+		{
+			name:        "empty output",
+			stdout:      "   \n",
+			wantErr:     "no output",
+			wantInvalid: true,
+		},
+		{
+			name:        "empty output with a python error",
+			stdout:      "",
+			stderr:      "DEBUG: Using model: x\nTraceback (most recent call last):\nModuleNotFoundError: No module named 'sentence_transformers'",
+			wantErr:     "python reported: Traceback (most recent call last):; ModuleNotFoundError",
+			wantInvalid: true,
+		},
+		{
+			name:    "error message on stdout",
+			stdout:  "Error: CUDA out of memory",
+			wantErr: "failed to parse embedding value",
+		},
+		{
+			name:    "malformed value names the python error",
+			stdout:  "0.1,abc",
+			stderr:  "RuntimeError: boom",
+			wantErr: "python reported: RuntimeError: boom",
+		},
+		{
+			name:        "single element",
+			stdout:      "0.1",
+			wantErr:     "length 1",
+			wantInvalid: true,
+		},
+		{
+			name:    "wrong dimension",
+			stdout:  "0.1,0.2,0.3",
+			dim:     4,
+			wantErr: "dimension 3, expected 4",
+		},
+		{
+			name:   "dimension unchecked when zero",
+			stdout: "0.1,0.2,0.3",
+			want:   []float32{0.1, 0.2, 0.3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEmbeddingOutput(tt.stdout, tt.stderr, tt.dim)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				if tt.wantInvalid && !errors.Is(err, ErrInvalidEmbedding) {
+					t.Errorf("error %v does not wrap ErrInvalidEmbedding", err)
+				}
+				if got != nil {
+					t.Errorf("got vector %v alongside an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPythonErrorOutput(t *testing.T) {
+	stderr := "DEBUG: loading\n\n  Warning: slow  \nDEBUG: done\nValueError: bad"
+	if got, want := pythonErrorOutput(stderr), "Warning: slow; ValueError: bad"; got != want {
+		t.Errorf("pythonErrorOutput = %q, want %q", got, want)
+	}
+	if got := pythonErrorOutput("DEBUG: only debug\n"); got != "" {
+		t.Errorf("pythonErrorOutput of debug lines = %q, want empty", got)
+	}
+}
+
+// writeScript writes an executable shell script to dir and returns its path.
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// fakePython writes an interpreter stand-in that records its model argument
+// and stdin in dir and prints a fixed 3-dimensional embedding.
+func fakePython(t *testing.T, dir string) string {
+	t.Helper()
+	return writeScript(t, dir, "fake-python", `
+printf '%s' "$1" > "`+dir+`/flag"
+printf '%s' "$3" > "`+dir+`/model"
+cat > "`+dir+`/stdin"
+echo "0.1,0.2,0.3"
+`)
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestLocalEmbedderUsesConfiguredBinaryAndModel(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLocalEmbedder("metadata", fakePython(t, dir), "custom/model", 3, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec, err := l.Embed("hello world")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != 3 {
+		t.Fatalf("got %d values, want 3", len(vec))
+	}
+	if got := readFile(t, filepath.Join(dir, "flag")); got != "-c" {
+		t.Errorf("interpreter flag = %q, want -c", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "model")); got != "custom/model" {
+		t.Errorf("model argument = %q, want custom/model", got)
+	}
+}
+
+func TestLocalEmbedderDefaults(t *testing.T) {
+	tests := []struct {
+		modelType string
+		wantModel string
+		wantDim   int
+	}{
+		{"metadata", defaultMetadataModel, metadataEmbeddingDim},
+		{"code", defaultCodeModel, codeEmbeddingDim},
+	}
+	for _, tt := range tests {
+		l, err := NewLocalEmbedder(tt.modelType, "", "", 0, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.modelName != tt.wantModel || l.dimension != tt.wantDim || l.minLength != 1 {
+			t.Errorf("%s embedder = model %q dim %d minLength %d, want %q %d 1",
+				tt.modelType, l.modelName, l.dimension, l.minLength, tt.wantModel, tt.wantDim)
+		}
+		if l.timeout != DefaultLocalEmbedTimeout {
+			t.Errorf("%s embedder timeout = %s, want the bounded default %s", tt.modelType, l.timeout, DefaultLocalEmbedTimeout)
+		}
+	}
+	if _, err := NewLocalEmbedder("images", "", "", 0, 0, 0); err == nil {
+		t.Error("NewLocalEmbedder accepted an unknown model type")
+	}
+}
+
+// hostileTexts would break out of a Python string literal if they were
+// interpolated into the script.
+var hostileTexts = []string{
+	`ends with a backslash \`,
+	`quote \' then code'); import os; os.system('touch pwned') #`,
+	"multi\nline\r\ntext with \"double\" and 'single' quotes",
+	`""" triple quotes ''' and \x00 escapes A`,
+}
+
+func TestLocalEmbedderPassesTextAsData(t *testing.T) {
+	for _, text := range hostileTexts {
+		dir := t.TempDir()
+		l, err := NewLocalEmbedder("metadata", fakePython(t, dir), "m", 3, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Embed(text); err != nil {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+		var got string
+		if err := json.Unmarshal([]byte(readFile(t, filepath.Join(dir, "stdin"))), &got); err != nil {
+			t.Fatalf("stdin is not a JSON string: %v", err)
+		}
+		if got != strings.TrimSpace(text) {
+			t.Errorf("script received %q, want %q", got, strings.TrimSpace(text))
+		}
+	}
+	if strings.Contains(embedScript, "%s") || strings.Contains(embedScript, "%q") {
+		t.Error("embedScript has format verbs; text must not be interpolated into it")
+	}
+}
+
+// stubSentenceTransformers writes a sentence_transformers module whose
+// "embedding" of a text is [len(text), 1.0] and returns its directory, for use
+// on PYTHONPATH with a real interpreter.
+func stubSentenceTransformers(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not available")
+	}
+	dir := t.TempDir()
+	stub := `
+class _Vec(list):
+    def tolist(self):
+        return list(self)
+
+class SentenceTransformer:
+    def __init__(self, name):
+        self.name = name
+
+    def encode(self, text, normalize_embeddings=True):
+        return _Vec([float(len(text)), 1.0])
+`
+	if err := os.WriteFile(filepath.Join(dir, "sentence_transformers.py"), []byte(stub), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestEmbedScriptKeepsHostileTextInert(t *testing.T) {
+	t.Setenv("PYTHONPATH", stubSentenceTransformers(t))
+	work := t.TempDir()
+	t.Chdir(work)
+
+	for _, text := range hostileTexts {
+		l, err := NewLocalEmbedder("metadata", "python3", "stub-model", 2, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vec, err := l.Embed(text)
+		if err != nil {
+			t.Fatalf("Embed(%q): %v", text, err)
+		}
+		if want := float32(len([]rune(strings.TrimSpace(text)))); vec[0] != want {
+			t.Errorf("Embed(%q) saw %v characters, want %v", text, vec[0], want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(work, "pwned")); err == nil {
+		t.Fatal("text was executed as Python")
+	}
+}
+
+func TestLocalEmbedderRejectsShortText(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLocalEmbedder("metadata", fakePython(t, dir), "m", 3, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"", " \t\n ", "ab", "  abc  ", "日本語"} {
+		if _, err := l.Embed(text); !errors.Is(err, ErrTextTooShort) {
+			t.Errorf("Embed(%q) error = %v, want ErrTextTooShort", text, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stdin")); !os.IsNotExist(err) {
+		t.Error("Python was run for too-short text")
+	}
+
+	// Length is counted in characters after trimming
+	if _, err := l.Embed("  日本語だ  "); err != nil {
+		t.Errorf("Embed of a 4-character text: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "stdin")); got != `"日本語だ"` {
+		t.Errorf("script received %s, want the trimmed text", got)
+	}
+}
+
+func TestLocalEmbedderDefaultRejectsOnlyBlankText(t *testing.T) {
+	l, err := NewLocalEmbedder("metadata", fakePython(t, t.TempDir()), "m", 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Embed("   "); !errors.Is(err, ErrTextTooShort) {
+		t.Errorf("Embed of whitespace: error = %v, want ErrTextTooShort", err)
+	}
+	if _, err := l.Embed("x"); err != nil {
+		t.Errorf("Embed of one character: %v", err)
+	}
+}
+
+// fakeWorkerPython writes an interpreter stand-in speaking the worker
+// protocol: it records each start in dir/starts, then answers every request
+// line with a 3-dimensional embedding after a short delay.
+func fakeWorkerPython(t *testing.T, dir string) string {
+	t.Helper()
+	return writeScript(t, dir, "fake-worker", `
+echo $$ >> "`+dir+`/starts"
+echo '{"ready": true}'
+while read -r line; do
+	sleep 0.02
+	echo '{"embedding": [0.1, 0.2, 0.3]}'
+done
+`)
+}
+
+func TestWorkerPoolIsSharedAndBounded(t *testing.T) {
+	dir := t.TempDir()
+	python := fakeWorkerPython(t, dir)
+	const poolSize = 2
+	code, err := NewLocalEmbedder("code", python, "shared/model", 3, 1, poolSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := NewLocalEmbedder("metadata", python, "shared/model", 3, 1, poolSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.pool != meta.pool {
+		t.Fatal("embedders for the same interpreter and model got separate pools")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 12)
+	for i := 0; i < 12; i++ {
+		e := code
+		if i%2 == 1 {
+			e = meta
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := e.Embed("concurrent text"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Embed: %v", err)
+	}
+
+	starts := strings.Fields(readFile(t, filepath.Join(dir, "starts")))
+	if len(starts) == 0 || len(starts) > poolSize {
+		t.Errorf("started %d workers for 12 embeds, want 1 to %d reused workers", len(starts), poolSize)
+	}
+
+	code.Close()
+	pythonPools.mu.Lock()
+	_, live := pythonPools.pools[python+"\x00shared/model"]
+	pythonPools.mu.Unlock()
+	if !live {
+		t.Error("pool closed while the metadata embedder still uses it")
+	}
+	meta.Close()
+	pythonPools.mu.Lock()
+	_, live = pythonPools.pools[python+"\x00shared/model"]
+	pythonPools.mu.Unlock()
+	if live {
+		t.Error("pool outlived its last embedder")
+	}
+}
+
+func TestReleasingPoolKillsBusyWorker(t *testing.T) {
+	// The worker records its pid, signals when it has a request, then takes
+	// a moment to answer
+	dir := t.TempDir()
+	python := writeScript(t, dir, "slow-python", `echo $$ > "`+dir+`/pid.tmp" && mv "`+dir+`/pid.tmp" "`+dir+`/pid"
+echo '{"ready": true}'
+while read -r line; do
+  touch "`+dir+`/busy"
+  sleep 0.3
+  echo '{"embedding": [0.1, 0.2, 0.3]}'
+done
+`)
+	l, err := NewLocalEmbedder("code", python, "m", 3, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Embed("hello world")
+		done <- err
+	}()
+	pid := waitForPID(t, dir)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, err := os.Stat(filepath.Join(dir, "busy")); err != nil; _, err = os.Stat(filepath.Join(dir, "busy")) {
+		if time.Now().After(deadline) {
+			t.Fatal("worker never received the request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Releasing the last embedder mid-embedding lets the call finish, then
+	// stops the worker instead of parking it in the closed pool
+	l.Close()
+	if err := <-done; err != nil {
+		t.Errorf("in-flight Embed: %v", err)
+	}
+	if !processGone(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("worker %d outlived its released pool", pid)
+	}
+}
+
+// hangingPython writes an interpreter stand-in that records its pid in
+// dir/pid and then hangs. With worker set it first completes the worker
+// handshake and hangs on the first request.
+func hangingPython(t *testing.T, dir string, worker bool) string {
+	t.Helper()
+	body := `echo $$ > "` + dir + `/pid.tmp" && mv "` + dir + `/pid.tmp" "` + dir + `/pid"
+exec sleep 30
+`
+	if worker {
+		body = `echo '{"ready": true}'
+read -r line
+` + body
+	}
+	return writeScript(t, dir, "hanging-python", body)
+}
+
+// waitForPID returns the pid a hangingPython recorded in dir.
+func waitForPID(t *testing.T, dir string) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if b, err := os.ReadFile(filepath.Join(dir, "pid")); err == nil {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+			if err != nil {
+				t.Fatalf("bad pid %q", b)
+			}
+			return pid
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("python stand-in never started")
+	return 0
+}
+
+// processGone reports whether pid has exited, waiting briefly for it to.
+func processGone(pid int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(pid, 0) != nil {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestLocalEmbedderCancelKillsSubprocess(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		poolSize int
+	}{
+		{"per-call process", 0},
+		{"pooled worker", 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			l, err := NewLocalEmbedder("code", hangingPython(t, dir, tt.poolSize > 0), "m", 3, 1, tt.poolSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			l.SetTimeout(0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			errc := make(chan error, 1)
+			go func() {
+				_, err := l.EmbedWithContext(ctx, "hello world")
+				errc <- err
+			}()
+			pid := waitForPID(t, dir)
+			cancel()
+
+			select {
+			case err := <-errc:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("err = %v, want context.Canceled", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("EmbedWithContext did not return after cancel")
+			}
+			if !processGone(pid) {
+				syscall.Kill(pid, syscall.SIGKILL)
+				t.Errorf("python process %d still running after cancel", pid)
+			}
+		})
+	}
+}
+
+func TestLocalEmbedderTimeoutKillsSubprocess(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		poolSize int
+	}{
+		{"per-call process", 0},
+		{"pooled worker", 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			l, err := NewLocalEmbedder("code", hangingPython(t, dir, tt.poolSize > 0), "m", 3, 1, tt.poolSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			l.SetTimeout(200 * time.Millisecond)
+
+			start := time.Now()
+			if _, err := l.Embed("hello world"); !errors.Is(err, ErrEmbedTimeout) {
+				t.Errorf("err = %v, want ErrEmbedTimeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Embed returned after %s, want soon after the 200ms timeout", elapsed)
+			}
+			if pid := waitForPID(t, dir); !processGone(pid) {
+				syscall.Kill(pid, syscall.SIGKILL)
+				t.Errorf("python process %d still running after the timeout", pid)
+			}
+		})
+	}
+}
+
+func TestLocalEmbedderTimeoutCoversWorkerStartup(t *testing.T) {
+	// The stand-in never prints "ready", like a worker stuck loading its model
+	dir := t.TempDir()
+	l, err := NewLocalEmbedder("code", hangingPython(t, dir, false), "m", 3, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.SetTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := l.Embed("hello world"); !errors.Is(err, ErrEmbedTimeout) {
+		t.Errorf("err = %v, want ErrEmbedTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Embed returned after %s, want soon after the 200ms timeout", elapsed)
+	}
+	if pid := waitForPID(t, dir); !processGone(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("worker %d still running after its startup timed out", pid)
+	}
+
+	// The slot is free again: the next call starts a new worker
+	if _, err := l.Embed("hello world"); !errors.Is(err, ErrEmbedTimeout) {
+		t.Errorf("second call err = %v, want ErrEmbedTimeout from a fresh worker", err)
+	}
+}
+
+func TestLocalEmbedderCallerDeadlineIsNotATimeout(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLocalEmbedder("code", hangingPython(t, dir, false), "m", 3, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetTimeout(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = l.EmbedWithContext(ctx, "hello world")
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrEmbedTimeout) {
+		t.Errorf("err = %v, want the caller's context.DeadlineExceeded", err)
+	}
+	if pid := waitForPID(t, dir); !processGone(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("python process %d still running after the caller's deadline", pid)
+	}
+}
+
+func TestLocalEmbedderSanitizesInvalidUTF8(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	l, err := NewLocalEmbedder("metadata", fakePython(t, dir), "m", 3, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Embed("caf\xe9 latte"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	stdin := readFile(t, filepath.Join(dir, "stdin"))
+	var got string
+	if err := json.Unmarshal([]byte(stdin), &got); err != nil || !utf8.ValidString(stdin) {
+		t.Fatalf("stdin %q is not valid UTF-8 JSON: %v", stdin, err)
+	}
+	if got != "caf� latte" {
+		t.Errorf("script received %q, want the invalid byte replaced", got)
+	}
+	if !strings.Contains(logs.String(), "invalid UTF-8") {
+		t.Errorf("log = %q, want a warning", logs)
+	}
+}
+
+func TestLocalEmbedderReportsRawOutputOnParseFailure(t *testing.T) {
+	dir := t.TempDir()
+	python := writeScript(t, dir, "fake-python", `
+cat > /dev/null
+echo "0.1,oops,0.3"
+echo "UserWarning: tokenizer fell back to slow mode" >&2
+`)
+	l, err := NewLocalEmbedder("metadata", python, "custom/model", 3, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := captureLog(t)
+
+	_, err = l.Embed("hello world")
+	var parseErr *EmbedParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Embed error = %v, want an *EmbedParseError", err)
+	}
+	for _, want := range []string{"stdout: 0.1,oops,0.3", "stderr: UserWarning: tokenizer fell back to slow mode"} {
+		if !strings.Contains(parseErr.Raw, want) {
+			t.Errorf("Raw = %q, want it to contain %q", parseErr.Raw, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "raw output:\n"+parseErr.Raw) {
+		t.Errorf("log = %q, want the raw output logged", logs.String())
+	}
+}
+
+func TestEmbedParseErrorTruncatesRawOutput(t *testing.T) {
+	_, err := parseEmbeddingOutput(strings.Repeat("x", 5*maxEmbedParseRaw), "", 3)
+	var parseErr *EmbedParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("error = %v, want an *EmbedParseError", err)
+	}
+	if !strings.HasSuffix(parseErr.Raw, "... (truncated)") || len(parseErr.Raw) > maxEmbedParseRaw+len("... (truncated)") {
+		t.Errorf("Raw has %d bytes, want it truncated to %d", len(parseErr.Raw), maxEmbedParseRaw)
+	}
+	if parseErr.Unwrap() == nil || parseErr.Error() != parseErr.Err.Error() {
+		t.Errorf("EmbedParseError does not wrap its cause: %v", parseErr)
+	}
+}
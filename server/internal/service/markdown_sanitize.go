@@ -0,0 +1,217 @@
+package service
+
+import (
+	"html"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	// Elements that run code or pull in content, with everything between
+	// their tags; an unclosed one swallows the rest of the text
+	dangerousElement = regexp.MustCompile(`(?is)<(script|style|iframe|object|embed|svg|math)\b.*?(?:</(?:script|style|iframe|object|embed|svg|math)\s*>|$)`)
+	// An HTML comment, closed or not
+	anyHTMLComment = regexp.MustCompile(`(?s)<!--.*?(?:-->|$)`)
+	// Any complete HTML tag, declaration or processing instruction, or else
+	// the start of one the LLM never closed
+	htmlTag = regexp.MustCompile(`</?[a-zA-Z][^<>]*>|<[!?][^<>]*>|<[a-zA-Z/!?]`)
+	// Autolinks, which look like tags but are kept when their scheme is safe
+	safeAutolink = regexp.MustCompile(`(?i)^<(?:(?:https?|mailto):[^\s<>]*|[^\s<>@]+@[^\s<>@]+)>$`)
+	// The destination of an inline markdown link or image, with balanced parens
+	linkDestination = regexp.MustCompile(`\]\(\s*([^\s()]*(?:\([^\s()]*\)[^\s()]*)*)`)
+	// The destination of a link reference definition
+	referenceDestination = regexp.MustCompile(`\]:\s*([^\s<>]+)`)
+)
+
+// maxSanitizePasses bounds sanitizeMarkdown's passes; every pass that changes
+// the text removes a '<' or shortens it, so a handful is always enough.
+const maxSanitizePasses = 8
+
+// sanitizeMarkdown neutralizes the raw HTML in LLM-generated markdown that
+// could run script when a client renders it: script-like elements are removed
+// with their content, every other HTML tag is stripped, and javascript:,
+// vbscript: and data: link targets are replaced with "#". Code blocks and
+// code spans, as a CommonMark parser finds them, are left as they are, since
+// clients show them as text.
+//
+// Stripping can change how the rest of the text parses (a removed tag may
+// turn a line into a code fence), so the text is sanitized until it no longer
+// changes and then checked once more; if anything unsafe is still there, all
+// HTML and link syntax outside code is escaped.
+func sanitizeMarkdown(md string) string {
+	clean := md
+	for i := 0; i < maxSanitizePasses; i++ {
+		next := mapProse(clean, sanitizeProse)
+		if next == clean {
+			break
+		}
+		clean = next
+	}
+	if !markdownSafe(clean) {
+		clean = mapProse(clean, escapeProse)
+	}
+
+	if clean != md {
+		log.Printf("Warning: removed unsafe HTML from generated markdown (%d bytes dropped)", len(md)-len(clean))
+	}
+	return clean
+}
+
+// sanitizeProse sanitizes markdown text outside code.
+func sanitizeProse(s string) string {
+	s = dangerousElement.ReplaceAllString(s, "")
+	s = anyHTMLComment.ReplaceAllString(s, "")
+	s = htmlTag.ReplaceAllStringFunc(s, func(tag string) string {
+		switch {
+		case safeAutolink.MatchString(tag):
+			return tag
+		case strings.HasSuffix(tag, ">"):
+			return ""
+		default:
+			return "&lt;" + tag[1:]
+		}
+	})
+	s = replaceUnsafeURLs(s, linkDestination)
+	return replaceUnsafeURLs(s, referenceDestination)
+}
+
+// escapeProse turns every '<' and '[' in markdown text into an entity, so
+// that no HTML or link can be left in it.
+func escapeProse(s string) string {
+	return strings.NewReplacer("<", "&lt;", "[", "&#91;").Replace(s)
+}
+
+// replaceUnsafeURLs replaces the URLs captured by re's first group with "#"
+// when unsafeURL reports them.
+func replaceUnsafeURLs(s string, re *regexp.Regexp) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		if !unsafeURL(s[m[2]:m[3]]) {
+			continue
+		}
+		b.WriteString(s[last:m[2]])
+		b.WriteString("#")
+		last = m[3]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// unsafeURL reports whether a link destination uses a javascript:, vbscript:
+// or data: scheme, the way a browser would read it: entities and backslash
+// escapes are decoded and whitespace and control characters, which browsers
+// skip, are dropped before the scheme is checked.
+func unsafeURL(dest string) bool {
+	for {
+		decoded := html.UnescapeString(dest)
+		if decoded == dest {
+			break
+		}
+		dest = decoded
+	}
+	dest = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f || r == '\\' {
+			return -1
+		}
+		return r
+	}, dest)
+	dest = strings.ToLower(dest)
+	for _, scheme := range []string{"javascript:", "vbscript:", "data:"} {
+		if strings.HasPrefix(dest, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapProse applies fn to the parts of md outside code blocks and code spans.
+func mapProse(md string, fn func(string) string) string {
+	src := []byte(md)
+	var b strings.Builder
+	last := 0
+	for _, code := range codeRanges(src) {
+		b.WriteString(fn(md[last:code.Start]))
+		b.WriteString(md[code.Start:code.Stop])
+		last = code.Stop
+	}
+	b.WriteString(fn(md[last:]))
+	return b.String()
+}
+
+// codeRanges returns the byte ranges of src holding the contents of code
+// blocks and code spans, in order and without overlaps.
+func codeRanges(src []byte) []text.Segment {
+	var ranges []text.Segment
+	doc := guideMarkdown.Parser().Parse(text.NewReader(src))
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindFencedCodeBlock, ast.KindCodeBlock:
+			lines := n.Lines()
+			if lines.Len() > 0 {
+				ranges = append(ranges, text.NewSegment(lines.At(0).Start, lines.At(lines.Len()-1).Stop))
+			}
+			return ast.WalkSkipChildren, nil
+		case ast.KindCodeSpan:
+			first, okFirst := n.FirstChild().(*ast.Text)
+			last, okLast := n.LastChild().(*ast.Text)
+			if okFirst && okLast {
+				ranges = append(ranges, text.NewSegment(first.Segment.Start, last.Segment.Stop))
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.Start <= merged[n-1].Stop {
+			if r.Stop > merged[n-1].Stop {
+				merged[n-1].Stop = r.Stop
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// markdownSafe reports whether md, as a CommonMark parser reads it, holds no
+// raw HTML and no link or image with an unsafe URL.
+func markdownSafe(md string) bool {
+	src := []byte(md)
+	safe := true
+	doc := guideMarkdown.Parser().Parse(text.NewReader(src))
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.HTMLBlock, *ast.RawHTML:
+			safe = false
+		case *ast.Link:
+			safe = safe && !unsafeURL(string(n.Destination))
+		case *ast.Image:
+			safe = safe && !unsafeURL(string(n.Destination))
+		case *ast.AutoLink:
+			safe = safe && !unsafeURL(string(n.URL(src)))
+		}
+		if !safe {
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return safe
+}
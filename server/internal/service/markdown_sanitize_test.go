@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// maliciousAnswer is LLM output trying each way the sanitizer has to catch.
+const maliciousAnswer = "## How to fix\n" +
+	"1) Read [the docs](javascript&#58;alert(1)) <svg onload=alert(1)><circle/></svg>\n" +
+	"2) Then <a title=\"`\" href=\"javascript:alert(1)\">click</a>\n" +
+	"<form action=\"javascript:alert(1)\"><button>Go</button></form>\n\n" +
+	"Keep `<script>` in code."
+
+func TestSanitizeMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"script element", "Run it.\n<script>alert(1)</script>\nDone.", "Run it.\n\nDone."},
+		{"unclosed script", "Run it. <script>alert(1)\nDone.", "Run it. "},
+		{"event handler", `See <img src=x onerror="alert(1)"> here.`, "See  here."},
+		{"javascript link", "[x](javascript:alert(1))", "[x](#)"},
+		{"mixed-case scheme", "[x](JaVaScRiPt:alert(1))", "[x](#)"},
+		{"entity-encoded scheme", "[x](javascript&#58;alert(1))", "[x](#)"},
+		{"entity-encoded letters", "[x](&#106;avascript:alert(1))", "[x](#)"},
+		{"whitespace in scheme", "[x](<java\tscript:alert(1)>)", "[x]()"},
+		{"data image", "![i](data:text/html;base64,PHNjcmlwdD4=)", "![i](#)"},
+		{"vbscript reference", "[x][r]\n\n[r]: vbscript:msgbox(1)", "[x][r]\n\n[r]: #"},
+		{"javascript autolink", "Go to <javascript:alert(1)>.", "Go to ."},
+		{"svg", "<svg onload=alert(1)><circle/></svg> hi", " hi"},
+		{"math", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>ok`, "ok"},
+		{"base, link and meta", "<base href=\"https://evil.example/\">\n<link rel=stylesheet href=x>\n<meta http-equiv=\"refresh\" content=\"0;url=javascript:alert(1)\">\nok", "\n\n\nok"},
+		{"form", `<form action="javascript:alert(1)"><button>Go</button></form>`, "Go"},
+		{"comment", "a <!-- <script>alert(1)</script> --> b", "a  b"},
+		{"tag split across backticks", "<img src=x `onerror=alert(1)`>", "&lt;img src=x `onerror=alert(1)`>"},
+		{"backtick inside a tag", "<a title=\"`\" href=\"javascript:alert(1)\">x</a>`", "x`"},
+		{"stripping opens a fence", "<b></b>```\n```\n<svg onload=alert(1)>\n```", "```\n```\n"},
+		{"fence closed inside a list", "- ```\n  x\n  ```\n<img src=x onerror=alert(1)>", "- ```\n  x\n  ```\n"},
+		{"backticks inside an HTML block", "<div>\n`<script>alert(1)</script>`\n</div>", "\n``\n"},
+		{"code left alone", "Use `<script>` and `Vec<String>`.\n\n```html\n<script>ok()</script>\n```", "Use `<script>` and `Vec<String>`.\n\n```html\n<script>ok()</script>\n```"},
+		{"safe links kept", "See <https://example.com>, <dev@example.com> and [docs](https://example.com/a_(b)).", "See <https://example.com>, <dev@example.com> and [docs](https://example.com/a_(b))."},
+		{"comparisons kept", "Check a < b and 2<3.", "Check a < b and 2<3."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeMarkdown(tt.in)
+			if got != tt.want {
+				t.Errorf("sanitizeMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if !markdownSafe(got) {
+				t.Errorf("sanitizeMarkdown(%q) = %q, still unsafe", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestEscapeProse(t *testing.T) {
+	// The fallback for anything the text pass misses: all HTML and link
+	// syntax outside code is escaped
+	in := "[x](javascript:alert(1)) <javascript:alert(1)> <b>hi</b> `[y](javascript:z)`"
+	if markdownSafe(in) {
+		t.Fatalf("markdownSafe(%q) = true, want false", in)
+	}
+	got := mapProse(in, escapeProse)
+	if !markdownSafe(got) {
+		t.Fatalf("escaped markdown %q is still unsafe", got)
+	}
+	if !strings.Contains(got, "`[y](javascript:z)`") {
+		t.Errorf("escaped markdown %q changed the code span", got)
+	}
+}
+
+func TestUnsafeURL(t *testing.T) {
+	for _, u := range []string{"javascript:x", " JavaScript:x", "java\tscript:x", "java\nscript:x", "javascript&#58;x", "&#x6A;avascript:x", "javascript&amp;#58;x", `java\script:x`, "vbscript:x", "data:text/html,x"} {
+		if !unsafeURL(u) {
+			t.Errorf("unsafeURL(%q) = false, want true", u)
+		}
+	}
+	for _, u := range []string{"https://example.com", "/docs/javascript:x", "#javascript", "mailto:a@b.c", "javascript-guide.md"} {
+		if unsafeURL(u) {
+			t.Errorf("unsafeURL(%q) = true, want false", u)
+		}
+	}
+}
+
+// checkNeutralized fails t if md still holds any of maliciousAnswer's payloads.
+func checkNeutralized(t testing.TB, what, md string) {
+	t.Helper()
+	if !markdownSafe(md) {
+		t.Errorf("%s is unsafe: %q", what, md)
+	}
+	for _, bad := range []string{"<svg", "<form", "<a ", "javascript"} {
+		if strings.Contains(md, bad) {
+			t.Errorf("%s still holds %q: %q", what, bad, md)
+		}
+	}
+	if !strings.Contains(md, "`<script>`") {
+		t.Errorf("%s lost its inline code: %q", what, md)
+	}
+}
+
+func TestGetGuideSanitizesAnswer(t *testing.T) {
+	svc, guides, gh := newTestGuideService(t, &stubLLM{answer: maliciousAnswer})
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+
+	guide, err := svc.GetGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	checkNeutralized(t, "returned guide", guide.Answer)
+	stored, _ := guides.FindByIssueID(context.Background(), "o/r#1")
+	checkNeutralized(t, "stored guide", stored.Answer)
+}
+
+func TestRAGSanitizesAnswers(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("answer", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "x", Relevance: 0.9}))
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, &stubLLM{answer: maliciousAnswer}, nil, 0, "")
+
+		resp, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		checkNeutralized(mt, "answer", resp.Answer)
+	})
+
+	mt.Run("guide", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "x", Relevance: 0.9}))
+		guides := &fakeGuides{issue: models.Issue{Number: 12, Title: "Crash", State: "open"}}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, &stubLLM{answer: maliciousAnswer}, guides, 0, "")
+
+		resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"})
+		if err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		checkNeutralized(mt, "guide", resp.Guide)
+		if len(guides.upserted) != 1 {
+			mt.Fatalf("cached %d guides, want 1", len(guides.upserted))
+		}
+		checkNeutralized(mt, "cached guide", guides.upserted[0].Answer)
+	})
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// OpenAILLM implements the LLM interface against any OpenAI-compatible
+// chat-completions endpoint (OpenAI itself, vLLM, Ollama, LM Studio, ...).
+// It is safe for concurrent use.
+type OpenAILLM struct {
+	http   *http.Client
+	url    string
+	model  string
+	apiKey string
+
+	promptWarnTokens int // warn when a prompt's estimated tokens exceed this; 0 disables
+}
+
+// NewOpenAILLM creates a client for the chat-completions endpoint at url.
+// apiKey may be empty for local servers that don't require one.
+func NewOpenAILLM(url, model, apiKey string) *OpenAILLM {
+	return &OpenAILLM{
+		http: &http.Client{
+			Timeout: 2 * time.Minute,
+		},
+		url:    url,
+		model:  model,
+		apiKey: apiKey,
+	}
+}
+
+// SetPromptWarnTokens sets the estimated token count above which prompts are
+// logged with a warning; 0 disables the warning. Call it before the client is
+// shared.
+func (l *OpenAILLM) SetPromptWarnTokens(n int) {
+	l.promptWarnTokens = n
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float32       `json:"temperature"`
+	TopP        float32       `json:"top_p"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// GenerateResponse sends prompt as a single user message and returns the
+// first choice's content. Sampling matches the Vertex defaults.
+func (l *OpenAILLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	gen, err := l.GenerateMetered(ctx, prompt)
+	return gen.Text, err
+}
+
+// ModelName returns the model requested from the endpoint.
+func (l *OpenAILLM) ModelName() string {
+	return l.model
+}
+
+// GenerateMetered generates a response like GenerateResponse, reporting the
+// model that answered and the token usage when the endpoint returns them.
+func (l *OpenAILLM) GenerateMetered(ctx context.Context, prompt string) (LLMGeneration, error) {
+	logPromptSize("[OpenAI LLM]", "request", prompt, l.promptWarnTokens)
+	body, err := json.Marshal(chatCompletionRequest{
+		Model:       l.model,
+		Messages:    []chatMessage{{Role: "user", Content: prompt}},
+		Temperature: 0.7,
+		TopP:        0.8,
+	})
+	if err != nil {
+		return LLMGeneration{}, fmt.Errorf("failed to encode completion request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return LLMGeneration{}, fmt.Errorf("failed to create completion request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+l.apiKey)
+	}
+
+	resp, err := l.http.Do(req)
+	if err != nil {
+		return LLMGeneration{}, fmt.Errorf("failed to generate response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return LLMGeneration{}, fmt.Errorf("failed to read completion response: %w", err)
+	}
+
+	var out chatCompletionResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		if resp.StatusCode >= 300 {
+			return LLMGeneration{}, fmt.Errorf("completions endpoint error: %s", resp.Status)
+		}
+		return LLMGeneration{}, fmt.Errorf("failed to decode completion response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		if out.Error != nil && out.Error.Message != "" {
+			return LLMGeneration{}, fmt.Errorf("completions endpoint error: %s: %s", resp.Status, out.Error.Message)
+		}
+		return LLMGeneration{}, fmt.Errorf("completions endpoint error: %s", resp.Status)
+	}
+
+	if len(out.Choices) == 0 {
+		return LLMGeneration{}, fmt.Errorf("no response generated")
+	}
+	gen := LLMGeneration{Text: out.Choices[0].Message.Content, Model: out.Model}
+	if gen.Model == "" {
+		gen.Model = l.model
+	}
+	if out.Usage != nil {
+		gen.Usage = &models.TokenUsage{
+			PromptTokens:     out.Usage.PromptTokens,
+			CompletionTokens: out.Usage.CompletionTokens,
+			TotalTokens:      out.Usage.TotalTokens,
+		}
+	}
+	return gen, nil
+}
+
+// GenerateGuide generates a guide using the configured model
+func (l *OpenAILLM) GenerateGuide(issue models.Issue, snippets []string) (string, error) {
+	return l.GenerateResponse(context.Background(), issueGuidePrompt(issueGuidePromptFormat, issue, snippets, defaultEmptyIssueBodyNote))
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newCompletionsServer starts a fake chat-completions endpoint answering with
+// status and body, and records the last request it received.
+func newCompletionsServer(t *testing.T, status int, body string) (*httptest.Server, *chatCompletionRequest, *http.Header) {
+	t.Helper()
+	var got chatCompletionRequest
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got, &header
+}
+
+func TestOpenAILLMGenerateMetered(t *testing.T) {
+	srv, req, header := newCompletionsServer(t, http.StatusOK, `{
+		"model": "gpt-4o-mini-2024-07-18",
+		"choices": [{"message": {"role": "assistant", "content": "Hello there"}}],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}
+	}`)
+	llm := NewOpenAILLM(srv.URL, "gpt-4o-mini", "sk-test")
+
+	gen, err := llm.GenerateMetered(context.Background(), "Say hello")
+	if err != nil {
+		t.Fatalf("GenerateMetered: %v", err)
+	}
+	if gen.Text != "Hello there" || gen.Model != "gpt-4o-mini-2024-07-18" {
+		t.Errorf("generation = %+v, want the endpoint's text and model", gen)
+	}
+	if gen.Usage == nil || gen.Usage.PromptTokens != 12 || gen.Usage.CompletionTokens != 3 || gen.Usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v, want 12/3/15", gen.Usage)
+	}
+	if req.Model != "gpt-4o-mini" || len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content != "Say hello" {
+		t.Errorf("request = %+v, want one user message with the prompt", req)
+	}
+	if got := header.Get("Authorization"); got != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want the API key", got)
+	}
+}
+
+func TestOpenAILLMWithoutAPIKeyOrModelEcho(t *testing.T) {
+	srv, _, header := newCompletionsServer(t, http.StatusOK, `{"choices": [{"message": {"content": "ok"}}]}`)
+	llm := NewOpenAILLM(srv.URL, "llama3", "")
+
+	gen, err := llm.GenerateMetered(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("GenerateMetered: %v", err)
+	}
+	if gen.Model != "llama3" || gen.Usage != nil {
+		t.Errorf("generation = %+v, want the configured model and no usage", gen)
+	}
+	if got := header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization = %q, want none without an API key", got)
+	}
+}
+
+func TestOpenAILLMErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"API error message", http.StatusUnauthorized, `{"error": {"message": "invalid api key"}}`, "invalid api key"},
+		{"non-JSON error", http.StatusBadGateway, `<html>bad gateway</html>`, "502"},
+		{"no choices", http.StatusOK, `{"choices": []}`, "no response generated"},
+		{"malformed body", http.StatusOK, `{"choices": [`, "failed to decode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _, _ := newCompletionsServer(t, tt.status, tt.body)
+			_, err := NewOpenAILLM(srv.URL, "m", "").GenerateResponse(context.Background(), "hi")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
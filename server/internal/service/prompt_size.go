@@ -0,0 +1,30 @@
+package service
+
+import (
+	"log"
+	"unicode/utf8"
+)
+
+// charsPerToken is the rough characters-per-token ratio used to estimate
+// prompt sizes; close enough for English prose and code to spot bloat.
+const charsPerToken = 4
+
+// estimateTokens returns a rough token count for text.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// logPromptSize logs the size of a prompt about to be sent to an LLM and
+// warns when its estimated token count exceeds warnTokens (0 disables the
+// warning). It reports whether the warning fired. The LLM clients call it for
+// every request, so each prompt is logged once whichever service built it.
+func logPromptSize(prefix, name, prompt string, warnTokens int) bool {
+	chars := utf8.RuneCountInString(prompt)
+	tokens := estimateTokens(prompt)
+	log.Printf("%s %s prompt: %d chars, ~%d tokens", prefix, name, chars, tokens)
+	if warnTokens > 0 && tokens > warnTokens {
+		log.Printf("%s Warning: %s prompt is ~%d tokens, over the %d-token warning threshold; the model may truncate or reject it", prefix, name, tokens, warnTokens)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger to a buffer for the rest of the
+// test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+func TestLogPromptSizeWarnsAboveThreshold(t *testing.T) {
+	prompt := strings.Repeat("abcd", 100) // ~100 tokens
+	tests := []struct {
+		name       string
+		warnTokens int
+		want       bool
+	}{
+		{"above", 99, true},
+		{"at", 100, false},
+		{"below", 500, false},
+		{"disabled", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := captureLog(t)
+			if got := logPromptSize("[Test]", "answer", prompt, tt.warnTokens); got != tt.want {
+				t.Errorf("logPromptSize warned = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(out.String(), "answer prompt: 400 chars, ~100 tokens") {
+				t.Errorf("log = %q, want the prompt size", out)
+			}
+			if got := strings.Contains(out.String(), "Warning"); got != tt.want {
+				t.Errorf("log has a warning: %v, want %v (%q)", got, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestOpenAILLMWarnsOnLargePrompt(t *testing.T) {
+	srv, _, _ := newCompletionsServer(t, http.StatusOK, `{"choices": [{"message": {"content": "ok"}}]}`)
+	llm := NewOpenAILLM(srv.URL, "llama3", "")
+	llm.SetPromptWarnTokens(10)
+	out := captureLog(t)
+
+	if _, err := llm.GenerateResponse(context.Background(), strings.Repeat("word ", 40)); err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+	if n := strings.Count(out.String(), "over the 10-token warning threshold"); n != 1 {
+		t.Errorf("logged %d warnings, want exactly 1:\n%s", n, out)
+	}
+}
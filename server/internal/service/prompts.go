@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Built-in prompt formats for the LLM calls made by GuideService and
+// RAGService. They are fmt format strings rather than templates; the chat
+// follow-up prompt is a text/template (see ChatPrompt). PromptStore can
+// replace any of them with the contents of a file.
+
+// ragPromptFormat is the RAG answer prompt. Its verbs are, in order, the issue
+// details, the contributor guide, the code sources and the user's question.
+const ragPromptFormat = `You are an AI assistant helping a developer understand and work on a GitHub issue. Use the following context to answer the user's question:
+
+Issue Details:
+%s
+
+First-Time Contributor Guide:
+%s
+
+Relevant Code Snippets:
+%s
+
+User's Question: %s
+
+Please provide a clear and helpful answer that:
+1. Directly addresses the user's question
+2. References specific parts of the code when relevant
+3. Uses markdown links in the format [filename](filepath) when referencing files
+• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using ` + "`...`" + ` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
+4. Maintains a professional and technical tone
+5. Focuses on helping the user understand and solve the issue
+6. Remember that most if not all questions have the goal or the need of solving the issue.  IMPORTANT!
+
+IMPORTANT NOTE: 
+You will always be given code snippets. Sometimes the users response will not require new snippets, and you will not have to use them in your response. 
+Sometimes they will ask about the snippets in the first-time contributor guide which you will have to respond to. 
+
+Formatting Rules
+• Use level 2 headers (##) for top-level sections.
+• Use level 3 headers (###) for optional sub-sections if needed.
+• Use bullet points or numbered steps for procedures.
+• Use fenced code blocks(%[1]s) for code snippets.
+• Use markdown links for file references: [filename](filepath)
+• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using ` + "`...`" + ` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
+• Do not use conventional number a number should be followed by ) in a numbered list, such as 1) 2) 3)
+• **All bullets and numbered steps must place their description on the same line**. Example: 1) Run the test not 1)\nRun the tests. Make sure no formatting glitch causes this to happen.
+• You must not break to a new line after 1) or •. The description must follow immediately on the same line. 
+• If a break after a numbered step or a bullet is done then the output is considered invalid. 
+
+Failure to follow any rules will deem the response invalid. 
+
+Your response should be in markdown format and should not include any meta-commentary or disclaimers.`
+
+// guidePromptFormat is the contributor-guide prompt. Its verbs are the code
+// fence warning, the issue and the code sources.
+const guidePromptFormat = `
+
+IMPORTANT: When generating the guide below:
+- DO NOT put the content of any step on a new line after 1), 2), etc.
+- Do NOT format numbered steps or bullets with * or ** or other characters that cause indentation or list parsing.
+- DO NOT indent or break lines between the number and the description.
+- Every bullet point or step must stay on the SAME line as its description. If you break after 1), your output will be considered INVALID. Now follow the instructions below:
+
+You are generating a first-time contributor guide for a GitHub issue using retrieval-augmented context. You will be given:
+• A GitHub issue describing a bug or feature request.
+• A list of relevant files extracted from the codebase.
+
+Write a clear, actionable, and beginner-friendly guide to help a developer confidently address this specific issue—even if it's their first time in the repository.
+
+⸻
+
+Output Requirements
+• Write in pure Markdown. Do not wrap the entire guide in %s or any fenced code block.
+• The guide must focus only on solving the issue described—not on general contribution practices.
+• Tone should be clear, direct, and confidence-building.
+• Avoid conversational or overly friendly language.
+• Do not include PR submission instructions.
+• Keep total length between 400–700 words.
+• Use 2 to 3 code snippets (in fenced code blocks using triple backticks, not indented).
+• When referencing files, use markdown links in the format [filename](filepath). For example, if you want to reference a file at src/main.go, write it as [main.go](src/main.go).
+• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using ` + "`...`" + ` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
+
+⸻
+
+Formatting Rules
+• Use level 2 headers (##) for top-level sections.
+• Use level 3 headers (###) for optional sub-sections if needed.
+• Use bullet points or numbered steps for procedures.
+• Use fenced code blocks (%[1]s) for code snippets.
+• Use markdown links for file references: [filename](filepath)
+• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using ` + "`...`" + ` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
+• Do not use convential number a number should be followed by ) in a numbered list, such as 1) 2) 3)
+• **All bullets and numbered steps must place their description on the same line**. Example: 1) Run the test not 1)\nRun the tests. Make sure no formatting glitch causes this to happen.
+• You must not break to a new line after 1) or •. The description must follow immediately on the same line. 
+• If a break after a numbered step or a bullet is done then the output is considered invalid. 
+
+⸻
+
+Required Section Structure
+
+Use the following exact headers and order (do not add or rename):
+
+## Purpose of This Contribution
+
+Clearly explain what this contribution aims to fix, improve, or introduce in direct relation to the GitHub issue. Frame it in terms of developer clarity, performance, maintainability, or correctness.
+
+## Context
+
+Summarize the relevant background from the issue—prior behavior, technical gaps, or what problem the current implementation poses.
+
+## Files to Review
+
+For each file provided (make sure you include each source provided), use markdown links to reference them. it should always be the full filename and full filepath never cut them down. Always break a line between the repo link and its description.
+
+> [filename](filepath)
+
+Explain what the file does in the context of the project. Describe how it relates to the issue or implementation. Mention important functions, components, or logic to focus on.
+
+Do not use bullet points or numbers to list the file paths. Only use block quotes for the path and unformatted text underneath for its description. This is achieved by making sure there is a blank next line between the two. 
+
+## How to Fix
+• Outline where and how to make the required changes.
+• Reference specific file paths using markdown links, it should always be the full filename and full filepath never cut them down: [filename](filepath). 
+• Use bullet points or numbered steps.
+• Assume beginner familiarity with the codebase.
+
+## How to Test
+• Describe how to verify the changes are working correctly.
+• Include any commands, scripts, or test steps.
+• Mention what successful behavior looks like.
+
+## Example
+
+(Optional) Include 1–2 relevant code snippets, logs, or output examples showing the fix in action or an expected result.
+
+## Notes
+• List any extra considerations like edge cases, performance implications, or future improvements.
+• If applicable, include known limitations or tradeoffs.
+
+GitHub Issue: %[2]s
+
+Relevant Files:
+%[3]s
+
+Write a guide that helps a junior developer contribute confidently without prior repo experience.`
+
+// issueGuidePromptFormat is the issue guide prompt GuideService generates
+// with, and the one every LLM backend's GenerateGuide uses. Its verbs are the
+// issue title, the issue body and the code snippets.
+const issueGuidePromptFormat = `Based on this GitHub issue and relevant code snippets, provide a detailed guide:
+
+Issue Title: %s
+Issue Description: %s
+
+Relevant Code Snippets:
+%s
+
+Please provide a comprehensive guide that addresses the issue.`
+
+// How many arguments each fmt prompt is filled with, by the function named;
+// PromptStore checks the prompts against these on every load.
+const (
+	ragPromptArgs        = 4 // RAGService.generateResponse
+	guidePromptArgs      = 3 // buildGuidePrompt
+	issueGuidePromptArgs = 3 // issueGuidePrompt
+)
+
+// Prompts is one consistent set of the prompts the server generates with. A
+// generation reads every prompt it needs from the same Prompts, so a reload
+// never mixes old and new versions within one request.
+type Prompts struct {
+	Guide      string    `json:"guide"`
+	IssueGuide string    `json:"issue_guide"`
+	RAG        string    `json:"rag"`
+	Chat       string    `json:"chat"`
+	LoadedAt   time.Time `json:"loaded_at"`
+
+	// Version identifies this set of prompt texts; it changes whenever any
+	// of them does and is recorded on the guides generated with them.
+	Version string `json:"version"`
+
+	chat *ChatPrompt
+}
+
+// ChatPrompt returns the parsed chat template.
+func (p *Prompts) ChatPrompt() *ChatPrompt {
+	return p.chat
+}
+
+// PromptFiles names the files prompts are loaded from; an empty path selects
+// the built-in prompt.
+type PromptFiles struct {
+	Guide      string
+	IssueGuide string
+	RAG        string
+	Chat       string
+}
+
+// PromptStore holds the active Prompts and swaps them atomically on Reload.
+type PromptStore struct {
+	files   PromptFiles
+	current atomic.Pointer[Prompts]
+
+	mu      sync.Mutex           // serializes reloads
+	modTime map[string]time.Time // file modification times at the last load
+}
+
+// NewPromptStore loads the prompts named by files.
+func NewPromptStore(files PromptFiles) (*PromptStore, error) {
+	s := &PromptStore{files: files}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DefaultPrompts returns a store with the built-in prompts.
+func DefaultPrompts() *PromptStore {
+	s, err := NewPromptStore(PromptFiles{})
+	if err != nil {
+		panic(err) // the built-in templates always parse
+	}
+	return s
+}
+
+// Current returns the active prompts. Callers should read it once per
+// generation and use that snapshot throughout.
+func (s *PromptStore) Current() *Prompts {
+	return s.current.Load()
+}
+
+// Reload re-reads every prompt file and swaps them in together. Each prompt is
+// first checked against the arguments its callers fill it with; on any error
+// the active prompts are left unchanged.
+func (s *PromptStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modTime := map[string]time.Time{}
+	readFile := func(path, fallback, name string) (string, error) {
+		if path == "" {
+			return fallback, nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s prompt: %w", name, err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s prompt: %w", name, err)
+		}
+		if strings.TrimSpace(string(b)) == "" {
+			return "", fmt.Errorf("%s prompt file %s is empty", name, path)
+		}
+		modTime[path] = info.ModTime()
+		return string(b), nil
+	}
+
+	guide, err := readFile(s.files.Guide, guidePromptFormat, "guide")
+	if err != nil {
+		return err
+	}
+	issueGuide, err := readFile(s.files.IssueGuide, issueGuidePromptFormat, "issue guide")
+	if err != nil {
+		return err
+	}
+	rag, err := readFile(s.files.RAG, ragPromptFormat, "RAG")
+	if err != nil {
+		return err
+	}
+	chatText, err := readFile(s.files.Chat, defaultChatPromptTemplate, "chat")
+	if err != nil {
+		return err
+	}
+	// Check every prompt against what its callers fill in before swapping
+	// any of them in
+	for _, p := range []struct {
+		name, format string
+		args         int
+	}{
+		{"guide", guide, guidePromptArgs},
+		{"issue guide", issueGuide, issueGuidePromptArgs},
+		{"RAG", rag, ragPromptArgs},
+	} {
+		if err := checkPromptFormat(p.name, p.format, p.args); err != nil {
+			return err
+		}
+	}
+	chat, err := parseChatPrompt(chatText)
+	if err != nil {
+		return err
+	}
+	if _, err := chat.Render(ChatPromptData{History: []ChatTurn{{}}}); err != nil {
+		return err
+	}
+
+	s.current.Store(&Prompts{
+		Guide:      guide,
+		IssueGuide: issueGuide,
+		RAG:        rag,
+		Chat:       chatText,
+		LoadedAt:   time.Now(),
+		Version:    promptVersion(guide, issueGuide, rag, chatText),
+		chat:       chat,
+	})
+	s.modTime = modTime
+	return nil
+}
+
+// fmtError matches the error fmt writes in place of a verb that has no
+// argument, an argument without a verb, or a malformed verb.
+var fmtError = regexp.MustCompile(`%!\w?\([^)]*\)`)
+
+// checkPromptFormat reports whether format, a prompt named name, takes the
+// args string arguments its callers pass with no verb left over or missing.
+func checkPromptFormat(name, format string, args int) error {
+	values := make([]any, args)
+	for i := range values {
+		values[i] = ""
+	}
+	if bad := fmtError.FindString(fmt.Sprintf(format, values...)); bad != "" {
+		return fmt.Errorf("%s prompt does not take its %d arguments: %s", name, args, bad)
+	}
+	return nil
+}
+
+// promptVersion returns a short content hash of prompts, so a version is the
+// same across restarts and changes with any edit.
+func promptVersion(prompts ...string) string {
+	h := sha256.New()
+	for _, p := range prompts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// changed reports whether any prompt file was modified since the last load.
+func (s *PromptStore) changed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range []string{s.files.Guide, s.files.IssueGuide, s.files.RAG, s.files.Chat} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(s.modTime[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls the prompt files every interval and reloads them when one
+// changes, until ctx is done. Failed reloads are logged and keep the
+// previous prompts.
+func (s *PromptStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.changed() {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			log.Printf("[Prompts] Reload failed, keeping previous prompts: %v", err)
+			continue
+		}
+		log.Printf("[Prompts] Reloaded prompt templates")
+	}
+}
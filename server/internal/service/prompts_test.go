@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+func TestPromptStoreReloadSwapsTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guide.txt")
+	if err := os.WriteFile(path, []byte("guide v1 %[1]s %[2]s %[3]s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPromptStore(PromptFiles{Guide: path})
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	before := store.Current()
+	if before.Guide != "guide v1 %[1]s %[2]s %[3]s" || before.RAG != ragPromptFormat {
+		t.Fatalf("prompts = %+v, want the file's guide and the built-in RAG prompt", before)
+	}
+
+	if err := os.WriteFile(path, []byte("guide v2 %[1]s %[2]s %[3]s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	after := store.Current()
+	if after.Guide != "guide v2 %[1]s %[2]s %[3]s" {
+		t.Errorf("guide = %q after reload, want v2", after.Guide)
+	}
+	if after.Version == before.Version {
+		t.Error("version unchanged after the guide prompt changed")
+	}
+	// A generation holding the earlier snapshot keeps seeing it
+	if before.Guide != "guide v1 %[1]s %[2]s %[3]s" {
+		t.Errorf("earlier snapshot changed to %q", before.Guide)
+	}
+}
+
+func TestPromptStoreReloadFailureKeepsPrompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guide.txt")
+	if err := os.WriteFile(path, []byte("guide v1 %s %s %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPromptStore(PromptFiles{Guide: path})
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatal("Reload of an empty prompt file succeeded, want an error")
+	}
+	if got := store.Current().Guide; got != "guide v1 %s %s %s" {
+		t.Errorf("guide = %q after a failed reload, want v1 kept", got)
+	}
+}
+
+func TestPromptStoreReloadChecksEveryPrompt(t *testing.T) {
+	dir := t.TempDir()
+	files := PromptFiles{
+		Guide:      filepath.Join(dir, "guide.txt"),
+		IssueGuide: filepath.Join(dir, "issue_guide.txt"),
+		RAG:        filepath.Join(dir, "rag.txt"),
+	}
+	write := func(path, text string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(files.Guide, "guide %s %s %s")
+	write(files.IssueGuide, "issue guide %s %s %s")
+	write(files.RAG, "rag %[4]s %[3]s %[2]s %[1]s")
+	store, err := NewPromptStore(files)
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	before := store.Current()
+
+	tests := []struct {
+		name, path, text, want string
+	}{
+		{"guide verb missing", files.Guide, "guide %s %s", "guide prompt does not take its 3 arguments"},
+		{"issue guide verb extra", files.IssueGuide, "issue guide %s %s %s %s", "issue guide prompt does not take its 3 arguments"},
+		{"RAG index out of range", files.RAG, "rag %[5]s", "RAG prompt does not take its 4 arguments"},
+		{"RAG wrong verb", files.RAG, "rag %s %s %s %d", "RAG prompt does not take its 4 arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved, _ := os.ReadFile(tt.path)
+			defer write(tt.path, string(saved))
+			// A valid change to another prompt is rejected with the bad one
+			if tt.path != files.Guide {
+				write(files.Guide, "guide v2 %s %s %s")
+				defer write(files.Guide, "guide %s %s %s")
+			}
+			write(tt.path, tt.text)
+
+			err := store.Reload()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Reload error = %v, want it to mention %q", err, tt.want)
+			}
+			if store.Current() != before {
+				t.Error("a failed reload replaced the active prompts")
+			}
+		})
+	}
+}
+
+func TestPromptStoreWatchReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rag.txt")
+	if err := os.WriteFile(path, []byte("rag v1 %s %s %s %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPromptStore(PromptFiles{RAG: path})
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, 10*time.Millisecond)
+
+	if err := os.WriteFile(path, []byte("rag v2 %s %s %s %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Make the change visible even on filesystems with coarse timestamps
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Current().RAG != "rag v2 %s %s %s %s" {
+		if time.Now().After(deadline) {
+			t.Fatalf("RAG prompt = %q, want the watcher to load v2", store.Current().RAG)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGuideServiceUsesReloadedIssueGuidePrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issue_guide.txt")
+	if err := os.WriteFile(path, []byte("v1: %s / %s / %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := NewPromptStore(PromptFiles{IssueGuide: path})
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	gh, client := newFakeGitHub(t)
+	gh.setIssue("o/r/issues/1", models.Issue{Number: 1, Title: "Crash", Body: "It crashes", State: "open"})
+	gh.setIssue("o/r/issues/2", models.Issue{Number: 2, Title: "Hang", Body: "It hangs", State: "open"})
+	repos := &stubRepoRepo{
+		repos:  map[string]*models.Repo{"o/r": {ID: "o/r", FullName: "o/r"}},
+		chunks: []models.CodeChunk{{RepoID: "o/r", File: "main.go", Text: "package main"}},
+	}
+	llm := &stubLLM{answer: "1) Read main.go"}
+	svc := NewGuideService(newMemGuideRepo(), client, repos, &stubEmbedder{}, llm, 0, nil, 0, prompts, "")
+
+	first, err := svc.GetGuide(context.Background(), "o/r#1")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+	v1 := prompts.Current().Version
+	if err := os.WriteFile(path, []byte("v2: %s / %s / %s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := prompts.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	second, err := svc.GetGuide(context.Background(), "o/r#2")
+	if err != nil {
+		t.Fatalf("GetGuide: %v", err)
+	}
+
+	want := []string{"v1: Crash / It crashes / package main", "v2: Hang / It hangs / package main"}
+	if llm.calls() != 2 || llm.prompts[0] != want[0] || llm.prompts[1] != want[1] {
+		t.Errorf("prompts = %q, want %q", llm.prompts, want)
+	}
+	// Each guide records the version of the prompt it was generated with
+	if first.PromptVersion != v1 || second.PromptVersion != prompts.Current().Version || second.PromptVersion == v1 {
+		t.Errorf("prompt versions = %q, %q; want %q, then the reloaded %q", first.PromptVersion, second.PromptVersion, v1, prompts.Current().Version)
+	}
+}
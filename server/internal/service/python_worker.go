@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// workerScript loads a sentence-transformers model once, then embeds one JSON
+// request per stdin line, answering with one JSON line on stdout.
+const workerScript = `
+import sys, json
+from sentence_transformers import SentenceTransformer
+
+model = SentenceTransformer(sys.argv[1])
+print(json.dumps({"ready": True}), flush=True)
+for line in sys.stdin:
+    try:
+        text = json.loads(line)["text"]
+        out = {"embedding": model.encode(text, normalize_embeddings=True).tolist()}
+    except Exception as e:
+        out = {"error": str(e)}
+    print(json.dumps(out), flush=True)
+`
+
+// pythonWorker is one long-lived Python process with a model loaded.
+type pythonWorker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+type workerResponse struct {
+	Ready     bool      `json:"ready"`
+	Embedding []float32 `json:"embedding"`
+	Error     string    `json:"error"`
+}
+
+// startPythonWorker launches a worker and waits until its model is loaded. If
+// ctx is done first (a model download can hang) the worker is killed and
+// ctx's error returned.
+func startPythonWorker(ctx context.Context, pythonBin, modelName string) (*pythonWorker, error) {
+	cmd := exec.Command(pythonBin, "-c", workerScript, modelName)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worker stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worker stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start embedding worker: %w", err)
+	}
+
+	w := &pythonWorker{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	ready := make(chan error, 1)
+	go func() {
+		resp, err := w.read()
+		if err == nil && !resp.Ready {
+			err = fmt.Errorf("unexpected handshake")
+		}
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			w.kill()
+			return nil, fmt.Errorf("embedding worker for %s failed to start: %w", modelName, err)
+		}
+	case <-ctx.Done():
+		w.kill()
+		return nil, ctx.Err()
+	}
+	log.Printf("Started embedding worker for %s (pid %d)", modelName, cmd.Process.Pid)
+	return w, nil
+}
+
+// embed sends text to the worker and returns its response. An error means
+// the worker itself is broken; a failed embedding is reported in resp.Error.
+func (w *pythonWorker) embed(text string) (workerResponse, error) {
+	req, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return workerResponse{}, err
+	}
+	if _, err := w.stdin.Write(append(req, '\n')); err != nil {
+		return workerResponse{}, fmt.Errorf("failed to send text to embedding worker: %w", err)
+	}
+	return w.read()
+}
+
+// read returns the next JSON response, skipping any other stdout output
+// (libraries sometimes print there).
+func (w *pythonWorker) read() (workerResponse, error) {
+	for {
+		line, err := w.stdout.ReadBytes('\n')
+		if err != nil {
+			return workerResponse{}, fmt.Errorf("embedding worker exited: %w", err)
+		}
+		var resp workerResponse
+		if json.Unmarshal(line, &resp) == nil {
+			return resp, nil
+		}
+	}
+}
+
+func (w *pythonWorker) kill() {
+	w.stdin.Close()
+	if w.cmd.Process != nil {
+		w.cmd.Process.Kill()
+	}
+	w.cmd.Wait()
+}
+
+// workerPool bounds the warm workers for one (interpreter, model) pair.
+// Workers are started lazily, reused across calls, and replaced when one
+// fails.
+type workerPool struct {
+	pythonBin string
+	modelName string
+
+	slots chan struct{}      // one token per worker that may exist
+	idle  chan *pythonWorker // started workers not in use
+	refs  int                // embedders sharing the pool; guarded by pythonPools.mu
+
+	mu     sync.Mutex // orders put against close
+	closed bool       // workers returned after close are killed
+}
+
+func newWorkerPool(pythonBin, modelName string, size int) *workerPool {
+	return &workerPool{
+		pythonBin: pythonBin,
+		modelName: modelName,
+		slots:     make(chan struct{}, size),
+		idle:      make(chan *pythonWorker, size),
+	}
+}
+
+// embed runs text on an idle worker, starting one if the pool has room and
+// waiting otherwise. If ctx is canceled mid-embedding the worker is killed,
+// since it cannot be interrupted and its late reply would desync the next
+// caller; the pool starts a replacement on demand.
+func (p *workerPool) embed(ctx context.Context, text string) ([]float32, error) {
+	w, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		resp workerResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := w.embed(text)
+		done <- result{resp, err}
+	}()
+
+	var resp workerResponse
+	select {
+	case r := <-done:
+		resp, err = r.resp, r.err
+	case <-ctx.Done():
+		p.discard(w)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		// The process may be wedged or dead; never reuse it
+		p.discard(w)
+		return nil, err
+	}
+	p.put(w)
+	if resp.Error != "" {
+		return nil, fmt.Errorf("embedding worker error: %s", resp.Error)
+	}
+	return resp.Embedding, nil
+}
+
+func (p *workerPool) get(ctx context.Context) (*pythonWorker, error) {
+	select {
+	case w := <-p.idle:
+		return w, nil
+	default:
+	}
+	select {
+	case w := <-p.idle:
+		return w, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case p.slots <- struct{}{}:
+		w, err := startPythonWorker(ctx, p.pythonBin, p.modelName)
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return w, nil
+	}
+}
+
+// put returns a healthy worker to the pool, or kills it if the pool was
+// closed while the worker was checked out.
+func (p *workerPool) put(w *pythonWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.discard(w)
+		return
+	}
+	p.idle <- w
+}
+
+func (p *workerPool) discard(w *pythonWorker) {
+	w.kill()
+	<-p.slots
+}
+
+// close stops the idle workers; workers still embedding are stopped when they
+// are returned. Callers must not start embeddings afterwards.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for {
+		select {
+		case w := <-p.idle:
+			p.discard(w)
+		default:
+			return
+		}
+	}
+}
+
+// pythonPools shares worker pools between LocalEmbedders using the same
+// interpreter and model, so the metadata and code embedders (and every
+// concurrent request) draw on one bounded set of warm processes per model.
+var pythonPools = struct {
+	mu    sync.Mutex
+	pools map[string]*workerPool
+}{pools: map[string]*workerPool{}}
+
+// acquireWorkerPool returns the shared pool for pythonBin and modelName,
+// creating it with size workers if needed, and takes a reference to it.
+func acquireWorkerPool(pythonBin, modelName string, size int) *workerPool {
+	key := pythonBin + "\x00" + modelName
+	pythonPools.mu.Lock()
+	defer pythonPools.mu.Unlock()
+
+	p, ok := pythonPools.pools[key]
+	if !ok {
+		p = newWorkerPool(pythonBin, modelName, size)
+		pythonPools.pools[key] = p
+	}
+	p.refs++
+	return p
+}
+
+// releaseWorkerPool drops a reference and stops the pool's workers when the
+// last embedder using it is closed.
+func releaseWorkerPool(p *workerPool) {
+	key := p.pythonBin + "\x00" + p.modelName
+	pythonPools.mu.Lock()
+	defer pythonPools.mu.Unlock()
+
+	p.refs--
+	if p.refs > 0 {
+		return
+	}
+	delete(pythonPools.pools, key)
+	p.close()
+}
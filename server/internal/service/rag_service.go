@@ -2,11 +2,12 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
@@ -25,30 +26,175 @@ type RAGService struct {
 	embedder     Embedder
 	llm          LLM
 	guideSvc     GuideService
+	minRelevance float64 // sources scoring below this are not sent to the LLM
+
+	emptyBodyNote string // stands in for an empty issue body in prompts
+
+	prompts *PromptStore
+
+	codeSvc          CodeService // fetches files for RAGRequest.IncludeFullFile
+	fullFileMaxBytes int         // full files are cut to this many bytes
+
+	dedupThreshold float64 // overlap above which same-file sources merge; 0 disables
 }
 
-func NewRAGService(codeColl, metadataColl *mongo.Collection, embedder Embedder, llm LLM, guideSvc GuideService) *RAGService {
+// NewRAGService wires dependencies. emptyBodyNote describes issues without a
+// body in prompts; "" selects the built-in note.
+func NewRAGService(codeColl, metadataColl *mongo.Collection, embedder Embedder, llm LLM, guideSvc GuideService, minRelevance float64, emptyBodyNote string) *RAGService {
+	if emptyBodyNote == "" {
+		emptyBodyNote = defaultEmptyIssueBodyNote
+	}
 	return &RAGService{
-		codeColl:     codeColl,
-		metadataColl: metadataColl,
-		embedder:     embedder,
-		llm:          llm,
-		guideSvc:     guideSvc,
+		codeColl:      codeColl,
+		metadataColl:  metadataColl,
+		embedder:      embedder,
+		llm:           llm,
+		guideSvc:      guideSvc,
+		minRelevance:  minRelevance,
+		emptyBodyNote: emptyBodyNote,
+		prompts:       DefaultPrompts(),
 	}
 }
 
+// SetPromptStore makes the service generate with the prompts in store, so
+// reloading the store changes the prompts of later generations.
+func (s *RAGService) SetPromptStore(store *PromptStore) {
+	s.prompts = store
+}
+
+// SetFullFileSource enables RAGRequest.IncludeFullFile: each source's file is
+// fetched through codeSvc and attached, cut to at most maxBytes bytes.
+func (s *RAGService) SetFullFileSource(codeSvc CodeService, maxBytes int) {
+	s.codeSvc = codeSvc
+	s.fullFileMaxBytes = maxBytes
+}
+
+// SetSourceDedupThreshold merges sources from the same file whose word
+// shingles overlap by at least threshold (0–1) before they are used; 0
+// disables merging.
+func (s *RAGService) SetSourceDedupThreshold(threshold float64) {
+	s.dedupThreshold = threshold
+}
+
+// Bounds for RAGRequest.MaxResults.
+const (
+	defaultRAGResults = 5
+	maxRAGResults     = 20
+)
+
+// Bounds for RAGRequest.MaxSources.
+const (
+	defaultRAGSources = 5
+	maxRAGSources     = 20
+)
+
 type RAGRequest struct {
-	Query       string `json:"query"`
+	Query       string `json:"query" validate:"required"`
 	RepoID      string `json:"repo_id,omitempty"`
-	IssueNumber string `json:"issue_number,omitempty"` // GitHub issue number (e.g., "51878")
-	MaxResults  int    `json:"max_results,omitempty"`
+	IssueNumber string `json:"issue_number,omitempty"`                        // GitHub issue number (e.g., "51878")
+	MaxResults  int    `json:"max_results,omitempty" validate:"gte=0,lte=20"` // chunks retrieved for the LLM
+	MaxSources  int    `json:"max_sources,omitempty" validate:"gte=0,lte=20"` // sources returned to the client
+	DryRun      bool   `json:"dry_run,omitempty"`                             // return the prompt instead of calling the LLM
+
+	// IncludeFullFile attaches the whole file of every source (up to the
+	// configured size limit) as Source.FullFile
+	IncludeFullFile bool `json:"include_full_file,omitempty"`
+
+	// Refresh refetches the issue from GitHub instead of the issue cache and,
+	// for guides, regenerates the guide instead of returning the cached one
+	Refresh bool `json:"refresh,omitempty"`
+
+	// IncludeSources set to false leaves the sources out of the response;
+	// they are still retrieved and used as context
+	IncludeSources *bool `json:"include_sources,omitempty"`
+}
+
+// WantsSources reports whether the response should carry its sources.
+func (r RAGRequest) WantsSources() bool {
+	return r.IncludeSources == nil || *r.IncludeSources
+}
+
+// ErrInvalidRAGRequest wraps request validation failures. Handlers map it to
+// 400 Bad Request.
+var ErrInvalidRAGRequest = errors.New("invalid RAG request")
+
+// IssueID returns the "owner/repo#number" ID of the request's issue, or "" when
+// no issue number is set. It does not check the parts; see validate.
+func (r RAGRequest) IssueID() string {
+	if r.IssueNumber == "" {
+		return ""
+	}
+	return r.RepoID + "#" + r.IssueNumber
+}
+
+// validate checks that the query is set and, when an issue number is given,
+// that RepoID has the owner/repo shape and the number is a positive integer.
+func (r RAGRequest) validate() error {
+	if strings.TrimSpace(r.Query) == "" {
+		return fmt.Errorf("%w: query cannot be empty", ErrInvalidRAGRequest)
+	}
+	if r.IssueNumber == "" {
+		return nil
+	}
+	owner, repo, ok := strings.Cut(r.RepoID, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return fmt.Errorf("%w: repo_id must be owner/repo when issue_number is set", ErrInvalidRAGRequest)
+	}
+	if n, err := strconv.Atoi(r.IssueNumber); err != nil || n <= 0 {
+		return fmt.Errorf("%w: issue_number must be a positive integer", ErrInvalidRAGRequest)
+	}
+	return nil
+}
+
+// sourceLimit returns MaxSources, defaulting to 5 when unset and capped at 20.
+func (r RAGRequest) sourceLimit() int {
+	switch {
+	case r.MaxSources <= 0:
+		return defaultRAGSources
+	case r.MaxSources > maxRAGSources:
+		return maxRAGSources
+	default:
+		return r.MaxSources
+	}
+}
+
+// resultLimit returns MaxResults, defaulting to 5 when unset and capped at 20.
+func (r RAGRequest) resultLimit() int {
+	switch {
+	case r.MaxResults <= 0:
+		return defaultRAGResults
+	case r.MaxResults > maxRAGResults:
+		return maxRAGResults
+	default:
+		return r.MaxResults
+	}
 }
 
 type RAGResponse struct {
 	Answer     string   `json:"answer"`
 	Sources    []Source `json:"sources"`
 	Confidence float64  `json:"confidence"`
-	Guide      string   `json:"guide,omitempty"`
+
+	// TotalSources is how many sources informed the answer; Sources holds
+	// the most relevant of them, up to the request's max_sources
+	TotalSources int `json:"total_sources"`
+
+	Guide  string `json:"guide,omitempty"`
+	Prompt string `json:"prompt,omitempty"` // set only for dry runs
+
+	// Issue is the GitHub issue a guide was generated for (guide requests only)
+	Issue *models.Issue `json:"issue,omitempty"`
+
+	// LowConfidence is set when the issue has an empty body, so the answer
+	// rests on the title and code context alone
+	LowConfidence bool `json:"low_confidence,omitempty"`
+
+	// Model, PromptVersion and TokenUsage describe the LLM generation; a
+	// guide's TokenUsage covers both of its LLM calls. Unset for dry runs
+	// and when the LLM client does not report them.
+	Model         string             `json:"model,omitempty"`
+	PromptVersion string             `json:"prompt_version,omitempty"`
+	TokenUsage    *models.TokenUsage `json:"token_usage,omitempty"`
 }
 
 type Source struct {
@@ -56,29 +202,234 @@ type Source struct {
 	FilePath  string  `json:"file_path"`
 	Content   string  `json:"content"`
 	Relevance float64 `json:"relevance"`
+
+	// FullFile is the content of the whole file, set when the request asked
+	// for it; FullFileTruncated reports that it was cut at the size limit.
+	FullFile          string `json:"full_file,omitempty"`
+	FullFileTruncated bool   `json:"full_file_truncated,omitempty"`
+}
+
+// limitSources records the number of sources in TotalSources and keeps the
+// first n, or none when the request asked to leave them out.
+func (r *RAGResponse) limitSources(req RAGRequest) {
+	r.TotalSources = len(r.Sources)
+	if !req.WantsSources() {
+		r.Sources = nil
+		return
+	}
+	if n := req.sourceLimit(); len(r.Sources) > n {
+		r.Sources = r.Sources[:n]
+	}
 }
 
 func (s *RAGService) GenerateResponse(ctx context.Context, req RAGRequest) (*RAGResponse, error) {
+	resp, err := s.generateResponse(ctx, req, s.prompts.Current(), true)
+	if err != nil {
+		return nil, err
+	}
+	resp.limitSources(req)
+	s.attachRequestedFiles(ctx, req, resp)
+	return resp, nil
+}
+
+// attachRequestedFiles attaches the full files of the returned sources when
+// req asks for them. It runs after limitSources so only the files of sources
+// the client receives are fetched.
+func (s *RAGService) attachRequestedFiles(ctx context.Context, req RAGRequest, resp *RAGResponse) {
+	if req.IncludeFullFile && len(resp.Sources) > 0 {
+		s.attachFullFiles(ctx, resp.Sources)
+	}
+}
+
+// generateResponse answers req. With useGuide the issue's guide (cached or
+// generated) is part of the prompt; guide regeneration passes false so the
+// guide being replaced, or one half-written, never becomes its own context,
+// and only the issue itself is included.
+func (s *RAGService) generateResponse(ctx context.Context, req RAGRequest, prompts *Prompts, useGuide bool) (*RAGResponse, error) {
 	// Validate request
-	if strings.TrimSpace(req.Query) == "" {
-		return nil, fmt.Errorf("query cannot be empty")
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	// 1-5. Retrieve the most relevant code chunks
+	sources, err := s.retrieve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop weak matches so they can't mislead the answer, and merge
+	// overlapping chunks so they don't repeat
+	sources = filterSourcesByRelevance(sources, s.minRelevance)
+	sources = dedupSources(sources, s.dedupThreshold)
+
+	if len(sources) == 0 {
+		return &RAGResponse{
+			Answer:     "I couldn't find any relevant code snippets to answer your question. Please try rephrasing your question or ask about a different aspect of the codebase.",
+			Sources:    []Source{},
+			Confidence: 0.0,
+		}, nil
+	}
+
+	// 6. Get the issue details and guide
+	var guide models.Guide
+	var issueDetails string
+	var emptyBody bool
+	if issueID := req.IssueID(); issueID != "" && req.Refresh {
+		s.guideSvc.InvalidateIssue(issueID)
+	}
+	if issueID := req.IssueID(); issueID != "" && !useGuide {
+		issue, err := s.guideSvc.GetIssue(ctx, issueID)
+		if err != nil {
+			log.Printf("Warning: Failed to get issue %s: %v", issueID, err)
+		} else {
+			issueDetails = fmt.Sprintf("Title: %s\n\nDescription:\n%s", issue.Title, formatIssueBody(issue.Body, s.emptyBodyNote))
+			emptyBody = issueBodyIsEmpty(issue.Body)
+		}
+	} else if issueID != "" {
+		if req.DryRun {
+			// GetGuide would generate a missing guide with the LLM
+			guide, err = s.guideSvc.CachedGuide(ctx, issueID)
+		} else {
+			guide, err = s.guideSvc.GetGuide(ctx, issueID)
+		}
+		if err != nil {
+			log.Printf("Warning: Failed to get guide for issue %s: %v", issueID, err)
+		} else if req.Refresh {
+			// The guide's copy of the issue may be stale; use the refetched one
+			if issue, err := s.guideSvc.GetIssue(ctx, issueID); err != nil {
+				log.Printf("Warning: Failed to get issue %s: %v", issueID, err)
+			} else {
+				issueDetails = fmt.Sprintf("Title: %s\n\nDescription:\n%s", issue.Title, formatIssueBody(issue.Body, s.emptyBodyNote))
+				emptyBody = issueBodyIsEmpty(issue.Body)
+			}
+		} else if guide.Issue.Title != "" {
+			// Use cached issue details; an empty body gets a note from formatIssueBody
+			issueDetails = fmt.Sprintf("Title: %s\n\nDescription:\n%s", guide.Issue.Title, formatIssueBody(guide.Issue.Body, s.emptyBodyNote))
+			emptyBody = issueBodyIsEmpty(guide.Issue.Body)
+		} else {
+			// The guide is missing issue details; fetch them from GitHub
+			log.Printf("Guide is missing issue details. Fetching from GitHub API...")
+			if issue, err := s.guideSvc.GetIssue(ctx, issueID); err != nil {
+				log.Printf("Warning: Failed to get issue %s: %v", issueID, err)
+			} else {
+				issueDetails = fmt.Sprintf("Title: %s\n\nDescription:\n%s", issue.Title, formatIssueBody(issue.Body, s.emptyBodyNote))
+				emptyBody = issueBodyIsEmpty(issue.Body)
+			}
+		}
+	}
+
+	// 7. Generate answer using Vertex AI with enhanced prompt
+	prompt := fmt.Sprintf(prompts.RAG,
+		issueDetails, // Formatted issue details
+		guide.Answer, // Guide content
+		formatSources(sources),
+		req.Query) // User's question
+
+	if req.DryRun {
+		return &RAGResponse{
+			Sources:       sources,
+			Confidence:    sources[0].Relevance,
+			Prompt:        prompt,
+			LowConfidence: emptyBody,
+		}, nil
+	}
+
+	gen, err := generateMetered(ctx, s.llm, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+
+	return &RAGResponse{
+		Answer:        sanitizeMarkdown(normalizeGuideFormatting(gen.Text)),
+		Sources:       sources,
+		Confidence:    sources[0].Relevance,
+		LowConfidence: emptyBody,
+		Model:         gen.Model,
+		PromptVersion: prompts.Version,
+		TokenUsage:    gen.Usage,
+	}, nil
+}
+
+// Retrieve runs only the embedding and vector-search steps of GenerateResponse
+// and returns the matched sources with their scores, without calling the LLM.
+func (s *RAGService) Retrieve(ctx context.Context, req RAGRequest) ([]Source, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
 	}
+	sources, err := s.retrieve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.IncludeFullFile {
+		s.attachFullFiles(ctx, sources)
+	}
+	return sources, nil
+}
+
+// attachFullFiles fetches the file of every source concurrently and sets
+// FullFile, cut to fullFileMaxBytes. A file that can't be fetched is logged
+// and left out; the chunk content is still returned.
+func (s *RAGService) attachFullFiles(ctx context.Context, sources []Source) {
+	if s.codeSvc == nil {
+		log.Printf("[RAG] Full file content requested but no code service is configured")
+		return
+	}
+	files := make(map[string]string) // repo ID and path -> content, fetched once per file
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		key := src.RepoID + "\x00" + src.FilePath
+		mu.Lock()
+		_, seen := files[key]
+		files[key] = ""
+		mu.Unlock()
+		if seen {
+			continue
+		}
+		wg.Add(1)
+		go func(repoID, filePath, key string) {
+			defer wg.Done()
+			content, err := s.codeSvc.GetFileContent(ctx, repoID, filePath, "")
+			if err != nil {
+				log.Printf("[RAG] Could not fetch full file %s for source: %v", filePath, err)
+				return
+			}
+			mu.Lock()
+			files[key] = content
+			mu.Unlock()
+		}(src.RepoID, src.FilePath, key)
+	}
+	wg.Wait()
+
+	for i := range sources {
+		content := files[sources[i].RepoID+"\x00"+sources[i].FilePath]
+		if s.fullFileMaxBytes > 0 && len(content) > s.fullFileMaxBytes {
+			content = strings.ToValidUTF8(content[:s.fullFileMaxBytes], "")
+			sources[i].FullFileTruncated = true
+		}
+		sources[i].FullFile = content
+	}
+}
 
+// retrieve embeds the query and returns the top code chunks for the request's
+// repository, ordered by descending vector-search score.
+func (s *RAGService) retrieve(ctx context.Context, req RAGRequest) ([]Source, error) {
 	// 1. Get query embedding
-	queryEmbedding, err := s.embedder.Embed(req.Query)
+	queryEmbedding, err := EmbedContext(ctx, s.embedder, req.Query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to embed query: %w", err)
 	}
 
 	// 2. Build search pipeline
+	limit := req.resultLimit()
 	pipeline := mongo.Pipeline{
 		{
 			{"$vectorSearch", bson.M{
 				"index":         "vector_index",
 				"path":          "embedding",
 				"queryVector":   queryEmbedding,
-				"numCandidates": 100,
-				"limit":         5,
+				"numCandidates": limit * 20,
+				"limit":         limit,
 				"similarity":    "cosine",
 				"filter":        bson.M{"repo_id": req.RepoID},
 			}},
@@ -117,14 +468,6 @@ func (s *RAGService) GenerateResponse(ctx context.Context, req RAGRequest) (*RAG
 		return nil, fmt.Errorf("failed to decode search results: %w", err)
 	}
 
-	if len(results) == 0 {
-		return &RAGResponse{
-			Answer:     "I couldn't find any relevant code snippets to answer your question. Please try rephrasing your question or ask about a different aspect of the codebase.",
-			Sources:    []Source{},
-			Confidence: 0.0,
-		}, nil
-	}
-
 	// 5. Format sources
 	sources := make([]Source, len(results))
 	for i, r := range results {
@@ -136,243 +479,115 @@ func (s *RAGService) GenerateResponse(ctx context.Context, req RAGRequest) (*RAG
 		}
 	}
 
-	// 6. Get the issue details and guide
-	var guide models.Guide
-	var issueDetails string
-	if req.IssueNumber != "" {
-		issueID := req.RepoID + "#" + req.IssueNumber
-		guide, err = s.guideSvc.GetGuide(ctx, issueID)
-		if err != nil {
-			log.Printf("Warning: Failed to get guide for issue %s: %v", issueID, err)
-		} else if guide.Issue.Title != "" && guide.Issue.Body != "" {
-			// Use cached issue details
-			issueDetails = fmt.Sprintf("Title: %s\n\nDescription:\n%s", guide.Issue.Title, guide.Issue.Body)
-		} else {
-			// Fallback to GitHub API
-			log.Printf("Guide is missing issue details. Fetching from GitHub API...")
-			url := fmt.Sprintf("https://api.github.com/repos/%s/issues/%s", req.RepoID, req.IssueNumber)
-			reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-			defer cancel()
-
-			type ghIssue struct {
-				Title string `json:"title"`
-				Body  string `json:"body"`
-			}
-
-			httpReq, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
-			if err != nil {
-				log.Printf("Failed to create GitHub request: %v", err)
-			} else {
-				httpReq.Header.Set("Accept", "application/vnd.github+json")
-				client := &http.Client{}
-				resp, err := client.Do(httpReq)
-				if err != nil {
-					log.Printf("Failed to fetch GitHub issue: %v", err)
-				} else {
-					defer resp.Body.Close()
-					var gh ghIssue
-					if err := json.NewDecoder(resp.Body).Decode(&gh); err != nil {
-						log.Printf("Failed to decode GitHub issue response: %v", err)
-					} else {
-						issueDetails = fmt.Sprintf("Title: %s\n\nDescription:\n%s", gh.Title, gh.Body)
-					}
-				}
-			}
-		}
-	}
-
-	// 7. Generate answer using Vertex AI with enhanced prompt
-	prompt := fmt.Sprintf(`You are an AI assistant helping a developer understand and work on a GitHub issue. Use the following context to answer the user's question:
-
-Issue Details:
-%s
-
-First-Time Contributor Guide:
-%s
-
-Relevant Code Snippets:
-%s
-
-User's Question: %s
-
-Please provide a clear and helpful answer that:
-1. Directly addresses the user's question
-2. References specific parts of the code when relevant
-3. Uses markdown links in the format [filename](filepath) when referencing files
-• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using `+"`...`"+` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
-4. Maintains a professional and technical tone
-5. Focuses on helping the user understand and solve the issue
-6. Remember that most if not all questions have the goal or the need of solving the issue.  IMPORTANT!
-
-IMPORTANT NOTE: 
-You will always be given code snippets. Sometimes the users response will not require new snippets, and you will not have to use them in your response. 
-Sometimes they will ask about the snippets in the first-time contributor guide which you will have to respond to. 
-
-Formatting Rules
-• Use level 2 headers (##) for top-level sections.
-• Use level 3 headers (###) for optional sub-sections if needed.
-• Use bullet points or numbered steps for procedures.
-• Use fenced code blocks(%[1]s) for code snippets.
-• Use markdown links for file references: [filename](filepath)
-• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using `+"`...`"+` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
-• Do not use conventional number a number should be followed by ) in a numbered list, such as 1) 2) 3)
-• **All bullets and numbered steps must place their description on the same line**. Example: 1) Run the test not 1)\nRun the tests. Make sure no formatting glitch causes this to happen.
-• You must not break to a new line after 1) or •. The description must follow immediately on the same line. 
-• If a break after a numbered step or a bullet is done then the output is considered invalid. 
-
-Failure to follow any rules will deem the response invalid. 
-
-Your response should be in markdown format and should not include any meta-commentary or disclaimers.`,
-		issueDetails, // Formatted issue details
-		guide.Answer, // Guide content
-		formatSources(sources),
-		req.Query) // User's question
+	return sources, nil
+}
 
-	answer, err := s.llm.GenerateResponse(ctx, prompt)
+// GenerateGuide returns the cached guide for the request's issue or generates
+// one, returning at most the request's max_sources sources.
+func (s *RAGService) GenerateGuide(ctx context.Context, req RAGRequest) (*RAGResponse, error) {
+	resp, err := s.generateGuide(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
+		return nil, err
 	}
-
-	return &RAGResponse{
-		Answer:     answer,
-		Sources:    sources,
-		Confidence: results[0].Score,
-	}, nil
+	resp.limitSources(req)
+	s.attachRequestedFiles(ctx, req, resp)
+	return resp, nil
 }
 
-func (s *RAGService) GenerateGuide(ctx context.Context, req RAGRequest) (*RAGResponse, error) {
+func (s *RAGService) generateGuide(ctx context.Context, req RAGRequest) (*RAGResponse, error) {
 	log.Printf("[Guide Generation] Starting guide generation for repo: %s, issue: %s", req.RepoID, req.IssueNumber)
 
 	// Validate required fields
 	if req.IssueNumber == "" {
 		log.Printf("[Guide Generation] Missing issue number in request")
-		return nil, fmt.Errorf("issue number is required")
+		return nil, fmt.Errorf("%w: issue number is required", ErrInvalidRAGRequest)
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
 	}
+	prompts := s.prompts.Current()
 
-	// Check cache first
-	issueID := req.RepoID + "#" + req.IssueNumber
-	guide, err := s.guideSvc.GetGuide(ctx, issueID)
-	if err == nil && guide.ID != "" {
+	// A dry run skips the cache and both LLM calls and returns the guide prompt
+	if req.DryRun {
+		sources, err := s.retrieve(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate guide: %w", err)
+		}
+		sources = filterSourcesByRelevance(sources, s.minRelevance)
+		sources = dedupSources(sources, s.dedupThreshold)
+		resp := &RAGResponse{
+			Sources: sources,
+			Prompt:  buildGuidePrompt(prompts.Guide, req.Query, sources),
+		}
+		if len(sources) > 0 {
+			resp.Confidence = sources[0].Relevance
+		}
+		return resp, nil
+	}
+
+	// Check cache first, unless refreshing. CachedGuide, unlike GetGuide,
+	// doesn't generate on a miss, so the guide below is built from this
+	// request's sources.
+	issueID := req.IssueID()
+	if req.Refresh {
+		log.Printf("[Guide Generation] Refreshing guide for issue: %s", issueID)
+	} else if guide, err := s.guideSvc.CachedGuide(ctx, issueID); err == nil && guide.ID != "" {
 		log.Printf("[Guide Generation] Found cached guide for issue: %s", issueID)
 		return &RAGResponse{
-			Guide: guide.Answer,
+			Guide:         guide.Answer,
+			Issue:         &guide.Issue,
+			LowConfidence: guide.LowConfidence,
+			Model:         guide.Model,
+			PromptVersion: guide.PromptVersion,
+			TokenUsage:    guide.TokenUsage,
 		}, nil
+	} else {
+		log.Printf("[Guide Generation] No cached guide found, generating new guide for issue: %s", issueID)
 	}
-	log.Printf("[Guide Generation] No cached guide found, generating new guide for issue: %s", issueID)
 
 	// Generate new guide using RAG
-	resp, err := s.GenerateResponse(ctx, req)
+	resp, err := s.generateResponse(ctx, req, prompts, false)
 	if err != nil {
 		log.Printf("[Guide Generation] Error generating initial response: %v", err)
 		return nil, fmt.Errorf("failed to generate guide: %w", err)
 	}
 	log.Printf("[Guide Generation] Successfully generated initial response")
 
-	// Update the prompt to generate a guide
-	guidePrompt := fmt.Sprintf(`
-
-IMPORTANT: When generating the guide below:
-- DO NOT put the content of any step on a new line after 1), 2), etc.
-- Do NOT format numbered steps or bullets with * or ** or other characters that cause indentation or list parsing.
-- DO NOT indent or break lines between the number and the description.
-- Every bullet point or step must stay on the SAME line as its description. If you break after 1), your output will be considered INVALID. Now follow the instructions below:
-
-You are generating a first-time contributor guide for a GitHub issue using retrieval-augmented context. You will be given:
-• A GitHub issue describing a bug or feature request.
-• A list of relevant files extracted from the codebase.
-
-Write a clear, actionable, and beginner-friendly guide to help a developer confidently address this specific issue—even if it's their first time in the repository.
-
-⸻
-
-Output Requirements
-• Write in pure Markdown. Do not wrap the entire guide in %s or any fenced code block.
-• The guide must focus only on solving the issue described—not on general contribution practices.
-• Tone should be clear, direct, and confidence-building.
-• Avoid conversational or overly friendly language.
-• Do not include PR submission instructions.
-• Keep total length between 400–700 words.
-• Use 2 to 3 code snippets (in fenced code blocks using triple backticks, not indented).
-• When referencing files, use markdown links in the format [filename](filepath). For example, if you want to reference a file at src/main.go, write it as [main.go](src/main.go).
-• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using `+"`...`"+` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
-
-⸻
-
-Formatting Rules
-• Use level 2 headers (##) for top-level sections.
-• Use level 3 headers (###) for optional sub-sections if needed.
-• Use bullet points or numbered steps for procedures.
-• Use fenced code blocks (%[1]s) for code snippets.
-• Use markdown links for file references: [filename](filepath)
-• If a file path has more than 6 segments (e.g., a/b/c/d/e/f/g), truncate the middle using `+"`...`"+` like a/b/c/.../e/f/g for display, but keep the full filepath in the markdown link.
-• Do not use convential number a number should be followed by ) in a numbered list, such as 1) 2) 3)
-• **All bullets and numbered steps must place their description on the same line**. Example: 1) Run the test not 1)\nRun the tests. Make sure no formatting glitch causes this to happen.
-• You must not break to a new line after 1) or •. The description must follow immediately on the same line. 
-• If a break after a numbered step or a bullet is done then the output is considered invalid. 
-
-⸻
-
-Required Section Structure
-
-Use the following exact headers and order (do not add or rename):
-
-## Purpose of This Contribution
-
-Clearly explain what this contribution aims to fix, improve, or introduce in direct relation to the GitHub issue. Frame it in terms of developer clarity, performance, maintainability, or correctness.
-
-## Context
-
-Summarize the relevant background from the issue—prior behavior, technical gaps, or what problem the current implementation poses.
-
-## Files to Review
-
-For each file provided (make sure you include each source provided), use markdown links to reference them. it should always be the full filename and full filepath never cut them down. Always break a line between the repo link and its description.
-
-> [filename](filepath)
-
-Explain what the file does in the context of the project. Describe how it relates to the issue or implementation. Mention important functions, components, or logic to focus on.
-
-Do not use bullet points or numbers to list the file paths. Only use block quotes for the path and unformatted text underneath for its description. This is achieved by making sure there is a blank next line between the two. 
+	guidePrompt := buildGuidePrompt(prompts.Guide, req.Query, resp.Sources)
 
-## How to Fix
-• Outline where and how to make the required changes.
-• Reference specific file paths using markdown links, it should always be the full filename and full filepath never cut them down: [filename](filepath). 
-• Use bullet points or numbered steps.
-• Assume beginner familiarity with the codebase.
-
-## How to Test
-• Describe how to verify the changes are working correctly.
-• Include any commands, scripts, or test steps.
-• Mention what successful behavior looks like.
-
-## Example
-
-(Optional) Include 1–2 relevant code snippets, logs, or output examples showing the fix in action or an expected result.
-
-## Notes
-• List any extra considerations like edge cases, performance implications, or future improvements.
-• If applicable, include known limitations or tradeoffs.
-
-GitHub Issue: %[2]s
-
-Relevant Files:
-%[3]s
-
-Write a guide that helps a junior developer contribute confidently without prior repo experience.`,
-		"```markdown, do not wrap the code in ```. If you do either, your answer is invalid.", req.Query, formatSources(resp.Sources))
-
-	guideContent, err := s.llm.GenerateResponse(ctx, guidePrompt)
+	gen, err := generateMetered(ctx, s.llm, guidePrompt)
 	if err != nil {
 		log.Printf("[Guide Generation] Error generating guide content: %v", err)
 		return nil, fmt.Errorf("failed to generate guide: %w", err)
 	}
 	log.Printf("[Guide Generation] Successfully generated guide content")
+	guideContent := sanitizeMarkdown(normalizeGuideFormatting(stripMarkdownFence(gen.Text)))
+
+	// The guide's cost includes the answer generated to retrieve its sources
+	usage := resp.TokenUsage
+	if gen.Usage != nil {
+		usage = usage.Add(*gen.Usage)
+	}
+
+	// Attach the issue so cached guides carry its title, body and URL
+	issue, err := s.guideSvc.GetIssue(ctx, issueID)
+	if err != nil {
+		log.Printf("[Guide Generation] Failed to fetch issue %s: %v", issueID, err)
+	}
 
 	// Create a guide model and cache it
 	guideModel := models.Guide{
-		ID:        issueID,
-		Answer:    guideContent,
-		CreatedAt: time.Now(),
+		ID:            issueID,
+		Issue:         issue,
+		Answer:        guideContent,
+		State:         issue.State,
+		CreatedAt:     time.Now(),
+		LowConfidence: resp.LowConfidence,
+		Model:         gen.Model,
+		PromptVersion: prompts.Version,
+		TokenUsage:    usage,
+		Sources:       guideSources(resp.Sources),
+		Prompt:        guidePrompt,
 	}
 
 	// Cache the guide in MongoDB
@@ -384,13 +599,58 @@ Write a guide that helps a junior developer contribute confidently without prior
 	}
 
 	return &RAGResponse{
-		Answer:     resp.Answer,
-		Sources:    resp.Sources,
-		Confidence: resp.Confidence,
-		Guide:      guideContent,
+		Answer:        resp.Answer,
+		Sources:       resp.Sources,
+		Confidence:    resp.Confidence,
+		Guide:         guideContent,
+		Issue:         &guideModel.Issue,
+		LowConfidence: guideModel.LowConfidence,
+		Model:         guideModel.Model,
+		PromptVersion: guideModel.PromptVersion,
+		TokenUsage:    guideModel.TokenUsage,
 	}, nil
 }
 
+// guideSources converts the sources a guide prompt was built from for storage
+// with the guide.
+func guideSources(sources []Source) []models.GuideSource {
+	stored := make([]models.GuideSource, len(sources))
+	for i, src := range sources {
+		stored[i] = models.GuideSource{
+			RepoID:    src.RepoID,
+			FilePath:  src.FilePath,
+			Content:   src.Content,
+			Relevance: src.Relevance,
+		}
+	}
+	return stored
+}
+
+// buildGuidePrompt assembles the contributor-guide prompt for an issue and the
+// code sources retrieved for it from format (see guidePromptFormat).
+func buildGuidePrompt(format, query string, sources []Source) string {
+	return fmt.Sprintf(format,
+		"```markdown, do not wrap the code in ```. If you do either, your answer is invalid.", query, formatSources(sources))
+}
+
+// filterSourcesByRelevance returns the sources whose relevance is at least
+// minRelevance. A non-positive threshold keeps every source.
+func filterSourcesByRelevance(sources []Source, minRelevance float64) []Source {
+	if minRelevance <= 0 {
+		return sources
+	}
+	kept := make([]Source, 0, len(sources))
+	for _, src := range sources {
+		if src.Relevance >= minRelevance {
+			kept = append(kept, src)
+		}
+	}
+	if dropped := len(sources) - len(kept); dropped > 0 {
+		log.Printf("Dropped %d of %d sources below relevance %.4f", dropped, len(sources), minRelevance)
+	}
+	return kept
+}
+
 func formatSources(sources []Source) string {
 	var sb strings.Builder
 	for _, s := range sources {
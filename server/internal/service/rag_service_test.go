@@ -0,0 +1,690 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// stubEmbedder returns vec for every text and records what it embedded.
+type stubEmbedder struct {
+	vec   []float32
+	err   error
+	mu    sync.Mutex
+	texts []string
+}
+
+func (e *stubEmbedder) Embed(text string) ([]float32, error) {
+	e.mu.Lock()
+	e.texts = append(e.texts, text)
+	e.mu.Unlock()
+	if e.err != nil {
+		return nil, e.err
+	}
+	if e.vec == nil {
+		return []float32{0.1, 0.2, 0.3}, nil
+	}
+	return e.vec, nil
+}
+
+// stubLLM answers every prompt with answer and records the prompts.
+type stubLLM struct {
+	answer  string
+	err     error
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (l *stubLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	l.mu.Lock()
+	l.prompts = append(l.prompts, prompt)
+	l.mu.Unlock()
+	return l.answer, l.err
+}
+
+func (l *stubLLM) calls() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.prompts)
+}
+
+// newMockMongo returns a mock-mode mtest.T; tests queue server replies on it
+// with AddMockResponses.
+func newMockMongo(t *testing.T) *mtest.T {
+	return mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+}
+
+// chunkCursor is the server reply to a vector search that matched chunks.
+func chunkCursor(ns string, chunks ...Source) bson.D {
+	docs := make([]bson.D, len(chunks))
+	for i, c := range chunks {
+		docs[i] = bson.D{
+			{Key: "_id", Value: c.FilePath},
+			{Key: "repo_id", Value: c.RepoID},
+			{Key: "file", Value: c.FilePath},
+			{Key: "text", Value: c.Content},
+			{Key: "score", Value: c.Relevance},
+		}
+	}
+	return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...)
+}
+
+func TestRetrieveReturnsSourcesWithoutCallingLLM(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("retrieve", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor(mt.Coll.Database().Name()+"."+mt.Coll.Name(),
+			Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9},
+			Source{RepoID: "o/r", FilePath: "b.go", Content: "func B() {}", Relevance: 0.7},
+		))
+		embedder := &stubEmbedder{}
+		llm := &stubLLM{answer: "should not be used"}
+		svc := NewRAGService(mt.Coll, mt.Coll, embedder, llm, nil, 0, "")
+
+		sources, err := svc.Retrieve(context.Background(), RAGRequest{Query: "where is A?", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("Retrieve: %v", err)
+		}
+		if len(sources) != 2 || sources[0].FilePath != "a.go" || sources[0].Relevance != 0.9 || sources[1].FilePath != "b.go" {
+			mt.Errorf("sources = %+v, want a.go (0.9) then b.go", sources)
+		}
+		if n := llm.calls(); n != 0 {
+			mt.Errorf("LLM called %d times, want 0", n)
+		}
+		if len(embedder.texts) != 1 || embedder.texts[0] != "where is A?" {
+			mt.Errorf("embedded %q, want the query", embedder.texts)
+		}
+	})
+}
+
+func TestFilterSourcesByRelevance(t *testing.T) {
+	sources := []Source{{FilePath: "a", Relevance: 0.9}, {FilePath: "b", Relevance: 0.5}, {FilePath: "c", Relevance: 0.2}}
+	tests := []struct {
+		name      string
+		threshold float64
+		want      []string
+	}{
+		{"disabled", 0, []string{"a", "b", "c"}},
+		{"partial", 0.5, []string{"a", "b"}},
+		{"all filtered", 0.95, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range filterSourcesByRelevance(sources, tt.threshold) {
+				got = append(got, s.FilePath)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateResponseDropsWeakSources(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("partial", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code",
+			Source{RepoID: "o/r", FilePath: "strong.go", Content: "strong chunk", Relevance: 0.9},
+			Source{RepoID: "o/r", FilePath: "weak.go", Content: "weak chunk", Relevance: 0.1},
+		))
+		llm := &stubLLM{answer: "answer"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, nil, 0.5, "")
+
+		resp, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if len(resp.Sources) != 1 || resp.Sources[0].FilePath != "strong.go" {
+			mt.Errorf("sources = %+v, want only strong.go", resp.Sources)
+		}
+		if llm.calls() != 1 {
+			mt.Fatalf("LLM called %d times, want 1", llm.calls())
+		}
+		if prompt := llm.prompts[0]; !strings.Contains(prompt, "strong chunk") || strings.Contains(prompt, "weak chunk") {
+			mt.Errorf("prompt should hold only the strong chunk:\n%s", prompt)
+		}
+	})
+	mt.Run("all filtered", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code",
+			Source{RepoID: "o/r", FilePath: "weak.go", Content: "weak chunk", Relevance: 0.1},
+		))
+		llm := &stubLLM{answer: "answer"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, nil, 0.5, "")
+
+		resp, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if !strings.Contains(resp.Answer, "couldn't find any relevant code snippets") || len(resp.Sources) != 0 || resp.Confidence != 0 {
+			mt.Errorf("response = %+v, want the no-relevant-snippets answer", resp)
+		}
+		if llm.calls() != 0 {
+			mt.Errorf("LLM called %d times, want 0", llm.calls())
+		}
+	})
+}
+
+func TestVectorSearchUsesMaxResults(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxResults int
+		wantLimit  int32
+	}{
+		{"default", 0, 5},
+		{"custom", 8, 8},
+		{"capped", 50, 20},
+	}
+	mt := newMockMongo(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(chunkCursor("db.code"))
+			svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, &stubLLM{}, nil, 0, "")
+
+			if _, err := svc.Retrieve(context.Background(), RAGRequest{Query: "q", RepoID: "o/r", MaxResults: tt.maxResults}); err != nil {
+				mt.Fatalf("Retrieve: %v", err)
+			}
+			search := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$vectorSearch").Document()
+			if got := search.Lookup("limit").Int32(); got != tt.wantLimit {
+				mt.Errorf("limit = %d, want %d", got, tt.wantLimit)
+			}
+			if got := search.Lookup("numCandidates").Int32(); got != tt.wantLimit*20 {
+				mt.Errorf("numCandidates = %d, want %d", got, tt.wantLimit*20)
+			}
+		})
+	}
+}
+
+func TestGenerateResponseNormalizesAnswerLists(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("answer", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "x", Relevance: 0.9}))
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, &stubLLM{answer: "1.\nOpen a.go\n2. Edit it"}, nil, 0, "")
+
+		resp, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if resp.Answer != "1) Open a.go\n2) Edit it" {
+			mt.Errorf("answer = %q, want normalized list markers", resp.Answer)
+		}
+	})
+}
+
+func TestDryRunReturnsPromptWithoutCallingLLM(t *testing.T) {
+	mt := newMockMongo(t)
+	for _, path := range []string{"answer", "guide"} {
+		mt.Run(path, func(mt *mtest.T) {
+			mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "sched.go", Content: "func schedule() {}", Relevance: 0.8}))
+			llm := &stubLLM{answer: "should not be used"}
+			svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, nil, 0, "")
+			req := RAGRequest{Query: "how are jobs scheduled?", RepoID: "o/r", DryRun: true}
+
+			var resp *RAGResponse
+			var err error
+			if path == "guide" {
+				req.IssueNumber = "12"
+				resp, err = svc.GenerateGuide(context.Background(), req)
+			} else {
+				resp, err = svc.GenerateResponse(context.Background(), req)
+			}
+			if err != nil {
+				mt.Fatalf("dry run: %v", err)
+			}
+			if !strings.Contains(resp.Prompt, "how are jobs scheduled?") || !strings.Contains(resp.Prompt, "func schedule() {}") {
+				mt.Errorf("prompt lacks the query or the source:\n%s", resp.Prompt)
+			}
+			if len(resp.Sources) != 1 || resp.Sources[0].FilePath != "sched.go" {
+				mt.Errorf("sources = %+v, want sched.go", resp.Sources)
+			}
+			if resp.Answer != "" || resp.Guide != "" {
+				mt.Errorf("dry run generated text: answer %q, guide %q", resp.Answer, resp.Guide)
+			}
+			if llm.calls() != 0 {
+				mt.Errorf("LLM called %d times, want 0", llm.calls())
+			}
+		})
+	}
+}
+
+// fakeGuides is a GuideService with an in-memory guide cache and one issue.
+type fakeGuides struct {
+	GuideService
+	issue       models.Issue
+	cached      map[string]models.Guide
+	upserted    []models.Guide
+	invalidated []string
+}
+
+func (g *fakeGuides) CachedGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	return g.cached[issueID], nil
+}
+
+func (g *fakeGuides) GetIssue(ctx context.Context, issueID string) (models.Issue, error) {
+	return g.issue, nil
+}
+
+func (g *fakeGuides) InvalidateIssue(issueID string) {
+	g.invalidated = append(g.invalidated, issueID)
+}
+
+func (g *fakeGuides) Upsert(ctx context.Context, guide models.Guide) error {
+	g.upserted = append(g.upserted, guide)
+	return nil
+}
+
+func TestGenerateGuidePopulatesIssue(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("generated", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		issue := models.Issue{Number: 12, Title: "Crash on start", Body: "It panics", HTMLURL: "https://github.com/o/r/issues/12", State: "open"}
+		guides := &fakeGuides{issue: issue}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, &stubLLM{answer: "1. Read a.go"}, guides, 0, "")
+
+		resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"})
+		if err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		if resp.Issue == nil || !reflect.DeepEqual(*resp.Issue, issue) {
+			mt.Errorf("response issue = %+v, want %+v", resp.Issue, issue)
+		}
+		if len(guides.upserted) != 1 {
+			mt.Fatalf("cached %d guides, want 1", len(guides.upserted))
+		}
+		if got := guides.upserted[0]; got.ID != "o/r#12" || !reflect.DeepEqual(got.Issue, issue) || got.State != "open" {
+			mt.Errorf("cached guide %s has issue %+v (state %q), want %+v", got.ID, got.Issue, got.State, issue)
+		}
+	})
+
+	mt.Run("cached", func(mt *mtest.T) {
+		issue := models.Issue{Number: 12, Title: "Crash on start", HTMLURL: "https://github.com/o/r/issues/12"}
+		guides := &fakeGuides{cached: map[string]models.Guide{"o/r#12": {ID: "o/r#12", Issue: issue, Answer: "1) Read a.go"}}}
+		llm := &stubLLM{}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"})
+		if err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		if resp.Guide != "1) Read a.go" || resp.Issue == nil || !reflect.DeepEqual(*resp.Issue, issue) {
+			mt.Errorf("response = %+v, want the cached guide with its issue", resp)
+		}
+		if llm.calls() != 0 {
+			mt.Errorf("LLM called %d times for a cached guide", llm.calls())
+		}
+	})
+}
+
+func TestRAGRequestIssueID(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RAGRequest
+		wantID  string
+		wantErr bool
+	}{
+		{"no issue", RAGRequest{Query: "q", RepoID: "o/r"}, "", false},
+		{"no issue needs no repo", RAGRequest{Query: "q"}, "", false},
+		{"issue", RAGRequest{Query: "q", RepoID: "o/r", IssueNumber: "12"}, "o/r#12", false},
+		{"missing query", RAGRequest{Query: "  ", RepoID: "o/r"}, "", true},
+		{"repo without owner", RAGRequest{Query: "q", RepoID: "r", IssueNumber: "12"}, "r#12", true},
+		{"repo with empty owner", RAGRequest{Query: "q", RepoID: "/r", IssueNumber: "12"}, "/r#12", true},
+		{"nested repo path", RAGRequest{Query: "q", RepoID: "o/r/x", IssueNumber: "12"}, "o/r/x#12", true},
+		{"non-numeric issue", RAGRequest{Query: "q", RepoID: "o/r", IssueNumber: "abc"}, "o/r#abc", true},
+		{"zero issue", RAGRequest{Query: "q", RepoID: "o/r", IssueNumber: "0"}, "o/r#0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.IssueID(); got != tt.wantID {
+				t.Errorf("IssueID() = %q, want %q", got, tt.wantID)
+			}
+			err := tt.req.validate()
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRAGRequest) {
+				t.Errorf("validate() = %v, want ErrInvalidRAGRequest", err)
+			}
+			if err == nil && tt.wantID != "" {
+				if _, perr := ParseIssueRef(tt.wantID); perr != nil {
+					t.Errorf("valid request built unparseable issue ID %q: %v", tt.wantID, perr)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateGuideEmptyIssueBody(t *testing.T) {
+	mt := newMockMongo(t)
+	for _, tt := range []struct {
+		name    string
+		body    string
+		wantLow bool
+	}{
+		{"empty", "", true},
+		{"unfilled template", "### Steps to reproduce\n\n### Expected behavior\n<!-- describe it -->", true},
+		{"described", "It panics on an empty config", false},
+	} {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+			guides := &fakeGuides{issue: models.Issue{Number: 12, Title: "Crash on start", Body: tt.body, State: "open"}}
+			llm := &stubLLM{answer: "1. Read a.go"}
+			svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "(no description)")
+
+			resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"})
+			if err != nil {
+				mt.Fatalf("GenerateGuide: %v", err)
+			}
+			if resp.LowConfidence != tt.wantLow {
+				mt.Errorf("LowConfidence = %v, want %v", resp.LowConfidence, tt.wantLow)
+			}
+			if len(guides.upserted) != 1 || guides.upserted[0].LowConfidence != tt.wantLow {
+				mt.Errorf("cached guides = %+v, want one with LowConfidence %v", guides.upserted, tt.wantLow)
+			}
+			// The first prompt, answering the query, carries the issue
+			if llm.calls() != 2 {
+				mt.Fatalf("LLM called %d times, want 2 (answer, then guide)", llm.calls())
+			}
+			if got := strings.Contains(llm.prompts[0], "(no description)"); got != tt.wantLow {
+				mt.Errorf("prompt has the empty-body note: %v, want %v\n%s", got, tt.wantLow, llm.prompts[0])
+			}
+		})
+	}
+}
+
+// stubFiles is a CodeService serving files by path and recording the paths
+// it was asked for.
+type stubFiles struct {
+	CodeService
+	files     map[string]string
+	mu        sync.Mutex
+	requested []string
+}
+
+func (f *stubFiles) GetFileContent(ctx context.Context, repoID, filePath, ref string) (string, error) {
+	f.mu.Lock()
+	f.requested = append(f.requested, filePath)
+	f.mu.Unlock()
+	content, ok := f.files[filePath]
+	if !ok {
+		return "", errors.New("file not found")
+	}
+	return content, nil
+}
+
+func TestGenerateResponseIncludeFullFile(t *testing.T) {
+	chunks := []Source{
+		{RepoID: "o/r", FilePath: "a.go", Content: "chunk a", Relevance: 0.9},
+		{RepoID: "o/r", FilePath: "b.go", Content: "chunk b", Relevance: 0.8},
+		{RepoID: "o/r", FilePath: "c.go", Content: "chunk c", Relevance: 0.7},
+	}
+	newService := func(mt *mtest.T, files *stubFiles) *RAGService {
+		mt.AddMockResponses(chunkCursor("db.code", chunks...))
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, &stubLLM{answer: "answer"}, nil, 0, "")
+		svc.SetFullFileSource(files, 10)
+		return svc
+	}
+	files := map[string]string{"a.go": "package a // the whole file", "b.go": "package b"}
+
+	mt := newMockMongo(t)
+	mt.Run("requested", func(mt *mtest.T) {
+		fs := &stubFiles{files: files}
+		resp, err := newService(mt, fs).GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r", MaxSources: 2, IncludeFullFile: true})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if len(resp.Sources) != 2 || resp.TotalSources != 3 {
+			mt.Fatalf("sources = %+v (total %d), want 2 of 3", resp.Sources, resp.TotalSources)
+		}
+		if got := resp.Sources[0]; got.FullFile != "package a " || !got.FullFileTruncated || got.Content != "chunk a" {
+			mt.Errorf("a.go source = %+v, want its file cut to 10 bytes alongside the chunk", got)
+		}
+		if got := resp.Sources[1]; got.FullFile != "package b" || got.FullFileTruncated {
+			mt.Errorf("b.go source = %+v, want its whole file", got)
+		}
+		if len(fs.requested) != 2 {
+			mt.Errorf("fetched %q, want only the 2 returned sources' files", fs.requested)
+		}
+	})
+	mt.Run("omitted by default", func(mt *mtest.T) {
+		fs := &stubFiles{files: files}
+		resp, err := newService(mt, fs).GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		for _, src := range resp.Sources {
+			if src.FullFile != "" {
+				mt.Errorf("%s has a full file without include_full_file", src.FilePath)
+			}
+		}
+		if len(fs.requested) != 0 {
+			mt.Errorf("fetched %q, want no file fetches", fs.requested)
+		}
+	})
+	mt.Run("sources left out", func(mt *mtest.T) {
+		fs := &stubFiles{files: files}
+		noSources := false
+		if _, err := newService(mt, fs).GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r", IncludeFullFile: true, IncludeSources: &noSources}); err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if len(fs.requested) != 0 {
+			mt.Errorf("fetched %q for a response without sources", fs.requested)
+		}
+	})
+}
+
+func TestLimitSources(t *testing.T) {
+	sources := func(n int) []Source {
+		s := make([]Source, n)
+		for i := range s {
+			s[i].FilePath = strconv.Itoa(i)
+		}
+		return s
+	}
+	off := false
+	tests := []struct {
+		name      string
+		retrieved int
+		req       RAGRequest
+		want      int
+	}{
+		{"default of 5", 8, RAGRequest{}, 5},
+		{"fewer than requested", 3, RAGRequest{MaxSources: 10}, 3},
+		{"requested count", 8, RAGRequest{MaxSources: 2}, 2},
+		{"capped at 20", 30, RAGRequest{MaxSources: 50}, 20},
+		{"sources left out", 8, RAGRequest{IncludeSources: &off}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &RAGResponse{Sources: sources(tt.retrieved)}
+			resp.limitSources(tt.req)
+			if len(resp.Sources) != tt.want || resp.TotalSources != tt.retrieved {
+				t.Errorf("kept %d of %d sources, want %d of %d", len(resp.Sources), resp.TotalSources, tt.want, tt.retrieved)
+			}
+			if tt.want > 0 && resp.Sources[0].FilePath != "0" {
+				t.Errorf("first source = %q, want the most relevant kept", resp.Sources[0].FilePath)
+			}
+		})
+	}
+}
+
+// staleGuides is a fakeGuides whose cache holds a half-written guide for every
+// issue: it has an answer but no ID, so it is not served as a cache hit.
+type staleGuides struct {
+	fakeGuides
+	getGuideCalls int
+}
+
+const staleAnswer = "1) An outdated guide"
+
+func (g *staleGuides) CachedGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	return models.Guide{Answer: staleAnswer, Issue: g.issue}, nil
+}
+
+func (g *staleGuides) GetGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	g.getGuideCalls++
+	return models.Guide{ID: issueID, Answer: staleAnswer, Issue: g.issue}, nil
+}
+
+func TestGenerateGuideIgnoresPriorGuideAsContext(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("regeneration", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		guides := &staleGuides{fakeGuides: fakeGuides{issue: models.Issue{Number: 12, Title: "Crash on start", Body: "It panics"}}}
+		llm := &stubLLM{answer: "1. Read a.go"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		if _, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"}); err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		if guides.getGuideCalls != 0 {
+			mt.Errorf("GetGuide called %d times while regenerating that guide", guides.getGuideCalls)
+		}
+		if len(llm.prompts) == 0 || !strings.Contains(llm.prompts[0], "Crash on start") {
+			mt.Fatalf("prompts = %q, want the issue in the first", llm.prompts)
+		}
+		for i, prompt := range llm.prompts {
+			if strings.Contains(prompt, staleAnswer) {
+				mt.Errorf("prompt %d holds the prior guide:\n%s", i, prompt)
+			}
+		}
+		if len(guides.upserted) != 1 || guides.upserted[0].Answer == staleAnswer {
+			mt.Errorf("cached %+v, want the regenerated guide", guides.upserted)
+		}
+	})
+
+	mt.Run("questions still use the guide", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		guides := &staleGuides{fakeGuides: fakeGuides{issue: models.Issue{Number: 12, Title: "Crash on start"}}}
+		llm := &stubLLM{answer: "Look at a.go"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		if _, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "where?", RepoID: "o/r", IssueNumber: "12"}); err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if guides.getGuideCalls != 1 || !strings.Contains(llm.prompts[0], staleAnswer) {
+			mt.Errorf("GetGuide called %d times, prompt:\n%s\nwant the guide as context", guides.getGuideCalls, llm.prompts[0])
+		}
+	})
+}
+
+// guideWithIssue is a fakeGuides whose GetGuide serves guide, with the copy of
+// the issue taken when it was generated.
+type guideWithIssue struct {
+	fakeGuides
+	guide models.Guide
+}
+
+func (g *guideWithIssue) GetGuide(ctx context.Context, issueID string) (models.Guide, error) {
+	return g.guide, nil
+}
+
+func TestRAGRefresh(t *testing.T) {
+	mt := newMockMongo(t)
+	edited := models.Issue{Number: 12, Title: "Crash on start", Body: "It panics at boot", State: "open"}
+	cachedGuide := models.Guide{ID: "o/r#12", Issue: models.Issue{Number: 12, Title: "Crash"}, Answer: "1) Read a.go"}
+
+	mt.Run("guide is regenerated", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		guides := &fakeGuides{issue: edited, cached: map[string]models.Guide{"o/r#12": cachedGuide}}
+		llm := &stubLLM{answer: "1. Read a.go again"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12", Refresh: true})
+		if err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		if llm.calls() == 0 || resp.Guide == cachedGuide.Answer {
+			mt.Errorf("response = %+v, want a regenerated guide", resp)
+		}
+		if len(guides.invalidated) != 1 || guides.invalidated[0] != "o/r#12" {
+			mt.Errorf("invalidated %q, want the issue", guides.invalidated)
+		}
+		if len(guides.upserted) != 1 || guides.upserted[0].Issue.Title != edited.Title {
+			mt.Errorf("cached %+v, want the guide for the edited issue", guides.upserted)
+		}
+	})
+
+	mt.Run("answer uses the refetched issue", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		guides := &guideWithIssue{fakeGuides: fakeGuides{issue: edited}, guide: cachedGuide}
+		llm := &stubLLM{answer: "Look at a.go"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		if _, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "where?", RepoID: "o/r", IssueNumber: "12", Refresh: true}); err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		prompt := llm.prompts[0]
+		if len(guides.invalidated) != 1 || !strings.Contains(prompt, "Title: Crash on start") {
+			mt.Errorf("invalidated %q, prompt:\n%s\nwant the refetched issue", guides.invalidated, prompt)
+		}
+		if !strings.Contains(prompt, cachedGuide.Answer) {
+			mt.Errorf("prompt lacks the guide:\n%s", prompt)
+		}
+	})
+
+	mt.Run("without refresh the caches are used", func(mt *mtest.T) {
+		guides := &fakeGuides{issue: edited, cached: map[string]models.Guide{"o/r#12": cachedGuide}}
+		llm := &stubLLM{}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guides, 0, "")
+
+		resp, err := svc.GenerateGuide(context.Background(), RAGRequest{Query: "crash", RepoID: "o/r", IssueNumber: "12"})
+		if err != nil {
+			mt.Fatalf("GenerateGuide: %v", err)
+		}
+		if resp.Guide != cachedGuide.Answer || llm.calls() != 0 || len(guides.invalidated) != 0 {
+			mt.Errorf("response = %+v, invalidated %q; want the cached guide", resp, guides.invalidated)
+		}
+	})
+}
+
+func TestGenerateResponseWithoutSourcesStillUsesThem(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("include_sources false", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		llm := &stubLLM{answer: "Look at a.go"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, nil, 0, "")
+
+		off := false
+		resp, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "where?", IncludeSources: &off})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if resp.Sources != nil || resp.TotalSources != 1 {
+			mt.Errorf("sources = %+v (total %d), want none returned of 1", resp.Sources, resp.TotalSources)
+		}
+		if !strings.Contains(llm.prompts[0], "func A() {}") {
+			mt.Errorf("prompt lacks the source:\n%s", llm.prompts[0])
+		}
+	})
+}
+
+func TestGenerateResponseFetchesMissingIssueFromGitHub(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("fallback", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code", Source{RepoID: "o/r", FilePath: "a.go", Content: "func A() {}", Relevance: 0.9}))
+		llm := &stubLLM{answer: "Look at a.go"}
+		guideSvc, guides, gh := newTestGuideService(t, llm)
+		// A guide cached before issue details were stored with it
+		guides.Upsert(context.Background(), models.Guide{ID: "o/r#12", Answer: "1) Read a.go"})
+		gh.setIssue("o/r/issues/12", models.Issue{Number: 12, Title: "Crash on start", Body: "It panics", State: "open"})
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, guideSvc, 0, "")
+
+		if _, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "why?", RepoID: "o/r", IssueNumber: "12"}); err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		// The fake GitHub only answers through the guide service's configured client
+		if gh.calls() != 1 {
+			mt.Errorf("configured GitHub API asked for the issue %d times, want 1", gh.calls())
+		}
+		if !strings.Contains(llm.prompts[0], "Crash on start") || !strings.Contains(llm.prompts[0], "It panics") {
+			mt.Errorf("prompt = %q, want the issue fetched from GitHub", llm.prompts[0])
+		}
+	})
+}
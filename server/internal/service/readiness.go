@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Readiness records whether the embedders and LLM have finished warming up.
+// The zero value is not ready.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+// Ready reports whether warm-up has completed.
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// MarkReady flips the gate open.
+func (r *Readiness) MarkReady() {
+	r.ready.Store(true)
+}
+
+// warmUpText is embedded once per embedder to load the models.
+const warmUpText = "warm up the embedding model"
+
+// WarmUp runs one embedding per embedder and one short LLM call so the first
+// real request doesn't pay for model loading, then marks r ready. Failures are
+// logged but still open the gate: the instance is serving either way and
+// requests will surface the error themselves.
+func WarmUp(ctx context.Context, r *Readiness, llm LLM, embedders ...Embedder) {
+	start := time.Now()
+	for i, e := range embedders {
+		if _, err := EmbedContext(ctx, e, warmUpText); err != nil {
+			log.Printf("[Warm-up] Embedder %d failed: %v", i, err)
+		}
+	}
+	if _, err := llm.GenerateResponse(ctx, "Reply with OK."); err != nil {
+		log.Printf("[Warm-up] LLM failed: %v", err)
+	}
+	r.MarkReady()
+	log.Printf("[Warm-up] Completed in %s; accepting traffic", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWarmUpMarksReady(t *testing.T) {
+	t.Run("after warming every model", func(t *testing.T) {
+		var r Readiness
+		if r.Ready() {
+			t.Fatal("Readiness is ready before warm-up")
+		}
+		meta, code := &stubEmbedder{}, &stubEmbedder{}
+		llm := &stubLLM{answer: "OK"}
+
+		WarmUp(context.Background(), &r, llm, meta, code)
+
+		if !r.Ready() {
+			t.Error("Readiness is not ready after warm-up")
+		}
+		if len(meta.texts) != 1 || len(code.texts) != 1 || llm.calls() != 1 {
+			t.Errorf("warm-up embedded %d and %d texts and called the LLM %d times, want 1 each", len(meta.texts), len(code.texts), llm.calls())
+		}
+	})
+
+	t.Run("even when a model fails", func(t *testing.T) {
+		var r Readiness
+		WarmUp(context.Background(), &r, &stubLLM{err: errors.New("quota")}, &stubEmbedder{err: errors.New("no python")})
+		if !r.Ready() {
+			t.Error("a failed warm-up left the gate closed")
+		}
+	})
+}
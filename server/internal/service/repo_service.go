@@ -2,10 +2,18 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/github"
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // ---- Return DTO ------------------------------------------------------------
@@ -16,22 +24,66 @@ type RepoSDetail struct {
 	Issues []models.Issue `json:"issues"`
 }
 
+// RepoStats pairs the counters stored in the dataset with live values from
+// GitHub. Live is nil and Stale is true when GitHub could not be reached.
+type RepoStats struct {
+	RepoID    string             `json:"repo_id"`
+	Dataset   models.RepoCounts  `json:"dataset"`
+	Live      *models.RepoCounts `json:"live,omitempty"`
+	Stale     bool               `json:"stale"`
+	FetchedAt time.Time          `json:"fetched_at"`
+}
+
+// Sections of a RepoOverview, used as keys of its Errors map.
+const (
+	OverviewRepo         = "repo"
+	OverviewIssues       = "issues"
+	OverviewLanguages    = "languages"
+	OverviewCachedGuides = "cached_guides"
+)
+
+// overviewIssues is how many open issues a RepoOverview includes.
+const overviewIssues = 20
+
+// RepoOverview is everything the repository page shows, gathered in one call.
+// A section whose source failed is left empty and its error is reported in
+// Errors under the section's name.
+type RepoOverview struct {
+	Repo         *models.Repo      `json:"repo"`
+	Issues       []models.Issue    `json:"issues"`
+	Languages    map[string]int    `json:"languages"`
+	CachedGuides []int             `json:"cached_guides"` // numbers of issues with a cached guide
+	Errors       map[string]string `json:"errors,omitempty"`
+	Partial      bool              `json:"partial"`
+}
+
 // ---- Service interface + implementation ------------------------------------
 
 // RepoService enriches repository data with live GitHub information.
 type RepoService interface {
 	GetRepo(ctx context.Context, repoID string) (RepoSDetail, error)
+	GetRepoByGitHubID(ctx context.Context, id int64) (*models.Repo, error)
 	ListRepoIssues(ctx context.Context, owner, repoName, state string, perPage int) ([]models.Issue, error)
+	ListActionableIssues(ctx context.Context, owner, repoName string, closedWithin time.Duration, perPage int) ([]models.Issue, error)
+	GetRepoLanguages(ctx context.Context, owner, repoName string) (map[string]int, error)
+	GetRepoStats(ctx context.Context, repoID string) (RepoStats, error)
+	GetRepoOverview(ctx context.Context, owner, repoName string) (RepoOverview, error)
+	ReposByLanguage(ctx context.Context, perLanguage int) ([]models.LanguageBucket, error)
+	EnsureReadme(ctx context.Context, repoID string) (string, error)
+	SearchFiles(ctx context.Context, repoID, pattern string) ([]string, error)
+	GetContextChunks(ctx context.Context, repoID string, k, offset int) ([]models.CodeChunk, error)
 }
 
 type repoService struct {
-	repoRepo RepoRepository
-	gh       *github.Client
+	repoRepo  RepoRepository
+	guideRepo GuideRepository
+	gh        *github.Client
 }
 
-// NewRepoService returns a concrete implementation.
-func NewRepoService(repoRepo RepoRepository, gh *github.Client) RepoService {
-	return &repoService{repoRepo: repoRepo, gh: gh}
+// NewRepoService returns a concrete implementation. guideRepo is consulted
+// for the cached guides listed in repository overviews.
+func NewRepoService(repoRepo RepoRepository, guideRepo GuideRepository, gh *github.Client) RepoService {
+	return &repoService{repoRepo: repoRepo, guideRepo: guideRepo, gh: gh}
 }
 
 // GetRepo fetches repository metadata from Mongo, then pulls live issues from GitHub.
@@ -63,6 +115,35 @@ func (s *repoService) GetRepo(ctx context.Context, repoID string) (RepoSDetail,
 	}, nil
 }
 
+// GetRepoByGitHubID returns the dataset metadata of the repository with the
+// given numeric GitHub ID. Datasets imported without numeric IDs are covered
+// by resolving the ID to its full name through the GitHub API. A repository
+// missing from the dataset yields ErrRepoNotFound.
+func (s *repoService) GetRepoByGitHubID(ctx context.Context, id int64) (*models.Repo, error) {
+	repoDoc, err := s.repoRepo.FindByGitHubID(ctx, id)
+	if err == nil {
+		return repoDoc, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	fullName, err := s.gh.GetRepoFullName(ctx, id)
+	if err != nil {
+		log.Printf("Could not resolve GitHub repository id %d: %v", id, err)
+		return nil, fmt.Errorf("%w: GitHub id %d", ErrRepoNotFound, id)
+	}
+	repoDoc, err = s.repoRepo.FindByID(ctx, fullName)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrRepoNotFound, fullName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	repoDoc.GitHubID = id
+	return repoDoc, nil
+}
+
 // ListRepoIssues fetches issues for a repo from GitHub.
 func (s *repoService) ListRepoIssues(ctx context.Context, owner, repoName, state string, perPage int) ([]models.Issue, error) {
 	issues, err := s.gh.ListRepoIssues(owner, repoName, state, perPage)
@@ -71,3 +152,262 @@ func (s *repoService) ListRepoIssues(ctx context.Context, owner, repoName, state
 	}
 	return issues, nil
 }
+
+// ListActionableIssues returns the repo's open issues followed by the issues
+// closed within closedWithin, each keeping its GitHub state.
+func (s *repoService) ListActionableIssues(ctx context.Context, owner, repoName string, closedWithin time.Duration, perPage int) ([]models.Issue, error) {
+	open, err := s.gh.ListRepoIssues(owner, repoName, "open", perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-closedWithin)
+	closed, err := s.gh.ListIssuesClosedSince(ctx, owner, repoName, since, perPage)
+	if err != nil {
+		return nil, err
+	}
+	return mergeActionableIssues(open, closed, since), nil
+}
+
+// mergeActionableIssues returns open followed by the issues in closed that
+// were closed at or after since, most recently closed first. An issue present
+// in both lists (reopened or closed between the two calls) is listed once,
+// as open.
+func mergeActionableIssues(open, closed []models.Issue, since time.Time) []models.Issue {
+	merged := make([]models.Issue, 0, len(open)+len(closed))
+	seen := make(map[int]bool, len(open))
+	for _, issue := range open {
+		seen[issue.Number] = true
+		merged = append(merged, issue)
+	}
+
+	var recent []models.Issue
+	for _, issue := range closed {
+		if seen[issue.Number] || issue.State != "closed" {
+			continue
+		}
+		closedAt, err := time.Parse(time.RFC3339, issue.ClosedAt)
+		if err != nil || closedAt.Before(since) {
+			continue
+		}
+		seen[issue.Number] = true
+		recent = append(recent, issue)
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].ClosedAt > recent[j].ClosedAt // RFC 3339 UTC sorts lexically
+	})
+	return append(merged, recent...)
+}
+
+// GetRepoOverview fetches the repository metadata, its first page of open
+// issues, its language stats and the issues with cached guides concurrently.
+// Sections that fail are reported in the overview's Errors rather than
+// failing the call; only a repository missing from the dataset is an error
+// (ErrRepoNotFound).
+func (s *repoService) GetRepoOverview(ctx context.Context, owner, repoName string) (RepoOverview, error) {
+	repoID := owner + "/" + repoName
+	var (
+		overview = RepoOverview{Issues: []models.Issue{}, Languages: map[string]int{}, CachedGuides: []int{}}
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+	)
+	section := func(name string, fetch func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fetch(); err != nil {
+				log.Printf("Repo overview for %s: %s failed: %v", repoID, name, err)
+				mu.Lock()
+				if overview.Errors == nil {
+					overview.Errors = map[string]string{}
+				}
+				overview.Errors[name] = err.Error()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var repoErr error
+	section(OverviewRepo, func() error {
+		repoDoc, err := s.repoRepo.FindByID(ctx, repoID)
+		mu.Lock()
+		defer mu.Unlock()
+		overview.Repo, repoErr = repoDoc, err
+		return err
+	})
+	section(OverviewIssues, func() error {
+		issues, err := s.gh.ListRepoIssues(owner, repoName, "open", overviewIssues)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		overview.Issues = issues
+		return nil
+	})
+	section(OverviewLanguages, func() error {
+		languages, err := s.gh.GetRepoLanguages(ctx, owner, repoName)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		overview.Languages = languages
+		return nil
+	})
+	section(OverviewCachedGuides, func() error {
+		ids, err := s.guideRepo.ListIDs(ctx, repoID+"#")
+		if err != nil {
+			return err
+		}
+		numbers := make([]int, 0, len(ids))
+		for _, id := range ids {
+			if ref, err := ParseIssueRef(id); err == nil {
+				numbers = append(numbers, ref.Number)
+			}
+		}
+		sort.Ints(numbers)
+		mu.Lock()
+		defer mu.Unlock()
+		overview.CachedGuides = numbers
+		return nil
+	})
+	wg.Wait()
+
+	if errors.Is(repoErr, mongo.ErrNoDocuments) {
+		return RepoOverview{}, fmt.Errorf("%w: %s", ErrRepoNotFound, repoID)
+	}
+	overview.Partial = len(overview.Errors) > 0
+	return overview, nil
+}
+
+// ReposByLanguage groups the dataset's repositories by primary language, with
+// up to perLanguage sample repositories per language.
+func (s *repoService) ReposByLanguage(ctx context.Context, perLanguage int) ([]models.LanguageBucket, error) {
+	return s.repoRepo.GroupByLanguage(ctx, perLanguage)
+}
+
+// readmeFile is the README EnsureReadme fetches.
+const readmeFile = "README.md"
+
+// EnsureReadme returns the README of repoID ("owner/name"). Ingestion often
+// left Readme empty, so a missing README is fetched from the GCS snapshot,
+// falling back to GitHub at the default branch, and cached in the dataset;
+// later calls return the cached copy.
+func (s *repoService) EnsureReadme(ctx context.Context, repoID string) (string, error) {
+	repoDoc, err := s.repoRepo.FindByID(ctx, repoID)
+	if err != nil {
+		return "", err
+	}
+	if repoDoc.Readme != "" {
+		return repoDoc.Readme, nil
+	}
+	cached, err := s.repoRepo.FindReadme(ctx, repoID)
+	if err != nil {
+		return "", err
+	}
+	if cached != "" {
+		return cached, nil
+	}
+
+	owner, name, ok := strings.Cut(repoID, "/")
+	if !ok {
+		return "", fmt.Errorf("invalid repo id: %s", repoID)
+	}
+	readme, err := s.repoRepo.GetFileContent(ctx, owner, name+"/"+readmeFile)
+	if err != nil {
+		log.Printf("README of %s not in snapshot, fetching from GitHub: %v", repoID, err)
+		readme, err = s.gh.GetFileContent(ctx, owner, name, readmeFile, repoDoc.DefaultBranch)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch README of %s: %w", repoID, err)
+		}
+	}
+
+	if err := s.repoRepo.SetReadme(ctx, repoID, readme); err != nil {
+		// Still usable; the next call fetches it again
+		log.Printf("Failed to cache README of %s: %v", repoID, err)
+	}
+	return readme, nil
+}
+
+// GetRepoLanguages fetches the per-language byte counts for a repo from GitHub.
+func (s *repoService) GetRepoLanguages(ctx context.Context, owner, repoName string) (map[string]int, error) {
+	return s.gh.GetRepoLanguages(ctx, owner, repoName)
+}
+
+// GetRepoStats returns the dataset counters for a repo alongside live ones from
+// GitHub, falling back to dataset-only (flagged stale) if GitHub fails. A repo
+// missing from the dataset yields ErrRepoNotFound.
+func (s *repoService) GetRepoStats(ctx context.Context, repoID string) (RepoStats, error) {
+	repoDoc, err := s.repoRepo.FindByID(ctx, repoID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return RepoStats{}, fmt.Errorf("%w: %s", ErrRepoNotFound, repoID)
+	}
+	if err != nil {
+		return RepoStats{}, err
+	}
+
+	stats := RepoStats{
+		RepoID: repoID,
+		Dataset: models.RepoCounts{
+			StargazersCount: repoDoc.StargazersCount,
+			ForksCount:      repoDoc.ForksCount,
+			OpenIssuesCount: repoDoc.OpenIssuesCount,
+			WatchersCount:   repoDoc.WatchersCount,
+		},
+		Stale:     true,
+		FetchedAt: time.Now(),
+	}
+
+	owner, name, _ := strings.Cut(repoID, "/")
+	live, err := s.gh.GetRepo(ctx, owner, name)
+	if err != nil {
+		// Non-fatal: dataset counters are still useful, just possibly outdated.
+		log.Printf("Warning: could not fetch live stats for %s: %v", repoID, err)
+		return stats, nil
+	}
+	stats.Live = &live
+	stats.Stale = false
+	return stats, nil
+}
+
+// SearchFiles returns the repository's file paths that match pattern. A
+// pattern containing *, ? or [ is a glob matched against the full path or the
+// file name; anything else is a case-insensitive substring of the path.
+func (s *repoService) SearchFiles(ctx context.Context, repoID, pattern string) ([]string, error) {
+	files, err := s.repoRepo.ListFiles(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []string{}
+	for _, f := range files {
+		if matchFilePath(f, pattern) {
+			matches = append(matches, f)
+		}
+	}
+	return matches, nil
+}
+
+// GetContextChunks returns the k chunks the guide generator uses as context
+// for repoID after skipping offset, highest score first.
+func (s *repoService) GetContextChunks(ctx context.Context, repoID string, k, offset int) ([]models.CodeChunk, error) {
+	repoDoc, err := s.repoRepo.FindByID(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repoRepo.GetTopContextChunks(ctx, repoDoc.ID, k, offset)
+}
+
+// matchFilePath reports whether filePath matches pattern as described on
+// SearchFiles.
+func matchFilePath(filePath, pattern string) bool {
+	if strings.ContainsAny(pattern, "*?[") {
+		if ok, _ := path.Match(pattern, filePath); ok {
+			return true
+		}
+		ok, _ := path.Match(pattern, path.Base(filePath))
+		return ok
+	}
+	return strings.Contains(strings.ToLower(filePath), strings.ToLower(pattern))
+}
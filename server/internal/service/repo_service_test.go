@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/github"
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newGitHubStub starts a server running handler and returns a client for it.
+func newGitHubStub(t *testing.T, handler http.HandlerFunc) *github.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return github.NewClientWithBaseURL("", srv.URL)
+}
+
+// statsRepoRepo holds one dataset repo, o/r, with stale counters.
+func statsRepoRepo() *stubRepoRepo {
+	return &stubRepoRepo{repos: map[string]*models.Repo{
+		"o/r": {ID: "o/r", FullName: "o/r", StargazersCount: 100, ForksCount: 10, OpenIssuesCount: 3, WatchersCount: 100},
+	}}
+}
+
+func TestGetRepoStatsMergesLiveCounts(t *testing.T) {
+	gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"stargazers_count": 23400, "forks_count": 1200, "open_issues_count": 42, "watchers_count": 23400}`))
+	})
+	svc := NewRepoService(statsRepoRepo(), nil, gh)
+
+	stats, err := svc.GetRepoStats(context.Background(), "o/r")
+	if err != nil {
+		t.Fatalf("GetRepoStats: %v", err)
+	}
+	if stats.Dataset.StargazersCount != 100 || stats.Dataset.OpenIssuesCount != 3 {
+		t.Errorf("dataset counts = %+v, want the stored ones", stats.Dataset)
+	}
+	if stats.Live == nil || stats.Live.StargazersCount != 23400 || stats.Live.OpenIssuesCount != 42 {
+		t.Errorf("live counts = %+v, want GitHub's", stats.Live)
+	}
+	if stats.Stale {
+		t.Error("stats flagged stale although GitHub answered")
+	}
+}
+
+func TestGetRepoStatsFallsBackToDataset(t *testing.T) {
+	gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	})
+	svc := NewRepoService(statsRepoRepo(), nil, gh)
+
+	stats, err := svc.GetRepoStats(context.Background(), "o/r")
+	if err != nil {
+		t.Fatalf("GetRepoStats: %v", err)
+	}
+	if stats.Live != nil || !stats.Stale {
+		t.Errorf("stats = %+v, want dataset-only and stale", stats)
+	}
+	if stats.Dataset.StargazersCount != 100 {
+		t.Errorf("dataset counts = %+v, want the stored ones", stats.Dataset)
+	}
+}
+
+func TestGetRepoStatsMissingRepo(t *testing.T) {
+	gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("GitHub called for a repo missing from the dataset: %s", r.URL.Path)
+	})
+	svc := NewRepoService(statsRepoRepo(), nil, gh)
+
+	if _, err := svc.GetRepoStats(context.Background(), "o/missing"); !errors.Is(err, ErrRepoNotFound) {
+		t.Errorf("err = %v, want ErrRepoNotFound", err)
+	}
+}
+
+func TestMatchFilePath(t *testing.T) {
+	tests := []struct {
+		path, pattern string
+		want          bool
+	}{
+		{"internal/router/router.go", "router", true},
+		{"internal/router/router.go", "ROUTER", true}, // substring is case-insensitive
+		{"internal/router/router.go", "handler", false},
+		{"cmd/server/main.go", "server/main", true},
+		{"internal/router/router.go", "*.go", true},            // glob on the file name
+		{"internal/router/router.go", "internal/*/*.go", true}, // glob on the full path
+		{"internal/router/router.go", "*.ts", false},
+		{"internal/router/router_test.go", "router_?est.go", true},
+		{"web/App.tsx", "[A-Z]*.tsx", true},
+		{"web/index.tsx", "[A-Z]*.tsx", false},
+	}
+	for _, tt := range tests {
+		if got := matchFilePath(tt.path, tt.pattern); got != tt.want {
+			t.Errorf("matchFilePath(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// filesRepoRepo lists files for every repo.
+type filesRepoRepo struct {
+	RepoRepository
+	files []string
+}
+
+func (r *filesRepoRepo) ListFiles(ctx context.Context, repoID string) ([]string, error) {
+	return r.files, nil
+}
+
+func TestSearchFiles(t *testing.T) {
+	repos := &filesRepoRepo{files: []string{"README.md", "internal/router/router.go", "internal/router/router_test.go", "web/router.ts"}}
+	svc := NewRepoService(repos, nil, nil)
+
+	got, err := svc.SearchFiles(context.Background(), "o/r", "router*.go")
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	if strings.Join(got, ",") != "internal/router/router.go,internal/router/router_test.go" {
+		t.Errorf("matches = %q, want the two Go router files", got)
+	}
+
+	got, err = svc.SearchFiles(context.Background(), "o/r", "nothing")
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("matches = %#v, want an empty, non-nil list", got)
+	}
+}
+
+func TestMergeActionableIssues(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	open := []models.Issue{
+		{Number: 1, State: "open"},
+		{Number: 2, State: "open"},
+	}
+	closed := []models.Issue{
+		{Number: 3, State: "closed", ClosedAt: "2026-10-02T00:00:00Z"},
+		{Number: 4, State: "closed", ClosedAt: "2026-09-20T00:00:00Z"}, // before since
+		{Number: 2, State: "closed", ClosedAt: "2026-10-05T00:00:00Z"}, // reopened since
+		{Number: 5, State: "closed", ClosedAt: "2026-10-09T00:00:00Z"},
+		{Number: 6, State: "open"},                        // updated, not closed
+		{Number: 7, State: "closed", ClosedAt: "garbage"}, // unparseable
+	}
+
+	got := mergeActionableIssues(open, closed, since)
+	var numbers, states []string
+	for _, issue := range got {
+		numbers = append(numbers, strconv.Itoa(issue.Number))
+		states = append(states, issue.State)
+	}
+	if want := "1,2,5,3"; strings.Join(numbers, ",") != want {
+		t.Errorf("issues = %s, want %s (open first, then most recently closed)", strings.Join(numbers, ","), want)
+	}
+	if want := "open,open,closed,closed"; strings.Join(states, ",") != want {
+		t.Errorf("states = %s, want %s", strings.Join(states, ","), want)
+	}
+}
+
+func TestMergeActionableIssuesEmpty(t *testing.T) {
+	if got := mergeActionableIssues(nil, nil, time.Now()); got == nil || len(got) != 0 {
+		t.Errorf("merge of nothing = %#v, want an empty, non-nil list", got)
+	}
+}
+
+// githubIDRepoRepo is a stubRepoRepo that also finds repos by numeric
+// GitHub ID, when the dataset recorded one.
+type githubIDRepoRepo struct {
+	*stubRepoRepo
+}
+
+func (r githubIDRepoRepo) FindByGitHubID(ctx context.Context, id int64) (*models.Repo, error) {
+	for _, repo := range r.repos {
+		if repo.GitHubID == id {
+			return repo, nil
+		}
+	}
+	return nil, fmt.Errorf("repository with GitHub id %d not found: %w", id, mongo.ErrNoDocuments)
+}
+
+func TestGetRepoByGitHubID(t *testing.T) {
+	repos := githubIDRepoRepo{&stubRepoRepo{repos: map[string]*models.Repo{
+		"o/stored":   {ID: "o/stored", FullName: "o/stored", GitHubID: 100},
+		"o/unstored": {ID: "o/unstored", FullName: "o/unstored"}, // imported without a numeric ID
+	}}}
+	var ghPaths []string
+	gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		ghPaths = append(ghPaths, r.URL.Path)
+		switch r.URL.Path {
+		case "/repositories/200":
+			w.Write([]byte(`{"full_name": "o/unstored"}`))
+		case "/repositories/300":
+			w.Write([]byte(`{"full_name": "o/elsewhere"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	svc := NewRepoService(repos, nil, gh)
+
+	t.Run("stored id", func(t *testing.T) {
+		ghPaths = nil
+		repo, err := svc.GetRepoByGitHubID(context.Background(), 100)
+		if err != nil || repo.FullName != "o/stored" {
+			t.Fatalf("GetRepoByGitHubID = %+v, %v; want o/stored", repo, err)
+		}
+		if len(ghPaths) != 0 {
+			t.Errorf("GitHub called for a stored id: %q", ghPaths)
+		}
+	})
+	t.Run("resolved through GitHub", func(t *testing.T) {
+		repo, err := svc.GetRepoByGitHubID(context.Background(), 200)
+		if err != nil {
+			t.Fatalf("GetRepoByGitHubID: %v", err)
+		}
+		if repo.FullName != "o/unstored" || repo.GitHubID != 200 {
+			t.Errorf("repo = %+v, want o/unstored with GitHub id 200", repo)
+		}
+	})
+	for _, id := range []int64{300, 400} { // not in the dataset; unknown to GitHub
+		if _, err := svc.GetRepoByGitHubID(context.Background(), id); !errors.Is(err, ErrRepoNotFound) {
+			t.Errorf("id %d: err = %v, want ErrRepoNotFound", id, err)
+		}
+	}
+}
+
+// overviewGitHub serves o/r's open issues and, unless languagesDown, its
+// languages.
+func overviewGitHub(t *testing.T, languagesDown bool) *github.Client {
+	return newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/issues":
+			w.Write([]byte(`[{"number": 7, "title": "Crash", "state": "open"}, {"number": 3, "title": "Docs", "state": "open"}]`))
+		case "/repos/o/r/languages":
+			if languagesDown {
+				http.Error(w, "unavailable", http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"Go": 9000, "Shell": 100}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func overviewGuides() *memGuideRepo {
+	guides := newMemGuideRepo()
+	for _, id := range []string{"o/r#7", "o/r#3", "o/other#1"} {
+		guides.guides[id] = models.Guide{ID: id}
+	}
+	return guides
+}
+
+func TestGetRepoOverview(t *testing.T) {
+	svc := NewRepoService(statsRepoRepo(), overviewGuides(), overviewGitHub(t, false))
+
+	overview, err := svc.GetRepoOverview(context.Background(), "o", "r")
+	if err != nil {
+		t.Fatalf("GetRepoOverview: %v", err)
+	}
+	if overview.Repo == nil || overview.Repo.FullName != "o/r" {
+		t.Errorf("repo = %+v, want o/r", overview.Repo)
+	}
+	if len(overview.Issues) != 2 || overview.Issues[0].Number != 7 {
+		t.Errorf("issues = %+v, want 7 and 3", overview.Issues)
+	}
+	if overview.Languages["Go"] != 9000 {
+		t.Errorf("languages = %v, want Go 9000", overview.Languages)
+	}
+	if !reflect.DeepEqual(overview.CachedGuides, []int{3, 7}) {
+		t.Errorf("cached guides = %v, want [3 7] (o/other excluded)", overview.CachedGuides)
+	}
+	if overview.Partial || overview.Errors != nil {
+		t.Errorf("overview partial %v with errors %v, want complete", overview.Partial, overview.Errors)
+	}
+
+	raw, err := json.Marshal(overview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shape map[string]json.RawMessage
+	json.Unmarshal(raw, &shape)
+	for _, key := range []string{"repo", "issues", "languages", "cached_guides", "partial"} {
+		if _, ok := shape[key]; !ok {
+			t.Errorf("overview JSON lacks %q: %s", key, raw)
+		}
+	}
+	if _, ok := shape["errors"]; ok {
+		t.Errorf("complete overview JSON has errors: %s", raw)
+	}
+}
+
+func TestGetRepoOverviewPartialFailure(t *testing.T) {
+	svc := NewRepoService(statsRepoRepo(), overviewGuides(), overviewGitHub(t, true))
+
+	overview, err := svc.GetRepoOverview(context.Background(), "o", "r")
+	if err != nil {
+		t.Fatalf("GetRepoOverview: %v", err)
+	}
+	if !overview.Partial || overview.Errors[OverviewLanguages] == "" || len(overview.Errors) != 1 {
+		t.Errorf("partial %v errors %v, want only the languages section failed", overview.Partial, overview.Errors)
+	}
+	if overview.Languages == nil || len(overview.Languages) != 0 {
+		t.Errorf("languages = %#v, want an empty map", overview.Languages)
+	}
+	if len(overview.Issues) != 2 || overview.Repo == nil || len(overview.CachedGuides) != 2 {
+		t.Errorf("overview = %+v, want the other sections filled", overview)
+	}
+}
+
+func TestGetRepoOverviewMissingRepo(t *testing.T) {
+	svc := NewRepoService(statsRepoRepo(), overviewGuides(), overviewGitHub(t, false))
+	if _, err := svc.GetRepoOverview(context.Background(), "o", "missing"); !errors.Is(err, ErrRepoNotFound) {
+		t.Errorf("err = %v, want ErrRepoNotFound", err)
+	}
+}
+
+// readmeRepoRepo is a snapshotRepoRepo that caches READMEs in readmes.
+type readmeRepoRepo struct {
+	snapshotRepoRepo
+	readmes map[string]string
+	sets    int
+}
+
+func (r *readmeRepoRepo) FindReadme(ctx context.Context, id string) (string, error) {
+	return r.readmes[id], nil
+}
+
+func (r *readmeRepoRepo) SetReadme(ctx context.Context, id, readme string) error {
+	r.sets++
+	r.readmes[id] = readme
+	return nil
+}
+
+func TestEnsureReadme(t *testing.T) {
+	newRepos := func(repo *models.Repo, files map[string]string) *readmeRepoRepo {
+		return &readmeRepoRepo{
+			snapshotRepoRepo: snapshotRepoRepo{files: files, repos: map[string]*models.Repo{"o/r": repo}},
+			readmes:          map[string]string{},
+		}
+	}
+
+	t.Run("already present", func(t *testing.T) {
+		repos := newRepos(&models.Repo{ID: "o/r", Readme: "# Ingested"}, nil)
+		svc := NewRepoService(repos, nil, nil)
+
+		readme, err := svc.EnsureReadme(context.Background(), "o/r")
+		if err != nil || readme != "# Ingested" {
+			t.Fatalf("EnsureReadme = %q, %v; want the ingested README", readme, err)
+		}
+		if repos.sets != 0 {
+			t.Error("an ingested README was cached again")
+		}
+	})
+
+	t.Run("fetched from the snapshot and cached", func(t *testing.T) {
+		repos := newRepos(&models.Repo{ID: "o/r"}, map[string]string{"o:r/README.md": "# From GCS"})
+		var ghCalls int
+		gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+			ghCalls++
+			http.NotFound(w, r)
+		})
+		svc := NewRepoService(repos, nil, gh)
+
+		for i := 0; i < 2; i++ {
+			readme, err := svc.EnsureReadme(context.Background(), "o/r")
+			if err != nil || readme != "# From GCS" {
+				t.Fatalf("call %d: EnsureReadme = %q, %v; want the snapshot README", i+1, readme, err)
+			}
+		}
+		if repos.sets != 1 || repos.readmes["o/r"] != "# From GCS" {
+			t.Errorf("cached %d times (%q), want once", repos.sets, repos.readmes["o/r"])
+		}
+		if ghCalls != 0 {
+			t.Errorf("GitHub called %d times, want 0", ghCalls)
+		}
+		// Later calls are served from the cache, not the snapshot
+		delete(repos.files, "o:r/README.md")
+		if readme, err := svc.EnsureReadme(context.Background(), "o/r"); err != nil || readme != "# From GCS" {
+			t.Errorf("EnsureReadme = %q, %v; want the cached README", readme, err)
+		}
+	})
+
+	t.Run("falls back to GitHub", func(t *testing.T) {
+		repos := newRepos(&models.Repo{ID: "o/r", DefaultBranch: "develop"}, nil)
+		var gotPath, gotRef string
+		gh := newGitHubStub(t, func(w http.ResponseWriter, r *http.Request) {
+			gotPath, gotRef = r.URL.Path, r.URL.Query().Get("ref")
+			w.Write([]byte(`{"type":"file","encoding":"base64","content":"IyBGcm9tIEdpdEh1Yg=="}`))
+		})
+		svc := NewRepoService(repos, nil, gh)
+
+		readme, err := svc.EnsureReadme(context.Background(), "o/r")
+		if err != nil || readme != "# From GitHub" {
+			t.Fatalf("EnsureReadme = %q, %v; want the GitHub README", readme, err)
+		}
+		if gotPath != "/repos/o/r/contents/README.md" || gotRef != "develop" {
+			t.Errorf("fetched %s at %q, want README.md at the default branch", gotPath, gotRef)
+		}
+		if repos.readmes["o/r"] != "# From GitHub" {
+			t.Errorf("cached %q, want the GitHub README", repos.readmes["o/r"])
+		}
+	})
+
+	t.Run("missing everywhere", func(t *testing.T) {
+		repos := newRepos(&models.Repo{ID: "o/r"}, nil)
+		gh := newGitHubStub(t, http.NotFound)
+		if _, err := NewRepoService(repos, nil, gh).EnsureReadme(context.Background(), "o/r"); err == nil {
+			t.Error("EnsureReadme succeeded without a README anywhere")
+		}
+		if repos.sets != 0 {
+			t.Error("a missing README was cached")
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// repoSortFields are the repository fields GetAllRepos can sort by.
+var repoSortFields = map[string]bool{
+	"stargazers_count":  true,
+	"forks_count":       true,
+	"watchers_count":    true,
+	"open_issues_count": true,
+	"pushed_at":         true,
+	"created_at":        true,
+	"full_name":         true,
+}
+
+// DefaultRepoSort lists the most-starred repositories first.
+var DefaultRepoSort = models.RepoSort{Field: "stargazers_count", Descending: true}
+
+// ParseRepoSort validates a sort field and order ("asc" or "desc"; empty
+// means "desc"). An empty field yields the zero RepoSort, meaning "use the
+// default".
+func ParseRepoSort(field, order string) (models.RepoSort, error) {
+	if field == "" {
+		if order != "" {
+			return models.RepoSort{}, fmt.Errorf("order requires sort")
+		}
+		return models.RepoSort{}, nil
+	}
+	if !repoSortFields[field] {
+		fields := make([]string, 0, len(repoSortFields))
+		for f := range repoSortFields {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		return models.RepoSort{}, fmt.Errorf("unknown sort field %q (expected one of %s)", field, strings.Join(fields, ", "))
+	}
+	switch order {
+	case "", "desc":
+		return models.RepoSort{Field: field, Descending: true}, nil
+	case "asc":
+		return models.RepoSort{Field: field}, nil
+	default:
+		return models.RepoSort{}, fmt.Errorf("unknown sort order %q (expected \"asc\" or \"desc\")", order)
+	}
+}
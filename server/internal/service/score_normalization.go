@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// ScoreNormalization selects how raw vector-search scores are mapped to a
+// 0–1 normalized relevance. Normalization is per query: it ranks results
+// against the other results of the same search, so a normalized score of 1
+// means "best match for this query", not "good match" in absolute terms.
+type ScoreNormalization string
+
+// Supported score normalizations.
+const (
+	NormalizeNone   ScoreNormalization = "none"   // only raw scores are returned
+	NormalizeMinMax ScoreNormalization = "minmax" // best result 1, worst 0
+	NormalizeZScore ScoreNormalization = "zscore" // standard normal CDF of the z-score
+)
+
+// ParseScoreNormalization validates a configured normalization name; empty
+// means NormalizeNone.
+func ParseScoreNormalization(s string) (ScoreNormalization, error) {
+	switch n := ScoreNormalization(s); n {
+	case "", NormalizeNone:
+		return NormalizeNone, nil
+	case NormalizeMinMax, NormalizeZScore:
+		return n, nil
+	default:
+		return "", fmt.Errorf("unknown score normalization %q (expected %q, %q or %q)",
+			s, NormalizeNone, NormalizeMinMax, NormalizeZScore)
+	}
+}
+
+// NormalizeScores maps the scores of one query's results into [0, 1] with
+// method, returning nil for NormalizeNone. When every score is equal
+// (including a single result) nothing distinguishes the results and each
+// normalized score is 1.
+func NormalizeScores(scores []float64, method ScoreNormalization) []float64 {
+	if method != NormalizeMinMax && method != NormalizeZScore || len(scores) == 0 {
+		return nil
+	}
+
+	lo, hi, sum := scores[0], scores[0], 0.0
+	for _, s := range scores {
+		lo, hi, sum = math.Min(lo, s), math.Max(hi, s), sum+s
+	}
+	normalized := make([]float64, len(scores))
+	if hi == lo {
+		for i := range normalized {
+			normalized[i] = 1
+		}
+		return normalized
+	}
+
+	if method == NormalizeMinMax {
+		for i, s := range scores {
+			normalized[i] = (s - lo) / (hi - lo)
+		}
+		return normalized
+	}
+
+	mean := sum / float64(len(scores))
+	var variance float64
+	for _, s := range scores {
+		variance += (s - mean) * (s - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(scores)))
+	for i, s := range scores {
+		z := (s - mean) / stddev
+		normalized[i] = 0.5 * (1 + math.Erf(z/math.Sqrt2))
+	}
+	return normalized
+}
+
+// normalizeRepoScores sets NormalizedScore on repos according to method.
+func normalizeRepoScores(repos []models.Repo, method ScoreNormalization) {
+	scores := make([]float64, len(repos))
+	for i, r := range repos {
+		scores[i] = r.Score
+	}
+	for i, n := range NormalizeScores(scores, method) {
+		n := n
+		repos[i].NormalizedScore = &n
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+func TestNormalizeScores(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []float64
+		method ScoreNormalization
+		want   []float64
+	}{
+		{"none", []float64{0.9, 0.5}, NormalizeNone, nil},
+		{"no results", nil, NormalizeMinMax, nil},
+		{"minmax", []float64{0.9, 0.7, 0.5}, NormalizeMinMax, []float64{1, 0.5, 0}},
+		// Mean 0.7 and population stddev 0.2: z-scores of 1 and -1
+		{"zscore", []float64{0.9, 0.5}, NormalizeZScore, []float64{0.8413447, 0.1586553}},
+		{"minmax single result", []float64{0.42}, NormalizeMinMax, []float64{1}},
+		{"zscore single result", []float64{0.42}, NormalizeZScore, []float64{1}},
+		{"minmax all equal", []float64{0.6, 0.6, 0.6}, NormalizeMinMax, []float64{1, 1, 1}},
+		{"zscore all equal", []float64{0.6, 0.6}, NormalizeZScore, []float64{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeScores(tt.scores, tt.method)
+			if len(got) != len(tt.want) || (got == nil) != (tt.want == nil) {
+				t.Fatalf("NormalizeScores(%v, %s) = %v, want %v", tt.scores, tt.method, got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-6 {
+					t.Errorf("NormalizeScores(%v, %s) = %v, want %v", tt.scores, tt.method, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestParseScoreNormalization(t *testing.T) {
+	for in, want := range map[string]ScoreNormalization{"": NormalizeNone, "none": NormalizeNone, "minmax": NormalizeMinMax, "zscore": NormalizeZScore} {
+		if got, err := ParseScoreNormalization(in); err != nil || got != want {
+			t.Errorf("ParseScoreNormalization(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseScoreNormalization("softmax"); err == nil {
+		t.Error("ParseScoreNormalization(softmax) succeeded, want an error")
+	}
+}
+
+func TestSearchNormalizesScoresPerQuery(t *testing.T) {
+	repo := &stubSearchRepo{repos: []models.Repo{{ID: "a/best", Score: 0.8}, {ID: "b/worst", Score: 0.4}}}
+	svc := NewSearchService(repo, &stubEmbedder{vec: []float32{0.1, 0.2, 0.3, 0.4, 0.5}}, NormalizeMinMax, models.RepoSort{})
+
+	repos, _, err := svc.Search("cli tools")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(repos) != 2 || repos[0].NormalizedScore == nil || repos[1].NormalizedScore == nil {
+		t.Fatalf("repos = %+v, want both with a normalized score", repos)
+	}
+	if *repos[0].NormalizedScore != 1 || *repos[1].NormalizedScore != 0 {
+		t.Errorf("normalized scores = %v, %v; want 1, 0", *repos[0].NormalizedScore, *repos[1].NormalizedScore)
+	}
+	if repos[0].Score != 0.8 {
+		t.Errorf("raw score = %v, want 0.8 kept alongside", repos[0].Score)
+	}
+
+	svc = NewSearchService(repo, &stubEmbedder{vec: []float32{0.1, 0.2, 0.3, 0.4, 0.5}}, NormalizeNone, models.RepoSort{})
+	repos, _, _ = svc.Search("cli tools")
+	if repos[0].NormalizedScore != nil {
+		t.Errorf("normalized score = %v with normalization off, want none", *repos[0].NormalizedScore)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
 )
@@ -15,8 +16,12 @@ type SearchRepoRepository interface {
 	// VectorSearch returns the top‑k repositories whose stored embedding is
 	// most similar to queryVec. The implementation typically uses
 	// MongoDB Atlas Vector Search.
-	VectorSearch(ctx context.Context, queryVec []float32, k int) ([]models.Repo, error)
-	GetAllRepos(ctx context.Context) ([]models.Repo, error)
+	// Warnings list results that were dropped because they could not be
+	// fully loaded.
+	VectorSearch(ctx context.Context, queryVec []float32, k int) ([]models.Repo, []string, error)
+	// GetAllRepos returns one page of repositories in sort order and the
+	// total count.
+	GetAllRepos(ctx context.Context, limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error)
 }
 
 // ---- Service interface + implementation ------------------------------------
@@ -24,64 +29,140 @@ type SearchRepoRepository interface {
 // SearchService converts natural‑language queries into embeddings and performs
 // K‑NN searches through the repository vector index.
 type SearchService interface {
-	Search(query string) ([]models.Repo, error)
-	GetAllRepos() ([]models.Repo, error)
+	Search(query string) ([]models.Repo, []string, error)
+	GetAllRepos(limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error)
+	SearchBatch(ctx context.Context, queries []string, k int) ([]BatchSearchResult, error)
+}
+
+// BatchSearchResult is the outcome of one query in a SearchBatch call. A
+// failed vector search sets Error without failing the whole batch.
+type BatchSearchResult struct {
+	Query    string        `json:"query"`
+	Results  []models.Repo `json:"results"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Error    string        `json:"error,omitempty"`
 }
 
 type searchService struct {
-	repo     SearchRepoRepository
-	embedder EmbeddingClient
+	repo          SearchRepoRepository
+	embedder      EmbeddingClient
+	normalization ScoreNormalization
+	defaultSort   models.RepoSort
 }
 
-// NewSearchService wires the repository and embedder.
-func NewSearchService(repo SearchRepoRepository, embedder EmbeddingClient) SearchService {
+// NewSearchService wires the repository and embedder. Search results carry a
+// normalized score computed with normalization (per query); repository
+// listings without an explicit sort use defaultSort.
+func NewSearchService(repo SearchRepoRepository, embedder EmbeddingClient, normalization ScoreNormalization, defaultSort models.RepoSort) SearchService {
 	return &searchService{
-		repo:     repo,
-		embedder: embedder,
+		repo:          repo,
+		embedder:      embedder,
+		normalization: normalization,
+		defaultSort:   defaultSort,
 	}
 }
 
 // Search embeds the query string and calls the repository's VectorSearch method.
-func (s *searchService) Search(query string) ([]models.Repo, error) {
+// The returned warnings are non-empty when the result set is partial.
+func (s *searchService) Search(query string) ([]models.Repo, []string, error) {
 	ctx := context.Background()
 	log.Printf("Starting search for query: %q", query)
 
 	// Generate embedding
 	log.Printf("Generating embedding for query...")
-	vec, err := s.embedder.Embed(query)
+	vec, err := EmbedContext(ctx, s.embedder, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate embedding: %w", err)
 	}
 	log.Printf("Generated embedding vector of length %d", len(vec))
 	log.Printf("First few values of embedding: %v", vec[:5])
 
 	// Search repositories
 	log.Printf("Performing vector search with k=30...")
-	repos, err := s.repo.VectorSearch(ctx, vec, 30)
+	repos, warnings, err := s.repo.VectorSearch(ctx, vec, 30)
 	if err != nil {
-		return nil, fmt.Errorf("vector search failed: %w", err)
+		return nil, nil, fmt.Errorf("vector search failed: %w", err)
 	}
 	log.Printf("Vector search returned %d results", len(repos))
 
 	if len(repos) == 0 {
 		log.Printf("No repositories found for query: %q", query)
-		return []models.Repo{}, nil
+		return []models.Repo{}, warnings, nil
 	}
 
+	normalizeRepoScores(repos, s.normalization)
+
 	// Log results for debugging
 	for i, repo := range repos {
 		log.Printf("Result #%d: %s (score: %.4f)", i+1, repo.ID, repo.Score)
 	}
 
-	return repos, nil
+	return repos, warnings, nil
 }
 
-// GetAllRepos retrieves all repositories from the federated database.
-func (s *searchService) GetAllRepos() ([]models.Repo, error) {
+// GetAllRepos retrieves one page of repositories from the federated database
+// along with the total number of repositories. A zero sort uses the service's
+// default sort.
+func (s *searchService) GetAllRepos(limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error) {
 	ctx := context.Background()
-	repos, err := s.repo.GetAllRepos(ctx)
+	if sort.Field == "" {
+		sort = s.defaultSort
+	}
+	repos, total, err := s.repo.GetAllRepos(ctx, limit, offset, sort)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get all repos: %w", err)
+	}
+	return repos, total, nil
+}
+
+// SearchBatch embeds every query in one batch call and runs the k-NN searches
+// concurrently. Results are returned in query order.
+func (s *searchService) SearchBatch(ctx context.Context, queries []string, k int) ([]BatchSearchResult, error) {
+	vecs, err := s.embedBatch(ctx, queries)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all repos: %w", err)
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+	if len(vecs) != len(queries) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d queries", len(vecs), len(queries))
+	}
+
+	results := make([]BatchSearchResult, len(queries))
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := BatchSearchResult{Query: queries[i], Results: []models.Repo{}}
+			repos, warnings, err := s.repo.VectorSearch(ctx, vecs[i], k)
+			if err != nil {
+				log.Printf("Batch search failed for query %q: %v", queries[i], err)
+				res.Error = "vector search failed: " + err.Error()
+			} else if len(repos) > 0 {
+				normalizeRepoScores(repos, s.normalization)
+				res.Results = repos
+			}
+			res.Warnings = warnings
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+
+	log.Printf("Batch search ran %d queries with k=%d", len(queries), k)
+	return results, nil
+}
+
+// embedBatch uses the embedder's batch API when it has one.
+func (s *searchService) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if batch, ok := s.embedder.(BatchEmbedder); ok {
+		return batch.EmbedBatch(ctx, texts)
+	}
+	vecs := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vec, err := EmbedContext(ctx, s.embedder, text)
+		if err != nil {
+			return nil, err
+		}
+		vecs = append(vecs, vec)
 	}
-	return repos, nil
+	return vecs, nil
 }
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// stubSearchRepo answers every vector search with repos and warnings.
+type stubSearchRepo struct {
+	SearchRepoRepository
+	repos    []models.Repo
+	warnings []string
+}
+
+func (r *stubSearchRepo) VectorSearch(ctx context.Context, queryVec []float32, k int) ([]models.Repo, []string, error) {
+	return append([]models.Repo(nil), r.repos...), r.warnings, nil
+}
+
+func TestSearchSurfacesPartialResultWarnings(t *testing.T) {
+	warnings := []string{"metadata unavailable for a/fail; result omitted"}
+	repo := &stubSearchRepo{repos: []models.Repo{{ID: "b/kept", Score: 0.8}}, warnings: warnings}
+	svc := NewSearchService(repo, &stubEmbedder{vec: []float32{0.1, 0.2, 0.3, 0.4, 0.5}}, NormalizeNone, models.RepoSort{})
+
+	repos, got, err := svc.Search("cli tools")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(repos) != 1 || repos[0].ID != "b/kept" {
+		t.Errorf("repos = %+v, want b/kept", repos)
+	}
+	if !reflect.DeepEqual(got, warnings) {
+		t.Errorf("warnings = %q, want %q", got, warnings)
+	}
+
+	batch, err := svc.SearchBatch(context.Background(), []string{"cli tools"}, 5)
+	if err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	if !reflect.DeepEqual(batch[0].Warnings, warnings) {
+		t.Errorf("batch warnings = %q, want %q", batch[0].Warnings, warnings)
+	}
+}
+
+// batchStubEmbedder embeds text i of a batch as the vector {i}, recording
+// the batches it was given.
+type batchStubEmbedder struct {
+	stubEmbedder
+	batches [][]string
+}
+
+func (e *batchStubEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	e.batches = append(e.batches, texts)
+	vecs := make([][]float32, len(texts))
+	for i := range texts {
+		vecs[i] = []float32{float32(i)}
+	}
+	return vecs, nil
+}
+
+// vecSearchRepo answers a vector search with the repos for the query
+// vector's first value.
+type vecSearchRepo struct {
+	SearchRepoRepository
+	byVec map[float32][]models.Repo
+}
+
+func (r *vecSearchRepo) VectorSearch(ctx context.Context, queryVec []float32, k int) ([]models.Repo, []string, error) {
+	return r.byVec[queryVec[0]], nil, nil
+}
+
+func TestSearchBatchTwoQueries(t *testing.T) {
+	embedder := &batchStubEmbedder{}
+	repo := &vecSearchRepo{byVec: map[float32][]models.Repo{
+		0: {{ID: "a/cli", Score: 0.9}},
+		1: {{ID: "b/web", Score: 0.8}, {ID: "c/web", Score: 0.7}},
+	}}
+	svc := NewSearchService(repo, embedder, NormalizeNone, models.RepoSort{})
+
+	results, err := svc.SearchBatch(context.Background(), []string{"cli tools", "web frameworks"}, 10)
+	if err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	if len(embedder.batches) != 1 || len(embedder.batches[0]) != 2 || len(embedder.texts) != 0 {
+		t.Errorf("embedded batches %q and single texts %q, want both queries in one batch", embedder.batches, embedder.texts)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d result sets, want 2", len(results))
+	}
+	if results[0].Query != "cli tools" || len(results[0].Results) != 1 || results[0].Results[0].ID != "a/cli" {
+		t.Errorf("results[0] = %+v, want a/cli for cli tools", results[0])
+	}
+	if results[1].Query != "web frameworks" || len(results[1].Results) != 2 || results[1].Results[0].ID != "b/web" {
+		t.Errorf("results[1] = %+v, want b/web and c/web for web frameworks", results[1])
+	}
+}
+
+// sortRecordingRepo records the sort of every repository listing.
+type sortRecordingRepo struct {
+	SearchRepoRepository
+	sorts []models.RepoSort
+}
+
+func (r *sortRecordingRepo) GetAllRepos(ctx context.Context, limit, offset int, sort models.RepoSort) ([]models.Repo, int64, error) {
+	r.sorts = append(r.sorts, sort)
+	return []models.Repo{}, 0, nil
+}
+
+func TestGetAllReposSort(t *testing.T) {
+	repo := &sortRecordingRepo{}
+	svc := NewSearchService(repo, &stubEmbedder{}, NormalizeNone, DefaultRepoSort)
+
+	override := models.RepoSort{Field: "pushed_at"}
+	for _, sort := range []models.RepoSort{{}, override} {
+		if _, _, err := svc.GetAllRepos(10, 0, sort); err != nil {
+			t.Fatalf("GetAllRepos: %v", err)
+		}
+	}
+	want := []models.RepoSort{{Field: "stargazers_count", Descending: true}, override}
+	if !reflect.DeepEqual(repo.sorts, want) {
+		t.Errorf("sorts = %+v, want the default, then the override", repo.sorts)
+	}
+}
+
+func TestParseRepoSort(t *testing.T) {
+	tests := []struct {
+		field, order string
+		want         models.RepoSort
+		wantErr      bool
+	}{
+		{"", "", models.RepoSort{}, false},
+		{"stargazers_count", "", models.RepoSort{Field: "stargazers_count", Descending: true}, false},
+		{"pushed_at", "desc", models.RepoSort{Field: "pushed_at", Descending: true}, false},
+		{"full_name", "asc", models.RepoSort{Field: "full_name"}, false},
+		{"", "asc", models.RepoSort{}, true},
+		{"embedding", "", models.RepoSort{}, true},
+		{"forks_count", "sideways", models.RepoSort{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRepoSort(tt.field, tt.order)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRepoSort(%q, %q) = %+v, %v; want %+v (error %v)", tt.field, tt.order, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
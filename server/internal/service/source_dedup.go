@@ -0,0 +1,124 @@
+package service
+
+import (
+	"log"
+	"strings"
+)
+
+// shingleSize is the number of consecutive words in a shingle.
+const shingleSize = 5
+
+// dedupSources merges sources from the same file whose contents overlap, as
+// adjacent chunks cut with overlap do. Two sources overlap when at least
+// threshold (0–1) of the shorter one's word shingles also occur in the other.
+// Overlapping chunks that continue one another are joined into one source;
+// otherwise the less relevant one is dropped. Order is preserved and a merged
+// source takes the higher relevance. A non-positive threshold disables it.
+func dedupSources(sources []Source, threshold float64) []Source {
+	if threshold <= 0 || len(sources) < 2 {
+		return sources
+	}
+
+	kept := make([]Source, 0, len(sources))
+	shingles := make([]map[string]struct{}, 0, len(sources))
+	merged := 0
+	for _, src := range sources {
+		srcShingles := contentShingles(src.Content)
+		dup := false
+		for i := range kept {
+			if kept[i].RepoID != src.RepoID || kept[i].FilePath != src.FilePath {
+				continue
+			}
+			if shingleOverlap(shingles[i], srcShingles) < threshold {
+				continue
+			}
+			kept[i].Content = mergeOverlapping(kept[i].Content, src.Content)
+			kept[i].Relevance = max(kept[i].Relevance, src.Relevance)
+			shingles[i] = contentShingles(kept[i].Content)
+			dup = true
+			break
+		}
+		if dup {
+			merged++
+			continue
+		}
+		kept = append(kept, src)
+		shingles = append(shingles, srcShingles)
+	}
+
+	if merged > 0 {
+		log.Printf("Merged %d of %d sources overlapping another from the same file", merged, len(sources))
+	}
+	return kept
+}
+
+// contentShingles returns the set of shingleSize-word runs in text. Text
+// shorter than a shingle is one shingle.
+func contentShingles(text string) map[string]struct{} {
+	words := strings.Fields(text)
+	set := make(map[string]struct{})
+	if len(words) <= shingleSize {
+		set[strings.Join(words, " ")] = struct{}{}
+		return set
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[strings.Join(words[i:i+shingleSize], " ")] = struct{}{}
+	}
+	return set
+}
+
+// shingleOverlap returns the share of the smaller set's shingles found in the
+// other set.
+func shingleOverlap(a, b map[string]struct{}) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 0
+	}
+	shared := 0
+	for s := range a {
+		if _, ok := b[s]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a))
+}
+
+// mergeOverlapping combines two overlapping chunks. A chunk contained in the
+// other yields the other; when the end of one repeats the start of the other,
+// line for line, they are joined without the repeat. Otherwise a is kept.
+func mergeOverlapping(a, b string) string {
+	switch {
+	case strings.Contains(a, b):
+		return a
+	case strings.Contains(b, a):
+		return b
+	}
+	aLines, bLines := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if n := lineOverlap(aLines, bLines); n > 0 {
+		return strings.Join(append(aLines, bLines[n:]...), "\n")
+	}
+	if n := lineOverlap(bLines, aLines); n > 0 {
+		return strings.Join(append(bLines, aLines[n:]...), "\n")
+	}
+	return a
+}
+
+// lineOverlap returns the largest n such that the last n lines of first are
+// the first n lines of second, or 0.
+func lineOverlap(first, second []string) int {
+	for n := min(len(first), len(second)); n > 0; n-- {
+		match := true
+		for i := 0; i < n; i++ {
+			if first[len(first)-n+i] != second[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// codeLines returns lines from..to of a fake source file, one statement each.
+func codeLines(from, to int) string {
+	var lines []string
+	for i := from; i <= to; i++ {
+		lines = append(lines, fmt.Sprintf("value%d := compute(input, %d) // step %d", i, i, i))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDedupSources(t *testing.T) {
+	tests := []struct {
+		name      string
+		sources   []Source
+		threshold float64
+		want      []Source
+	}{
+		{
+			"adjacent overlapping chunks merge",
+			[]Source{
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.7},
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(3, 12), Relevance: 0.9},
+			},
+			0.6,
+			[]Source{{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 12), Relevance: 0.9}},
+		},
+		{
+			"later chunk first",
+			[]Source{
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(3, 12), Relevance: 0.9},
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.7},
+			},
+			0.6,
+			[]Source{{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 12), Relevance: 0.9}},
+		},
+		{
+			"contained chunk dropped",
+			[]Source{
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(4, 6), Relevance: 0.9},
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.6},
+			},
+			0.6,
+			[]Source{{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.9}},
+		},
+		{
+			"other files untouched",
+			[]Source{
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.9},
+				{RepoID: "o/r", FilePath: "b.go", Content: codeLines(1, 10), Relevance: 0.8},
+				{RepoID: "o/other", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.7},
+			},
+			0.6,
+			nil, // unchanged
+		},
+		{
+			"small overlap kept apart",
+			[]Source{
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.9},
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(9, 18), Relevance: 0.8},
+			},
+			0.6,
+			nil,
+		},
+		{
+			"disabled",
+			[]Source{
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.9},
+				{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.8},
+			},
+			0,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want == nil {
+				want = tt.sources
+			}
+			got := dedupSources(append([]Source(nil), tt.sources...), tt.threshold)
+			if len(got) != len(want) {
+				t.Fatalf("kept %d sources, want %d: %+v", len(got), len(want), got)
+			}
+			for i := range want {
+				if got[i].FilePath != want[i].FilePath || got[i].RepoID != want[i].RepoID || got[i].Relevance != want[i].Relevance {
+					t.Errorf("source %d = %s/%s (%.1f), want %s/%s (%.1f)", i, got[i].RepoID, got[i].FilePath, got[i].Relevance, want[i].RepoID, want[i].FilePath, want[i].Relevance)
+				}
+				if got[i].Content != want[i].Content {
+					t.Errorf("source %d content =\n%s\nwant\n%s", i, got[i].Content, want[i].Content)
+				}
+			}
+		})
+	}
+}
+
+func TestShingleOverlap(t *testing.T) {
+	a := contentShingles("one two three four five six seven")
+	b := contentShingles("three four five six seven eight nine")
+	if got := shingleOverlap(a, b); got != 1.0/3 {
+		t.Errorf("overlap = %v, want 1/3", got)
+	}
+	if got := shingleOverlap(a, a); got != 1 {
+		t.Errorf("self overlap = %v, want 1", got)
+	}
+	if got := shingleOverlap(contentShingles("short"), contentShingles("short")); got != 1 {
+		t.Errorf("overlap of text shorter than a shingle = %v, want 1", got)
+	}
+	if got := shingleOverlap(contentShingles(""), a); got != 0 {
+		t.Errorf("overlap with empty text = %v", got)
+	}
+}
+
+func TestGenerateResponseMergesOverlappingSources(t *testing.T) {
+	mt := newMockMongo(t)
+	mt.Run("merged", func(mt *mtest.T) {
+		mt.AddMockResponses(chunkCursor("db.code",
+			Source{RepoID: "o/r", FilePath: "a.go", Content: codeLines(1, 10), Relevance: 0.9},
+			Source{RepoID: "o/r", FilePath: "a.go", Content: codeLines(3, 12), Relevance: 0.8},
+			Source{RepoID: "o/r", FilePath: "b.go", Content: "func B() {}", Relevance: 0.7},
+		))
+		llm := &stubLLM{answer: "Look at a.go"}
+		svc := NewRAGService(mt.Coll, mt.Coll, &stubEmbedder{}, llm, nil, 0, "")
+		svc.SetSourceDedupThreshold(0.6)
+
+		resp, err := svc.GenerateResponse(context.Background(), RAGRequest{Query: "q", RepoID: "o/r"})
+		if err != nil {
+			mt.Fatalf("GenerateResponse: %v", err)
+		}
+		if len(resp.Sources) != 2 || resp.Sources[0].Content != codeLines(1, 12) || resp.Sources[1].FilePath != "b.go" {
+			mt.Fatalf("sources = %+v, want the merged a.go chunk and b.go", resp.Sources)
+		}
+		if n := strings.Count(llm.prompts[0], "value5 := compute"); n != 1 {
+			mt.Errorf("prompt repeats the overlapping lines %d times, want once", n)
+		}
+	})
+}
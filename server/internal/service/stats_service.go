@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// StatsRepository reports per-collection dataset statistics.
+type StatsRepository interface {
+	CollectionStats(ctx context.Context) []models.CollectionStats
+}
+
+// DatasetStats is the dataset size overview served by GET /admin/stats.
+type DatasetStats struct {
+	Collections []models.CollectionStats `json:"collections"`
+	ComputedAt  time.Time                `json:"computed_at"`
+	Cached      bool                     `json:"cached"`
+}
+
+// StatsService caches dataset statistics for a short time, since counting
+// large collections is expensive.
+type StatsService struct {
+	repo StatsRepository
+	ttl  time.Duration
+
+	mu   sync.Mutex
+	last *DatasetStats
+}
+
+// NewStatsService returns a StatsService that recomputes the statistics at
+// most once per ttl.
+func NewStatsService(repo StatsRepository, ttl time.Duration) *StatsService {
+	return &StatsService{repo: repo, ttl: ttl}
+}
+
+// DatasetStats returns the cached statistics, recomputing them once they are
+// older than the TTL. Concurrent callers share one computation.
+func (s *StatsService) DatasetStats(ctx context.Context) DatasetStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last != nil && time.Since(s.last.ComputedAt) < s.ttl {
+		cached := *s.last
+		cached.Cached = true
+		return cached
+	}
+
+	s.last = &DatasetStats{
+		Collections: s.repo.CollectionStats(ctx),
+		ComputedAt:  time.Now(),
+	}
+	return *s.last
+}
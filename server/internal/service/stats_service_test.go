@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmednasr/ai-in-action/server/internal/models"
+)
+
+// countingStatsRepo reports fixed collection stats, counting the calls.
+type countingStatsRepo struct {
+	stats []models.CollectionStats
+	calls atomic.Int32
+}
+
+func (r *countingStatsRepo) CollectionStats(ctx context.Context) []models.CollectionStats {
+	r.calls.Add(1)
+	return r.stats
+}
+
+func TestDatasetStatsCachesCounts(t *testing.T) {
+	repo := &countingStatsRepo{stats: []models.CollectionStats{
+		{Database: "db", Collection: "repos_meta", Documents: 120},
+		{Database: "db", Collection: "repos_code", Documents: 98000},
+	}}
+	svc := NewStatsService(repo, time.Hour)
+
+	first := svc.DatasetStats(context.Background())
+	if first.Cached || len(first.Collections) != 2 || first.Collections[1].Documents != 98000 {
+		t.Errorf("first stats = %+v, want freshly computed counts", first)
+	}
+	second := svc.DatasetStats(context.Background())
+	if !second.Cached || !second.ComputedAt.Equal(first.ComputedAt) {
+		t.Errorf("second stats = %+v, want the cached counts", second)
+	}
+	if n := repo.calls.Load(); n != 1 {
+		t.Errorf("collections counted %d times within the TTL, want 1", n)
+	}
+}
+
+func TestDatasetStatsRecomputesAfterTTL(t *testing.T) {
+	repo := &countingStatsRepo{}
+	svc := NewStatsService(repo, 10*time.Millisecond)
+
+	svc.DatasetStats(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	if stats := svc.DatasetStats(context.Background()); stats.Cached {
+		t.Error("stats older than the TTL were served from the cache")
+	}
+	if n := repo.calls.Load(); n != 2 {
+		t.Errorf("collections counted %d times, want 2", n)
+	}
+}
@@ -3,30 +3,62 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"time"
 
 	aiplatform "cloud.google.com/go/aiplatform/apiv1"
 	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// Defaults for predictRetry when the caller passes zero values.
+const (
+	defaultPredictTimeout  = 30 * time.Second
+	defaultPredictAttempts = 3
+	predictInitialBackoff  = 500 * time.Millisecond
+)
+
+// predictRetry bounds each Predict call with a timeout and retries calls that
+// fail with a transient gRPC status.
+type predictRetry struct {
+	timeout     time.Duration // per-attempt deadline
+	maxAttempts int
+}
+
+func newPredictRetry(timeout time.Duration, maxAttempts int) predictRetry {
+	if timeout <= 0 {
+		timeout = defaultPredictTimeout
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultPredictAttempts
+	}
+	return predictRetry{timeout: timeout, maxAttempts: maxAttempts}
+}
+
 // VertexEmbedder uses Google's text-embedding-005 model to generate embeddings
 type VertexEmbedder struct {
 	client    *aiplatform.PredictionClient
 	modelName string
 	projectID string
 	location  string
+	retry     predictRetry
 }
 
 // GeminiEmbedder uses Google's gemini-embedding-001 model to generate embeddings
 type GeminiEmbedder struct {
 	client    *aiplatform.PredictionClient
 	modelName string
+	retry     predictRetry
 }
 
-// NewVertexEmbedder creates a new embedder using the service account credentials
-func NewVertexEmbedder(projectID, location string) (*VertexEmbedder, error) {
+// NewVertexEmbedder creates a new embedder using the service account credentials.
+// timeout bounds each prediction call and maxAttempts caps retries of transient
+// failures; zero values select the defaults.
+func NewVertexEmbedder(projectID, location string, timeout time.Duration, maxAttempts int) (*VertexEmbedder, error) {
 	ctx := context.Background()
 	client, err := aiplatform.NewPredictionClient(ctx)
 	if err != nil {
@@ -44,11 +76,13 @@ func NewVertexEmbedder(projectID, location string) (*VertexEmbedder, error) {
 		projectID: projectID,
 		location:  location,
 		modelName: modelName,
+		retry:     newPredictRetry(timeout, maxAttempts),
 	}, nil
 }
 
-// NewGeminiEmbedder creates a new embedder using the Gemini model
-func NewGeminiEmbedder() (*GeminiEmbedder, error) {
+// NewGeminiEmbedder creates a new embedder using the Gemini model.
+// timeout and maxAttempts behave as in NewVertexEmbedder.
+func NewGeminiEmbedder(timeout time.Duration, maxAttempts int) (*GeminiEmbedder, error) {
 	ctx := context.Background()
 
 	client, err := aiplatform.NewPredictionClient(ctx, option.WithCredentialsFile("server-key.json"))
@@ -66,15 +100,61 @@ func NewGeminiEmbedder() (*GeminiEmbedder, error) {
 	return &GeminiEmbedder{
 		client:    client,
 		modelName: modelName,
+		retry:     newPredictRetry(timeout, maxAttempts),
 	}, nil
 }
 
+// embedBatchWithRetry calls embedBatch, retrying the whole batch with
+// exponential backoff when Vertex reports a transient error.
+func embedBatchWithRetry(ctx context.Context, client *aiplatform.PredictionClient, modelName string, texts []string, retry predictRetry) ([][]float32, error) {
+	clean := make([]string, len(texts))
+	for i, text := range texts {
+		clean[i] = sanitizeUTF8(text)
+	}
+	texts = clean
+
+	backoff := predictInitialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, retry.timeout)
+		embeddings, err := embedBatch(attemptCtx, client, modelName, texts)
+		cancel()
+		if err == nil {
+			return embeddings, nil
+		}
+		if attempt >= retry.maxAttempts || !isRetryablePredictError(err) {
+			return nil, err
+		}
+
+		log.Printf("Embedding batch failed (attempt %d/%d), retrying in %s: %v", attempt, retry.maxAttempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryablePredictError reports whether err is a transient gRPC failure.
+func isRetryablePredictError(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// embedBatch embeds texts in one Predict call, returning one vector per text
+// in order. Texts are never skipped for being short: the server embeds search
+// queries here, which are often a few words, and code is indexed by
+// scripts/embed.py.
 func embedBatch(ctx context.Context, client *aiplatform.PredictionClient, modelName string, texts []string) ([][]float32, error) {
 	instances := make([]*structpb.Value, 0, len(texts))
 	for _, text := range texts {
-		if len(text) < 20 {
-			continue
-		}
 		if len(text) > 2000 {
 			text = text[:2000]
 		}
@@ -116,6 +196,9 @@ func embedBatch(ctx context.Context, client *aiplatform.PredictionClient, modelN
 		for j, v := range values {
 			result[j] = float32(v.GetNumberValue())
 		}
+		if err := checkEmbedding(result); err != nil {
+			return nil, fmt.Errorf("prediction %d: %w", i, err)
+		}
 		embeddingsBatch[i] = result
 	}
 
@@ -123,8 +206,7 @@ func embedBatch(ctx context.Context, client *aiplatform.PredictionClient, modelN
 }
 
 // EmbedBatch generates embedding vectors for multiple input texts using VertexEmbedder
-func (v *VertexEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
-	ctx := context.Background()
+func (v *VertexEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
 	const maxBatch = 5
 	var allEmbeddings [][]float32
 
@@ -134,7 +216,7 @@ func (v *VertexEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
 			end = len(texts)
 		}
 		chunk := texts[i:end]
-		embeddings, err := embedBatch(ctx, v.client, v.modelName, chunk)
+		embeddings, err := embedBatchWithRetry(ctx, v.client, v.modelName, chunk, v.retry)
 		if err != nil {
 			return nil, err
 		}
@@ -144,8 +226,7 @@ func (v *VertexEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
 }
 
 // EmbedBatch generates embedding vectors for multiple input texts using GeminiEmbedder
-func (g *GeminiEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
-	ctx := context.Background()
+func (g *GeminiEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
 	const maxBatch = 5
 	var allEmbeddings [][]float32
 
@@ -155,7 +236,7 @@ func (g *GeminiEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
 			end = len(texts)
 		}
 		chunk := texts[i:end]
-		embeddings, err := embedBatch(ctx, g.client, g.modelName, chunk)
+		embeddings, err := embedBatchWithRetry(ctx, g.client, g.modelName, chunk, g.retry)
 		if err != nil {
 			return nil, err
 		}
@@ -166,7 +247,7 @@ func (g *GeminiEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
 
 // Embed generates an embedding vector for a single input text using VertexEmbedder
 func (v *VertexEmbedder) Embed(text string) ([]float32, error) {
-	embeddings, err := v.EmbedBatch([]string{text})
+	embeddings, err := v.EmbedBatch(context.Background(), []string{text})
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +259,7 @@ func (v *VertexEmbedder) Embed(text string) ([]float32, error) {
 
 // Embed generates an embedding vector for a single input text using GeminiEmbedder
 func (g *GeminiEmbedder) Embed(text string) ([]float32, error) {
-	embeddings, err := g.EmbedBatch([]string{text})
+	embeddings, err := g.EmbedBatch(context.Background(), []string{text})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fakePredictionServer answers Predict with a two-value embedding per
+// instance, or values when set. Each call first takes the next entry of fail:
+// a non-nil error is returned as is, and errBlock makes the call wait for its
+// deadline.
+type fakePredictionServer struct {
+	aiplatformpb.UnimplementedPredictionServiceServer
+	mu       sync.Mutex
+	fail     []error
+	values   []interface{}
+	contents [][]string // instance contents of every call
+}
+
+// errBlock makes a fakePredictionServer call hang until it is canceled.
+var errBlock = status.Error(codes.Unknown, "block")
+
+func (s *fakePredictionServer) Predict(ctx context.Context, req *aiplatformpb.PredictRequest) (*aiplatformpb.PredictResponse, error) {
+	s.mu.Lock()
+	var contents []string
+	for _, inst := range req.Instances {
+		contents = append(contents, inst.GetStructValue().GetFields()["content"].GetStringValue())
+	}
+	s.contents = append(s.contents, contents)
+	var err error
+	if len(s.fail) > 0 {
+		err, s.fail = s.fail[0], s.fail[1:]
+	}
+	s.mu.Unlock()
+
+	if err == errBlock {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{0.1, 0.2}
+	if s.values != nil {
+		values = s.values
+	}
+	resp := &aiplatformpb.PredictResponse{}
+	for range req.Instances {
+		pred, _ := structpb.NewStruct(map[string]interface{}{
+			"embeddings": map[string]interface{}{"values": values},
+		})
+		resp.Predictions = append(resp.Predictions, structpb.NewStructValue(pred))
+	}
+	return resp, nil
+}
+
+func (s *fakePredictionServer) calls() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.contents
+}
+
+// newFakeVertexEmbedder starts srv and returns a VertexEmbedder talking to it.
+func newFakeVertexEmbedder(t *testing.T, srv *fakePredictionServer, timeout time.Duration, attempts int) *VertexEmbedder {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	aiplatformpb.RegisterPredictionServiceServer(gs, srv)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	client, err := aiplatform.NewPredictionClient(context.Background(),
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &VertexEmbedder{client: client, modelName: "projects/p/locations/l/publishers/google/models/text-embedding-005", retry: newPredictRetry(timeout, attempts)}
+}
+
+const longText = "a chunk of code long enough to be embedded"
+
+func TestVertexEmbedBatchRetriesTransientErrors(t *testing.T) {
+	srv := &fakePredictionServer{fail: []error{status.Error(codes.Unavailable, "try again")}}
+	e := newFakeVertexEmbedder(t, srv, time.Second, 3)
+
+	vecs, err := e.EmbedBatch(context.Background(), []string{longText, longText + " too"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(vecs) != 2 {
+		t.Errorf("got %d vectors, want 2", len(vecs))
+	}
+	calls := srv.calls()
+	if len(calls) != 2 {
+		t.Fatalf("Predict called %d times, want 2 (one failure, one retry)", len(calls))
+	}
+	if len(calls[1]) != 2 {
+		t.Errorf("retry sent %d instances, want the whole batch of 2", len(calls[1]))
+	}
+}
+
+func TestVertexEmbedBatchDoesNotRetryPermanentErrors(t *testing.T) {
+	srv := &fakePredictionServer{fail: []error{status.Error(codes.InvalidArgument, "bad request")}}
+	e := newFakeVertexEmbedder(t, srv, time.Second, 3)
+
+	if _, err := e.EmbedBatch(context.Background(), []string{longText}); err == nil {
+		t.Fatal("EmbedBatch succeeded, want the InvalidArgument error")
+	}
+	if n := len(srv.calls()); n != 1 {
+		t.Errorf("Predict called %d times, want 1", n)
+	}
+}
+
+func TestVertexEmbedBatchGivesUpAfterMaxAttempts(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	srv := &fakePredictionServer{fail: []error{unavailable, unavailable, unavailable}}
+	e := newFakeVertexEmbedder(t, srv, time.Second, 2)
+
+	if _, err := e.EmbedBatch(context.Background(), []string{longText}); err == nil {
+		t.Fatal("EmbedBatch succeeded, want an error after 2 attempts")
+	}
+	if n := len(srv.calls()); n != 2 {
+		t.Errorf("Predict called %d times, want 2", n)
+	}
+}
+
+func TestVertexEmbedBatchTimesOutEachAttempt(t *testing.T) {
+	srv := &fakePredictionServer{fail: []error{errBlock}}
+	e := newFakeVertexEmbedder(t, srv, 100*time.Millisecond, 2)
+
+	start := time.Now()
+	if _, err := e.EmbedBatch(context.Background(), []string{longText}); err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if n := len(srv.calls()); n != 2 {
+		t.Errorf("Predict called %d times, want 2 (timed out, then retried)", n)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("EmbedBatch took %s; the per-attempt timeout was not applied", elapsed)
+	}
+}
+
+func TestVertexEmbedBatchHonorsCallerContext(t *testing.T) {
+	srv := &fakePredictionServer{fail: []error{errBlock}}
+	e := newFakeVertexEmbedder(t, srv, time.Minute, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := e.EmbedBatch(ctx, []string{longText}); err == nil {
+		t.Fatal("EmbedBatch succeeded after its context expired")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("EmbedBatch took %s; the caller's deadline was ignored", elapsed)
+	}
+}
+
+func TestVertexEmbedsShortQueries(t *testing.T) {
+	srv := &fakePredictionServer{}
+	e := newFakeVertexEmbedder(t, srv, time.Second, 1)
+
+	vec, err := e.Embed("fix bug")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != 2 {
+		t.Errorf("got a %d-value vector, want 2", len(vec))
+	}
+
+	vecs, err := e.EmbedBatch(context.Background(), []string{"auth", longText, "retry"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(vecs) != 3 {
+		t.Errorf("got %d vectors for 3 queries, want one per query", len(vecs))
+	}
+	calls := srv.calls()
+	if len(calls) != 2 || len(calls[1]) != 3 || calls[1][0] != "auth" {
+		t.Errorf("Predict calls = %q, want the short queries sent as is", calls)
+	}
+}
+
+func TestVertexRejectsDegenerateEmbeddings(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		values []interface{}
+	}{
+		{"zero values", []interface{}{}},
+		{"one value", []interface{}{0.1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newFakeVertexEmbedder(t, &fakePredictionServer{values: tt.values}, time.Second, 1)
+
+			if _, err := e.EmbedBatch(context.Background(), []string{longText}); !errors.Is(err, ErrInvalidEmbedding) {
+				t.Errorf("EmbedBatch error = %v, want ErrInvalidEmbedding", err)
+			}
+			if _, err := e.Embed("auth"); !errors.Is(err, ErrInvalidEmbedding) {
+				t.Errorf("Embed error = %v, want ErrInvalidEmbedding", err)
+			}
+		})
+	}
+}
+
+func TestVertexSanitizesInvalidUTF8(t *testing.T) {
+	srv := &fakePredictionServer{}
+	e := newFakeVertexEmbedder(t, srv, time.Second, 1)
+
+	vecs, err := e.EmbedBatch(context.Background(), []string{"caf\xe9 " + longText, longText})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(vecs) != 2 {
+		t.Errorf("got %d vectors, want 2", len(vecs))
+	}
+	calls := srv.calls()
+	if len(calls) != 1 || calls[0][0] != "caf� "+longText {
+		t.Errorf("Predict calls = %q, want the invalid byte replaced", calls)
+	}
+}
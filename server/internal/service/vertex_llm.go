@@ -8,13 +8,17 @@ import (
 
 	"cloud.google.com/go/vertexai/genai"
 	"github.com/ahmednasr/ai-in-action/server/internal/models"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-// VertexLLM implements the LLM interface using Google's Vertex AI
+// VertexLLM implements the LLM interface using Google's Vertex AI.
 type VertexLLM struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
+	client    *genai.Client
+	model     *genai.GenerativeModel
+	modelName string
+
+	promptWarnTokens int // warn when a prompt's estimated tokens exceed this; 0 disables
 }
 
 // NewVertexLLM creates a new Vertex AI LLM client
@@ -32,52 +36,116 @@ func NewVertexLLM() (*VertexLLM, error) {
 		return nil, fmt.Errorf("failed to create Vertex AI client: %w", err)
 	}
 
-	model := client.GenerativeModel("gemini-2.0-flash-lite-001")
+	const modelName = "gemini-2.0-flash-lite-001"
+	model := client.GenerativeModel(modelName)
 	model.SetTemperature(0.7)
 	model.SetTopP(0.8)
 	model.SetTopK(40)
 
 	return &VertexLLM{
-		client: client,
-		model:  model,
+		client:    client,
+		model:     model,
+		modelName: modelName,
 	}, nil
 }
 
+// SetPromptWarnTokens sets the estimated token count above which prompts are
+// logged with a warning; 0 disables the warning. Call it before the client is
+// shared.
+func (l *VertexLLM) SetPromptWarnTokens(n int) {
+	l.promptWarnTokens = n
+}
+
 // GenerateResponse generates a response using the Vertex AI model
 func (l *VertexLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	gen, err := l.generate(ctx, prompt)
+	return gen.Text, err
+}
+
+// GenerateMetered generates a response like GenerateResponse, reporting the
+// model and token usage.
+func (l *VertexLLM) GenerateMetered(ctx context.Context, prompt string) (LLMGeneration, error) {
+	return l.generate(ctx, prompt)
+}
+
+// ModelName returns the Vertex AI model generations use.
+func (l *VertexLLM) ModelName() string {
+	return l.modelName
+}
+
+// GenerateStream generates a response like GenerateResponse, passing each
+// piece of text to onChunk as the model produces it, and returns the full
+// text.
+func (l *VertexLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(string)) (string, error) {
+	logPromptSize("[Vertex LLM]", "stream", prompt, l.promptWarnTokens)
+	iter := l.model.GenerateContentStream(ctx, genai.Text(prompt))
+	var sb strings.Builder
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to stream response: %w", err)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if text, ok := part.(genai.Text); ok && text != "" {
+				sb.WriteString(string(text))
+				onChunk(string(text))
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("no response generated")
+	}
+	return sb.String(), nil
+}
+
+// generate sends prompt to the model and returns the first candidate's text
+// with the token usage the response reports.
+func (l *VertexLLM) generate(ctx context.Context, prompt string) (LLMGeneration, error) {
+	logPromptSize("[Vertex LLM]", "request", prompt, l.promptWarnTokens)
 	resp, err := l.model.GenerateContent(ctx, genai.Text(prompt))
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %w", err)
+		return LLMGeneration{}, fmt.Errorf("failed to generate response: %w", err)
 	}
 
 	if len(resp.Candidates) == 0 {
-		return "", fmt.Errorf("no response generated")
+		return LLMGeneration{}, fmt.Errorf("no response generated")
 	}
 
 	// Convert the response to string
 	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
 	if !ok {
-		return "", fmt.Errorf("unexpected response type")
+		return LLMGeneration{}, fmt.Errorf("unexpected response type")
 	}
-	return string(text), nil
+	gen := LLMGeneration{Text: string(text), Model: l.modelName}
+	if u := resp.UsageMetadata; u != nil {
+		gen.Usage = &models.TokenUsage{
+			PromptTokens:     int(u.PromptTokenCount),
+			CompletionTokens: int(u.CandidatesTokenCount),
+			TotalTokens:      int(u.TotalTokenCount),
+		}
+	}
+	return gen, nil
 }
 
 // GenerateGuide generates a guide using the Vertex AI model
 func (l *VertexLLM) GenerateGuide(issue models.Issue, snippets []string) (string, error) {
-	prompt := fmt.Sprintf(`Based on this GitHub issue and relevant code snippets, provide a detailed guide:
-
-Issue Title: %s
-Issue Description: %s
-
-Relevant Code Snippets:
-%s
+	return l.GenerateResponse(context.Background(), issueGuidePrompt(issueGuidePromptFormat, issue, snippets, defaultEmptyIssueBodyNote))
+}
 
-Please provide a comprehensive guide that addresses the issue.`,
+// issueGuidePrompt builds the guide prompt for issue and its code snippets
+// from format, an issue guide prompt (see Prompts.IssueGuide). An empty issue
+// body is described by emptyNote.
+func issueGuidePrompt(format string, issue models.Issue, snippets []string, emptyNote string) string {
+	return fmt.Sprintf(format,
 		issue.Title,
-		issue.Body,
+		formatIssueBody(issue.Body, emptyNote),
 		strings.Join(snippets, "\n\n"))
-
-	return l.GenerateResponse(context.Background(), prompt)
 }
 
 // Close closes the Vertex AI client